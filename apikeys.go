@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Managed API keys live in their own schema, so they never show up among the
+// explored tables. Only a SHA-256 hash of each key is stored; the key itself
+// is returned once, when it is created.
+const keyTablesDDL = `CREATE SCHEMA IF NOT EXISTS explorer;
+CREATE TABLE IF NOT EXISTS explorer.api_keys (
+	id serial PRIMARY KEY,
+	key_hash text NOT NULL UNIQUE,
+	subject text NOT NULL,
+	roles text[] NOT NULL DEFAULT '{}',
+	expires_at timestamptz,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	revoked_at timestamptz
+);`
+
+// managedKey is the public view of a stored API key.
+type managedKey struct {
+	ID        int64      `json:"id"`
+	Subject   string     `json:"subject"`
+	Roles     []string   `json:"roles"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+const managedKeyColumns = "id, subject, roles, expires_at, created_at, revoked_at"
+
+func scanManagedKey(row interface{ Scan(...interface{}) error }) (*managedKey, error) {
+	key := &managedKey{}
+	var roles pq.StringArray
+	if err := row.Scan(&key.ID, &key.Subject, &roles, &key.ExpiresAt, &key.CreatedAt, &key.RevokedAt); err != nil {
+		return nil, err
+	}
+	key.Roles = []string(roles)
+	if key.Roles == nil {
+		key.Roles = []string{}
+	}
+	return key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (de *DbExplorer) ensureKeyTables() error {
+	_, err := de.db.Exec(keyTablesDDL)
+	return err
+}
+
+// managedKeyAuthenticator replaces the static API key authenticator when
+// managed keys are enabled: configured keys are tried first, then the active
+// (not revoked, not expired) keys stored in the database.
+func (de *DbExplorer) managedKeyAuthenticator() Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		presented := r.Header.Get("X-Api-Key")
+		if presented == "" {
+			return nil, nil
+		}
+		if id := matchAPIKey(de.cfg.Auth.APIKeys, presented); id != nil {
+			return id, nil
+		}
+		row := de.db.QueryRowContext(r.Context(), `SELECT subject, roles FROM explorer.api_keys
+			WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`,
+			hashAPIKey(presented))
+		var subject string
+		var roles pq.StringArray
+		switch err := row.Scan(&subject, &roles); err {
+		case nil:
+			return &Identity{Subject: subject, Roles: roles, Method: "api_key"}, nil
+		case sql.ErrNoRows:
+			return nil, errors.New("invalid api key")
+		default:
+			// The key may well be valid: no lockout for it.
+			log.Printf("api keys: %v", err)
+			return nil, errAuthUnavailable
+		}
+	})
+}
+
+// routeAdminKeys serves /_admin/keys and /_admin/keys/{id}.
+func (de *DbExplorer) routeAdminKeys(w http.ResponseWriter, r *http.Request, rest []string) {
+	if !de.cfg.Auth.ManagedKeys {
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+		return
+	}
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			de.handleListKeys(w, r)
+		case http.MethodPost, http.MethodPut:
+			de.handleCreateKey(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+	id, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil || len(rest) > 1 {
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		de.handleGetKey(w, r, id)
+	case http.MethodPost:
+		de.handleUpdateKey(w, r, id)
+	case http.MethodDelete:
+		de.handleRevokeKey(w, r, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (de *DbExplorer) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	rows, err := de.db.QueryContext(r.Context(), "SELECT "+managedKeyColumns+" FROM explorer.api_keys ORDER BY id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	keys := []*managedKey{}
+	for rows.Next() {
+		key, err := scanManagedKey(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeKeyResponse(w, map[string]interface{}{"keys": keys})
+}
+
+func (de *DbExplorer) handleGetKey(w http.ResponseWriter, r *http.Request, id int64) {
+	key, err := scanManagedKey(de.db.QueryRowContext(r.Context(),
+		"SELECT "+managedKeyColumns+" FROM explorer.api_keys WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeKeyResponse(w, map[string]interface{}{"key": key})
+}
+
+// handleCreateKey issues a new key for {"subject", "roles", "expires_at"}.
+// The response is the only place the key itself ever appears.
+func (de *DbExplorer) handleCreateKey(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Subject   string     `json:"subject"`
+		Roles     []string   `json:"roles"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if request.Subject == "" {
+		writeError(w, http.StatusBadRequest, "subject is required")
+		return
+	}
+	if request.Roles == nil {
+		request.Roles = []string{}
+	}
+
+	secret := randomToken(32)
+	key, err := scanManagedKey(de.db.QueryRowContext(r.Context(),
+		`INSERT INTO explorer.api_keys (key_hash, subject, roles, expires_at) VALUES ($1, $2, $3, $4)
+		RETURNING `+managedKeyColumns,
+		hashAPIKey(secret), request.Subject, pq.StringArray(request.Roles), request.ExpiresAt))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit("api_key_created", r, map[string]interface{}{"key_id": key.ID, "key_subject": key.Subject})
+	// The secret is shown once: neither caches nor idempotent retries keep it.
+	w.Header().Set("Cache-Control", "no-store")
+	writeKeyResponse(w, map[string]interface{}{"key": key, "secret": secret})
+}
+
+// handleUpdateKey assigns roles and changes the expiration of a key. Fields
+// left out are kept; "expires_at": null removes the expiration.
+func (de *DbExplorer) handleUpdateKey(w http.ResponseWriter, r *http.Request, id int64) {
+	var request struct {
+		Roles     *[]string       `json:"roles"`
+		ExpiresAt json.RawMessage `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	var sets []string
+	var args []interface{}
+	if request.Roles != nil {
+		args = append(args, pq.StringArray(*request.Roles))
+		sets = append(sets, "roles = $"+strconv.Itoa(len(args)))
+	}
+	if request.ExpiresAt != nil {
+		var expires *time.Time
+		if err := json.Unmarshal(request.ExpiresAt, &expires); err != nil {
+			writeError(w, http.StatusBadRequest, "expires_at must be an RFC 3339 time or null")
+			return
+		}
+		args = append(args, expires)
+		sets = append(sets, "expires_at = $"+strconv.Itoa(len(args)))
+	}
+	if len(sets) == 0 {
+		writeError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+
+	args = append(args, id)
+	query := "UPDATE explorer.api_keys SET " + strings.Join(sets, ", ") + " WHERE id = $" + strconv.Itoa(len(args)) +
+		" RETURNING " + managedKeyColumns
+	key, err := scanManagedKey(de.db.QueryRowContext(r.Context(), query, args...))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit("api_key_updated", r, map[string]interface{}{"key_id": key.ID, "key_roles": key.Roles})
+	writeKeyResponse(w, map[string]interface{}{"key": key})
+}
+
+// handleRevokeKey marks a key revoked; the row is kept for auditing.
+func (de *DbExplorer) handleRevokeKey(w http.ResponseWriter, r *http.Request, id int64) {
+	result, err := de.db.ExecContext(r.Context(),
+		"UPDATE explorer.api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if revoked > 0 {
+		audit("api_key_revoked", r, map[string]interface{}{"key_id": id})
+	}
+	writeKeyResponse(w, map[string]interface{}{"revoked": revoked})
+}
+
+func writeKeyResponse(w http.ResponseWriter, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"response": body})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// keyHash captures the hash a new key is stored under.
+type keyHash struct{ hash string }
+
+func (k *keyHash) Match(value driver.Value) bool {
+	k.hash, _ = value.(string)
+	return len(k.hash) == 64
+}
+
+func managedKeysExplorer(t *testing.T) (*DbExplorer, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	de := backendExplorer(newSQLStore(db, nil))
+	de.db = db
+	de.cfg.Auth.ManagedKeys = true
+	de.cfg.Auth.APIKeys = map[string]APIKey{"static": {Subject: "ops", Roles: []string{"admin"}}}
+	return de, mock
+}
+
+func presentKey(de *DbExplorer, key string) (*Identity, error) {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set("X-Api-Key", key)
+	return de.managedKeyAuthenticator().Authenticate(r)
+}
+
+func TestManagedKeyLifecycle(t *testing.T) {
+	de, mock := managedKeysExplorer(t)
+	columns := []string{"id", "subject", "roles", "expires_at", "created_at", "revoked_at"}
+	now := time.Now()
+	expires := now.Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	stored := &keyHash{}
+	mock.ExpectQuery("INSERT INTO explorer.api_keys").
+		WithArgs(stored, "etl", `{"analyst"}`, expires).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "etl", "{analyst}", expires, now, nil))
+	r := httptest.NewRequest(http.MethodPost, "/_admin/keys", strings.NewReader(`{"subject":"etl","roles":["analyst"],"expires_at":"`+expires.Format(time.RFC3339)+`"}`))
+	r.Header.Set(idempotencyHeader, "create-etl")
+	w := httptest.NewRecorder()
+	de.idempotent(w, r, de.route)
+	var created struct {
+		Response struct {
+			Key    managedKey `json:"key"`
+			Secret string     `json:"secret"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("results not match\nGot : %d %s\nWant: the created key", w.Code, w.Body)
+	}
+	secret := created.Response.Secret
+	if secret == "" || stored.hash != hashAPIKey(secret) || created.Response.Key.ID != 3 {
+		t.Fatalf("results not match\nGot : %s stored as %s\nWant: only the hash of the secret stored", w.Body, stored.hash)
+	}
+	// Nor is the secret kept for a retry with the same idempotency key.
+	if raw, _, _ := de.store.Get(r.Context(), "idempotency:anonymous:create-etl"); strings.Contains(raw, secret) {
+		t.Fatalf("results not match\nGot : %s\nWant: a response without the secret", raw)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/_admin/keys", strings.NewReader(`{"subject":"etl","roles":["analyst"],"expires_at":"`+expires.Format(time.RFC3339)+`"}`))
+	r.Header.Set(idempotencyHeader, "create-etl")
+	w = httptest.NewRecorder()
+	de.idempotent(w, r, de.route)
+	if w.Code != http.StatusConflict || strings.Contains(w.Body.String(), secret) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: a 409 without the secret", w.Code, w.Body)
+	}
+
+	// The key authenticates while active.
+	mock.ExpectQuery("SELECT subject, roles FROM explorer.api_keys").
+		WithArgs(hashAPIKey(secret)).
+		WillReturnRows(sqlmock.NewRows([]string{"subject", "roles"}).AddRow("etl", "{analyst}"))
+	id, err := presentKey(de, secret)
+	if err != nil || id == nil || id.Subject != "etl" || !id.HasRole("analyst") || id.Method != "api_key" {
+		t.Fatalf("results not match\nGot : %#v %v\nWant: etl, analyst", id, err)
+	}
+
+	// Once revoked it no longer matches an active key.
+	mock.ExpectExec("UPDATE explorer.api_keys SET revoked_at = now").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	w = httptest.NewRecorder()
+	de.route(w, httptest.NewRequest(http.MethodDelete, "/_admin/keys/3", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"revoked":1`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: one key revoked", w.Code, w.Body)
+	}
+	mock.ExpectQuery("SELECT subject, roles FROM explorer.api_keys").
+		WithArgs(hashAPIKey(secret)).
+		WillReturnRows(sqlmock.NewRows([]string{"subject", "roles"}))
+	if id, err := presentKey(de, secret); id != nil || err == nil || err.Error() != "invalid api key" {
+		t.Fatalf("results not match\nGot : %#v %v\nWant: invalid api key", id, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagedKeyExpiry(t *testing.T) {
+	de, mock := managedKeysExplorer(t)
+
+	// Revoked and expired keys are excluded by the lookup itself.
+	mock.ExpectQuery(`WHERE key_hash = \$1 AND revoked_at IS NULL AND \(expires_at IS NULL OR expires_at > now\(\)\)`).
+		WithArgs(hashAPIKey("expired")).
+		WillReturnRows(sqlmock.NewRows([]string{"subject", "roles"}))
+	if id, err := presentKey(de, "expired"); id != nil || err == nil {
+		t.Fatalf("results not match\nGot : %#v %v\nWant: invalid api key", id, err)
+	}
+
+	// Configured keys are matched before the database is asked.
+	if id, err := presentKey(de, "static"); err != nil || id == nil || id.Subject != "ops" {
+		t.Fatalf("results not match\nGot : %#v %v\nWant: ops", id, err)
+	}
+
+	// An expiration can be removed again.
+	mock.ExpectQuery(`UPDATE explorer.api_keys SET expires_at = \$1 WHERE id = \$2`).
+		WithArgs(nil, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "subject", "roles", "expires_at", "created_at", "revoked_at"}).
+			AddRow(3, "etl", "{}", nil, time.Now(), nil))
+	w := httptest.NewRecorder()
+	de.route(w, httptest.NewRequest(http.MethodPost, "/_admin/keys/3", strings.NewReader(`{"expires_at":null}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"expires_at":null`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: the key without expiration", w.Code, w.Body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagedKeyDatabaseDown(t *testing.T) {
+	de, mock := managedKeysExplorer(t)
+	de.authenticators = []Authenticator{de.managedKeyAuthenticator()}
+	de.lockout = newLockoutTracker(LockoutConfig{MaxFailures: 1}, de.store)
+
+	// A failing lookup says nothing about the key: no 401, no lockout.
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("FROM explorer.api_keys").
+			WithArgs(hashAPIKey("valid")).
+			WillReturnError(errors.New("connection refused"))
+		r := httptest.NewRequest(http.MethodGet, "/items", nil)
+		r.Header.Set("X-Api-Key", "valid")
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, r)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("attempt %d: results not match\nGot : %d %s\nWant: %d", i, w.Code, w.Body, http.StatusServiceUnavailable)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagedKeysAdminOnly(t *testing.T) {
+	de, _ := managedKeysExplorer(t)
+	de.cfg.Auth.Roles = map[string][]Permission{"analyst": {{Table: "*", Actions: []string{actionRead}}}}
+	r := withIdentity(httptest.NewRequest(http.MethodPost, "/_admin/keys", strings.NewReader(`{"subject":"me"}`)), &Identity{Subject: "ann", Roles: []string{"analyst"}})
+	w := httptest.NewRecorder()
+	de.route(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusForbidden)
+	}
+
+	de.cfg.Auth.ManagedKeys = false
+	w = httptest.NewRecorder()
+	de.route(w, httptest.NewRequest(http.MethodGet, "/_admin/keys", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusNotFound)
+	}
+}
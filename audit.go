@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// audit writes a structured audit event to the log.
+func audit(event string, r *http.Request, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"audit":  event,
+		"time":   time.Now().UTC().Format(time.RFC3339),
+		"remote": clientIP(r),
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}
+	if id := identityFromRequest(r); id != nil {
+		entry["subject"] = id.Subject
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	log.Print(string(line))
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
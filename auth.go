@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Identity describes the authenticated caller of a request.
+type Identity struct {
+	Subject string
+	Roles   []string
+	// Method names the authenticator that produced the identity.
+	Method string
+	// Attributes carries extra claims, available to injection templates as
+	// {{auth.<name>}}.
+	Attributes map[string]string
+}
+
+func (id *Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator resolves the caller of a request. It returns a nil identity
+// and a nil error when the request carries no credentials it understands, so
+// the next authenticator can be tried; an error means the credentials were
+// present but invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(r *http.Request) (*Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Identity, error) {
+	return f(r)
+}
+
+// AuthConfig configures the built-in authenticators. Embedders can add their
+// own implementations through Authenticators.
+type AuthConfig struct {
+	// Required rejects requests no authenticator recognised.
+	Required bool `json:"required"`
+	// APIKeys maps a key, sent as X-Api-Key, to its identity.
+	APIKeys map[string]APIKey `json:"api_keys"`
+	// ManagedKeys additionally accepts keys issued through /_admin/keys and
+	// stored in the explorer.api_keys table.
+	ManagedKeys bool `json:"managed_keys"`
+	// JWTSecret is a secret reference for HS256 bearer tokens.
+	JWTSecret string `json:"jwt_secret"`
+	// LDAP enables basic authentication against a directory.
+	LDAP *LDAPConfig `json:"ldap"`
+	// OIDC enables single sign-on and cookie sessions for the UI.
+	OIDC *OIDCConfig `json:"oidc"`
+
+	Lockout LockoutConfig `json:"lockout"`
+
+	// Roles maps a role to its access rules; "*" applies to every caller.
+	// Access control is off while no roles are configured.
+	Roles map[string][]Permission `json:"roles"`
+	// AdminRole may use the administrative endpoints; defaults to "admin".
+	AdminRole string `json:"admin_role"`
+	// ImpersonateRole may act as another user through the X-Impersonate
+	// header. Impersonation is disabled when it is empty.
+	ImpersonateRole string `json:"impersonate_role"`
+
+	Authenticators []Authenticator `json:"-"`
+}
+
+type APIKey struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+}
+
+// errAuthRequired rejects requests without credentials; unlike invalid
+// credentials it doesn't count towards a lockout.
+var errAuthRequired = errors.New("authentication required")
+
+// errAuthUnavailable is returned when the credentials can't be checked, for
+// instance while the directory is down. It doesn't count towards a lockout
+// either, and its cause is only logged.
+var errAuthUnavailable = errors.New("authentication unavailable")
+
+type identityKey struct{}
+
+func withIdentity(r *http.Request, id *Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+func identityFromRequest(r *http.Request) *Identity {
+	id, _ := r.Context().Value(identityKey{}).(*Identity)
+	return id
+}
+
+// buildAuthenticators returns the configured built-in authenticators followed
+// by the embedder supplied ones, in the order they are tried.
+func buildAuthenticators(cfg *AuthConfig) ([]Authenticator, error) {
+	var chain []Authenticator
+	if len(cfg.APIKeys) > 0 && !cfg.ManagedKeys {
+		chain = append(chain, apiKeyAuthenticator(cfg.APIKeys))
+	}
+	if cfg.JWTSecret != "" {
+		secret, err := resolveSecret(cfg.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jwtAuthenticator([]byte(secret)))
+	}
+	if cfg.LDAP != nil {
+		authn, err := ldapAuthenticator(cfg.LDAP)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authn)
+	}
+	return append(chain, cfg.Authenticators...), nil
+}
+
+// authenticate runs the authenticator chain; the first identity wins.
+func (de *DbExplorer) authenticate(r *http.Request) (*Identity, error) {
+	for _, authn := range de.authenticators {
+		id, err := authn.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if id != nil {
+			return id, nil
+		}
+	}
+	if de.cfg.Auth.Required {
+		return nil, errAuthRequired
+	}
+	return nil, nil
+}
+
+func apiKeyAuthenticator(keys map[string]APIKey) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		presented := r.Header.Get("X-Api-Key")
+		if presented == "" {
+			return nil, nil
+		}
+		if id := matchAPIKey(keys, presented); id != nil {
+			return id, nil
+		}
+		return nil, errors.New("invalid api key")
+	})
+}
+
+// matchAPIKey looks presented up among the configured keys.
+func matchAPIKey(keys map[string]APIKey, presented string) *Identity {
+	for key, entry := range keys {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(key)) == 1 {
+			return &Identity{Subject: entry.Subject, Roles: entry.Roles, Method: "api_key"}
+		}
+	}
+	return nil
+}
+
+// jwtAuthenticator accepts HS256 bearer tokens. The subject comes from "sub",
+// roles from "roles" and every other string claim becomes an attribute.
+func jwtAuthenticator(secret []byte) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return nil, nil
+		}
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return nil, errors.New("malformed token")
+		}
+
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+			return nil, errors.New("unsupported token algorithm")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid token signature")
+		}
+
+		var claims map[string]interface{}
+		if err := decodeJWTPart(parts[1], &claims); err != nil {
+			return nil, errors.New("malformed token claims")
+		}
+		return identityFromClaims(claims, "jwt")
+	})
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// identityFromClaims validates the registered time claims and maps the rest
+// onto an Identity.
+func identityFromClaims(claims map[string]interface{}, method string) (*Identity, error) {
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, errors.New("token not yet valid")
+	}
+
+	id := &Identity{Method: method, Attributes: make(map[string]string)}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				id.Roles = append(id.Roles, s)
+			}
+		}
+	}
+	for name, value := range claims {
+		if s, ok := value.(string); ok {
+			id.Attributes[name] = s
+		}
+	}
+	return id, nil
+}
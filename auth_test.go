@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signTestJWT(secret, claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticators(t *testing.T) {
+	chain, err := buildAuthenticators(&AuthConfig{
+		APIKeys:   map[string]APIKey{"k1": {Subject: "ci", Roles: []string{"reader"}}},
+		JWTSecret: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("error building authenticators: %v", err)
+	}
+	de := &DbExplorer{cfg: &Config{Auth: AuthConfig{Required: true}}, authenticators: chain}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Api-Key", "k1")
+	if id, err := de.authenticate(r); err != nil || id.Subject != "ci" || !id.HasRole("reader") {
+		t.Fatalf("api key: unexpected identity %#v, %v", id, err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestJWT("s3cret", `{"sub":"alice","roles":["admin"],"tenant":"t1"}`))
+	if id, err := de.authenticate(r); err != nil || id.Subject != "alice" || id.Attributes["tenant"] != "t1" {
+		t.Fatalf("jwt: unexpected identity %#v, %v", id, err)
+	}
+
+	expired := `{"sub":"alice","exp":` + strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10) + `}`
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestJWT("s3cret", expired))
+	if _, err := de.authenticate(r); err == nil {
+		t.Fatalf("expected expired token to be rejected")
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestJWT("other", `{"sub":"alice"}`))
+	if _, err := de.authenticate(r); err == nil {
+		t.Fatalf("expected bad signature to be rejected")
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	if _, err := de.authenticate(r); err == nil {
+		t.Fatalf("expected anonymous request to be rejected when auth is required")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// BackpressureConfig sheds low priority requests, exports and aggregations,
+// with a 503 while the database is saturated, so simple reads stay fast.
+// Saturation is read from the connection pool of the store.
+type BackpressureConfig struct {
+	// Interval is how often the pool is sampled; defaults to 1s.
+	Interval Duration `json:"interval"`
+	// MaxWait is the average time statements may wait for a connection
+	// over an interval before the database counts as saturated.
+	MaxWait Duration `json:"max_wait"`
+	// MaxInUse is the share of the pool's connections, between 0 and 1, in
+	// use beyond which the database counts as saturated. It needs a pool
+	// with a maximum size.
+	MaxInUse float64 `json:"max_in_use"`
+}
+
+// poolStats is the use of a connection pool; Waits and WaitTime are
+// totals since the pool was opened.
+type poolStats struct {
+	InUse    int
+	Max      int
+	Waits    int64
+	WaitTime time.Duration
+}
+
+// poolReporter is implemented by stores reporting the use of their
+// connection pool, which backpressure needs.
+type poolReporter interface {
+	PoolStats() poolStats
+}
+
+func (s *sqlStore) PoolStats() poolStats {
+	stats := s.db.Stats()
+	return poolStats{InUse: stats.InUse, Max: stats.MaxOpenConnections, Waits: stats.WaitCount, WaitTime: stats.WaitDuration}
+}
+
+// PoolStats of pgx count the time of every acquire, waiting or not, so the
+// wait time is an upper bound.
+func (s *pgxStore) PoolStats() poolStats {
+	stats := s.pool.Stat()
+	return poolStats{InUse: int(stats.AcquiredConns()), Max: int(stats.MaxConns()), Waits: stats.EmptyAcquireCount(), WaitTime: stats.AcquireDuration()}
+}
+
+func (cfg *BackpressureConfig) interval() time.Duration {
+	if cfg.Interval <= 0 {
+		return time.Second
+	}
+	return time.Duration(cfg.Interval)
+}
+
+// saturated reports whether the pool was saturated between the samples
+// prev and cur.
+func (cfg *BackpressureConfig) saturated(prev, cur poolStats) bool {
+	if cfg.MaxInUse > 0 && cur.Max > 0 && float64(cur.InUse) >= cfg.MaxInUse*float64(cur.Max) {
+		return true
+	}
+	if waits := cur.Waits - prev.Waits; cfg.MaxWait > 0 && waits > 0 {
+		return (cur.WaitTime-prev.WaitTime)/time.Duration(waits) > time.Duration(cfg.MaxWait)
+	}
+	return false
+}
+
+// watchLoad samples the pool of the store every interval and switches
+// shedding on and off.
+func (de *DbExplorer) watchLoad(cfg *BackpressureConfig) {
+	reporter, ok := de.backend.(poolReporter)
+	if !ok {
+		log.Printf("backpressure: the store doesn't report its pool, nothing is shed")
+		return
+	}
+	prev := reporter.PoolStats()
+	for range time.Tick(cfg.interval()) {
+		cur := reporter.PoolStats()
+		saturated := cfg.saturated(prev, cur)
+		if saturated != de.saturated.Load() {
+			log.Printf("backpressure: database saturated: %v (%d/%d connections in use)", saturated, cur.InUse, cur.Max)
+		}
+		de.saturated.Store(saturated)
+		prev = cur
+	}
+}
+
+// shed answers low priority requests with a 503 while the database is
+// saturated; it reports whether r was shed.
+func (de *DbExplorer) shed(w http.ResponseWriter, r *http.Request) bool {
+	if !de.saturated.Load() || !lowPriority(r) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(de.cfg.Backpressure.interval().Seconds())+1))
+	writeError(w, http.StatusServiceUnavailable, "database is saturated, try again later")
+	return true
+}
+
+// lowPriority reports whether r is an export, a streamed or counted
+// listing, or an aggregation: requests that hold a connection long and can
+// be retried later.
+func lowPriority(r *http.Request) bool {
+	parts, err := splitPath(r.URL)
+	if err != nil || len(parts) == 0 || parts[0][0] == '_' {
+		return false
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			return false
+		}
+		format, _ := listingFormat(r)
+		_, count := r.URL.Query()["count"]
+		return streamed(format) || count
+	}
+	switch parts[1] {
+	case "_distinct", "_import":
+		return true
+	}
+	return false
+}
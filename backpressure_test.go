@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSaturated(t *testing.T) {
+	cfg := &BackpressureConfig{MaxWait: Duration(50 * time.Millisecond), MaxInUse: 0.9}
+	prev := poolStats{InUse: 2, Max: 10, Waits: 10, WaitTime: time.Second}
+	cases := []struct {
+		name string
+		cur  poolStats
+		want bool
+	}{
+		{"idle", poolStats{InUse: 2, Max: 10, Waits: 10, WaitTime: time.Second}, false},
+		{"busy pool", poolStats{InUse: 9, Max: 10, Waits: 10, WaitTime: time.Second}, true},
+		{"unbounded pool", poolStats{InUse: 90, Max: 0, Waits: 10, WaitTime: time.Second}, false},
+		{"short waits", poolStats{InUse: 5, Max: 10, Waits: 20, WaitTime: time.Second + 100*time.Millisecond}, false},
+		{"long waits", poolStats{InUse: 5, Max: 10, Waits: 12, WaitTime: time.Second + 200*time.Millisecond}, true},
+	}
+	for _, item := range cases {
+		if got := cfg.saturated(prev, item.cur); got != item.want {
+			t.Fatalf("[%s] results not match\nGot : %v\nWant: %v", item.name, got, item.want)
+		}
+	}
+}
+
+func TestLowPriority(t *testing.T) {
+	cases := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/items", false},
+		{http.MethodGet, "/items?format=csv", true},
+		{http.MethodGet, "/items?count=exact", true},
+		{http.MethodGet, "/items/1", false},
+		{http.MethodGet, "/items/_distinct/title", true},
+		{http.MethodPost, "/items/_import", true},
+		{http.MethodPost, "/items", false},
+		{http.MethodGet, "/_usage", false},
+	}
+	for _, item := range cases {
+		if got := lowPriority(httptest.NewRequest(item.method, item.path, nil)); got != item.want {
+			t.Fatalf("[%s %s] results not match\nGot : %v\nWant: %v", item.method, item.path, got, item.want)
+		}
+	}
+}
+
+func TestShed(t *testing.T) {
+	de := backendExplorer(&fakeStore{records: []map[string]interface{}{{"id": int64(1)}}})
+	de.cfg.Backpressure = &BackpressureConfig{Interval: Duration(2 * time.Second)}
+	de.saturated.Store(true)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?format=csv", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "3" {
+		t.Fatalf("results not match\nGot : %d %q\nWant: 503 \"3\"", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("results not match\nGot : %d\nWant: 200", w.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// batchResult is the outcome of one entry of a batch request.
+type batchResult struct {
+	ID      interface{} `json:"id"`
+	Status  string      `json:"status"`
+	Updated int64       `json:"updated,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// handleBatchUpdate applies [{"id": ..., "fields": {...}}, ...] in a single
+// transaction. The first failing entry rolls everything back; the response
+// reports the status of every entry either way.
+func (de *DbExplorer) handleBatchUpdate(w http.ResponseWriter, r *http.Request, table *Table) {
+	body, err := de.readBody(r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	entries, ok := body.([]interface{})
+	if !ok || len(entries) == 0 {
+		writeError(w, http.StatusBadRequest, "expected a non-empty array of {id, fields} objects")
+		return
+	}
+
+	results := make([]batchResult, len(entries))
+	for i := range results {
+		results[i] = batchResult{Status: "skipped"}
+	}
+	fail := func(i int, status int, err error) {
+		for j := 0; j < i; j++ {
+			results[j].Status = "rolled_back"
+		}
+		results[i].Status = "failed"
+		results[i].Error = err.Error()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   fmt.Sprintf("entry %d failed, batch rolled back", i),
+			"results": results,
+		})
+	}
+
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var total int64
+	for i, item := range entries {
+		entry, _ := item.(map[string]interface{})
+		rawID := entry["id"]
+		fields, ok := entry["fields"].(map[string]interface{})
+		if rawID == nil || !ok {
+			fail(i, http.StatusBadRequest, fmt.Errorf("expected an {id, fields} object"))
+			return
+		}
+		results[i].ID = rawID
+		key, err := table.keyFromJSON(rawID)
+		if err != nil {
+			fail(i, http.StatusBadRequest, err)
+			return
+		}
+		data, err := de.prepareUpdate(r, table, fields)
+		if err != nil {
+			fail(i, http.StatusBadRequest, err)
+			return
+		}
+		if err := de.encryptValues(table.Name, data); err != nil {
+			fail(i, http.StatusInternalServerError, err)
+			return
+		}
+
+		affected, err := tx.Update(r.Context(), updateRecord(table, data, key))
+		if err != nil {
+			fail(i, http.StatusInternalServerError, err)
+			return
+		}
+		results[i].Status = "updated"
+		results[i].Updated = affected
+		if affected == 0 {
+			results[i].Status = "not_found"
+		}
+		total += affected
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), total)
+
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"updated": total,
+			"results": results,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleBatchDelete removes every row whose primary key is listed, either in
+// a {"ids": [...]} body or as ?<pk>=in.(1,2,3), with a single statement.
+func (de *DbExplorer) handleBatchDelete(w http.ResponseWriter, r *http.Request, table *Table) {
+	if len(table.PrimaryKey) != 1 {
+		writeError(w, http.StatusBadRequest, "batch delete needs a single-column primary key")
+		return
+	}
+	pk := table.PrimaryKey[0]
+	column, _ := table.Column(pk)
+
+	var rawIDs []string
+	if list := r.URL.Query().Get(pk); list != "" {
+		if !strings.HasPrefix(list, "in.(") || !strings.HasSuffix(list, ")") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expected %s=in.(...)", pk))
+			return
+		}
+		rawIDs = strings.Split(strings.TrimSuffix(strings.TrimPrefix(list, "in.("), ")"), ",")
+	} else {
+		body, err := de.readBody(r)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		object, _ := body.(map[string]interface{})
+		ids, ok := object["ids"].([]interface{})
+		if !ok {
+			writeError(w, http.StatusBadRequest, `expected {"ids": [...]}`)
+			return
+		}
+		for _, id := range ids {
+			rawIDs = append(rawIDs, fmt.Sprint(id))
+		}
+	}
+	if len(rawIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "no ids to delete")
+		return
+	}
+
+	// Keys travel as one text array cast to the key type, so every key
+	// type works with the same statement.
+	keys := make([]string, len(rawIDs))
+	for i, raw := range rawIDs {
+		key, err := table.parseKey(strings.TrimSpace(raw))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		keys[i] = fmt.Sprint(key[0])
+	}
+
+	affected, err := de.backend.Delete(r.Context(), querybuilder.Delete{
+		From:  table.ref(),
+		Where: querybuilder.AnyOf{Column: pk, Type: column.Type, Values: keys},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting records: %v", err), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), affected)
+
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"deleted": affected,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBatchDeleteCast(t *testing.T) {
+	cases := []struct {
+		column *Column
+		ids    string
+		cast   string
+	}{
+		{&Column{Name: "id", DataType: "integer", Type: "integer"}, "in.(1,2)", "integer[]"},
+		{&Column{Name: "id", DataType: "USER-DEFINED", Type: `billing."Status"`, Enum: "Status", EnumValues: []string{"open", "closed"}}, "in.(open,closed)", `billing."Status"[]`},
+		{&Column{Name: "id", DataType: "USER-DEFINED", Type: "citext"}, "in.(a,b)", "citext[]"},
+	}
+	for _, item := range cases {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		de := backendExplorer(newSQLStore(db, nil))
+		de.schema.Store(&Schema{Name: "public", Tables: map[string]*Table{
+			"tickets": {Schema: "public", Name: "tickets", PrimaryKey: []string{"id"}, Columns: []*Column{item.column}},
+		}})
+		mock.ExpectExec(regexp.QuoteMeta(`"id" = ANY($1::` + item.cast + `)`)).WillReturnResult(sqlmock.NewResult(0, 2))
+
+		w := httptest.NewRecorder()
+		de.route(w, httptest.NewRequest(http.MethodDelete, "/tickets?id="+item.ids, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d", item.cast, w.Code, w.Body, http.StatusOK)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("[%s] %v", item.cast, err)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"db_explorer/internal/querybuilder"
+	"github.com/lib/pq"
+)
+
+const (
+	bodyModeStrict  = "strict"
+	bodyModeLenient = "lenient"
+)
+
+// bodyMode returns the parsing mode for r: the X-Body-Mode header wins over
+// the configured default, which itself defaults to lenient.
+func (de *DbExplorer) bodyMode(r *http.Request) string {
+	switch mode := r.Header.Get("X-Body-Mode"); mode {
+	case bodyModeStrict, bodyModeLenient:
+		return mode
+	}
+	if de.cfg.BodyMode == bodyModeStrict {
+		return bodyModeStrict
+	}
+	return bodyModeLenient
+}
+
+// fieldError is a validation error caused by a single payload field; it is
+// reported with the field name next to the message.
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string {
+	return e.Message
+}
+
+// requiredError lists the NOT NULL columns a new record leaves empty.
+type requiredError struct {
+	Fields []string
+}
+
+func (e *requiredError) Error() string {
+	return "missing required fields: " + strings.Join(e.Fields, ", ")
+}
+
+// enumError rejects a value of an enum column that isn't one of its
+// labels, which the database would fail with a bare 22P02.
+type enumError struct {
+	Field   string
+	Allowed []string
+}
+
+func (e *enumError) Error() string {
+	return fmt.Sprintf("field %s must be one of: %s", e.Field, strings.Join(e.Allowed, ", "))
+}
+
+// checkEnum rejects a value of column that isn't one of the labels of its
+// enum type.
+func checkEnum(column *Column, value interface{}) error {
+	if len(column.EnumValues) == 0 || value == nil {
+		return nil
+	}
+	if s, ok := value.(string); ok && containsString(column.EnumValues, s) {
+		return nil
+	}
+	return &enumError{column.Name, column.EnumValues}
+}
+
+// checkRange rejects a value of column its type can't hold: an integer
+// out of the range of a smallint or integer column, a string longer than
+// the declared length of a character column. The database would fail the
+// statement otherwise.
+func checkRange(column *Column, value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		var min, max int64
+		switch column.DataType {
+		case "smallint":
+			min, max = math.MinInt16, math.MaxInt16
+		case "integer":
+			min, max = math.MinInt32, math.MaxInt32
+		default:
+			return nil
+		}
+		if v < min || v > max {
+			return &fieldError{column.Name, fmt.Sprintf("field %s is out of range for type %s", column.Name, column.DataType)}
+		}
+	case string:
+		if column.MaxLength == 0 {
+			return nil
+		}
+		if column.DataType == "character" {
+			// Padding beyond the length is dropped.
+			v = strings.TrimRight(v, " ")
+		}
+		if utf8.RuneCountInString(v) > column.MaxLength {
+			return &fieldError{column.Name, fmt.Sprintf("field %s is longer than %d characters", column.Name, column.MaxLength)}
+		}
+	}
+	return nil
+}
+
+// writeBodyError reports a payload validation error as a 400.
+func writeBodyError(w http.ResponseWriter, err error) {
+	body := map[string]interface{}{"error": err.Error()}
+	var fe *fieldError
+	var ee *enumError
+	var re *requiredError
+	switch {
+	case errors.As(err, &fe):
+		body["field"] = fe.Field
+	case errors.As(err, &ee):
+		body["field"] = ee.Field
+		body["allowed"] = ee.Allowed
+	case errors.As(err, &re):
+		body["fields"] = re.Fields
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(body)
+}
+
+// readBody decodes the request body as JSON, numbers kept as json.Number.
+// Strict mode also rejects trailing data after the first value.
+func (de *DbExplorer) readBody(r *http.Request) (interface{}, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, errors.New("invalid JSON")
+	}
+	if de.bodyMode(r) == bodyModeStrict {
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, errors.New("unexpected data after JSON body")
+		}
+	}
+	return body, nil
+}
+
+// checkRecord validates a decoded record against the columns of table. Keys
+// that aren't columns are always rejected, since they would otherwise end up
+// in the generated SQL. Strict mode rejects mismatched types; lenient mode
+// coerces compatible values, e.g. "42" into an integer column.
+func (de *DbExplorer) checkRecord(r *http.Request, table *Table, data map[string]interface{}) (map[string]interface{}, error) {
+	strict := de.bodyMode(r) == bodyModeStrict
+	for key, value := range data {
+		column, ok := table.Column(key)
+		if !ok {
+			return nil, &fieldError{key, fmt.Sprintf("unknown field %s", key)}
+		}
+		converted, ok := de.convertValue(column, value, strict)
+		if !ok {
+			return nil, &fieldError{key, fmt.Sprintf("field %s have invalid type", key)}
+		}
+		if err := checkEnum(column, converted); err != nil {
+			return nil, err
+		}
+		if err := checkRange(column, converted); err != nil {
+			return nil, err
+		}
+		data[key] = converted
+	}
+	return data, nil
+}
+
+// checkRequired reports the NOT NULL columns of table that an insert of data
+// would leave empty: those missing without a default and those set to null.
+// Generated columns are always filled by the database.
+func checkRequired(table *Table, data map[string]interface{}) error {
+	var missing []string
+	for _, column := range table.Columns {
+		if column.Nullable || column.Generated {
+			continue
+		}
+		value, ok := data[column.Name]
+		if ok && value == nil || !ok && column.Default == "" {
+			missing = append(missing, column.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return &requiredError{missing}
+	}
+	return nil
+}
+
+// columnKind groups Postgres data types by the JSON values they accept.
+func columnKind(dataType string) string {
+	switch dataType {
+	case "smallint", "integer", "bigint":
+		return "int"
+	case "numeric":
+		return "numeric"
+	case "real", "double precision":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "uuid":
+		return "uuid"
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		return "timestamp"
+	case "json", "jsonb":
+		return "json"
+	case "ARRAY":
+		return "array"
+	case "geometry", "geography":
+		return "geometry"
+	}
+	return "string"
+}
+
+// jsonKind names the JSON type of a decoded value as used in coercion keys.
+func jsonKind(value interface{}) string {
+	switch v := value.(type) {
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "int"
+		}
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return "object"
+}
+
+// defaultCoercion reports whether the "<json kind>-><column kind>" coercion
+// is enabled when the configuration doesn't mention it.
+func defaultCoercion(key string) bool {
+	switch key {
+	case "string->int", "string->float", "string->numeric", "string->bool",
+		"int->string", "float->string", "bool->string":
+		return true
+	}
+	return false
+}
+
+func (de *DbExplorer) coercionAllowed(key string) bool {
+	if allowed, ok := de.cfg.Coercions[key]; ok {
+		return allowed
+	}
+	return defaultCoercion(key)
+}
+
+// convertValue checks value against the column and maps it onto a value the
+// driver can send for the column's type. Values of the matching JSON type are
+// always accepted; anything else goes through the coercion table, which
+// strict mode disables entirely. uuid and timestamp columns take strings in
+// their textual format only, json columns take any value, array columns
+// arrays of values their elements take and spatial columns GeoJSON
+// geometries.
+func (de *DbExplorer) convertValue(column *Column, value interface{}, strict bool) (interface{}, bool) {
+	if value == nil {
+		return nil, true
+	}
+	target := columnKind(column.DataType)
+	source := jsonKind(value)
+
+	switch target {
+	case "json":
+		return toJSON(value)
+	case "array":
+		return de.toArray(column, value, strict)
+	case "geometry":
+		return toGeometry(value)
+	case "uuid":
+		s, ok := value.(string)
+		return s, ok && isUUID(s)
+	case "timestamp":
+		s, ok := value.(string)
+		return s, ok && isTimestamp(column.DataType, s)
+	}
+
+	switch {
+	case source == target:
+	case source == "int" && target == "float", target == "numeric" && (source == "int" || source == "float"):
+	case strict || !de.coercionAllowed(source+"->"+target):
+		return nil, false
+	}
+
+	switch target {
+	case "int":
+		return toInt(value)
+	case "float":
+		return toFloat(value)
+	case "numeric":
+		return toNumeric(value)
+	case "bool":
+		return toBool(value)
+	case "string":
+		return toString(value)
+	}
+	return nil, false
+}
+
+func toInt(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			f, ferr := v.Float64()
+			if ferr != nil || f != float64(int64(f)) {
+				return nil, false
+			}
+			n = int64(f)
+		}
+		return n, true
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n, err == nil
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+	return nil, false
+}
+
+func toFloat(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// toNumeric keeps numeric values as text, so Postgres gets every digit
+// instead of a float64 approximation.
+func toNumeric(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), true
+	case string:
+		v = strings.TrimSpace(v)
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return nil, false
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// toArray converts each element of a JSON array as for a column of the
+// element type; elements may be null. The array is sent as a Postgres
+// array.
+func (de *DbExplorer) toArray(column *Column, value interface{}, strict bool) (interface{}, bool) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	element := &Column{Name: column.Name, DataType: column.ElementType, Nullable: true}
+	elements := make([]interface{}, len(items))
+	for i, item := range items {
+		if elements[i], ok = de.convertValue(element, item, strict); !ok {
+			return nil, false
+		}
+	}
+	return pq.Array(elements), true
+}
+
+// toGeometry takes a GeoJSON geometry object, which PostGIS parses.
+func toGeometry(value interface{}) (interface{}, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if _, ok := object["type"].(string); !ok {
+		return nil, false
+	}
+	b, err := json.Marshal(object)
+	if err != nil {
+		return nil, false
+	}
+	return querybuilder.GeoJSON(b), true
+}
+
+func toBool(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	case json.Number:
+		switch v.String() {
+		case "0":
+			return false, true
+		case "1":
+			return true, true
+		}
+	}
+	return nil, false
+}
+
+func toString(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return nil, false
+}
+
+// toJSON encodes a value for a json or jsonb column; numbers keep their
+// original text since they are json.Number.
+func toJSON(value interface{}) (interface{}, bool) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	return string(data), true
+}
+
+// isUUID accepts the canonical 8-4-4-4-12 form and bare 32 hex digits.
+func isUUID(s string) bool {
+	if len(s) == 36 {
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return false
+		}
+		s = strings.Replace(s, "-", "", 4)
+	}
+	if len(s) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// isTimestamp checks s against the formats accepted for dataType: ISO dates
+// for date columns, RFC 3339 or a zone-less date and time for timestamps.
+func isTimestamp(dataType, s string) bool {
+	layouts := []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+	if dataType == "date" {
+		layouts = layouts[3:]
+	}
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
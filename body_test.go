@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+	"github.com/lib/pq"
+)
+
+func TestCheckRecord(t *testing.T) {
+	table := &Table{Name: "items", Columns: []*Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "title", DataType: "character varying"},
+		{Name: "price", DataType: "numeric", Nullable: true},
+		{Name: "ref", DataType: "uuid", Nullable: true},
+		{Name: "created", DataType: "timestamp with time zone", Nullable: true},
+		{Name: "born", DataType: "date", Nullable: true},
+		{Name: "extra", DataType: "jsonb", Nullable: true},
+		{Name: "sizes", DataType: "ARRAY", ElementType: "integer", Nullable: true},
+		{Name: "refs", DataType: "ARRAY", ElementType: "uuid", Nullable: true},
+		{Name: "location", DataType: "geometry", Nullable: true},
+		{Name: "status", DataType: "USER-DEFINED", Enum: "order_status", EnumValues: []string{"new", "paid"}, Nullable: true},
+		{Name: "qty", DataType: "smallint", Nullable: true},
+		{Name: "code", DataType: "character varying", MaxLength: 3, Nullable: true},
+		{Name: "grade", DataType: "character", MaxLength: 2, Nullable: true},
+	}}
+	de := &DbExplorer{cfg: &Config{}}
+
+	cases := []struct {
+		mode   string
+		body   string
+		result map[string]interface{}
+		err    string
+	}{
+		{bodyModeLenient, `{"id": "42", "title": "x"}`, map[string]interface{}{"id": int64(42), "title": "x"}, ""},
+		{bodyModeLenient, `{"title": "x", "title = 'x', admin": 1}`, nil, "unknown field title = 'x', admin"},
+		{bodyModeLenient, `{"title": 5}`, map[string]interface{}{"title": "5"}, ""},
+		{bodyModeLenient, `{"id": "abc"}`, nil, "field id have invalid type"},
+		{bodyModeStrict, `{"id": "42"}`, nil, "field id have invalid type"},
+		{bodyModeStrict, `{"junk": 1}`, nil, "unknown field junk"},
+		{bodyModeStrict, `{"title": "x"} {}`, nil, "unexpected data after JSON body"},
+		{bodyModeStrict, `{"id": 7, "price": null}`, map[string]interface{}{"id": int64(7), "price": nil}, ""},
+		{bodyModeLenient, `{"price": 3}`, map[string]interface{}{"price": "3"}, ""},
+		{bodyModeStrict, `{"price": 0.10000000000000000001}`, map[string]interface{}{"price": "0.10000000000000000001"}, ""},
+		{bodyModeLenient, `{"price": " 1.5 "}`, map[string]interface{}{"price": "1.5"}, ""},
+		{bodyModeLenient, `{"price": "cheap"}`, nil, "field price have invalid type"},
+		{bodyModeStrict, `{"ref": "3F2504E0-4F89-11D3-9A0C-0305E82C3301"}`, map[string]interface{}{"ref": "3F2504E0-4F89-11D3-9A0C-0305E82C3301"}, ""},
+		{bodyModeLenient, `{"ref": "3F2504E0"}`, nil, "field ref have invalid type"},
+		{bodyModeLenient, `{"ref": 5}`, nil, "field ref have invalid type"},
+		{bodyModeStrict, `{"created": "2024-05-01T10:00:00+02:00", "born": "1990-12-31"}`, map[string]interface{}{"created": "2024-05-01T10:00:00+02:00", "born": "1990-12-31"}, ""},
+		{bodyModeLenient, `{"born": "1990-12-31T00:00:00Z"}`, nil, "field born have invalid type"},
+		{bodyModeLenient, `{"created": "yesterday"}`, nil, "field created have invalid type"},
+		{bodyModeStrict, `{"extra": {"n": 1.50, "tags": ["a"]}}`, map[string]interface{}{"extra": `{"n":1.50,"tags":["a"]}`}, ""},
+		{bodyModeLenient, `{"sizes": [1, "2", null]}`, map[string]interface{}{"sizes": pq.Array([]interface{}{int64(1), int64(2), nil})}, ""},
+		{bodyModeStrict, `{"sizes": [1, "2"]}`, nil, "field sizes have invalid type"},
+		{bodyModeLenient, `{"sizes": "{1,2}"}`, nil, "field sizes have invalid type"},
+		{bodyModeStrict, `{"refs": ["3F2504E0-4F89-11D3-9A0C-0305E82C3301"]}`, map[string]interface{}{"refs": pq.Array([]interface{}{"3F2504E0-4F89-11D3-9A0C-0305E82C3301"})}, ""},
+		{bodyModeStrict, `{"refs": ["3F2504E0"]}`, nil, "field refs have invalid type"},
+		{bodyModeStrict, `{"location": {"type": "Point", "coordinates": [13.4, 52.5]}}`, map[string]interface{}{"location": querybuilder.GeoJSON(`{"coordinates":[13.4,52.5],"type":"Point"}`)}, ""},
+		{bodyModeLenient, `{"location": "POINT(13.4 52.5)"}`, nil, "field location have invalid type"},
+		{bodyModeLenient, `{"location": {"coordinates": [13.4, 52.5]}}`, nil, "field location have invalid type"},
+		{bodyModeStrict, `{"status": "paid"}`, map[string]interface{}{"status": "paid"}, ""},
+		{bodyModeLenient, `{"status": "lost"}`, nil, "field status must be one of: new, paid"},
+		{bodyModeLenient, `{"status": 1}`, nil, "field status must be one of: new, paid"},
+		{bodyModeStrict, `{"id": 2147483647, "qty": -32768}`, map[string]interface{}{"id": int64(2147483647), "qty": int64(-32768)}, ""},
+		{bodyModeStrict, `{"id": 3000000000}`, nil, "field id is out of range for type integer"},
+		{bodyModeLenient, `{"qty": "40000"}`, nil, "field qty is out of range for type smallint"},
+		{bodyModeStrict, `{"code": "äöü", "grade": "A  "}`, map[string]interface{}{"code": "äöü", "grade": "A  "}, ""},
+		{bodyModeStrict, `{"code": "abcd"}`, nil, "field code is longer than 3 characters"},
+		{bodyModeLenient, `{"grade": 123}`, nil, "field grade is longer than 2 characters"},
+	}
+
+	for idx, item := range cases {
+		r := httptest.NewRequest("PUT", "/items", strings.NewReader(item.body))
+		r.Header.Set("X-Body-Mode", item.mode)
+		var data map[string]interface{}
+		body, err := de.readBody(r)
+		if err == nil {
+			data, err = de.checkRecord(r, table, body.(map[string]interface{}))
+		}
+		if item.err != "" {
+			if err == nil || err.Error() != item.err {
+				t.Fatalf("case %d: expected error %q, got %v", idx, item.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", idx, err)
+		}
+		if !reflect.DeepEqual(data, item.result) {
+			t.Fatalf("case %d: results not match\nGot : %#v\nWant: %#v", idx, data, item.result)
+		}
+	}
+}
+
+func TestWriteEnumError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeBodyError(w, &enumError{"status", []string{"new", "paid"}})
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"error":   "field status must be one of: new, paid",
+		"field":   "status",
+		"allowed": []interface{}{"new", "paid"},
+	}
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %d %#v\nWant: 400 %#v", w.Code, got, want)
+	}
+}
+
+func TestCoercionTable(t *testing.T) {
+	column := &Column{Name: "active", DataType: "boolean"}
+	de := &DbExplorer{cfg: &Config{}}
+	if _, ok := de.convertValue(column, json.Number("1"), false); ok {
+		t.Fatalf("int->bool should be disabled by default")
+	}
+
+	de.cfg.Coercions = map[string]bool{"int->bool": true, "string->bool": false}
+	if value, ok := de.convertValue(column, json.Number("1"), false); !ok || value != true {
+		t.Fatalf("expected int->bool coercion, got %#v, %v", value, ok)
+	}
+	if _, ok := de.convertValue(column, "true", false); ok {
+		t.Fatalf("string->bool should be disabled by config")
+	}
+	if _, ok := de.convertValue(column, json.Number("1"), true); ok {
+		t.Fatalf("strict mode must not coerce")
+	}
+}
+
+func TestCheckRequired(t *testing.T) {
+	table := &Table{Name: "items", Columns: []*Column{
+		{Name: "id", DataType: "integer", Default: "nextval('items_id_seq'::regclass)", Generated: true},
+		{Name: "title", DataType: "character varying"},
+		{Name: "status", DataType: "text", Default: "'new'::text"},
+		{Name: "updated", DataType: "character varying", Nullable: true},
+	}}
+
+	cases := []struct {
+		data    map[string]interface{}
+		missing []string
+	}{
+		{map[string]interface{}{"title": "x"}, nil},
+		{map[string]interface{}{}, []string{"title"}},
+		{map[string]interface{}{"title": "x", "status": nil, "updated": nil}, []string{"status"}},
+	}
+	for idx, item := range cases {
+		err := checkRequired(table, item.data)
+		var got []string
+		if re, ok := err.(*requiredError); ok {
+			got = re.Fields
+		} else if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", idx, err)
+		}
+		if !reflect.DeepEqual(got, item.missing) {
+			t.Fatalf("case %d: results not match\nGot : %#v\nWant: %#v", idx, got, item.missing)
+		}
+	}
+}
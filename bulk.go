@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// maxBulkParams keeps every statement of a bulk insert below the protocol
+// limit of 65535 bind parameters.
+const maxBulkParams = 65000
+
+// handleBulkInsert creates every record of items in one transaction using
+// multi-row INSERTs and returns the generated primary keys in input order.
+func (de *DbExplorer) handleBulkInsert(w http.ResponseWriter, r *http.Request, table *Table, items []interface{}) {
+	records := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("record %d: expected a JSON object", i))
+			return
+		}
+		data, err := de.prepareInsert(r, table, object)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("record %d: %v", i, err))
+			return
+		}
+		if err := de.encryptValues(table.Name, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		records = append(records, data)
+	}
+	if len(records) == 0 {
+		writeError(w, http.StatusBadRequest, "no records to insert")
+		return
+	}
+
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	returned, err := insertRecords(r.Context(), tx, table, records)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error inserting records: %v", err), http.StatusInternalServerError)
+		return
+	}
+	ids := []interface{}{}
+	for _, key := range returned {
+		ids = append(ids, keyValue(table, key))
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), int64(len(records)))
+
+	result := map[string]interface{}{"inserted": len(records)}
+	if len(table.PrimaryKey) > 0 {
+		result["ids"] = ids
+	}
+	response := map[string]interface{}{
+		"response": result,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// insertRecords inserts records in as few statements as the parameter
+// limit allows and returns the primary keys of the new rows in order.
+func insertRecords(ctx context.Context, tx Tx, table *Table, records []map[string]interface{}) ([][]interface{}, error) {
+	columns := bulkColumns(table, records)
+	// Records without any value fall back to one DEFAULT VALUES row each.
+	perStatement := 1
+	if len(columns) > 0 {
+		perStatement = maxBulkParams / len(columns)
+	}
+
+	var keys [][]interface{}
+	for start := 0; start < len(records); start += perStatement {
+		end := start + perStatement
+		if end > len(records) {
+			end = len(records)
+		}
+		returned, err := tx.Insert(ctx, bulkInsert(table, columns, records[start:end]))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, returned...)
+	}
+	return keys, nil
+}
+
+// bulkColumns returns, in table order, every column set by any record.
+func bulkColumns(table *Table, records []map[string]interface{}) []*Column {
+	var columns []*Column
+	for _, column := range table.Columns {
+		for _, record := range records {
+			if _, ok := record[column.Name]; ok {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// bulkInsert builds one multi-row INSERT; columns missing from a record
+// get DEFAULT. Without any columns it inserts a single DEFAULT VALUES row.
+func bulkInsert(table *Table, columns []*Column, records []map[string]interface{}) querybuilder.Insert {
+	insert := querybuilder.Insert{Into: table.ref(), Returning: returningKey(table)}
+	if len(columns) == 0 {
+		return insert
+	}
+
+	for _, column := range columns {
+		insert.Columns = append(insert.Columns, column.Name)
+	}
+	for _, record := range records {
+		row := make([]interface{}, len(columns))
+		for i, column := range columns {
+			value, ok := record[column.Name]
+			if !ok {
+				value = querybuilder.DefaultValue{}
+			}
+			row[i] = value
+		}
+		insert.Rows = append(insert.Rows, row)
+	}
+	return insert
+}
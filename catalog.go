@@ -0,0 +1,47 @@
+package main
+
+import "context"
+
+// tableDetail is a table as GET /?detail=full lists it. The statistics are
+// null when the store has no catalog to read them from, the row estimate
+// also when the table was never analyzed.
+type tableDetail struct {
+	Name            string   `json:"name"`
+	Kind            string   `json:"kind"`
+	PrimaryKey      []string `json:"primary_key"`
+	ApproximateRows *int64   `json:"approximate_rows"`
+	SizeBytes       *int64   `json:"size_bytes"`
+	Comment         *string  `json:"comment"`
+}
+
+// tableDetails describes the tables of schema, in name order.
+func (de *DbExplorer) tableDetails(ctx context.Context, schema *Schema) ([]tableDetail, error) {
+	var stats map[string]TableStats
+	if catalog, ok := de.backend.(cataloger); ok {
+		var err error
+		if stats, err = catalog.Catalog(ctx, schema.Name); err != nil {
+			return nil, err
+		}
+	}
+	names := schema.TableNames()
+	details := make([]tableDetail, len(names))
+	for i, name := range names {
+		detail := tableDetail{Name: name, Kind: schema.Tables[name].kind(), PrimaryKey: schema.Tables[name].PrimaryKey}
+		if detail.PrimaryKey == nil {
+			detail.PrimaryKey = []string{}
+		}
+		if table, ok := stats[name]; ok {
+			if table.Rows >= 0 {
+				detail.ApproximateRows = &table.Rows
+			}
+			detail.SizeBytes = &table.Size
+			if table.Comment != "" {
+				detail.Comment = &table.Comment
+			}
+		} else if estimate, ok := schema.Estimates[name]; ok {
+			detail.ApproximateRows = &estimate
+		}
+		details[i] = detail
+	}
+	return details, nil
+}
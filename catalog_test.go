@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// catalogStore is a fakeStore with a catalog.
+type catalogStore struct {
+	fakeStore
+	stats map[string]TableStats
+}
+
+func (s *catalogStore) Catalog(ctx context.Context, schema string) (map[string]TableStats, error) {
+	return s.stats, nil
+}
+
+func TestRootDetail(t *testing.T) {
+	backend := &catalogStore{stats: map[string]TableStats{
+		"items":       {Rows: 1200, Size: 8192, Comment: "Things for sale"},
+		"order_items": {Rows: -1, Size: 16384},
+	}}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?detail=full", nil))
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"tables": []interface{}{
+				map[string]interface{}{"name": "items", "kind": "table", "primary_key": []interface{}{"id"}, "approximate_rows": float64(1200), "size_bytes": float64(8192), "comment": "Things for sale"},
+				map[string]interface{}{"name": "order_items", "kind": "table", "primary_key": []interface{}{"order_id", "line"}, "approximate_rows": nil, "size_bytes": float64(16384), "comment": nil},
+				map[string]interface{}{"name": `we"ird`, "kind": "table", "primary_key": []interface{}{`i'd`}, "approximate_rows": nil, "size_bytes": nil, "comment": nil},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?detail=some", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
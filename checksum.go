@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The trailers of an export with ?checksum=true.
+const (
+	exportRowsTrailer     = "X-Export-Rows"
+	exportSHA256Trailer   = "X-Export-Sha256"
+	exportManifestTrailer = "X-Export-Manifest"
+)
+
+// exportOptions are the choices of a streamed listing.
+type exportOptions struct {
+	format string
+	// resume is the range of a resumed export, nil for a whole one.
+	resume *recordRange
+	// checksum adds the manifest of the export in trailers.
+	checksum bool
+}
+
+// wantsChecksum reads ?checksum=.
+func wantsChecksum(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("checksum")
+	if raw == "" {
+		return false, nil
+	}
+	checksum, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("checksum must be true or false")
+	}
+	return checksum, nil
+}
+
+// exportManifest describes a completed export, so a pipeline can check the
+// file it received before loading it. SHA256 is the digest of the response
+// body; for a resumed export, that of the part in Range.
+type exportManifest struct {
+	Table      string           `json:"table"`
+	Format     string           `json:"format"`
+	Rows       int64            `json:"rows"`
+	SHA256     string           `json:"sha256"`
+	Range      string           `json:"range,omitempty"`
+	Columns    []manifestColumn `json:"columns"`
+	ExportedAt time.Time        `json:"exported_at"`
+}
+
+// manifestColumn is a column of the export as the schema had it.
+type manifestColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Enum lists the labels of an enum column.
+	Enum []string `json:"enum,omitempty"`
+}
+
+// hashingWriter hashes the body of a response as it is written.
+type hashingWriter struct {
+	http.ResponseWriter
+	hash hash.Hash
+}
+
+func newHashingWriter(w http.ResponseWriter) *hashingWriter {
+	return &hashingWriter{ResponseWriter: w, hash: sha256.New()}
+}
+
+func (hw *hashingWriter) Write(data []byte) (int, error) {
+	n, err := hw.ResponseWriter.Write(data)
+	hw.hash.Write(data[:n])
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (hw *hashingWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// declareTrailers announces the manifest trailers; it has to happen before
+// the body is written.
+func declareTrailers(h http.Header) {
+	h.Set("Trailer", exportRowsTrailer+", "+exportSHA256Trailer+", "+exportManifestTrailer)
+}
+
+// writeTrailers sets the manifest trailers of a completed export.
+func (hw *hashingWriter) writeTrailers(table *Table, fields []string, export exportOptions, rows int64) {
+	manifest := exportManifest{
+		Table:      table.Name,
+		Format:     export.format,
+		Rows:       rows,
+		SHA256:     hex.EncodeToString(hw.hash.Sum(nil)),
+		Columns:    make([]manifestColumn, 0, len(fields)),
+		ExportedAt: time.Now().UTC(),
+	}
+	if export.resume != nil {
+		manifest.Range = export.resume.contentRange()
+	}
+	for _, name := range fields {
+		if column, ok := table.Column(name); ok {
+			manifest.Columns = append(manifest.Columns, manifestColumn{column.Name, column.DataType, column.Nullable, column.EnumValues})
+		}
+	}
+	encoded, _ := json.Marshal(manifest)
+
+	h := hw.Header()
+	h.Set(exportRowsTrailer, strconv.FormatInt(rows, 10))
+	h.Set(exportSHA256Trailer, manifest.SHA256)
+	h.Set(exportManifestTrailer, string(encoded))
+}
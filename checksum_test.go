@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExportChecksum(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(1), "title": "memcache"},
+		{"id": int64(2), "title": "redis"},
+	}}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?format=csv&fields=id,title&checksum=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	sum := sha256.Sum256(w.Body.Bytes())
+	trailer := w.Result().Trailer
+	if got, want := trailer.Get(exportSHA256Trailer), hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+	if got := trailer.Get(exportRowsTrailer); got != "2" {
+		t.Fatalf("results not match\nGot : %s\nWant: 2", got)
+	}
+
+	var manifest exportManifest
+	if err := json.Unmarshal([]byte(trailer.Get(exportManifestTrailer)), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := []manifestColumn{{"id", "integer", false, nil}, {"title", "character varying", false, nil}}
+	if manifest.Table != "items" || manifest.Format != "csv" || manifest.Rows != 2 || !reflect.DeepEqual(manifest.Columns, want) {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?checksum=true", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d\nWant: 400", w.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// handleClone serves POST /{table}/{id}/_clone, which inserts a copy of the
+// record and returns it. The primary key, generated columns and the
+// columns CloneExclude lists for the table are left to their defaults; an
+// optional JSON object body sets fields of the copy, as a create would.
+// Injected values are applied as on any insert.
+func (de *DbExplorer) handleClone(w http.ResponseWriter, r *http.Request, table *Table, key recordKey) {
+	overrides := map[string]interface{}{}
+	if r.ContentLength != 0 {
+		body, err := de.readBody(r)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		object, ok := body.(map[string]interface{})
+		if !ok {
+			writeError(w, http.StatusBadRequest, "expected a JSON object")
+			return
+		}
+		overrides = object
+	}
+	data, err := de.checkRecord(r, table, overrides)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	records, err := de.selectRecords(r.Context(), table, selectRecord(table, table.ColumnNames(), key))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	exclude := de.cfg.CloneExclude[table.Name]
+	for _, column := range table.Columns {
+		value := records[0][column.Name]
+		if _, ok := data[column.Name]; ok || value == nil || column.Generated ||
+			containsString(table.PrimaryKey, column.Name) || containsString(exclude, column.Name) {
+			continue
+		}
+		if data[column.Name], err = de.copyValue(column, value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if data, err = de.completeRecord(r, table, data, nil); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if err := de.encryptValues(table.Name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The copy is read back in the transaction inserting it, as the
+	// database filled it.
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	returned, err := tx.Insert(r.Context(), insertRecord(table, data))
+	if err == nil && len(returned) != 1 {
+		err = fmt.Errorf("%d rows returned", len(returned))
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error cloning record: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var clone map[string]interface{}
+	err = tx.Select(r.Context(), selectRecord(table, table.ColumnNames(), recordKey(returned[0])), func(record map[string]interface{}) error {
+		clone = record
+		return nil
+	})
+	if err == nil && clone == nil {
+		err = fmt.Errorf("clone %v not found", keyValue(table, recordKey(returned[0])))
+	}
+	if err == nil {
+		err = de.decryptValues(table.Name, clone)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), 1)
+
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"record": clone,
+		},
+	}, false)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	source := map[string]interface{}{"id": int64(1), "title": "memcache", "price": json.Number("9.50"), "created": nil, "extra": map[string]interface{}{"a": 1}}
+	backend := &fakeStore{records: []map[string]interface{}{source}, lastID: 1}
+	de := backendExplorer(backend)
+	de.cfg.CloneExclude = map[string][]string{"items": {"title"}}
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/1/_clone", strings.NewReader(`{"title": "memcache 2"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+	// The key is left to the database, title is excluded but set by the
+	// body.
+	want := [][]interface{}{{"memcache 2", "9.50", `{"a":1}`}}
+	if !reflect.DeepEqual(backend.inserted, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.inserted, want)
+	}
+	if query, args := buildSQL(backend.query); query != `SELECT "id", "title", "price", "created", "extra" FROM "public"."items" WHERE "id" = $1` || args[0] != int64(2) {
+		t.Fatalf("results not match\nGot : %s %v\nWant: the clone read back", query, args)
+	}
+
+	cases := []struct {
+		body   string
+		status int
+		error  string
+	}{
+		{``, http.StatusBadRequest, `"fields":["title"]`},
+		{`{"nope": 1}`, http.StatusBadRequest, "unknown field nope"},
+		{`[1]`, http.StatusBadRequest, "expected a JSON object"},
+	}
+	for _, item := range cases {
+		backend.inserted = nil
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/1/_clone", strings.NewReader(item.body)))
+		if w.Code != item.status || !strings.Contains(w.Body.String(), item.error) || backend.inserted != nil {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.body, w.Code, w.Body, item.status, item.error)
+		}
+	}
+
+	backend.records = nil
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/1/_clone", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusNotFound)
+	}
+}
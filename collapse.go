@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// collapsedSelect reads the records of query once for all the callers
+// asking for it at the same time. Each caller gets its own copy of the
+// records, which it may change; the copy is shallow, so JSON objects and
+// arrays in them are shared and must not be modified in place. A caller
+// giving up stops waiting, the query goes on for the others: it runs with
+// the values and deadline of the first caller's context but not its
+// cancellation.
+func (de *DbExplorer) collapsedSelect(ctx context.Context, query querybuilder.Select) ([]map[string]interface{}, error) {
+	sqlQuery, args := buildSQL(query)
+	key := sqlQuery + "\x00" + fmt.Sprintf("%#v", args)
+	results := de.reads.DoChan(key, func() (interface{}, error) {
+		shared := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			shared, cancel = context.WithDeadline(shared, deadline)
+			defer cancel()
+		}
+		var records []map[string]interface{}
+		err := de.backend.Select(shared, query, func(record map[string]interface{}) error {
+			records = append(records, record)
+			return nil
+		})
+		return records, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		shared := result.Val.([]map[string]interface{})
+		records := make([]map[string]interface{}, len(shared))
+		for i, record := range shared {
+			records[i] = make(map[string]interface{}, len(record))
+			for column, value := range record {
+				records[i][column] = value
+			}
+		}
+		return records, nil
+	}
+}
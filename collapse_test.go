@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// blockingStore holds every read until release is closed, then fails those
+// whose context is done by then.
+type blockingStore struct {
+	fakeStore
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	if s.calls.Add(1) == 1 {
+		close(s.started)
+	}
+	<-s.release
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.fakeStore.Select(ctx, query, each)
+}
+
+func TestCollapseReads(t *testing.T) {
+	backend := &blockingStore{
+		fakeStore: fakeStore{records: []map[string]interface{}{{"id": int64(1), "title": "memcache"}}},
+		started:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	de := backendExplorer(backend)
+	de.cfg.CollapseReads = true
+	table := fuzzSchema().Tables["items"]
+	query := selectRecord(table, []string{"id", "title"}, recordKey{int64(1)})
+
+	const callers = 5
+	results := make([][]map[string]interface{}, callers)
+	var wg sync.WaitGroup
+	read := func(i int) {
+		defer wg.Done()
+		records, err := de.selectRecords(context.Background(), table, query)
+		if err != nil {
+			t.Error(err)
+		}
+		results[i] = records
+	}
+	wg.Add(callers)
+	go read(0)
+	<-backend.started
+	for i := 1; i < callers; i++ {
+		go read(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Fatalf("results not match\nGot : %d queries\nWant: 1", calls)
+	}
+	results[0][0]["title"] = "changed"
+	for i := 1; i < callers; i++ {
+		if len(results[i]) != 1 || results[i][0]["title"] != "memcache" {
+			t.Fatalf("results not match\nGot : %#v\nWant: the shared record", results[i])
+		}
+	}
+}
+
+func TestCollapseReadsCancel(t *testing.T) {
+	backend := &blockingStore{
+		fakeStore: fakeStore{records: []map[string]interface{}{{"id": int64(1), "title": "memcache"}}},
+		started:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	de := backendExplorer(backend)
+	de.cfg.CollapseReads = true
+	table := fuzzSchema().Tables["items"]
+	query := selectRecord(table, []string{"id", "title"}, recordKey{int64(1)})
+
+	// The caller whose read is shared gives up; the other one still gets
+	// the records.
+	first, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := de.selectRecords(first, table, query)
+		errs <- err
+	}()
+	<-backend.started
+	done := make(chan []map[string]interface{}, 1)
+	go func() {
+		records, err := de.selectRecords(context.Background(), table, query)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- records
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("results not match\nGot : %v\nWant: %v", err, context.Canceled)
+	}
+	close(backend.release)
+	if records := <-done; len(records) != 1 || records[0]["title"] != "memcache" {
+		t.Fatalf("results not match\nGot : %#v\nWant: the shared record", records)
+	}
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Fatalf("results not match\nGot : %d queries\nWant: 1", calls)
+	}
+}
+
+// contextStore remembers the context of the last read.
+type contextStore struct {
+	fakeStore
+	ctx context.Context
+}
+
+func (s *contextStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	s.ctx = ctx
+	return s.fakeStore.Select(ctx, query, each)
+}
+
+type collapseKey struct{}
+
+func TestCollapseReadsContext(t *testing.T) {
+	backend := &contextStore{}
+	de := backendExplorer(backend)
+	de.cfg.CollapseReads = true
+	table := fuzzSchema().Tables["items"]
+
+	// The shared read keeps the caller's values and deadline, however far.
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), collapseKey{}, "ann"), deadline)
+	defer cancel()
+	if _, err := de.selectRecords(ctx, table, selectRecord(table, []string{"id"}, recordKey{int64(1)})); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := backend.ctx.Deadline()
+	if !ok || !got.Equal(deadline) || backend.ctx.Value(collapseKey{}) != "ann" {
+		t.Fatalf("results not match\nGot : %v %v %v\nWant: %v ann", got, ok, backend.ctx.Value(collapseKey{}), deadline)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Config holds the optional behaviour of the explorer. The zero value is a
+// valid configuration that keeps the original behaviour.
+type Config struct {
+	Auth AuthConfig `json:"auth"`
+	TLS  *TLSConfig `json:"tls"`
+	// SecurityHeaders overrides the default security response headers; an
+	// empty value removes the header.
+	SecurityHeaders map[string]string `json:"security_headers"`
+
+	// SharedState connects replicas through Redis for lockouts, quotas,
+	// idempotency keys and schema switches; a single instance doesn't need
+	// it. Embedders may plug their own implementation in Store instead.
+	SharedState *SharedStateConfig `json:"shared_state"`
+	Store       SharedStore        `json:"-"`
+	// IdempotencyTTL is how long Idempotency-Key responses are kept;
+	// defaults to 24h.
+	IdempotencyTTL Duration `json:"idempotency_ttl"`
+
+	// Backend replaces the database/sql access to records and schema
+	// metadata, e.g. with a fake in tests. Operational features such as
+	// managed keys and the warm-up still use the *sql.DB.
+	Backend Store `json:"-"`
+
+	// Driver is the PostgreSQL driver reading and writing records: "pq"
+	// (default) or "pgx", which is faster on large results. Schema
+	// metadata and operational features always go through lib/pq.
+	Driver string `json:"driver"`
+
+	// DSN and DBPassword accept secret references ("env:", "file:", "vault:").
+	DSN        string `json:"dsn"`
+	DBPassword string `json:"db_password"`
+	// SecretRefresh enables periodic re-resolution of DSN and DBPassword.
+	SecretRefresh Duration `json:"secret_refresh"`
+	// HealthCheckInterval enables the background database watchdog.
+	HealthCheckInterval Duration `json:"health_check_interval"`
+	// HealthCheckFailures is the number of failed pings before the
+	// explorer reports itself not ready; defaults to 3.
+	HealthCheckFailures int `json:"health_check_failures"`
+
+	// Sandbox serves requests with X-Environment: sandbox from a second
+	// database; nil leaves it off.
+	Sandbox *SandboxConfig `json:"sandbox"`
+
+	// WarmUp opens the idle connections, reads table row estimates and
+	// prepares the hot statements before the explorer starts serving.
+	WarmUp bool `json:"warm_up"`
+
+	// DBRoles are the database sessions callers may pick per request
+	// with the X-Db-Role header, keyed by the header value.
+	DBRoles map[string]DBRole `json:"db_roles"`
+
+	// Backpressure sheds exports and aggregations while the database is
+	// saturated.
+	Backpressure *BackpressureConfig `json:"backpressure"`
+
+	// Scheduling caps the requests served at a time and queues the others
+	// by priority class.
+	Scheduling *SchedulingConfig `json:"scheduling"`
+
+	// CollapseReads runs identical reads arriving at the same time once
+	// and hands every caller the result, sparing the database the
+	// stampedes on hot pages. A read may then miss a write committed while
+	// the shared query was already running.
+	CollapseReads bool `json:"collapse_reads"`
+
+	// PgBouncer avoids session state (named prepared statements, session
+	// level SET) so the explorer works behind transaction pooling.
+	PgBouncer bool `json:"pgbouncer"`
+
+	// ActiveSchema is the Postgres schema whose tables are served, "public"
+	// by default. /_admin/schema switches it at runtime.
+	ActiveSchema string `json:"active_schema"`
+	// ExposeTables restricts the tables served to those matching one of
+	// the globs, e.g. "public.*" or "orders_*"; HideTables keeps those
+	// matching one from being served, e.g. "public.audit_*". Globs with a
+	// dot match the schema-qualified name. The -expose-tables and
+	// -hide-tables flags or the EXPLORER_EXPOSE_TABLES and
+	// EXPLORER_HIDE_TABLES variables override them.
+	ExposeTables []string `json:"expose_tables"`
+	HideTables   []string `json:"hide_tables"`
+	// SchemaRefresh enables reloading the schema periodically, so tables
+	// and columns created since are served without a restart or a POST
+	// /_reload.
+	SchemaRefresh Duration `json:"schema_refresh"`
+
+	// SchemaManifest is the path of a JSON file listing required tables and
+	// columns. SchemaDriftMode "fail" refuses to start on drift; any other
+	// value only reports it.
+	SchemaManifest  string `json:"schema_manifest"`
+	SchemaDriftMode string `json:"schema_drift_mode"`
+	// SchemaHistory is the path of a JSON file keeping the versions of the
+	// schema served, which /_schema/changes compares, across restarts;
+	// without it the history starts with the process.
+	SchemaHistory string `json:"schema_history"`
+
+	// BodyMode is "strict" or "lenient" (default); a request may override it
+	// with the X-Body-Mode header. Strict mode rejects type mismatches and
+	// trailing data, lenient mode coerces per Coercions.
+	BodyMode string `json:"body_mode"`
+	// Coercions enables or disables lenient conversions keyed as
+	// "<json type>-><column kind>", e.g. {"int->bool": true}. JSON types are
+	// string, int, float and bool; column kinds are int, float, numeric, bool
+	// and string. uuid, date and timestamp columns only take strings.
+	Coercions map[string]bool `json:"coercions"`
+
+	// TablePolicies restricts tables regardless of the caller, before any
+	// role is considered: "read-only" or a comma separated list of
+	// "no-create", "no-update", "no-delete" and "no-refresh". "*" applies to
+	// every table.
+	TablePolicies map[string]string `json:"table_policies"`
+
+	// Deprecations marks tables, keyed by name, and routes, keyed by path
+	// such as "/_query", as going away; their responses carry Deprecation
+	// and Sunset headers ahead of the removal.
+	Deprecations map[string]Deprecation `json:"deprecations"`
+
+	Limits Limits `json:"limits"`
+
+	// Query enables POST /_query, read-only SQL for analysts; nil leaves
+	// it off.
+	Query *QueryConfig `json:"query"`
+	// Queries are the named queries of GET /_queries/{name}, keyed by
+	// name.
+	Queries map[string]NamedQuery `json:"queries"`
+
+	// ImportBatchSize is how many records of an NDJSON import are inserted
+	// per transaction; defaults to 500. A request may ask for another size
+	// with ?batch_size=.
+	ImportBatchSize int `json:"import_batch_size"`
+
+	// Relations declares, per table, the foreign keys the database doesn't
+	// enforce. They serve as the constraints do, e.g. for child listings
+	// and expansion, and /_admin/orphans finds the rows breaking them.
+	Relations map[string][]RelationConfig `json:"relations"`
+
+	// CloneExclude lists, per table, the columns /{table}/{id}/_clone
+	// leaves out of the copy besides the primary key, e.g. those with a
+	// unique constraint.
+	CloneExclude map[string][]string `json:"clone_exclude"`
+
+	// Search lists, per table, the columns /{table}/_search looks in;
+	// tables not listed search all their text columns.
+	Search map[string][]string `json:"search"`
+
+	// MonthlyQuotas caps the cost units each caller may spend per calendar
+	// month; "*" is the default for callers not listed.
+	MonthlyQuotas map[string]float64 `json:"monthly_quotas"`
+
+	// FieldUsage counts the reads of each table and the columns they
+	// select, filter and order on, for /_admin/field_usage. Only names are
+	// counted, never values.
+	FieldUsage bool `json:"field_usage"`
+
+	// Inject maps a table name (or "*" for every table) to column values that
+	// are forced on insert and update, e.g. {"created_by": "{{auth.subject}}"}.
+	Inject map[string]map[string]string `json:"inject"`
+
+	// Encrypt lists, per table, the columns stored encrypted with AES-GCM.
+	Encrypt map[string][]string `json:"encrypt"`
+	// EncryptionKey references the key as "env:NAME" or "file:/path".
+	EncryptionKey string `json:"encryption_key"`
+}
+
+// RelationConfig declares that Columns reference RefColumns of the table
+// References, its primary key when RefColumns is empty.
+type RelationConfig struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	References string   `json:"references"`
+	RefColumns []string `json:"ref_columns"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Duration is a time.Duration read from JSON strings such as "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
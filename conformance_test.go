@@ -0,0 +1,116 @@
+//go:build conformance
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// conformanceTarget is a database the API cases must pass on, started in a
+// throwaway container. The DSN is a format taking the mapped host and port.
+type conformanceTarget struct {
+	name  string
+	image string
+	env   []string
+	port  string
+	dsn   string
+}
+
+// TestConformance runs the API cases against every supported database:
+//
+//	go test -tags conformance -run TestConformance
+//
+// The explorer speaks PostgreSQL only, so the matrix covers the oldest and
+// newest supported servers, each through every driver; a new backend adds
+// its targets here.
+func TestConformance(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available")
+	}
+
+	postgres := func(version string) conformanceTarget {
+		return conformanceTarget{
+			name:  "postgres-" + version,
+			image: "postgres:" + version + "-alpine",
+			env:   []string{"POSTGRES_PASSWORD=conformance", "POSTGRES_DB=db_go"},
+			port:  "5432/tcp",
+			dsn:   "host=%s port=%s user=postgres password=conformance dbname=db_go sslmode=disable",
+		}
+	}
+	targets := []conformanceTarget{postgres("12"), postgres("16")}
+
+	for _, target := range targets {
+		target := target
+		t.Run(target.name, func(t *testing.T) {
+			t.Parallel()
+			db, dsn := startContainer(t, target)
+			for _, driver := range []string{"pq", "pgx"} {
+				t.Run(driver, func(t *testing.T) {
+					cfg := &Config{Driver: driver}
+					backend, err := openDriverStore(context.Background(), cfg, newRotatingConnector(dsn), db)
+					if err != nil {
+						t.Fatalf("opening %s store: %v", driver, err)
+					}
+					if store, ok := backend.(*pgxStore); ok {
+						t.Cleanup(store.pool.Close)
+						cfg.Backend = store
+					}
+					testApis(t, db, cfg)
+				})
+			}
+		})
+	}
+}
+
+// startContainer runs target, waits until it accepts connections and
+// returns a handle to it and its DSN. The container is removed when the test
+// ends.
+func startContainer(t *testing.T, target conformanceTarget) (*sql.DB, string) {
+	args := []string{"run", "--detach", "--rm", "--publish", "127.0.0.1::" + target.port}
+	for _, env := range target.env {
+		args = append(args, "--env", env)
+	}
+	out, err := exec.Command("docker", append(args, target.image)...).Output()
+	if err != nil {
+		t.Fatalf("starting %s: %v", target.image, err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "--force", id).Run()
+	})
+
+	out, err = exec.Command("docker", "port", id, target.port).Output()
+	if err != nil || len(strings.Fields(string(out))) == 0 {
+		t.Fatalf("reading port of %s: %v", target.image, err)
+	}
+	host, port, err := net.SplitHostPort(strings.Fields(string(out))[0])
+	if err != nil {
+		t.Fatalf("reading port of %s: %v", target.image, err)
+	}
+
+	dsn := fmt.Sprintf(target.dsn, host, port)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	deadline := time.Now().Add(time.Minute)
+	for {
+		err := db.Ping()
+		if err == nil {
+			return db, dsn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s didn't become ready: %v", target.image, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCSRF(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	id := &Identity{Subject: "ann"}
+	token, sess := de.sessions.create(id, time.Hour)
+
+	request := func(method string, header map[string]string) *http.Request {
+		r := httptest.NewRequest(method, "http://explorer.corp/items", nil)
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+	withSession := func(r *http.Request) *http.Request {
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+		return withIdentity(r, id)
+	}
+	withBasic := func(r *http.Request) *http.Request {
+		r.SetBasicAuth("ann", "secret")
+		return withIdentity(r, &Identity{Subject: "ann", Method: "ldap"})
+	}
+
+	cases := []struct {
+		name string
+		r    *http.Request
+		ok   bool
+	}{
+		{"session read", withSession(request(http.MethodGet, nil)), true},
+		{"session write without token", withSession(request(http.MethodPost, nil)), false},
+		{"session write with wrong token", withSession(request(http.MethodPost, map[string]string{csrfHeader: "forged"})), false},
+		{"session write with token", withSession(request(http.MethodPost, map[string]string{csrfHeader: sess.csrf})), true},
+		{"api key write", withIdentity(request(http.MethodPost, map[string]string{"X-Api-Key": "k"}), id), true},
+		{"basic write from a client", withBasic(request(http.MethodPost, nil)), true},
+		{"basic write from the same origin", withBasic(request(http.MethodPost, map[string]string{"Origin": "https://explorer.corp", "Sec-Fetch-Site": "same-origin"})), true},
+		{"basic cross-site form", withBasic(request(http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site"})), false},
+		{"basic write from another origin", withBasic(request(http.MethodPost, map[string]string{"Origin": "https://evil.example"})), false},
+		{"basic write from an opaque origin", withBasic(request(http.MethodDelete, map[string]string{"Origin": "null"})), false},
+		{"basic cross-site read", withBasic(request(http.MethodGet, map[string]string{"Sec-Fetch-Site": "cross-site"})), true},
+	}
+	for _, item := range cases {
+		if err := de.checkCSRF(item.r); (err == nil) != item.ok {
+			t.Fatalf("[%s] results not match\nGot : %v\nWant: allowed %v", item.name, err, item.ok)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// cursorState is the content of an opaque cursor: the ordering it belongs to
+// and the ordering key of the last record served.
+type cursorState struct {
+	Order  string        `json:"o"`
+	Values []interface{} `json:"v"`
+}
+
+// keysetTerms extends the requested ordering with the primary key columns it
+// lacks, so every record has a unique position to resume from.
+func keysetTerms(table *Table, terms []querybuilder.Sort) ([]querybuilder.Sort, error) {
+	if len(table.PrimaryKey) == 0 {
+		return nil, errors.New("cursor pagination needs a primary key")
+	}
+	for _, pk := range table.PrimaryKey {
+		present := false
+		for _, term := range terms {
+			present = present || term.Column == pk
+		}
+		if !present {
+			terms = append(terms, querybuilder.Sort{Column: pk})
+		}
+	}
+	return terms, nil
+}
+
+// encodeCursor builds the cursor pointing after record.
+func encodeCursor(order string, terms []querybuilder.Sort, record map[string]interface{}) (string, error) {
+	state := cursorState{Order: order, Values: make([]interface{}, len(terms))}
+	for i, term := range terms {
+		value, ok := record[term.Column]
+		if !ok {
+			return "", fmt.Errorf("fields must include %s for cursor pagination", term.Column)
+		}
+		// numeric and other textual types are scanned as bytes.
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		state.Values[i] = value
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the ordering key stored in raw, which must have been
+// built for the same ordering.
+func decodeCursor(raw, order string, terms []querybuilder.Sort) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	var state cursorState
+	if err := decoder.Decode(&state); err != nil || len(state.Values) != len(terms) {
+		return nil, errors.New("invalid cursor")
+	}
+	if state.Order != order {
+		return nil, errors.New("cursor was built for a different order")
+	}
+	return state.Values, nil
+}
+
+// keysetCondition selects the records after values in the ordering terms,
+// e.g. a > v1 OR (a = v1 AND b > v2) for two ascending columns. NULLs in the
+// ordering columns are not supported.
+func keysetCondition(terms []querybuilder.Sort, values []interface{}) querybuilder.Or {
+	alternatives := make(querybuilder.Or, len(terms))
+	for i, term := range terms {
+		var parts querybuilder.And
+		for j := 0; j < i; j++ {
+			parts = append(parts, querybuilder.Compare{Column: terms[j].Column, Op: querybuilder.Eq, Value: values[j]})
+		}
+		op := querybuilder.Gt
+		if term.Desc {
+			op = querybuilder.Lt
+		}
+		parts = append(parts, querybuilder.Compare{Column: term.Column, Op: op, Value: values[i]})
+		alternatives[i] = parts
+	}
+	return alternatives
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	terms := []querybuilder.Sort{{Column: "updated", Desc: true}, {Column: "id"}}
+	query, args := buildSQL(querybuilder.Delete{From: querybuilder.Table{Name: "items"}, Where: keysetCondition(terms, []interface{}{"2024-01-01", 7})})
+	expected := `DELETE FROM "items" WHERE ("updated" < $1 OR ("updated" = $2 AND "id" > $3))`
+	if query != expected {
+		t.Fatalf("results not match\nGot : %v\nWant: %v", query, expected)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"2024-01-01", "2024-01-01", 7}) {
+		t.Fatalf("unexpected args %#v", args)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	table := &Table{Name: "items", PrimaryKey: []string{"id"}, Columns: []*Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "title", DataType: "text"},
+	}}
+	terms, err := keysetTerms(table, []querybuilder.Sort{{Column: "title", Desc: true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(terms, []querybuilder.Sort{{Column: "title", Desc: true}, {Column: "id"}}) {
+		t.Fatalf("unexpected terms %#v", terms)
+	}
+
+	cursor, err := encodeCursor("title.desc", terms, map[string]interface{}{"id": int64(7), "title": []byte("memcache")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	values, err := decodeCursor(cursor, "title.desc", terms)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []interface{}{"memcache", json.Number("7")}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", values, expected)
+	}
+
+	if _, err := decodeCursor(cursor, "id", terms); err == nil || err.Error() != "cursor was built for a different order" {
+		t.Fatalf("expected order mismatch, got %v", err)
+	}
+	if _, err := decodeCursor("not a cursor", "title.desc", terms); err == nil || err.Error() != "invalid cursor" {
+		t.Fatalf("expected invalid cursor, got %v", err)
+	}
+	if _, err := keysetTerms(&Table{Name: "log"}, nil); err == nil {
+		t.Fatalf("expected an error for a table without primary key")
+	}
+}
@@ -2,98 +2,253 @@ package main
 
 import (
 	"context"
+	"crypto/cipher"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"sort"
-	"strings"
+	"strconv"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"db_explorer/internal/querybuilder"
+	"golang.org/x/sync/singleflight"
 )
 
 type DbExplorer struct {
 	db     *sql.DB
-	tables map[string][]string
+	cfg    *Config
+	cipher cipher.AEAD
+	schema atomic.Pointer[Schema]
+	ready  atomic.Bool
+	drift  []string
+	usage  *usageTracker
+
+	authenticators []Authenticator
+	sessions       *sessionStore
+	oidc           *oidcProvider
+	lockout        *lockoutTracker
+
+	// store holds the state shared with other replicas; instance tells
+	// this replica's own broadcasts apart.
+	store    SharedStore
+	instance string
+
+	// backend holds the records; db is only used directly for features
+	// specific to Postgres.
+	backend Store
+	// reads collapses identical concurrent reads, see Config.CollapseReads.
+	reads singleflight.Group
+	// saturated is set while Config.Backpressure sheds requests.
+	saturated atomic.Bool
+	// admission queues requests by priority, see Config.Scheduling.
+	admission *scheduler
+	// history keeps the schema versions served, see Config.SchemaHistory.
+	history *schemaHistory
+	// fieldUsage counts the columns reads name, see Config.FieldUsage.
+	fieldUsage *fieldUsage
+	// sandbox serves the sandbox environment, see Config.Sandbox;
+	// environment is "sandbox" for the sandbox itself.
+	sandbox     *DbExplorer
+	environment string
 }
 
 func NewDbExplorer(db *sql.DB) (*DbExplorer, error) {
-	explorer := &DbExplorer{db: db}
-	if err := explorer.loadTables(); err != nil {
-		return nil, err
-	}
-	return explorer, nil
+	return NewDbExplorerWithConfig(db, &Config{})
 }
 
-func (de *DbExplorer) loadTables() error {
-	de.tables = make(map[string][]string)
-	rows, err := de.db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = 'public'")
+func NewDbExplorerWithConfig(db *sql.DB, cfg *Config) (*DbExplorer, error) {
+	store := cfg.Store
+	if store == nil {
+		var err error
+		if store, err = newSharedStore(cfg.SharedState); err != nil {
+			return nil, err
+		}
+	}
+	explorer := &DbExplorer{
+		db:       db,
+		cfg:      cfg,
+		usage:    newUsageTracker(),
+		sessions: newSessionStore(),
+		lockout:  newLockoutTracker(cfg.Auth.Lockout, store),
+		store:    store,
+		instance: randomToken(8),
+	}
+	explorer.backend = cfg.Backend
+	if explorer.backend == nil {
+		explorer.backend = newSQLStore(db, explorer.preparedStatement)
+	}
+	if err := checkTablePatterns(cfg.ExposeTables, cfg.HideTables); err != nil {
+		return nil, err
+	}
+	if err := checkTablePolicies(cfg.TablePolicies); err != nil {
+		return nil, err
+	}
+	if err := checkDBRoles(cfg.DBRoles); err != nil {
+		return nil, err
+	}
+	if err := checkNamedQueries(cfg.Queries); err != nil {
+		return nil, err
+	}
+	if err := checkDeprecations(cfg.Deprecations); err != nil {
+		return nil, err
+	}
+	if err := checkScheduling(cfg.Scheduling); err != nil {
+		return nil, err
+	}
+	if cfg.FieldUsage {
+		explorer.fieldUsage = newFieldUsage()
+	}
+	if cfg.Scheduling != nil {
+		explorer.admission = newScheduler(cfg.Scheduling.MaxConcurrent, cfg.Scheduling.weights())
+	}
+	authenticators, err := buildAuthenticators(&cfg.Auth)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer rows.Close() 
-
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			return err
+	explorer.authenticators = authenticators
+	if cfg.Auth.ManagedKeys {
+		if err := explorer.ensureKeyTables(); err != nil {
+			return nil, err
+		}
+		explorer.authenticators = append([]Authenticator{explorer.managedKeyAuthenticator()}, explorer.authenticators...)
+	}
+	if cfg.TLS != nil && cfg.TLS.ClientCAFile != "" {
+		explorer.authenticators = append([]Authenticator{clientCertAuthenticator(cfg.TLS.ClientRoles)}, explorer.authenticators...)
+	}
+	if cfg.Auth.OIDC != nil {
+		explorer.oidc, err = newOIDCProvider(cfg.Auth.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		explorer.authenticators = append(explorer.authenticators, explorer.sessionAuthenticator())
+	}
+	if len(cfg.Encrypt) > 0 {
+		aead, err := newFieldCipher(cfg.EncryptionKey)
+		if err != nil {
+			return nil, err
 		}
-		de.tables[tableName] = nil
+		explorer.cipher = aead
 	}
-	return nil
+	schema, err := explorer.loadSchema(explorer.activeSchema())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.WarmUp {
+		if err := explorer.warmUp(context.Background(), schema); err != nil {
+			return nil, fmt.Errorf("warm-up: %v", err)
+		}
+	}
+	explorer.schema.Store(schema)
+	if explorer.history, err = loadSchemaHistory(cfg.SchemaHistory); err != nil {
+		return nil, err
+	}
+	explorer.recordSchema(schema)
+	if err := explorer.checkSchemaManifest(); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox != nil {
+		if explorer.sandbox, err = newSandbox(cfg); err != nil {
+			return nil, err
+		}
+	}
+	explorer.ready.Store(true)
+	go explorer.watchInvalidations(context.Background())
+	if cfg.HealthCheckInterval > 0 {
+		go explorer.watchdog(time.Duration(cfg.HealthCheckInterval), cfg.HealthCheckFailures)
+	}
+	if cfg.Backpressure != nil {
+		go explorer.watchLoad(cfg.Backpressure)
+	}
+	if cfg.SchemaRefresh > 0 {
+		go explorer.refreshSchema(time.Duration(cfg.SchemaRefresh))
+	}
+	return explorer, nil
 }
 
 func (de *DbExplorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := strings.Trim(r.URL.Path, "/")
-	parts := strings.Split(path, "/")
+	de.setSecurityHeaders(w, r)
+	if !isPublicPath(r.URL.Path) {
+		if wait := de.lockout.lockedFor(r); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "too many failed authentication attempts")
+			return
+		}
+		id, err := de.authenticate(r)
+		if err == errAuthRequired {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err == errAuthUnavailable {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			locked := de.lockout.fail(r)
+			audit("auth_failure", r, map[string]interface{}{"error": err.Error(), "locked_seconds": int(locked.Seconds())})
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if id != nil {
+			de.lockout.succeed(r)
+			r = withIdentity(r, id)
+		}
+		if err := de.checkCSRF(r); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if r, err = de.impersonate(r); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
 
-	if len(parts) == 1 && parts[0] == "" {
-		de.handleRoot(w, r)
+	target, ok := de.environmentFor(w, r)
+	if !ok {
 		return
 	}
-
-	tableName := parts[0]
-	if _, ok := de.tables[tableName]; !ok {
-		http.Error(w, `{"error": "unknown table"}`, http.StatusNotFound)
+	key := callerKey(r)
+	if de.quotaExceeded(r.Context(), key) {
+		writeError(w, http.StatusTooManyRequests, "monthly quota exceeded")
 		return
 	}
-
-	if len(parts) == 1 {
-		switch r.Method {
-		case http.MethodGet:
-			de.handleGetTable(w, r, tableName)
-		case http.MethodPut:
-			de.handlePutTable(w, r, tableName)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
+	if de.shed(w, r) {
 		return
 	}
-
-	if len(parts) == 2 {
-		id := parts[1]
-		switch r.Method {
-		case http.MethodGet:
-			de.handleGetRecord(w, r, tableName, id)
-		case http.MethodPost:
-			de.handlePostRecord(w, r, tableName, id)
-		case http.MethodDelete:
-			de.handleDeleteRecord(w, r, tableName, id)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
+	done, admitted := de.admit(w, r)
+	if !admitted {
+		return
 	}
+	defer done()
+
+	cost := &requestCost{}
+	start := time.Now()
+	ctx := context.WithValue(r.Context(), requestCostKey{}, cost)
+	ctx = context.WithValue(ctx, schemaKey{}, target.snapshot())
+	target.idempotent(w, r.WithContext(ctx), target.withDBRole(target.route))
+	de.recordUsage(r.Context(), key, cost.rows, time.Since(start))
 }
 
+// handleRoot lists the table names, or with ?detail=full the tables with
+// what the catalog knows about them.
 func (de *DbExplorer) handleRoot(w http.ResponseWriter, r *http.Request) {
-	tables := make([]string, 0, len(de.tables))
-	for tableName := range de.tables {
-		tables = append(tables, tableName)
+	schema := de.requestSchema(r.Context())
+	var tables interface{} = schema.TableNames()
+	switch r.URL.Query().Get("detail") {
+	case "":
+	case "full":
+		details, err := de.tableDetails(r.Context(), schema)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tables = details
+	default:
+		writeError(w, http.StatusBadRequest, "detail must be full")
+		return
 	}
 
-	sort.Strings(tables)
-
 	response := map[string]interface{}{
 		"response": map[string]interface{}{
 			"tables": tables,
@@ -102,145 +257,379 @@ func (de *DbExplorer) handleRoot(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (de *DbExplorer) handleGetTable(w http.ResponseWriter, r *http.Request, tableName string) {
-	limit := r.URL.Query().Get("limit")
-	offset := r.URL.Query().Get("offset")
+// handleGetTable lists the records of table. scope restricts the listing
+// on top of the filter parameters, e.g. to the children of one record.
+func (de *DbExplorer) handleGetTable(w http.ResponseWriter, r *http.Request, table *Table, scope querybuilder.And) {
+	params := r.URL.Query()
+	limit, offset, err := pagination(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The ndjson, csv, xlsx and parquet formats stream the records instead
+	// of buffering them, and read every one of them unless ?limit= is set.
+	format, err := listingFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stream := streamed(format)
+	export := exportOptions{format: format}
+	if export.checksum, err = wantsChecksum(r); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if export.checksum && !stream {
+		writeError(w, http.StatusBadRequest, "checksum needs a streamed format")
+		return
+	}
+	if stream {
+		if err := checkStreamParams(params); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	filters, err := de.whereClause(table, params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filters = append(append(querybuilder.And{}, scope...), filters...)
+	where := filters
 
-	limitValue := "100"
-	offsetValue := "0"
-	if limit != "" {
-		limitValue = limit
+	fields, err := table.selectFields(params.Get("fields"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	expand, err := de.parseExpand(params.Get("expand"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	if offset != "" {
-		offsetValue = offset
+	plan, ok := de.resolveExpand(w, r, table, fields, expand)
+	if !ok {
+		return
 	}
 
-	query := fmt.Sprintf("SELECT * FROM %s LIMIT %s OFFSET %s", tableName, limitValue, offsetValue)
+	terms, err := de.parseOrder(table, params.Get("order"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	de.recordReadUsage(table, params, fields, terms)
+	// ?cursor= switches to keyset pagination: records after the cursor
+	// instead of an OFFSET, which has to skip every earlier row.
+	_, keyset := params["cursor"]
+	if keyset {
+		if params.Get("offset") != "" {
+			writeError(w, http.StatusBadRequest, "cursor and offset can't be combined")
+			return
+		}
+		if terms, err = keysetTerms(table, terms); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, term := range terms {
+			if !containsString(fields, term.Column) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("fields must include %s for cursor pagination", term.Column))
+				return
+			}
+		}
+		if raw := params.Get("cursor"); raw != "" {
+			values, err := decodeCursor(raw, params.Get("order"), terms)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			// The total still counts every filtered record, so filters
+			// stays as it is.
+			where = append(querybuilder.And{keysetCondition(terms, values)}, filters...)
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Streamed CSV and NDJSON exports follow the primary key, so that one
+	// dropped midway can be resumed with Range: records=N-.
+	if stream && resumable(format) && len(table.PrimaryKey) > 0 {
+		terms, _ = keysetTerms(table, terms)
+		w.Header().Set("Accept-Ranges", "records")
+		if rng, ok := parseRecordRange(r.Header.Get("Range")); ok {
+			export.resume = &rng
+		}
+	}
 
-	rows, err := de.db.QueryContext(ctx, query)
+	count, err := countMode(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := querybuilder.Select{
+		Columns: table.projections(fields),
+		From:    table.ref(),
+		Where:   where,
+		OrderBy: terms,
+		Page:    &querybuilder.Page{Limit: limit, Offset: offset},
+	}
+	if stream && params.Get("limit") == "" {
+		query.Page = nil
+	}
+	if export.resume != nil {
+		if query.Page, err = export.resume.page(query.Page); err != nil {
+			w.Header().Set("Content-Range", "records */*")
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := de.checkQueryCost(ctx, query); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if stream {
+		// The stream lasts as long as the client keeps reading, not the
+		// timeout of a buffered page.
+		de.streamRecords(w, r, table, fields, query, export)
 		return
 	}
-	defer rows.Close()
 
-	columns, err := rows.Columns()
+	result, err := de.selectRecords(ctx, table, query)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	addRows(r.Context(), int64(len(result)))
 
-	var result []map[string]interface{}
-	for rows.Next() {
-		columnPointers := make([]interface{}, len(columns))
-		for i := range columnPointers {
-			columnPointers[i] = new(interface{})
+	body := map[string]interface{}{
+		"records": result,
+	}
+	if keyset {
+		body["next_cursor"] = nil
+		if limit > 0 && len(result) == limit {
+			next, err := encodeCursor(params.Get("order"), terms, result[len(result)-1])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			body["next_cursor"] = next
 		}
-
-		if err := rows.Scan(columnPointers...); err != nil {
+	}
+	// Expand after the cursor is built, it needs the raw key values.
+	if err := de.expandRecords(r.Context(), result, plan); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if count != "" {
+		total, err := de.countRecords(ctx, table, count, filters)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		body["total"] = total
+		body["limit"] = limit
+		body["offset"] = offset
+	}
+	response := map[string]interface{}{
+		"response": body,
+	}
+	writeResponse(w, response, format == "xml")
+}
 
-		rowMap := make(map[string]interface{})
-		for i, colName := range columns {
-			val := *(columnPointers[i].(*interface{}))
-			rowMap[colName] = val
+// countRecords returns the number of records matching where. The estimated
+// mode uses the row estimate primed by the warm-up when the listing isn't
+// filtered and falls back to an exact count otherwise.
+func (de *DbExplorer) countRecords(ctx context.Context, table *Table, mode string, where querybuilder.And) (int64, error) {
+	if mode == "estimated" && len(where) == 0 {
+		if estimate, ok := de.requestSchema(ctx).Estimates[table.Name]; ok {
+			return estimate, nil
 		}
-		result = append(result, rowMap)
 	}
+	var total int64
+	query := querybuilder.Select{
+		Columns: []querybuilder.Projection{querybuilder.Count{As: "count"}},
+		From:    table.ref(),
+		Where:   where,
+	}
+	err := de.backend.Select(ctx, query, func(record map[string]interface{}) error {
+		var ok bool
+		if total, ok = record["count"].(int64); !ok {
+			return fmt.Errorf("unexpected count %#v", record["count"])
+		}
+		return nil
+	})
+	return total, err
+}
 
-	response := map[string]interface{}{
-		"response": map[string]interface{}{
-			"records": result,
-		},
+// selectRecords reads every record of query, decrypting encrypted columns.
+func (de *DbExplorer) selectRecords(ctx context.Context, table *Table, query querybuilder.Select) ([]map[string]interface{}, error) {
+	// The statements of a session depend on its settings, they aren't
+	// shared.
+	if de.cfg.CollapseReads && ctx.Value(sessionKey{}) == nil {
+		records, err := de.collapsedSelect(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if err := de.decryptValues(table.Name, record); err != nil {
+				return nil, err
+			}
+		}
+		return records, nil
 	}
-	json.NewEncoder(w).Encode(response)
+
+	var result []map[string]interface{}
+	err := de.backend.Select(ctx, query, func(record map[string]interface{}) error {
+		if err := de.decryptValues(table.Name, record); err != nil {
+			return err
+		}
+		result = append(result, record)
+		return nil
+	})
+	return result, err
 }
 
-func (de *DbExplorer) handlePutTable(w http.ResponseWriter, r *http.Request, tableName string) {
-	var data map[string]interface{}
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&data); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+// handleCreateRecord inserts a new row. Generated (serial/identity) columns
+// are never taken from the body and omitted columns get their defaults.
+// A JSON array body is handed to handleBulkInsert.
+func (de *DbExplorer) handleCreateRecord(w http.ResponseWriter, r *http.Request, table *Table) {
+	body, err := de.readBody(r)
+	if err != nil {
+		writeBodyError(w, err)
 		return
 	}
-
-	id, ok := data["id"]
+	if items, ok := body.([]interface{}); ok {
+		de.handleBulkInsert(w, r, table, items)
+		return
+	}
+	object, ok := body.(map[string]interface{})
 	if !ok {
-		http.Error(w, "Missing 'id' field", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "expected a JSON object or array")
 		return
 	}
 
-	setClauses := []string{}
-	values := []interface{}{}
-	for key, value := range data {
-		if key == "id" {
-			continue
-		}
-		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", key, len(values)+1))
-		values = append(values, value)
+	data, err := de.prepareInsert(r, table, object)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if err := de.encryptValues(table.Name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	values = append(values, id)
-
-	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", tableName, strings.Join(setClauses, ", "), len(values))
 
-	_, err := de.db.Exec(query, values...)
+	returned, err := de.backend.Insert(r.Context(), insertRecord(table, data))
+	if err == nil && len(returned) != 1 {
+		err = fmt.Errorf("%d rows returned", len(returned))
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating record: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error inserting record: %v", err), http.StatusInternalServerError)
 		return
 	}
+	key := recordKey(returned[0])
+	addRows(r.Context(), 1)
 
+	result := map[string]interface{}{"inserted": 1}
+	if len(table.PrimaryKey) > 0 {
+		result = make(map[string]interface{}, len(key))
+		for i, name := range table.PrimaryKey {
+			result[name] = key[i]
+		}
+	}
 	response := map[string]interface{}{
-		"response": map[string]interface{}{
-			"id": id,
-		},
+		"response": result,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// prepareInsert validates a record for insertion and applies the server-side
+// rules: generated columns are dropped and injected values are set.
+func (de *DbExplorer) prepareInsert(r *http.Request, table *Table, object map[string]interface{}) (map[string]interface{}, error) {
+	return de.prepareRecord(r, table, object, nil)
+}
 
-func (de *DbExplorer) handleGetRecord(w http.ResponseWriter, r *http.Request, tableName, id string) {
-	row := de.db.QueryRow("SELECT * FROM "+tableName+" WHERE id = $1", id)
-
-	columns, err := de.db.Query("SELECT column_name FROM information_schema.columns WHERE table_name = $1", tableName)
+// prepareRecord is prepareInsert for a record some columns of which are set
+// by the server, with values taken as they are.
+func (de *DbExplorer) prepareRecord(r *http.Request, table *Table, object map[string]interface{}, set map[string]interface{}) (map[string]interface{}, error) {
+	data, err := de.checkRecord(r, table, object)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	defer columns.Close()
+	return de.completeRecord(r, table, data, set)
+}
 
-	var columnNames []string
-	for columns.Next() {
-		var columnName string
-		if err := columns.Scan(&columnName); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+// completeRecord applies the server-side rules of prepareRecord to data
+// that is already checked.
+func (de *DbExplorer) completeRecord(r *http.Request, table *Table, data map[string]interface{}, set map[string]interface{}) (map[string]interface{}, error) {
+	for _, column := range table.Columns {
+		if column.Generated {
+			delete(data, column.Name)
 		}
-		columnNames = append(columnNames, columnName)
 	}
+	if err := de.injectValues(r, table, data); err != nil {
+		return nil, err
+	}
+	for column, value := range set {
+		data[column] = value
+	}
+	if err := checkRequired(table, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-	columnPointers := make([]interface{}, len(columnNames))
-	for i := range columnPointers {
-		columnPointers[i] = new(interface{})
+// insertRecord builds an INSERT for data in column order, returning the
+// primary key columns.
+func insertRecord(table *Table, data map[string]interface{}) querybuilder.Insert {
+	insert := querybuilder.Insert{Into: table.ref(), Returning: returningKey(table)}
+	var row []interface{}
+	for _, column := range table.Columns {
+		value, ok := data[column.Name]
+		if !ok {
+			continue
+		}
+		insert.Columns = append(insert.Columns, column.Name)
+		row = append(row, value)
 	}
+	insert.Rows = [][]interface{}{row}
+	return insert
+}
+
 
-	if err := row.Scan(columnPointers...); err == sql.ErrNoRows {
-		http.Error(w, `{"error": "record not found"}`, http.StatusNotFound)
+func (de *DbExplorer) handleGetRecord(w http.ResponseWriter, r *http.Request, table *Table, key recordKey) {
+	columnNames, err := table.selectFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	expand, err := de.parseExpand(r.URL.Query().Get("expand"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	plan, ok := de.resolveExpand(w, r, table, columnNames, expand)
+	if !ok {
 		return
-	} else if err != nil {
+	}
+	de.recordReadUsage(table, r.URL.Query(), columnNames, nil)
+	records, err := de.selectRecords(r.Context(), table, selectRecord(table, columnNames, key))
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	rowMap := make(map[string]interface{})
-	for i, colName := range columnNames {
-		val := *(columnPointers[i].(*interface{}))
-		rowMap[colName] = val
+	if len(records) == 0 {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	rowMap := records[0]
+	addRows(r.Context(), 1)
+	if err := de.expandRecords(r.Context(), []map[string]interface{}{rowMap}, plan); err != nil {
+		writeQueryError(w, err)
+		return
 	}
 
 	response := map[string]interface{}{
@@ -248,55 +637,112 @@ func (de *DbExplorer) handleGetRecord(w http.ResponseWriter, r *http.Request, ta
 			"record": rowMap,
 		},
 	}
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, response, acceptsXML(r))
 }
 
+// selectRecord reads columns of the record addressed by key. The SQL
+// doesn't depend on the key, so it can be prepared with a nil one.
+func selectRecord(table *Table, columns []string, key recordKey) querybuilder.Select {
+	return querybuilder.Select{
+		Columns: table.projections(columns),
+		From:    table.ref(),
+		Where:   keyCondition(table, key),
+	}
+}
 
-func (de *DbExplorer) handlePostRecord(w http.ResponseWriter, r *http.Request, tableName, id string) {
-	var data map[string]interface{}
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&data); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+func (de *DbExplorer) handlePostRecord(w http.ResponseWriter, r *http.Request, table *Table, key recordKey) {
+	body, err := de.readBody(r)
+	if err != nil {
+		writeBodyError(w, err)
 		return
 	}
-
-	keys := []string{}
-	placeholders := []string{}
-	values := []interface{}{}
-
-	for key, value := range data {
-		keys = append(keys, key)
-		placeholders = append(placeholders, fmt.Sprintf("$%d", len(values)+1))
-		values = append(values, value)
+	object, ok := body.(map[string]interface{})
+	if !ok {
+		writeError(w, http.StatusBadRequest, "expected a JSON object")
+		return
+	}
+	if de.hasChildren(table, object) {
+		de.handleNestedUpdate(w, r, table, key, object)
+		return
+	}
+	data, err := de.prepareUpdate(r, table, object)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if err := de.encryptValues(table.Name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, strings.Join(keys, ", "), strings.Join(placeholders, ", "))
-	_, err := de.db.Exec(query, values...)
+	affected, err := de.backend.Update(r.Context(), updateRecord(table, data, key))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting record: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error updating record: %v", err), http.StatusInternalServerError)
 		return
 	}
+	addRows(r.Context(), affected)
 
 	response := map[string]interface{}{
-		"response": "Record inserted successfully",
+		"response": map[string]interface{}{
+			"updated": affected,
+		},
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// prepareUpdate validates a partial record for an update: unknown columns and
+// primary key changes are rejected and injected values are set.
+func (de *DbExplorer) prepareUpdate(r *http.Request, table *Table, object map[string]interface{}) (map[string]interface{}, error) {
+	data, err := de.checkRecord(r, table, object)
+	if err != nil {
+		return nil, err
+	}
+	for _, pk := range table.PrimaryKey {
+		if _, ok := data[pk]; ok {
+			return nil, &fieldError{pk, fmt.Sprintf("primary key field %s can't be updated", pk)}
+		}
+	}
+	if err := de.injectValues(r, table, data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("no fields to update")
+	}
+	return data, nil
+}
+
+// updateRecord builds an UPDATE of the data columns for the row with the
+// given primary key.
+func updateRecord(table *Table, data map[string]interface{}, key recordKey) querybuilder.Update {
+	update := querybuilder.Update{Table: table.ref(), Where: keyCondition(table, key)}
+	for _, column := range table.Columns {
+		if value, ok := data[column.Name]; ok {
+			update.Set = append(update.Set, querybuilder.Assign{Column: column.Name, Value: value})
+		}
+	}
+	return update
+}
 
-func (de *DbExplorer) handleDeleteRecord(w http.ResponseWriter, r *http.Request, tableName, id string) {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", tableName)
-	_, err := de.db.Exec(query, id)
+func (de *DbExplorer) handleDeleteRecord(w http.ResponseWriter, r *http.Request, table *Table, key recordKey) {
+	affected, err := de.backend.Delete(r.Context(), querybuilder.Delete{From: table.ref(), Where: keyCondition(table, key)})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error deleting record: %v", err), http.StatusInternalServerError)
 		return
 	}
+	addRows(r.Context(), affected)
 
 	response := map[string]interface{}{
-		"response": "Record deleted successfully",
+		"response": map[string]interface{}{
+			"deleted": affected,
+		},
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": message})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const dbRoleHeader = "X-Db-Role"
+
+// DBRole is a database session a caller may pick per request with the
+// X-Db-Role header: the statements of the request then run in one
+// transaction with these settings, e.g. a reporting role with a longer
+// statement timeout next to the default one on the same endpoints.
+type DBRole struct {
+	// Role is the database role the statements run as.
+	Role string `json:"role"`
+	// Isolation is "read committed", "repeatable read" or "serializable";
+	// empty keeps the server default.
+	Isolation string `json:"isolation"`
+	// Settings are run-time parameters such as statement_timeout.
+	Settings map[string]string `json:"settings"`
+	// AllowedRoles are the roles of the callers that may pick it.
+	AllowedRoles []string `json:"allowed_roles"`
+}
+
+// checkDBRoles rejects database roles that could never apply.
+func checkDBRoles(roles map[string]DBRole) error {
+	for name, role := range roles {
+		switch role.Isolation {
+		case "", "read committed", "repeatable read", "serializable":
+		default:
+			return fmt.Errorf("db role %s: unknown isolation %q", name, role.Isolation)
+		}
+		if len(role.AllowedRoles) == 0 {
+			return fmt.Errorf("db role %s: no allowed roles", name)
+		}
+	}
+	return nil
+}
+
+// sessionOptions applies the role first, so the other settings are checked
+// against its privileges, then the settings by name.
+func (role DBRole) sessionOptions() sessionOptions {
+	options := sessionOptions{isolation: role.Isolation}
+	if role.Role != "" {
+		options.settings = append(options.settings, sessionSetting{"role", role.Role})
+	}
+	names := make([]string, 0, len(role.Settings))
+	for name := range role.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		options.settings = append(options.settings, sessionSetting{name, role.Settings[name]})
+	}
+	return options
+}
+
+// withDBRole runs next in the session of the database role named by the
+// X-Db-Role header, if any.
+func (de *DbExplorer) withDBRole(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(dbRoleHeader)
+		if name == "" {
+			next(w, r)
+			return
+		}
+		role, ok := de.cfg.DBRoles[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown db role %s", name))
+			return
+		}
+		id := identityFromRequest(r)
+		allowed := false
+		for _, allowedRole := range role.AllowedRoles {
+			allowed = allowed || id != nil && id.HasRole(allowedRole)
+		}
+		if !allowed {
+			audit("db_role_denied", r, map[string]interface{}{"db_role": name})
+			writeError(w, http.StatusForbidden, fmt.Sprintf("db role %s not allowed", name))
+			return
+		}
+		store, ok := de.backend.(sessioner)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, "the store doesn't support db roles")
+			return
+		}
+
+		ctx, tx, err := store.Session(r.Context(), role.sessionOptions())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sw := &sessionWriter{ResponseWriter: w, tx: tx}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			sw.commit = true
+		}
+		next(sw, r.WithContext(ctx))
+		sw.end(http.StatusOK)
+	}
+}
+
+// sessionWriter ends the transaction of a session. Changes are committed
+// before the response goes out, so a failed commit is reported instead of
+// the success; an error status rolls them back. Safe methods only read,
+// their transaction is rolled back once the handler is done, which lets a
+// stream keep reading after its first write.
+type sessionWriter struct {
+	http.ResponseWriter
+	tx     Tx
+	commit bool
+	ended  bool
+	failed bool
+}
+
+// end finishes the transaction for a response with status; it reports
+// whether the response may be written.
+func (sw *sessionWriter) end(status int) bool {
+	if sw.ended {
+		return !sw.failed
+	}
+	sw.ended = true
+	if !sw.commit || status >= http.StatusBadRequest {
+		sw.tx.Rollback()
+		return true
+	}
+	if err := sw.tx.Commit(); err != nil {
+		sw.failed = true
+		http.Error(sw.ResponseWriter, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (sw *sessionWriter) WriteHeader(status int) {
+	if sw.commit && !sw.end(status) {
+		return
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *sessionWriter) Write(data []byte) (int, error) {
+	if sw.commit && !sw.end(http.StatusOK) {
+		return len(data), nil
+	}
+	return sw.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func dbRoleExplorer(t *testing.T) (*DbExplorer, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	de := backendExplorer(newSQLStore(db, nil))
+	de.cfg.DBRoles = map[string]DBRole{
+		"reporting": {Role: "reporting", Settings: map[string]string{"statement_timeout": "60s"}, AllowedRoles: []string{"analyst"}},
+	}
+	return de, mock
+}
+
+func dbRoleRequest(method, path string, roles ...string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set(dbRoleHeader, "reporting")
+	return withIdentity(r, &Identity{Subject: "ann", Roles: roles})
+}
+
+func TestDBRoleSession(t *testing.T) {
+	de, mock := dbRoleExplorer(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("set_config").WithArgs("role", "reporting").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set_config").WithArgs("statement_timeout", "60s").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "memcache"))
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	de.withDBRole(de.route)(w, dbRoleRequest(http.MethodGet, "/items/7?fields=id,title", "analyst"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write commits before the response is sent.
+	mock.ExpectBegin()
+	mock.ExpectExec("set_config").WithArgs("role", "reporting").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set_config").WithArgs("statement_timeout", "60s").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(errSerialization{})
+
+	w = httptest.NewRecorder()
+	de.withDBRole(de.route)(w, dbRoleRequest(http.MethodDelete, "/items/7", "analyst"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type errSerialization struct{}
+
+func (errSerialization) Error() string { return "could not serialize access" }
+
+func TestDBRoleDenied(t *testing.T) {
+	de, mock := dbRoleExplorer(t)
+	unknown := dbRoleRequest(http.MethodGet, "/items", "analyst")
+	unknown.Header.Set(dbRoleHeader, "admin")
+	cases := []struct {
+		r      *http.Request
+		status int
+	}{
+		{dbRoleRequest(http.MethodGet, "/items", "viewer"), http.StatusForbidden},
+		{unknown, http.StatusBadRequest},
+	}
+
+	for _, item := range cases {
+		w := httptest.NewRecorder()
+		de.withDBRole(de.route)(w, item.r)
+		if w.Code != item.status {
+			t.Fatalf("results not match\nGot : %d\nWant: %d", w.Code, item.status)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBRoleSessionOptions(t *testing.T) {
+	role := DBRole{Role: "reporting", Isolation: "repeatable read", Settings: map[string]string{"work_mem": "64MB", "statement_timeout": "60s"}}
+	want := sessionOptions{isolation: "repeatable read", settings: []sessionSetting{
+		{"role", "reporting"}, {"statement_timeout", "60s"}, {"work_mem", "64MB"},
+	}}
+	if got := role.sessionOptions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Deprecation announces that a table or route of Config.Deprecations is
+// going away. Its requests are still served, with Deprecation, Sunset and
+// Link headers (RFC 9745, RFC 8594) and a Warning telling what is ending.
+type Deprecation struct {
+	// Since is when it was deprecated, a date such as "2024-01-31" or an
+	// RFC 3339 time; without it the Deprecation header is "true".
+	Since string `json:"since"`
+	// Sunset is when it stops being served, in the same forms.
+	Sunset string `json:"sunset"`
+	// Link points to the notes on moving off it.
+	Link string `json:"link"`
+	// Message is the warning text; by default it names what is deprecated
+	// and its sunset.
+	Message string `json:"message"`
+}
+
+// parseDateTime reads a date such as "2024-01-31", which stands for its
+// midnight UTC, or an RFC 3339 time.
+func parseDateTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// checkDeprecations rejects entries whose dates can't be read, which would
+// otherwise go out without their headers.
+func checkDeprecations(deprecations map[string]Deprecation) error {
+	for name, deprecation := range deprecations {
+		for _, value := range []string{deprecation.Since, deprecation.Sunset} {
+			if value == "" {
+				continue
+			}
+			if _, err := parseDateTime(value); err != nil {
+				return fmt.Errorf("deprecation %s: %q is neither a date nor an RFC 3339 time", name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// deprecation returns the entry of Config.Deprecations covering the request
+// path of parts and what it covers: the longest route key ("/_query",
+// "/items/_search") the path is or is under, else the table the path is
+// in.
+func (de *DbExplorer) deprecation(parts []string) (string, Deprecation, bool) {
+	path := "/" + strings.Join(parts, "/")
+	name := ""
+	for key := range de.cfg.Deprecations {
+		if !strings.HasPrefix(key, "/") || len(key) <= len(name) {
+			continue
+		}
+		route := strings.TrimRight(key, "/")
+		if path == route || strings.HasPrefix(path, route+"/") {
+			name = key
+		}
+	}
+	if name == "" && len(parts) > 0 && !strings.HasPrefix(parts[0], "_") {
+		name = parts[0]
+	}
+	deprecation, ok := de.cfg.Deprecations[name]
+	return name, deprecation, ok
+}
+
+// announceDeprecation sets the deprecation headers on responses to a
+// deprecated table or route.
+func (de *DbExplorer) announceDeprecation(w http.ResponseWriter, parts []string) {
+	name, deprecation, ok := de.deprecation(parts)
+	if !ok {
+		return
+	}
+	header := w.Header()
+	header.Set("Deprecation", "true")
+	if since, err := parseDateTime(deprecation.Since); err == nil {
+		header.Set("Deprecation", fmt.Sprintf("@%d", since.Unix()))
+	}
+	message := deprecation.Message
+	if message == "" {
+		message = fmt.Sprintf("%s is deprecated", name)
+	}
+	if sunset, err := parseDateTime(deprecation.Sunset); err == nil {
+		header.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		if deprecation.Message == "" {
+			message += " and will be removed on " + sunset.UTC().Format("2006-01-02")
+		}
+	}
+	if deprecation.Link != "" {
+		header.Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", deprecation.Link))
+	}
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(message)
+	header.Add("Warning", fmt.Sprintf("299 - \"%s\"", quoted))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeprecationHeaders(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	de.cfg.Deprecations = map[string]Deprecation{
+		"order_items":    {Since: "2024-01-31", Sunset: "2024-06-30", Link: "https://example.com/migrate"},
+		"/items/_search": {Message: "use ?q= on /items instead"},
+	}
+	if err := checkDeprecations(de.cfg.Deprecations); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path                            string
+		deprecation, sunset, link, warn string
+	}{
+		{"/order_items/1", "@1706659200", "Sun, 30 Jun 2024 00:00:00 GMT", `<https://example.com/migrate>; rel="deprecation"`, `299 - "order_items is deprecated and will be removed on 2024-06-30"`},
+		{"/items/_search?q=go", "true", "", "", `299 - "use ?q= on /items instead"`},
+		{"/items", "", "", "", ""},
+		{"/_queries", "", "", "", ""},
+	}
+	for _, item := range cases {
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, item.path, nil))
+		header := w.Header()
+		got := []string{header.Get("Deprecation"), header.Get("Sunset"), header.Get("Link"), header.Get("Warning")}
+		want := []string{item.deprecation, item.sunset, item.link, item.warn}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("[%s] results not match\nGot : %q\nWant: %q", item.path, got, want)
+			}
+		}
+	}
+
+	if err := checkDeprecations(map[string]Deprecation{"items": {Sunset: "next year"}}); err == nil {
+		t.Fatal("results not match\nGot : nil\nWant: an error for an unreadable sunset")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// handleDistinct serves GET /{table}/_distinct/{column}, the unique values of
+// a column in ascending order, e.g. to fill a filter dropdown. With
+// ?counts=true each value comes with the number of records holding it.
+// Pagination and column filters work as in the table listing.
+func (de *DbExplorer) handleDistinct(w http.ResponseWriter, r *http.Request, table *Table, name string) {
+	column, ok := table.Column(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown column")
+		return
+	}
+	// Encrypted values are randomized, every one of them is distinct.
+	if de.isEncrypted(table.Name, column.Name) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("encrypted column %s has no distinct values", column.Name))
+		return
+	}
+
+	params := r.URL.Query()
+	withCounts := false
+	if raw := params.Get("counts"); raw != "" {
+		switch raw {
+		case "true":
+			withCounts = true
+		case "false":
+		default:
+			writeError(w, http.StatusBadRequest, "counts must be true or false")
+			return
+		}
+	}
+	params.Del("counts")
+
+	limit, offset, err := pagination(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filters, err := de.whereClause(table, params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := querybuilder.Select{
+		Columns: []querybuilder.Projection{querybuilder.Col(column.Name), querybuilder.Count{As: "_count"}},
+		From:    table.ref(),
+		Where:   filters,
+		GroupBy: []string{column.Name},
+		OrderBy: []querybuilder.Sort{{Column: column.Name}},
+		Page:    &querybuilder.Page{Limit: limit, Offset: offset},
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := de.checkQueryCost(ctx, query); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	values := []interface{}{}
+	err = de.backend.Select(ctx, query, func(record map[string]interface{}) error {
+		if withCounts {
+			values = append(values, map[string]interface{}{"value": record[column.Name], "count": record["_count"]})
+		} else {
+			values = append(values, record[column.Name])
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), int64(len(values)))
+
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"values": values,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
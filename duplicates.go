@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// The strategies of ?on_duplicate= for the rows of an import that duplicate
+// a unique key of the table.
+const (
+	// duplicateFail fails the import, or its batch, as any other error.
+	duplicateFail = "fail"
+	// duplicateSkip keeps the existing row.
+	duplicateSkip = "skip"
+	// duplicateUpdate sets the imported columns on the existing row.
+	duplicateUpdate = "update"
+)
+
+// onDuplicate reads ?on_duplicate=, which defaults to failing.
+func onDuplicate(r *http.Request) (string, error) {
+	switch raw := r.URL.Query().Get("on_duplicate"); raw {
+	case "":
+		return duplicateFail, nil
+	case duplicateFail, duplicateSkip, duplicateUpdate:
+		return raw, nil
+	}
+	return "", errors.New("on_duplicate must be skip, update or fail")
+}
+
+// duplicateCounts tells what became of the rows of an import that resolves
+// duplicates.
+type duplicateCounts struct {
+	inserted, updated, skipped int64
+}
+
+func (c *duplicateCounts) add(other duplicateCounts) {
+	c.inserted += other.inserted
+	c.updated += other.updated
+	c.skipped += other.skipped
+}
+
+// conflictClause resolves the duplicates of an insert of columns with
+// strategy. Skipping needs no key: a row is skipped whichever unique key it
+// duplicates. Updating needs the key the duplicates are found by: the
+// primary key, or else the first unique constraint, whose columns are all
+// imported.
+func conflictClause(table *Table, columns []string, strategy string) (*querybuilder.OnConflict, error) {
+	if strategy == duplicateSkip {
+		return &querybuilder.OnConflict{}, nil
+	}
+	keys := [][]string{table.PrimaryKey}
+	for _, unique := range table.UniqueKeys {
+		keys = append(keys, unique.Columns)
+	}
+	for _, key := range keys {
+		if len(key) == 0 || !containsAll(columns, key) {
+			continue
+		}
+		conflict := &querybuilder.OnConflict{Columns: key}
+		for _, column := range columns {
+			if !containsString(key, column) {
+				conflict.Update = append(conflict.Update, column)
+			}
+		}
+		if len(conflict.Update) == 0 {
+			// Nothing to update: the row is the key.
+			conflict.Columns = nil
+		}
+		return conflict, nil
+	}
+	return nil, &importError{fmt.Sprintf("on_duplicate=update needs every column of a unique key of %s", table.Name)}
+}
+
+func containsAll(values, wanted []string) bool {
+	for _, value := range wanted {
+		if !containsString(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// upsertRecords inserts records like insertRecords, resolving duplicates
+// with strategy, and counts the rows inserted, updated and skipped.
+func upsertRecords(ctx context.Context, tx Tx, table *Table, records []map[string]interface{}, strategy string) (duplicateCounts, error) {
+	columns := bulkColumns(table, records)
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	conflict, err := conflictClause(table, names, strategy)
+	if err != nil {
+		return duplicateCounts{}, err
+	}
+	perStatement := 1
+	if len(columns) > 0 {
+		perStatement = maxBulkParams / len(columns)
+	}
+
+	var counts duplicateCounts
+	for start := 0; start < len(records); start += perStatement {
+		end := start + perStatement
+		if end > len(records) {
+			end = len(records)
+		}
+		insert := bulkInsert(table, columns, records[start:end])
+		insert.OnConflict = conflict
+		insert.Returning = []querybuilder.Projection{querybuilder.Inserted{As: "inserted"}}
+		returned, err := tx.Insert(ctx, insert)
+		if err != nil {
+			return duplicateCounts{}, err
+		}
+		// Skipped rows return nothing.
+		for _, row := range returned {
+			if inserted, _ := row[0].(bool); inserted {
+				counts.inserted++
+			} else {
+				counts.updated++
+			}
+		}
+		counts.skipped += int64(end-start) - int64(len(returned))
+	}
+	return counts, nil
+}
+
+// upsertRows loads the rows of next, values of columns, in one transaction
+// as COPY would, resolving duplicates with strategy.
+func (de *DbExplorer) upsertRows(ctx context.Context, table *Table, columns []string, next func() ([]interface{}, error), strategy string) (duplicateCounts, error) {
+	tx, err := de.backend.Begin(ctx)
+	if err != nil {
+		return duplicateCounts{}, err
+	}
+	defer tx.Rollback()
+
+	size := maxBulkParams
+	if len(columns) > 0 {
+		size /= len(columns)
+	}
+	var counts duplicateCounts
+	for done := false; !done; {
+		records := make([]map[string]interface{}, 0, size)
+		for len(records) < size {
+			row, err := next()
+			if err != nil {
+				return duplicateCounts{}, err
+			}
+			if row == nil {
+				done = true
+				break
+			}
+			record := make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				record[column] = row[i]
+			}
+			records = append(records, record)
+		}
+		if len(records) == 0 {
+			break
+		}
+		batch, err := upsertRecords(ctx, tx, table, records, strategy)
+		if err != nil {
+			return duplicateCounts{}, err
+		}
+		counts.add(batch)
+	}
+	return counts, tx.Commit()
+}
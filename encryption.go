@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks values written by the explorer, so rows stored before
+// a column was configured for encryption are still returned as is.
+const encryptedPrefix = "enc:v1:"
+
+// newFieldCipher builds the AES-GCM cipher from a secret reference (see
+// resolveSecret). The key itself must be 32 base64-encoded bytes.
+func newFieldCipher(keyRef string) (cipher.AEAD, error) {
+	if keyRef == "" {
+		return nil, errors.New("encryption_key is not configured")
+	}
+	raw, err := resolveSecret(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (de *DbExplorer) isEncrypted(tableName, column string) bool {
+	for _, c := range de.cfg.Encrypt[tableName] {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptValues replaces configured columns in data with their ciphertext.
+func (de *DbExplorer) encryptValues(tableName string, data map[string]interface{}) error {
+	for column, value := range data {
+		if value == nil || !de.isEncrypted(tableName, column) {
+			continue
+		}
+		plain, ok := value.(string)
+		if !ok {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			plain = string(encoded)
+		}
+		nonce := make([]byte, de.cipher.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		sealed := de.cipher.Seal(nonce, nonce, []byte(plain), []byte(tableName+"."+column))
+		data[column] = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+	return nil
+}
+
+// decryptValues reverses encryptValues on a scanned row.
+func (de *DbExplorer) decryptValues(tableName string, row map[string]interface{}) error {
+	for column, value := range row {
+		if !de.isEncrypted(tableName, column) {
+			continue
+		}
+		var stored string
+		switch v := value.(type) {
+		case string:
+			stored = v
+		case []byte:
+			stored = string(v)
+		default:
+			continue
+		}
+		if !strings.HasPrefix(stored, encryptedPrefix) {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+		if err != nil {
+			return err
+		}
+		nonceSize := de.cipher.NonceSize()
+		if len(sealed) < nonceSize {
+			return fmt.Errorf("%s: ciphertext too short", column)
+		}
+		plain, err := de.cipher.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(tableName+"."+column))
+		if err != nil {
+			return fmt.Errorf("%s: %v", column, err)
+		}
+		row[column] = string(plain)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestFieldEncryptionRoundTrip(t *testing.T) {
+	t.Setenv("TEST_EXPLORER_KEY", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	aead, err := newFieldCipher("env:TEST_EXPLORER_KEY")
+	if err != nil {
+		t.Fatalf("error creating cipher: %v", err)
+	}
+	de := &DbExplorer{
+		cfg:    &Config{Encrypt: map[string][]string{"users": {"email"}}},
+		cipher: aead,
+	}
+
+	row := map[string]interface{}{"email": "rvasily@example.com", "login": "rvasily"}
+	if err := de.encryptValues("users", row); err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	if !strings.HasPrefix(row["email"].(string), encryptedPrefix) || row["login"] != "rvasily" {
+		t.Fatalf("unexpected encrypted row: %#v", row)
+	}
+
+	row["email"] = []byte(row["email"].(string))
+	if err := de.decryptValues("users", row); err != nil {
+		t.Fatalf("error decrypting: %v", err)
+	}
+	if row["email"] != "rvasily@example.com" {
+		t.Fatalf("expected decrypted email, got %#v", row["email"])
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// expansion is the tree of relations to embed, keyed by foreign key column:
+// ?expand=author,post.category is {author: {}, post: {category: {}}}.
+type expansion map[string]expansion
+
+// parseExpand reads ?expand=, checking the depth of every path against the
+// limits.
+func (de *DbExplorer) parseExpand(raw string) (expansion, error) {
+	tree := expansion{}
+	if raw == "" {
+		return tree, nil
+	}
+	for _, path := range strings.Split(raw, ",") {
+		segments := strings.Split(path, ".")
+		if err := de.checkExpandDepth(len(segments)); err != nil {
+			return nil, err
+		}
+		node := tree
+		for _, segment := range segments {
+			child, ok := node[segment]
+			if !ok {
+				child = expansion{}
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	return tree, nil
+}
+
+// expandPlan is an expansion as resolveExpand checked it: every relation,
+// in column order, with its foreign key and the table it references in the
+// snapshot of the request.
+type expandPlan []expandStep
+
+type expandStep struct {
+	column string
+	fk     *ForeignKey
+	ref    *Table
+	inner  expandPlan
+}
+
+// resolveExpand checks every relation of tree: the column of table must be
+// a single-column foreign key, selected by fields, and the caller must be
+// allowed to read the referenced table. It answers the request itself and
+// returns false when a check fails.
+func (de *DbExplorer) resolveExpand(w http.ResponseWriter, r *http.Request, table *Table, fields []string, tree expansion) (expandPlan, bool) {
+	var plan expandPlan
+	for _, column := range sortedKeys(tree) {
+		fk, ok := table.foreignKey(column)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expand %s: not a foreign key of %s", column, table.Name))
+			return nil, false
+		}
+		if fields != nil && !containsString(fields, column) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("fields must include %s to expand it", column))
+			return nil, false
+		}
+		ref, ok := de.requestSchema(r.Context()).Tables[fk.RefTable]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expand %s: unknown table %s", column, fk.RefTable))
+			return nil, false
+		}
+		if !de.authorize(w, r, ref, actionRead) {
+			return nil, false
+		}
+		inner, ok := de.resolveExpand(w, r, ref, nil, tree[column])
+		if !ok {
+			return nil, false
+		}
+		plan = append(plan, expandStep{column: column, fk: fk, ref: ref, inner: inner})
+	}
+	return plan, true
+}
+
+// expandRecords replaces the foreign key values of records by the records
+// they reference, level by level. Each relation costs one query for all
+// records instead of one per record. A reference that isn't found keeps
+// its raw value.
+func (de *DbExplorer) expandRecords(ctx context.Context, records []map[string]interface{}, plan expandPlan) error {
+	for _, step := range plan {
+		column, fk, ref := step.column, step.fk, step.ref
+
+		var values []interface{}
+		seen := make(map[string]bool)
+		for _, record := range records {
+			value := record[column]
+			if value == nil || seen[referenceKey(value)] {
+				continue
+			}
+			seen[referenceKey(value)] = true
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		query := querybuilder.Select{
+			Columns: ref.projections(ref.ColumnNames()),
+			From:    ref.ref(),
+			Where:   querybuilder.In{Column: fk.RefColumns[0], Values: values},
+		}
+		if err := de.checkQueryCost(ctx, query); err != nil {
+			return err
+		}
+		related, err := de.selectRecords(ctx, ref, query)
+		if err != nil {
+			return err
+		}
+		addRows(ctx, int64(len(related)))
+		if err := de.expandRecords(ctx, related, step.inner); err != nil {
+			return err
+		}
+
+		byKey := make(map[string]map[string]interface{}, len(related))
+		for _, record := range related {
+			byKey[referenceKey(record[fk.RefColumns[0]])] = record
+		}
+		for _, record := range records {
+			if value := record[column]; value != nil {
+				if embedded, ok := byKey[referenceKey(value)]; ok {
+					record[column] = embedded
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// referenceKey compares key values of both sides of a reference, which may
+// be scanned as different types.
+func referenceKey(value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+func sortedKeys(tree expansion) []string {
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+func TestParseExpand(t *testing.T) {
+	de := &DbExplorer{cfg: &Config{Limits: Limits{MaxExpandDepth: 2}}}
+
+	tree, err := de.parseExpand("author,post.category,post.author")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := expansion{
+		"author": expansion{},
+		"post":   expansion{"category": expansion{}, "author": expansion{}},
+	}
+	if !reflect.DeepEqual(tree, expected) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", tree, expected)
+	}
+
+	if _, err := de.parseExpand("post.author.company"); err == nil || err.Error() != "expansion depth 3 exceeds limit 2" {
+		t.Fatalf("expected depth limit error, got %v", err)
+	}
+	if referenceKey([]byte("42")) != referenceKey(int64(42)) {
+		t.Fatalf("reference keys of text and integer values must match")
+	}
+}
+
+func TestChildReference(t *testing.T) {
+	posts := &Table{Name: "posts", PrimaryKey: []string{"id"}}
+	comments := &Table{Name: "comments", ForeignKeys: []*ForeignKey{
+		{Name: "comments_post_id_fkey", Columns: []string{"post_id"}, RefTable: "posts", RefColumns: []string{"id"}},
+	}}
+	fk, ok, err := childReference(posts, comments)
+	if err != nil || !ok || fk.Columns[0] != "post_id" {
+		t.Fatalf("results not match\nGot : %#v %v %v", fk, ok, err)
+	}
+	if _, ok, _ := childReference(comments, posts); ok {
+		t.Fatalf("posts doesn't reference comments")
+	}
+
+	comments.ForeignKeys = append(comments.ForeignKeys,
+		&ForeignKey{Name: "comments_reply_to_fkey", Columns: []string{"reply_to"}, RefTable: "posts", RefColumns: []string{"id"}})
+	if _, _, err := childReference(posts, comments); err == nil || err.Error() != "comments references posts more than once" {
+		t.Fatalf("expected ambiguity error, got %v", err)
+	}
+}
+
+// reloadingStore reloads the schema of the explorer when the first query
+// runs, as a refresh racing a request would.
+type reloadingStore struct {
+	*memDB
+	reload sync.Once
+	de     *DbExplorer
+}
+
+func (s *reloadingStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	s.reload.Do(func() {
+		schema := fuzzSchema()
+		delete(schema.Tables, "items")
+		s.de.schema.Store(schema)
+	})
+	return s.memDB.Select(ctx, query, each)
+}
+
+func TestExpandRequestSchema(t *testing.T) {
+	ctx := context.Background()
+	schema := fuzzSchema()
+	backend := &reloadingStore{memDB: newMemDB(schema.Tables["items"], schema.Tables["order_items"])}
+	backend.Insert(ctx, querybuilder.Insert{Into: querybuilder.Table{Name: "items"}, Columns: []string{"title"}, Rows: [][]interface{}{{"memcache"}}})
+	backend.Insert(ctx, querybuilder.Insert{Into: querybuilder.Table{Name: "order_items"}, Columns: []string{"order_id", "line", "item_id"}, Rows: [][]interface{}{{1, 1, 1}}})
+	de := backendExplorer(backend)
+	backend.de = de
+
+	// items is dropped once the order items are read: the expansion still
+	// reads it from the schema the request started with.
+	r := httptest.NewRequest(http.MethodGet, "/order_items?expand=item_id&fields=item_id", nil)
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	want := `{"response":{"records":[{"item_id":{"created":null,"extra":null,"id":1,"price":null,"title":"memcache"}}]}}` + "\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %s", w.Code, w.Body, want)
+	}
+	if _, ok := de.snapshot().Tables["items"]; ok {
+		t.Fatalf("expected the schema to be reloaded during the request")
+	}
+}
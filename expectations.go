@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SchemaManifest declares the tables and columns a deployment relies on.
+type SchemaManifest struct {
+	Tables map[string][]string `json:"tables"`
+}
+
+func loadSchemaManifest(path string) (*SchemaManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SchemaManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("parsing schema manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// schemaDrift lists every table or column from the manifest missing in
+// schema.
+func schemaDrift(schema *Schema, manifest *SchemaManifest) []string {
+	var drift []string
+	for table, columns := range manifest.Tables {
+		loaded, ok := schema.Tables[table]
+		if !ok {
+			drift = append(drift, fmt.Sprintf("missing table %s", table))
+			continue
+		}
+		for _, column := range columns {
+			if _, ok := loaded.Column(column); !ok {
+				drift = append(drift, fmt.Sprintf("missing column %s.%s", table, column))
+			}
+		}
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+// checkSchemaManifest validates the schema at startup. In "fail" mode any
+// drift prevents the explorer from starting; otherwise it is only recorded
+// and reported by /_schema/status.
+func (de *DbExplorer) checkSchemaManifest() error {
+	if de.cfg.SchemaManifest == "" {
+		return nil
+	}
+	manifest, err := loadSchemaManifest(de.cfg.SchemaManifest)
+	if err != nil {
+		return err
+	}
+	de.drift = schemaDrift(de.snapshot(), manifest)
+	if len(de.drift) > 0 && de.cfg.SchemaDriftMode == "fail" {
+		return fmt.Errorf("schema does not match manifest: %s", strings.Join(de.drift, ", "))
+	}
+	return nil
+}
+
+func (de *DbExplorer) handleSchemaStatus(w http.ResponseWriter, r *http.Request) {
+	drift := de.drift
+	if drift == nil {
+		drift = []string{}
+	}
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"manifest": de.cfg.SchemaManifest != "",
+			"ok":       len(drift) == 0,
+			"drift":    drift,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, manifest string) string {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSchemaManifest(t *testing.T) {
+	manifest := writeManifest(t, `{"tables": {
+		"items": ["id", "title", "sku"],
+		"order_items": ["order_id", "line"],
+		"invoices": ["id"]
+	}}`)
+
+	// Drift is reported, and the explorer starts anyway.
+	de := backendExplorer(&fakeStore{})
+	de.cfg.SchemaManifest = manifest
+	if err := de.checkSchemaManifest(); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_schema/status", nil))
+	want := `{"response":{"drift":["missing column items.sku","missing table invoices"],"manifest":true,"ok":false}}`
+	if w.Code != http.StatusOK || w.Body.String() != want+"\n" {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %s", w.Code, w.Body, want)
+	}
+
+	// In fail mode it keeps the explorer from starting.
+	de.cfg.SchemaDriftMode = "fail"
+	err := de.checkSchemaManifest()
+	if err == nil || !strings.Contains(err.Error(), "missing column items.sku, missing table invoices") {
+		t.Fatalf("results not match\nGot : %v\nWant: the drift", err)
+	}
+
+	// A schema matching the manifest is ok.
+	de = backendExplorer(&fakeStore{})
+	de.cfg.SchemaManifest = writeManifest(t, `{"tables": {"items": ["id", "title"]}}`)
+	de.cfg.SchemaDriftMode = "fail"
+	if err := de.checkSchemaManifest(); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_schema/status", nil))
+	want = `{"response":{"drift":[],"manifest":true,"ok":true}}`
+	if w.Body.String() != want+"\n" {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", w.Body, want)
+	}
+
+	de.cfg.SchemaManifest = writeManifest(t, `{"tables": ["items"]}`)
+	if err := de.checkSchemaManifest(); err == nil || !strings.Contains(err.Error(), "parsing schema manifest") {
+		t.Fatalf("results not match\nGot : %v\nWant: a parse error", err)
+	}
+}
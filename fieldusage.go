@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// fieldUsage counts, per table, the reads of this replica and the columns
+// they select, filter and order on, see Config.FieldUsage. Only names are
+// counted, never values.
+type fieldUsage struct {
+	mu     sync.Mutex
+	since  time.Time
+	tables map[string]*tableUsage
+}
+
+type tableUsage struct {
+	reads int64
+	// allFields counts the reads without ?fields=, which return every
+	// column.
+	allFields int64
+	columns   map[string]*columnUsage
+}
+
+type columnUsage struct {
+	Name     string `json:"name"`
+	Selected int64  `json:"selected"`
+	Filtered int64  `json:"filtered"`
+	Ordered  int64  `json:"ordered"`
+}
+
+func newFieldUsage() *fieldUsage {
+	return &fieldUsage{since: time.Now().UTC(), tables: make(map[string]*tableUsage)}
+}
+
+// record counts a read of table. selected is nil for a read of every
+// column; names that aren't columns of table are left out.
+func (u *fieldUsage) record(table *Table, selected, filtered, ordered []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	usage, ok := u.tables[table.Name]
+	if !ok {
+		usage = &tableUsage{columns: make(map[string]*columnUsage)}
+		u.tables[table.Name] = usage
+	}
+	usage.reads++
+	if selected == nil {
+		usage.allFields++
+	}
+	count := func(names []string, counter func(*columnUsage) *int64) {
+		for _, name := range names {
+			if _, ok := table.Column(name); !ok {
+				continue
+			}
+			column, ok := usage.columns[name]
+			if !ok {
+				column = &columnUsage{Name: name}
+				usage.columns[name] = column
+			}
+			*counter(column)++
+		}
+	}
+	count(selected, func(c *columnUsage) *int64 { return &c.Selected })
+	count(filtered, func(c *columnUsage) *int64 { return &c.Filtered })
+	count(ordered, func(c *columnUsage) *int64 { return &c.Ordered })
+}
+
+// recordReadUsage counts a read of table returning fields, filtered by the
+// filter parameters of params and ordered by terms, when Config.FieldUsage
+// is set.
+func (de *DbExplorer) recordReadUsage(table *Table, params url.Values, fields []string, terms []querybuilder.Sort) {
+	if de.fieldUsage == nil {
+		return
+	}
+	var selected, filtered, ordered []string
+	if params.Get("fields") != "" {
+		selected = fields
+	}
+	for name := range params {
+		if !isReservedParam(name) {
+			filtered = append(filtered, name)
+		}
+	}
+	for _, term := range terms {
+		ordered = append(ordered, term.Column)
+	}
+	de.fieldUsage.record(table, selected, filtered, ordered)
+}
+
+// handleFieldUsage serves GET /_admin/field_usage, how often each table of
+// the schema served was read and each of its columns selected, filtered or
+// ordered on since the replica started, zeros included: a column no read
+// names while every read picks its fields is one clients don't rely on.
+func (de *DbExplorer) handleFieldUsage(w http.ResponseWriter, r *http.Request) {
+	if de.fieldUsage == nil {
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+		return
+	}
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	schema := de.requestSchema(r.Context())
+	u := de.fieldUsage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	tables := make([]map[string]interface{}, 0, len(schema.Tables))
+	for _, name := range schema.TableNames() {
+		table := schema.Tables[name]
+		usage, ok := u.tables[name]
+		if !ok {
+			usage = &tableUsage{}
+		}
+		columns := make([]columnUsage, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = columnUsage{Name: column.Name}
+			if counted, ok := usage.columns[column.Name]; ok {
+				columns[i] = *counted
+			}
+		}
+		tables = append(tables, map[string]interface{}{
+			"table":      name,
+			"reads":      usage.reads,
+			"all_fields": usage.allFields,
+			"columns":    columns,
+		})
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"since":  u.since,
+			"tables": tables,
+		},
+	}, false)
+}
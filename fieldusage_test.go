@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFieldUsage(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	de.fieldUsage = newFieldUsage()
+
+	for _, path := range []string{
+		"/items?fields=id,title&title=eq.x&order=id.desc",
+		"/items?fields=id",
+		"/items",
+		"/items/1?fields=title",
+	} {
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d", path, w.Code, w.Body, http.StatusOK)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_admin/field_usage", nil))
+	var report struct {
+		Response struct {
+			Tables []struct {
+				Table     string        `json:"table"`
+				Reads     int64         `json:"reads"`
+				AllFields int64         `json:"all_fields"`
+				Columns   []columnUsage `json:"columns"`
+			} `json:"tables"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("results not match\nGot : %d %s\nWant: a report", w.Code, w.Body)
+	}
+	for _, table := range report.Response.Tables {
+		if table.Table != "items" {
+			if table.Reads != 0 {
+				t.Fatalf("results not match\nGot : %+v\nWant: no reads of %s", table, table.Table)
+			}
+			continue
+		}
+		counts := map[string]columnUsage{}
+		for _, column := range table.Columns {
+			counts[column.Name] = column
+		}
+		want := map[string]columnUsage{
+			"id":    {Name: "id", Selected: 2, Ordered: 1},
+			"title": {Name: "title", Selected: 2, Filtered: 1},
+			"price": {Name: "price"},
+		}
+		for name, usage := range want {
+			if !reflect.DeepEqual(counts[name], usage) {
+				t.Fatalf("results not match\nGot : %+v\nWant: %+v", counts[name], usage)
+			}
+		}
+		if table.Reads != 4 || table.AllFields != 1 {
+			t.Fatalf("results not match\nGot : %d reads, %d of every column\nWant: 4 reads, 1 of every column", table.Reads, table.AllFields)
+		}
+	}
+
+	de.fieldUsage = nil
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_admin/field_usage", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusNotFound)
+	}
+}
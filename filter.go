@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// isReservedParam reports whether a query parameter controls the listing
+// itself rather than filtering on a column.
+func isReservedParam(name string) bool {
+	switch name {
+	case "limit", "offset", "key", "order", "fields", "count", "cursor", "expand", "format", "checksum", "bbox":
+		return true
+	}
+	return false
+}
+
+// pagination reads ?limit= and ?offset=, 100 and 0 by default.
+func pagination(query url.Values) (int, int, error) {
+	limit, offset := 100, 0
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid limit")
+		}
+		limit = n
+	}
+	if raw := query.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset")
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// countMode reads whether a listing should report its total: "exact" for
+// ?count=true or Prefer: count=exact, "estimated" for ?count=estimated or
+// Prefer: count=estimated, "" otherwise.
+func countMode(r *http.Request) (string, error) {
+	switch r.URL.Query().Get("count") {
+	case "":
+	case "true", "exact":
+		return "exact", nil
+	case "estimated":
+		return "estimated", nil
+	case "false":
+		return "", nil
+	default:
+		return "", fmt.Errorf("count must be true, exact, estimated or false")
+	}
+	for _, preference := range strings.Split(r.Header.Get("Prefer"), ",") {
+		switch strings.TrimSpace(preference) {
+		case "count=exact":
+			return "exact", nil
+		case "count=estimated":
+			return "estimated", nil
+		}
+	}
+	return "", nil
+}
+
+// filterOperator maps a comparison operator to SQL; in and is are handled
+// separately.
+func filterOperator(op string) (querybuilder.Op, bool) {
+	switch op {
+	case "eq":
+		return querybuilder.Eq, true
+	case "neq":
+		return querybuilder.Neq, true
+	case "gt":
+		return querybuilder.Gt, true
+	case "gte":
+		return querybuilder.Gte, true
+	case "lt":
+		return querybuilder.Lt, true
+	case "lte":
+		return querybuilder.Lte, true
+	case "like":
+		return querybuilder.Like, true
+	case "ilike":
+		return querybuilder.ILike, true
+	}
+	return "", false
+}
+
+// whereClause compiles filter parameters such as ?title=eq.memcache&age=gt.30
+// &updated=is.null into conditions. Operators are eq, neq, gt, gte, lt, lte,
+// like and ilike (with * as the wildcard), in.(a,b) and is.null, is.true or
+// is.false. Conditions on the same column are combined with AND. ?bbox=
+// adds a spatial filter, see bboxCondition.
+func (de *DbExplorer) whereClause(table *Table, query url.Values) (querybuilder.And, error) {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		if !isReservedParam(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var conditions querybuilder.And
+	for _, name := range names {
+		column, ok := table.Column(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter column %s", name)
+		}
+		for _, raw := range query[name] {
+			op, operand, ok := strings.Cut(raw, ".")
+			if !ok {
+				return nil, fmt.Errorf("filter %s: expected operator.value", name)
+			}
+
+			if op == "is" {
+				switch operand {
+				case "null":
+					conditions = append(conditions, querybuilder.IsNull{Column: column.Name})
+				case "true", "false":
+					if columnKind(column.DataType) != "bool" {
+						return nil, fmt.Errorf("filter %s: is.%s needs a boolean column", name, operand)
+					}
+					conditions = append(conditions, querybuilder.IsBool{Column: column.Name, Value: operand == "true"})
+				default:
+					return nil, fmt.Errorf("filter %s: is takes null, true or false", name)
+				}
+				continue
+			}
+
+			// Encrypted values are randomized, comparing them is meaningless.
+			if de.isEncrypted(table.Name, column.Name) {
+				return nil, fmt.Errorf("filter %s: encrypted columns only support is.null", name)
+			}
+
+			if op == "in" {
+				if !strings.HasPrefix(operand, "(") || !strings.HasSuffix(operand, ")") {
+					return nil, fmt.Errorf("filter %s: expected in.(a,b,...)", name)
+				}
+				items := strings.Split(operand[1:len(operand)-1], ",")
+				values := make([]interface{}, len(items))
+				for i, item := range items {
+					value, err := filterValue(column, item)
+					if err != nil {
+						return nil, err
+					}
+					values[i] = value
+				}
+				conditions = append(conditions, querybuilder.In{Column: column.Name, Values: values})
+				continue
+			}
+
+			sqlOp, ok := filterOperator(op)
+			if !ok {
+				return nil, fmt.Errorf("filter %s: unknown operator %s", name, op)
+			}
+			if op == "like" || op == "ilike" {
+				if columnKind(column.DataType) != "string" {
+					return nil, fmt.Errorf("filter %s: %s needs a text column", name, op)
+				}
+				operand = strings.ReplaceAll(operand, "*", "%")
+			}
+			value, err := filterValue(column, operand)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, querybuilder.Compare{Column: column.Name, Op: sqlOp, Value: value})
+		}
+	}
+	if raw := query.Get("bbox"); raw != "" {
+		condition, err := bboxCondition(table, raw)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+// bboxCondition reads ?bbox=minLon,minLat,maxLon,maxLat, which matches the
+// records whose geometry intersects the box by bounding box, as GeoJSON
+// clients send it. It applies to the first spatial column of the table, or
+// to the one named before a colon: ?bbox=area:13.3,52.4,13.5,52.6.
+func bboxCondition(table *Table, raw string) (querybuilder.BBox, error) {
+	var column *Column
+	if name, rest, ok := strings.Cut(raw, ":"); ok {
+		c, found := table.Column(name)
+		if !found || columnKind(c.DataType) != "geometry" {
+			return querybuilder.BBox{}, fmt.Errorf("bbox: %s is not a spatial column", name)
+		}
+		column, raw = c, rest
+	} else {
+		for _, c := range table.Columns {
+			if columnKind(c.DataType) == "geometry" {
+				column = c
+				break
+			}
+		}
+		if column == nil {
+			return querybuilder.BBox{}, fmt.Errorf("bbox: %s has no spatial column", table.Name)
+		}
+	}
+	items := strings.Split(raw, ",")
+	if len(items) != 4 {
+		return querybuilder.BBox{}, fmt.Errorf("bbox: expected minLon,minLat,maxLon,maxLat")
+	}
+	var box [4]float64
+	for i, item := range items {
+		f, err := strconv.ParseFloat(item, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return querybuilder.BBox{}, fmt.Errorf("bbox: invalid coordinate %s", item)
+		}
+		box[i] = f
+	}
+	if box[0] > box[2] || box[1] > box[3] {
+		return querybuilder.BBox{}, fmt.Errorf("bbox: the minimum exceeds the maximum")
+	}
+	return querybuilder.BBox{
+		Column:    column.Name,
+		MinX:      box[0],
+		MinY:      box[1],
+		MaxX:      box[2],
+		MaxY:      box[3],
+		Geography: column.DataType == "geography",
+	}, nil
+}
+
+// filterValue converts a raw filter operand by the column type, so a
+// malformed value is a 400 instead of a database error.
+func filterValue(column *Column, raw string) (interface{}, error) {
+	var value interface{}
+	ok := true
+	switch columnKind(column.DataType) {
+	case "int":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		value, ok = n, err == nil
+	case "float":
+		f, err := strconv.ParseFloat(raw, 64)
+		value, ok = f, err == nil
+	case "numeric":
+		value, ok = toNumeric(raw)
+	case "bool":
+		b, err := strconv.ParseBool(raw)
+		value, ok = b, err == nil
+	case "uuid":
+		value, ok = raw, isUUID(raw)
+	case "timestamp":
+		value, ok = raw, isTimestamp(column.DataType, raw)
+	default:
+		value = raw
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid value for filter %s", column.Name)
+	}
+	if len(column.EnumValues) > 0 && !containsString(column.EnumValues, raw) {
+		return nil, fmt.Errorf("invalid value for filter %s, must be one of: %s", column.Name, strings.Join(column.EnumValues, ", "))
+	}
+	return value, nil
+}
+
+// parseOrder reads ?order=column.asc,other.desc. The direction defaults to
+// asc; columns are checked against the table, so nothing from the parameter
+// reaches the SQL unchecked.
+func (de *DbExplorer) parseOrder(table *Table, raw string) ([]querybuilder.Sort, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var terms []querybuilder.Sort
+	for _, item := range strings.Split(raw, ",") {
+		name, direction, _ := strings.Cut(item, ".")
+		column, ok := table.Column(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown order column %s", name)
+		}
+		if de.isEncrypted(table.Name, column.Name) {
+			return nil, fmt.Errorf("order %s: encrypted columns can't be ordered", name)
+		}
+		switch direction {
+		case "", "asc":
+			terms = append(terms, querybuilder.Sort{Column: column.Name})
+		case "desc":
+			terms = append(terms, querybuilder.Sort{Column: column.Name, Desc: true})
+		default:
+			return nil, fmt.Errorf("order %s: direction must be asc or desc", name)
+		}
+	}
+	return terms, nil
+}
+
+// selectFields resolves ?fields=id,title to the columns to select, in the
+// requested order; all columns when the parameter is empty.
+func (t *Table) selectFields(raw string) ([]string, error) {
+	if raw == "" {
+		return t.ColumnNames(), nil
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		if _, ok := t.Column(name); !ok {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
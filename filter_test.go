@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+func TestWhereClause(t *testing.T) {
+	table := &Table{Name: "people", Columns: []*Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "title", DataType: "text"},
+		{Name: "age", DataType: "integer"},
+		{Name: "updated", DataType: "text", Nullable: true},
+		{Name: "status", DataType: "USER-DEFINED", Enum: "person_status", EnumValues: []string{"active", "gone"}},
+	}}
+	de := &DbExplorer{cfg: &Config{}}
+
+	cases := []struct {
+		query string
+		where string
+		args  []interface{}
+		err   string
+	}{
+		{"limit=5&offset=1", "", nil, ""},
+		{"title=eq.memcache&age=gt.30&updated=is.null",
+			` WHERE "age" > $1 AND "title" = $2 AND "updated" IS NULL`, []interface{}{int64(30), "memcache"}, ""},
+		{"id=in.(1,2)&title=like.mem*", ` WHERE "id" IN ($1, $2) AND "title" LIKE $3`, []interface{}{int64(1), int64(2), "mem%"}, ""},
+		{"age=gte.18&age=lt.65", ` WHERE "age" >= $1 AND "age" < $2`, []interface{}{int64(18), int64(65)}, ""},
+		{"password=eq.x", "", nil, "unknown filter column password"},
+		{"age=eq.old", "", nil, "invalid value for filter age"},
+		{"age=like.1*", "", nil, "filter age: like needs a text column"},
+		{"title=between.a", "", nil, "filter title: unknown operator between"},
+		{"title=memcache", "", nil, "filter title: expected operator.value"},
+		{"status=eq.gone", ` WHERE "status" = $1`, []interface{}{"gone"}, ""},
+		{"status=in.(active,lost)", "", nil, "invalid value for filter status, must be one of: active, gone"},
+	}
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		conditions, err := de.whereClause(table, query)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("%s: expected error %q, got %v", c.query, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.query, err)
+		}
+		// Render the conditions to check the SQL they produce.
+		rendered, args := buildSQL(querybuilder.Select{Columns: querybuilder.Cols("id"), From: table.ref(), Where: conditions})
+		where := strings.TrimPrefix(rendered, `SELECT "id" FROM "people"`)
+		if where != c.where || !reflect.DeepEqual(args, c.args) {
+			t.Fatalf("%s: results not match\nGot : %s %#v\nWant: %s %#v", c.query, where, args, c.where, c.args)
+		}
+	}
+}
+
+func TestBBoxCondition(t *testing.T) {
+	table := &Table{Name: "places", Columns: []*Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "location", DataType: "geometry"},
+		{Name: "area", DataType: "geography"},
+	}}
+	de := &DbExplorer{cfg: &Config{}}
+
+	cases := []struct {
+		query string
+		where string
+		args  []interface{}
+		err   string
+	}{
+		{"bbox=13.3,52.4,13.5,52.6&id=gt.1", ` WHERE "id" > $1 AND "location" && ST_MakeEnvelope($2, $3, $4, $5, 4326)`, []interface{}{int64(1), 13.3, 52.4, 13.5, 52.6}, ""},
+		{"bbox=area:-1,-1,1,1", ` WHERE "area" && ST_MakeEnvelope($1, $2, $3, $4, 4326)::geography`, []interface{}{-1.0, -1.0, 1.0, 1.0}, ""},
+		{"bbox=id:0,0,1,1", "", nil, "bbox: id is not a spatial column"},
+		{"bbox=0,0,1", "", nil, "bbox: expected minLon,minLat,maxLon,maxLat"},
+		{"bbox=0,0,1,NaN", "", nil, "bbox: invalid coordinate NaN"},
+		{"bbox=1,0,0,1", "", nil, "bbox: the minimum exceeds the maximum"},
+	}
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		conditions, err := de.whereClause(table, query)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("%s: expected error %q, got %v", c.query, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.query, err)
+		}
+		rendered, args := buildSQL(querybuilder.Select{Columns: querybuilder.Cols("id"), From: table.ref(), Where: conditions})
+		where := strings.TrimPrefix(rendered, `SELECT "id" FROM "places"`)
+		if where != c.where || !reflect.DeepEqual(args, c.args) {
+			t.Fatalf("%s: results not match\nGot : %s %#v\nWant: %s %#v", c.query, where, args, c.where, c.args)
+		}
+	}
+
+	projections := table.projections([]string{"id", "area"})
+	if want := []querybuilder.Projection{querybuilder.Col("id"), querybuilder.AsGeoJSON{Column: "area"}}; !reflect.DeepEqual(projections, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", projections, want)
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	table := &Table{Name: "people", Columns: []*Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "title", DataType: "text"},
+	}}
+	de := &DbExplorer{cfg: &Config{}}
+
+	cases := []struct {
+		raw   string
+		order []querybuilder.Sort
+		err   string
+	}{
+		{"", nil, ""},
+		{"title", []querybuilder.Sort{{Column: "title"}}, ""},
+		{"title.asc,id.desc", []querybuilder.Sort{{Column: "title"}, {Column: "id", Desc: true}}, ""},
+		{"id;drop table people.asc", nil, "unknown order column id;drop table people"},
+		{"id.sideways", nil, "order id: direction must be asc or desc"},
+	}
+	for _, c := range cases {
+		order, err := de.parseOrder(table, c.raw)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("%s: expected error %q, got %v", c.raw, c.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(order, c.order) {
+			t.Fatalf("%s: results not match\nGot : %#v %v\nWant: %#v", c.raw, order, err, c.order)
+		}
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	table := &Table{Name: "people", Columns: []*Column{
+		{Name: "id", DataType: "integer"},
+		{Name: "title", DataType: "text"},
+		{Name: "body", DataType: "bytea"},
+	}}
+	if got, _ := table.selectFields(""); !reflect.DeepEqual(got, []string{"id", "title", "body"}) {
+		t.Fatalf("results not match\nGot : %#v", got)
+	}
+	if got, _ := table.selectFields("title,id,title"); !reflect.DeepEqual(got, []string{"title", "id"}) {
+		t.Fatalf("results not match\nGot : %#v", got)
+	}
+	if _, err := table.selectFields("id,*"); err == nil || err.Error() != "unknown field *" {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	cases := []struct {
+		query         string
+		limit, offset int
+		err           string
+	}{
+		{"", 100, 0, ""},
+		{"limit=5&offset=7", 5, 7, ""},
+		{"limit=5%20OFFSET%200", 0, 0, "invalid limit"},
+		{"offset=-1", 0, 0, "invalid offset"},
+	}
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		limit, offset, err := pagination(query)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("%s: expected error %q, got %v", c.query, c.err, err)
+			}
+			continue
+		}
+		if err != nil || limit != c.limit || offset != c.offset {
+			t.Fatalf("%s: results not match\nGot : %d %d %v\nWant: %d %d", c.query, limit, offset, err, c.limit, c.offset)
+		}
+	}
+}
+
+func TestCountMode(t *testing.T) {
+	cases := []struct {
+		query, prefer, mode string
+	}{
+		{"", "", ""},
+		{"count=true", "", "exact"},
+		{"count=estimated", "count=exact", "estimated"},
+		{"", "return=minimal, count=exact", "exact"},
+		{"", "count=estimated", "estimated"},
+		{"count=false", "count=exact", ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/items?"+c.query, nil)
+		r.Header.Set("Prefer", c.prefer)
+		if mode, err := countMode(r); err != nil || mode != c.mode {
+			t.Fatalf("%s %s: results not match\nGot : %q %v\nWant: %q", c.query, c.prefer, mode, err, c.mode)
+		}
+	}
+}
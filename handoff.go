@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A process started by handOff finds the inherited listener and the write
+// end of its readiness pipe under these descriptors.
+const (
+	listenFDEnv    = "EXPLORER_LISTEN_FD"
+	readyFDEnv     = "EXPLORER_READY_FD"
+	handoffTimeout = 30 * time.Second
+)
+
+// listen returns the listener inherited from the previous process during a
+// handoff, or a new one on addr.
+func listen(addr string) (net.Listener, error) {
+	raw := os.Getenv(listenFDEnv)
+	if raw == "" {
+		return net.Listen("tcp", addr)
+	}
+	fd, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "listener")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// notifyReady tells the process that handed off the listener that this one
+// is serving, so it can stop accepting and drain.
+func notifyReady() {
+	raw := os.Getenv(readyFDEnv)
+	if raw == "" {
+		return
+	}
+	fd, err := strconv.Atoi(raw)
+	if err != nil {
+		return
+	}
+	pipe := os.NewFile(uintptr(fd), "ready")
+	pipe.Write([]byte{1})
+	pipe.Close()
+}
+
+// handOff starts a new copy of the current binary sharing ln and waits until
+// it reports itself ready. Both processes accept from the same socket until
+// the old one shuts down, so no connection is refused during the upgrade.
+func handOff(ln net.Listener) error {
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		return errors.New("listener can't be handed off")
+	}
+	file, err := tcp.File()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	ready, signalEnd, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		signalEnd.Close()
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenFDEnv+"=") && !strings.HasPrefix(kv, readyFDEnv+"=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	// ExtraFiles start at descriptor 3.
+	cmd.Env = append(cmd.Env, listenFDEnv+"=3", readyFDEnv+"=4")
+	cmd.ExtraFiles = []*os.File{file, signalEnd}
+	err = cmd.Start()
+	signalEnd.Close()
+	if err != nil {
+		return err
+	}
+
+	ready.SetReadDeadline(time.Now().Add(handoffTimeout))
+	if _, err := ready.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("new process did not become ready")
+	}
+	return cmd.Process.Release()
+}
+
+// serve runs server on ln until a signal arrives. SIGUSR2 hands the listener
+// to a freshly started binary first; SIGTERM and SIGINT just stop. Either way
+// the server stops accepting and waits for in-flight requests, long export
+// streams included, before returning.
+func serve(server *http.Server, ln net.Listener, tls *TLSConfig) error {
+	errc := make(chan error, 1)
+	go func() {
+		if tls != nil {
+			errc <- server.ServeTLS(ln, tls.CertFile, tls.KeyFile)
+			return
+		}
+		errc <- server.Serve(ln)
+	}()
+	notifyReady()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2, syscall.SIGTERM, syscall.SIGINT)
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGUSR2 {
+				if err := handOff(ln); err != nil {
+					log.Printf("handoff failed, still serving: %v", err)
+					continue
+				}
+				log.Printf("listener handed off, draining")
+			}
+			return server.Shutdown(context.Background())
+		}
+	}
+}
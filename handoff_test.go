@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// handoffMode tells the process started by a handoff what to do: "serve"
+// the inherited listener, or "fail" before becoming ready.
+const handoffMode = "EXPLORER_HANDOFF_TEST"
+
+// TestHandOff runs as both processes: started by handOff, it finds the
+// inherited listener in its environment.
+func TestHandOff(t *testing.T) {
+	if os.Getenv(listenFDEnv) != "" {
+		handOffChild()
+		return
+	}
+
+	// Only this test runs in the new process.
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestHandOff$"}
+	defer func() { os.Args = args }()
+
+	ln, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	get := func(path string) string {
+		resp, err := http.Get("http://" + ln.Addr().String() + path)
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Setenv(handoffMode, "fail")
+	if err := handOff(ln); err == nil || err.Error() != "new process did not become ready" {
+		t.Fatalf("results not match\nGot : %v\nWant: the new process not ready", err)
+	}
+
+	t.Setenv(handoffMode, "serve")
+	if err := handOff(ln); err != nil {
+		t.Fatal(err)
+	}
+	// Once the old process stops accepting, the new one serves alone on
+	// the same address.
+	ln.Close()
+	if got := get("/"); got != "handed off" {
+		t.Fatalf("results not match\nGot : %q\nWant: the new process answering", got)
+	}
+	get("/stop")
+}
+
+// handOffChild serves the inherited listener until asked to stop.
+func handOffChild() {
+	if os.Getenv(handoffMode) == "fail" {
+		os.Exit(1)
+	}
+	ln, err := listen("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	go func() {
+		time.Sleep(handoffTimeout)
+		os.Exit(1)
+	}()
+	notifyReady()
+	http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stop") {
+			os.Exit(0)
+		}
+		fmt.Fprint(w, "handed off")
+	}))
+}
+
+func TestHandOffListener(t *testing.T) {
+	ln, err := net.Listen("unix", t.TempDir()+"/explorer.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := handOff(ln); err == nil {
+		t.Fatal("results not match\nGot : nil\nWant: an error for a unix listener")
+	}
+}
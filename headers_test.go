@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	de.cfg.SecurityHeaders = map[string]string{
+		"X-Frame-Options":         "",
+		"Content-Security-Policy": "default-src 'self'",
+		"Permissions-Policy":      "camera=()",
+	}
+
+	cases := []struct {
+		tls     bool
+		headers map[string]string
+	}{
+		{false, map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "",
+			"Content-Security-Policy":   "default-src 'self'",
+			"Permissions-Policy":        "camera=()",
+			"Strict-Transport-Security": "",
+		}},
+		{true, map[string]string{
+			"Referrer-Policy":           "no-referrer",
+			"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+		}},
+	}
+	for _, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items", nil)
+		if item.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, r)
+		for name, value := range item.headers {
+			if got := w.Header().Get(name); got != value {
+				t.Fatalf("[tls %v] results not match\nGot : %s: %q\nWant: %q", item.tls, name, got, value)
+			}
+		}
+	}
+
+	// Errors carry the headers too.
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("results not match\nGot : %d %v\nWant: nosniff on the error", w.Code, w.Header())
+	}
+	// HSTS can be overridden too.
+	de.cfg.SecurityHeaders = map[string]string{"Strict-Transport-Security": "max-age=60"}
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=60" {
+		t.Fatalf("results not match\nGot : %q\nWant: max-age=60", got)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	idempotencyHeader     = "Idempotency-Key"
+	defaultIdempotencyTTL = 24 * time.Hour
+	idempotencyPending    = "pending"
+)
+
+// storedResponse is the replayable outcome of an idempotent request.
+// Request fingerprints the request that got it. Withheld responses, holding
+// a secret or streamed, aren't kept: a retry learns the request was done but
+// can't get them again.
+type storedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+	Request     string `json:"request"`
+	Withheld    bool   `json:"withheld,omitempty"`
+}
+
+// responseRecorder passes a response through while keeping a copy, but for
+// a streamed one: a flush drops the copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	streamed bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if !rec.streamed {
+		rec.body.Write(data)
+	}
+	return rec.ResponseWriter.Write(data)
+}
+
+// FlushError flushes the response, a stream not to be recorded.
+func (rec *responseRecorder) FlushError() error {
+	rec.streamed = true
+	rec.body.Reset()
+	return http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the other controls.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// idempotent runs next at most once per Idempotency-Key and caller across
+// all replicas. A retry gets the stored response of the first attempt; a
+// retry racing the first attempt gets a 409, one with another method, URL
+// or body a 422. Responses with a 5xx status aren't stored, so the request
+// can be retried; streamed ones and those marked Cache-Control: no-store
+// aren't replayed.
+func (de *DbExplorer) idempotent(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	token := r.Header.Get(idempotencyHeader)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		token = ""
+	}
+	if token == "" {
+		next(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	fingerprint := sha256.New()
+	io.WriteString(fingerprint, r.Method+" "+r.URL.RequestURI()+"\n")
+	ttl := time.Duration(de.cfg.IdempotencyTTL)
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	key := "idempotency:" + callerKey(r) + ":" + token
+	if de.environment != "" {
+		// The sandbox may share the store, its keys mustn't replay
+		// responses of the primary database.
+		key = de.environment + ":" + key
+	}
+	first, err := de.store.SetNX(ctx, key, idempotencyPending, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !first {
+		raw, ok, err := de.store.Get(ctx, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var stored storedResponse
+		if !ok || raw == idempotencyPending || json.Unmarshal([]byte(raw), &stored) != nil {
+			writeError(w, http.StatusConflict, "a request with this idempotency key is in progress")
+			return
+		}
+		if stored.Request != requestFingerprint(fingerprint, r.Body) {
+			writeError(w, http.StatusUnprocessableEntity, "the idempotency key was used for a different request")
+			return
+		}
+		if stored.Withheld {
+			writeError(w, http.StatusConflict, "the response to this idempotency key can't be replayed")
+			return
+		}
+		w.Header().Set("Content-Type", stored.ContentType)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+		return
+	}
+
+	// The body is hashed as the handler reads it, and what it left after.
+	body := r.Body
+	if body != nil {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(body, fingerprint), body}
+	}
+	rec := &responseRecorder{ResponseWriter: w}
+	next(rec, r)
+	if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+		if err := de.store.Delete(ctx, key); err != nil {
+			log.Printf("idempotency: %v", err)
+		}
+		return
+	}
+	stored := storedResponse{Status: rec.status, ContentType: w.Header().Get("Content-Type"), Body: rec.body.Bytes(), Request: requestFingerprint(fingerprint, body)}
+	if rec.streamed || strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+		stored.ContentType, stored.Body, stored.Withheld = "", nil, true
+	}
+	data, _ := json.Marshal(stored)
+	if err := de.store.Set(ctx, key, string(data), ttl); err != nil {
+		log.Printf("idempotency: %v", err)
+	}
+}
+
+// requestFingerprint finishes the fingerprint of a request with the rest of
+// its body.
+func requestFingerprint(fingerprint hash.Hash, body io.Reader) string {
+	if body != nil {
+		io.Copy(fingerprint, body)
+	}
+	return hex.EncodeToString(fingerprint.Sum(nil))
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"db_explorer/internal/querybuilder"
+)
+
+const (
+	// maxImpactRows caps the rows of a dependent table read to follow the
+	// cascade to their own dependents.
+	maxImpactRows = 10000
+	// maxImpactDepth caps the cascade followed, e.g. down a self-referencing
+	// tree.
+	maxImpactDepth = 16
+)
+
+// impactEntry is what deleting a record does to the rows of Table that
+// reference, through Constraint, rows the delete removes.
+type impactEntry struct {
+	Table      string   `json:"table"`
+	Constraint string   `json:"constraint"`
+	Columns    []string `json:"columns"`
+	// Action is delete, set_null or set_default as the constraint says,
+	// block when the rows make the delete fail, or orphan when a declared
+	// relation, which nothing enforces, leaves them referencing nothing.
+	Action string `json:"action"`
+	Rows   int64  `json:"rows"`
+	// Path is the tables from the record to Table.
+	Path []string `json:"path"`
+	// Truncated is set when the cascade below these rows isn't followed in
+	// full; the counts of their dependents are lower bounds then.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// impactAction maps the delete rule of fk to what it does to the
+// referencing rows.
+func impactAction(fk *ForeignKey) string {
+	if fk.Declared {
+		return "orphan"
+	}
+	switch fk.OnDelete {
+	case "CASCADE":
+		return "delete"
+	case "SET NULL":
+		return "set_null"
+	case "SET DEFAULT":
+		return "set_default"
+	}
+	return "block"
+}
+
+// handleImpact serves GET /{table}/{id}/_impact, a preview of deleting the
+// record: the rows referencing it, and the rows referencing those deleted
+// with it, by what the ON DELETE rule of their foreign key does to them.
+// deletable is false when rows would block the delete.
+func (de *DbExplorer) handleImpact(w http.ResponseWriter, r *http.Request, table *Table, key recordKey) {
+	schema := de.requestSchema(r.Context())
+	columns := referencedColumns(schema, table)
+	if len(columns) == 0 {
+		columns = table.PrimaryKey
+	}
+	var records []map[string]interface{}
+	err := de.backend.Select(r.Context(), selectRecord(table, columns, key), func(record map[string]interface{}) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+
+	entries := []impactEntry{}
+	if err := de.impact(r.Context(), schema, table, records, []string{table.Name}, &entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deletable := true
+	for _, entry := range entries {
+		if entry.Action == "block" {
+			deletable = false
+		}
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"deletable":  deletable,
+			"dependents": entries,
+		},
+	}, false)
+}
+
+// impact adds the entries of the rows referencing records of table, which
+// are deleted, and follows the cascade from those deleted with them.
+func (de *DbExplorer) impact(ctx context.Context, schema *Schema, table *Table, records []map[string]interface{}, path []string, entries *[]impactEntry) error {
+	names := make([]string, 0, len(schema.Tables))
+	for name := range schema.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := schema.Tables[name]
+		for _, fk := range child.ForeignKeys {
+			if fk.RefTable != table.Name {
+				continue
+			}
+			where := referencing(fk, records)
+			if where == nil {
+				continue
+			}
+			rows, err := de.countRecords(ctx, child, "exact", querybuilder.And{where})
+			if err != nil {
+				return err
+			}
+			if rows == 0 {
+				continue
+			}
+			entry := impactEntry{
+				Table:      child.Name,
+				Constraint: fk.Name,
+				Columns:    fk.Columns,
+				Action:     impactAction(fk),
+				Rows:       rows,
+				Path:       append(append([]string(nil), path...), child.Name),
+			}
+			columns := referencedColumns(schema, child)
+			if entry.Action != "delete" || len(columns) == 0 {
+				*entries = append(*entries, entry)
+				continue
+			}
+			if len(path) >= maxImpactDepth {
+				entry.Truncated = true
+				*entries = append(*entries, entry)
+				continue
+			}
+
+			query := querybuilder.Select{
+				Columns: querybuilder.Cols(columns...),
+				From:    child.ref(),
+				Where:   querybuilder.And{where},
+				Page:    &querybuilder.Page{Limit: maxImpactRows},
+			}
+			var deleted []map[string]interface{}
+			err = de.backend.Select(ctx, query, func(record map[string]interface{}) error {
+				deleted = append(deleted, record)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			entry.Truncated = rows > int64(len(deleted))
+			*entries = append(*entries, entry)
+			if err := de.impact(ctx, schema, child, deleted, entry.Path, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// referencedColumns are the columns of table foreign keys reference, in
+// column order.
+func referencedColumns(schema *Schema, table *Table) []string {
+	referenced := make(map[string]bool)
+	for _, other := range schema.Tables {
+		for _, fk := range other.ForeignKeys {
+			if fk.RefTable != table.Name {
+				continue
+			}
+			for _, column := range fk.RefColumns {
+				referenced[column] = true
+			}
+		}
+	}
+	var columns []string
+	for _, column := range table.Columns {
+		if referenced[column.Name] {
+			columns = append(columns, column.Name)
+		}
+	}
+	return columns
+}
+
+// referencing matches the rows whose foreign key fk points at one of
+// records, nil when no record can be referenced.
+func referencing(fk *ForeignKey, records []map[string]interface{}) querybuilder.Expr {
+	if len(fk.Columns) == 1 {
+		var values []interface{}
+		for _, record := range records {
+			if value := record[fk.RefColumns[0]]; value != nil {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return querybuilder.In{Column: fk.Columns[0], Values: values}
+	}
+	var matches querybuilder.Or
+records:
+	for _, record := range records {
+		match := make(querybuilder.And, len(fk.Columns))
+		for i, column := range fk.Columns {
+			value := record[fk.RefColumns[i]]
+			if value == nil {
+				continue records
+			}
+			match[i] = querybuilder.Compare{Column: column, Op: querybuilder.Eq, Value: value}
+		}
+		matches = append(matches, match)
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// tableStore serves the rows of every table matching the equalities at the
+// top of the condition, ignoring the rest, and counts them for COUNT(*).
+// Updates and deletes are kept as SQL; a delete removes the rows matching
+// the same way. It is its own transaction.
+type tableStore struct {
+	Store
+	rows    map[string][]map[string]interface{}
+	updates []string
+	deletes []string
+}
+
+// matches reports whether row meets the Compare conditions of where.
+func (s *tableStore) matches(where querybuilder.Expr, row map[string]interface{}) bool {
+	and, _ := where.(querybuilder.And)
+	for _, condition := range and {
+		if compare, ok := condition.(querybuilder.Compare); ok && fmt.Sprint(row[compare.Column]) != fmt.Sprint(compare.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *tableStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	var rows []map[string]interface{}
+	for _, row := range s.rows[query.From.Name] {
+		if s.matches(query.Where, row) {
+			rows = append(rows, row)
+		}
+	}
+	if _, ok := query.Columns[0].(querybuilder.Count); ok {
+		return each(map[string]interface{}{"count": int64(len(rows))})
+	}
+	for _, row := range rows {
+		if err := each(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tableStore) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	query, args := buildSQL(update)
+	s.updates = append(s.updates, fmt.Sprint(query, " ", args))
+	return 1, nil
+}
+
+func (s *tableStore) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	query, _ := buildSQL(del)
+	s.deletes = append(s.deletes, query)
+	var kept []map[string]interface{}
+	for _, row := range s.rows[del.From.Name] {
+		if !s.matches(del.Where, row) {
+			kept = append(kept, row)
+		}
+	}
+	affected := int64(len(s.rows[del.From.Name]) - len(kept))
+	s.rows[del.From.Name] = kept
+	return affected, nil
+}
+
+func (s *tableStore) Begin(ctx context.Context) (Tx, error) { return s, nil }
+
+func (s *tableStore) Commit() error { return nil }
+
+func (s *tableStore) Rollback() error { return nil }
+
+func TestImpact(t *testing.T) {
+	backend := &tableStore{rows: map[string][]map[string]interface{}{
+		"customers": {{"id": int64(5)}},
+		"orders":    {{"id": int64(1)}, {"id": int64(2)}},
+		"lines":     {{"order_id": int64(1)}, {"order_id": int64(1)}, {"order_id": int64(2)}},
+		"notes":     {{"id": int64(9)}},
+	}}
+	de := backendExplorer(backend)
+	de.schema.Store(&Schema{Name: "public", Tables: map[string]*Table{
+		"customers": {Name: "customers", PrimaryKey: []string{"id"}, Columns: []*Column{{Name: "id", DataType: "integer"}}},
+		"orders": {Name: "orders", PrimaryKey: []string{"id"}, Columns: []*Column{{Name: "id", DataType: "integer"}, {Name: "customer_id", DataType: "integer"}}, ForeignKeys: []*ForeignKey{
+			{Name: "orders_customer_id_fkey", Columns: []string{"customer_id"}, RefTable: "customers", RefColumns: []string{"id"}, OnDelete: "CASCADE"},
+		}},
+		"lines": {Name: "lines", Columns: []*Column{{Name: "order_id", DataType: "integer"}}, ForeignKeys: []*ForeignKey{
+			{Name: "lines_order_id_fkey", Columns: []string{"order_id"}, RefTable: "orders", RefColumns: []string{"id"}, OnDelete: "CASCADE"},
+		}},
+		"invoices": {Name: "invoices", Columns: []*Column{{Name: "order_id", DataType: "integer"}}, ForeignKeys: []*ForeignKey{
+			{Name: "invoices_order_id_fkey", Columns: []string{"order_id"}, RefTable: "orders", RefColumns: []string{"id"}, OnDelete: "NO ACTION"},
+		}},
+		"notes": {Name: "notes", Columns: []*Column{{Name: "id", DataType: "integer"}, {Name: "customer_id", DataType: "integer"}}, ForeignKeys: []*ForeignKey{
+			{Name: "notes_customer_id_fkey", Columns: []string{"customer_id"}, RefTable: "customers", RefColumns: []string{"id"}, OnDelete: "SET NULL"},
+		}},
+	}})
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customers/5/_impact", nil))
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	// invoices has no rows, so nothing blocks the delete.
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"deletable": true,
+			"dependents": []interface{}{
+				map[string]interface{}{"table": "notes", "constraint": "notes_customer_id_fkey", "columns": []interface{}{"customer_id"}, "action": "set_null", "rows": float64(1), "path": []interface{}{"customers", "notes"}},
+				map[string]interface{}{"table": "orders", "constraint": "orders_customer_id_fkey", "columns": []interface{}{"customer_id"}, "action": "delete", "rows": float64(2), "path": []interface{}{"customers", "orders"}},
+				map[string]interface{}{"table": "lines", "constraint": "lines_order_id_fkey", "columns": []interface{}{"order_id"}, "action": "delete", "rows": float64(3), "path": []interface{}{"customers", "orders", "lines"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+
+	backend.rows["invoices"] = []map[string]interface{}{{"order_id": int64(2)}}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customers/5/_impact", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if deletable := got["response"].(map[string]interface{})["deletable"]; deletable != false {
+		t.Fatalf("results not match\nGot : %v\nWant: false", deletable)
+	}
+
+	backend.rows["customers"] = nil
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customers/5/_impact", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusNotFound)
+	}
+}
+
+func TestReferencing(t *testing.T) {
+	fk := &ForeignKey{Columns: []string{"order_id", "line"}, RefColumns: []string{"id", "no"}}
+	where := referencing(fk, []map[string]interface{}{{"id": int64(1), "no": int64(2)}, {"id": nil, "no": int64(3)}})
+	query, args := buildSQL(querybuilder.Select{Columns: querybuilder.Cols("x"), From: querybuilder.Table{Name: "t"}, Where: where})
+	if want := `SELECT "x" FROM "t" WHERE ("order_id" = $1 AND "line" = $2)`; query != want || !reflect.DeepEqual(args, []interface{}{int64(1), int64(2)}) {
+		t.Fatalf("results not match\nGot : %s %v\nWant: %s", query, args, want)
+	}
+	if where := referencing(&ForeignKey{Columns: []string{"a"}, RefColumns: []string{"id"}}, []map[string]interface{}{{"id": nil}}); where != nil {
+		t.Fatalf("results not match\nGot : %#v\nWant: nil", where)
+	}
+}
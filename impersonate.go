@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+const impersonateHeader = "X-Impersonate"
+
+// impersonate replaces the caller's identity with the user named in the
+// X-Impersonate header, so support engineers see exactly what that user's
+// roles allow. Only holders of Auth.ImpersonateRole may do so, and every
+// impersonated request is audited under the real caller. Users holding the
+// admin or the impersonate role can't be impersonated, which would hand
+// their privileges to the support engineer.
+func (de *DbExplorer) impersonate(r *http.Request) (*http.Request, error) {
+	subject := r.Header.Get(impersonateHeader)
+	if subject == "" {
+		return r, nil
+	}
+	actor := identityFromRequest(r)
+	role := de.cfg.Auth.ImpersonateRole
+	if role == "" || actor == nil || !actor.HasRole(role) {
+		audit("impersonation_denied", r, map[string]interface{}{"impersonated": subject})
+		return nil, errors.New("impersonation not allowed")
+	}
+	roles, ok, err := de.rolesOf(r.Context(), subject)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown user %s", subject)
+	}
+	for _, privileged := range roles {
+		if privileged == de.adminRole() || privileged == role {
+			audit("impersonation_denied", r, map[string]interface{}{"impersonated": subject, "roles": roles})
+			return nil, fmt.Errorf("user %s can't be impersonated", subject)
+		}
+	}
+	audit("impersonation", r, map[string]interface{}{"impersonated": subject, "roles": roles})
+	return withIdentity(r, &Identity{
+		Subject:    subject,
+		Roles:      roles,
+		Method:     "impersonation",
+		Attributes: map[string]string{"impersonated_by": actor.Subject},
+	}), nil
+}
+
+// rolesOf collects the roles the explorer knows for subject from the
+// configured and the managed API keys; ok is false when subject has none.
+func (de *DbExplorer) rolesOf(ctx context.Context, subject string) ([]string, bool, error) {
+	found := false
+	seen := make(map[string]bool)
+	roles := []string{}
+	add := func(list []string) {
+		found = true
+		for _, role := range list {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	for _, entry := range de.cfg.Auth.APIKeys {
+		if entry.Subject == subject {
+			add(entry.Roles)
+		}
+	}
+	if de.cfg.Auth.ManagedKeys {
+		rows, err := de.db.QueryContext(ctx, `SELECT roles FROM explorer.api_keys
+			WHERE subject = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`, subject)
+		if err != nil {
+			return nil, false, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var list pq.StringArray
+			if err := rows.Scan(&list); err != nil {
+				return nil, false, err
+			}
+			add(list)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, false, err
+		}
+	}
+	return roles, found, nil
+}
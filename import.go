@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxImportErrors is how many row errors an import reports.
+const maxImportErrors = 20
+
+// maxMappingSize caps the mapping of an import.
+const maxMappingSize = 64 << 10
+
+// importRowError is a row of an import that was skipped.
+type importRowError struct {
+	Line  int    `json:"line"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// importError aborts an import because of its input; it maps to a 400.
+type importError struct {
+	msg string
+}
+
+func (e *importError) Error() string {
+	return e.msg
+}
+
+// importErrors counts the rows an import skipped and details the first
+// ones.
+type importErrors struct {
+	failed int
+	rows   []importRowError
+}
+
+func (e *importErrors) add(line int, err error) {
+	e.failed++
+	if len(e.rows) == maxImportErrors {
+		return
+	}
+	rowError := importRowError{Line: line, Error: err.Error()}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		rowError.Field = fe.Field
+	}
+	e.rows = append(e.rows, rowError)
+}
+
+// writeImportResult reports the rows an import loaded, or found valid when
+// it only validated, next to the rows that failed. An import that resolved
+// duplicates, with counts, reports the rows it updated and skipped too.
+func writeImportResult(w http.ResponseWriter, rows int64, validateOnly bool, failed *importErrors, counts *duplicateCounts) {
+	key := "inserted"
+	if validateOnly {
+		key = "valid"
+	}
+	rowErrors := failed.rows
+	if rowErrors == nil {
+		rowErrors = []importRowError{}
+	}
+	result := map[string]interface{}{
+		key:      rows,
+		"failed": failed.failed,
+		"errors": rowErrors,
+	}
+	if counts != nil {
+		result["updated"] = counts.updated
+		result["skipped"] = counts.skipped
+	}
+	response := map[string]interface{}{
+		"response": result,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// wantsValidateOnly reads ?validate_only=.
+func wantsValidateOnly(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("validate_only")
+	if raw == "" {
+		return false, nil
+	}
+	validateOnly, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, errors.New("validate_only must be true or false")
+	}
+	return validateOnly, nil
+}
+
+// handleImport serves POST /{table}/_import: it loads the CSV uploaded in
+// the "file" field of a multipart form, whose header row names the columns.
+// A "mapping" field may map them to the columns of the table instead, see
+// importMapping. Values are converted as in lenient mode and empty cells
+// are NULL. Rows that fail validation are skipped, the others are loaded
+// together with COPY. The response counts both and details the first row
+// errors.
+// ?validate_only=true checks every row the same way without loading any.
+// ?on_duplicate=skip or update resolves the rows that duplicate a unique
+// key, see conflictClause; they are then loaded with INSERTs in one
+// transaction, which COPY can't do, and counted in the response.
+// ?progress= streams the progress of the import, see progressWriter.
+// NDJSON bodies are imported by handleNDJSONImport and JSON documents by
+// handleNestedImport instead.
+func (de *DbExplorer) handleImport(w http.ResponseWriter, r *http.Request, table *Table) {
+	progress, err := newProgress(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if progress != nil {
+		defer progress.finish()
+		w = progress
+	}
+	validateOnly, err := wantsValidateOnly(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	strategy, err := onDuplicate(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Updating the rows an import duplicates overwrites them, which takes
+	// the update permission on top of create.
+	if strategy == duplicateUpdate && !de.authorize(w, r, table, actionUpdate) {
+		return
+	}
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case ndjsonType:
+		de.handleNDJSONImport(w, r, table, validateOnly, strategy)
+		return
+	case "application/json":
+		if validateOnly || strategy != duplicateFail {
+			writeError(w, http.StatusBadRequest, "validate_only and on_duplicate need a CSV or NDJSON import")
+			return
+		}
+		de.handleNestedImport(w, r, table)
+		return
+	}
+	store, ok := de.backend.(copier)
+	if !ok && !validateOnly && strategy == duplicateFail {
+		writeError(w, http.StatusNotImplemented, "the store doesn't support imports")
+		return
+	}
+	mappingData, file, err := importParts(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("reading the header row: %v", err))
+		return
+	}
+	header = append([]string(nil), header...)
+	// Without a mapping, the header names the columns.
+	var mapped []mappedColumn
+	if mappingData != nil {
+		mapping, err := parseImportMapping(mappingData)
+		if err == nil {
+			mapped, err = mapping.resolve(table, header)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		for i, name := range header {
+			column, ok := table.Column(name)
+			if !ok {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown field %s", name))
+				return
+			}
+			mapped = append(mapped, mappedColumn{column: column, source: i})
+		}
+	}
+	fields := make([]*Column, len(mapped))
+	names := make([]string, len(mapped))
+	for i, m := range mapped {
+		fields[i], names[i] = m.column, m.column.Name
+	}
+	// Injected values are the same for every row of the request.
+	injected := make(map[string]interface{})
+	if err := de.injectValues(r, table, injected); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// COPY takes the same columns for every row, those of the file and
+	// the injected ones; the others get their defaults.
+	var columns []string
+	for _, column := range table.Columns {
+		if column.Generated {
+			continue
+		}
+		if _, ok := injected[column.Name]; ok || containsString(names, column.Name) {
+			columns = append(columns, column.Name)
+		}
+	}
+	if strategy != duplicateFail {
+		if _, err := conflictClause(table, columns, strategy); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	skipped := &importErrors{}
+	next := func() ([]interface{}, error) {
+		for {
+			record, err := reader.Read()
+			var parseErr *csv.ParseError
+			if err != io.EOF {
+				progress.add(1)
+			}
+			switch {
+			case err == io.EOF:
+				return nil, nil
+			case errors.Is(err, csv.ErrFieldCount) && errors.As(err, &parseErr):
+				skipped.add(parseErr.StartLine, csv.ErrFieldCount)
+				continue
+			case err != nil:
+				return nil, &importError{err.Error()}
+			}
+			line, _ := reader.FieldPos(0)
+			cells := make([]string, len(mapped))
+			for i, m := range mapped {
+				if cells[i], err = m.cell(record); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				skipped.add(line, err)
+				continue
+			}
+			data, err := de.importRow(table, fields, cells, injected)
+			if err != nil {
+				skipped.add(line, err)
+				continue
+			}
+			row := make([]interface{}, len(columns))
+			for i, column := range columns {
+				row[i] = data[column]
+			}
+			return row, nil
+		}
+	}
+
+	var rows int64
+	var counts *duplicateCounts
+	switch {
+	case validateOnly:
+		rows, err = countRows(next)
+	case strategy != duplicateFail:
+		var resolved duplicateCounts
+		resolved, err = de.upsertRows(r.Context(), table, columns, next, strategy)
+		rows, counts = resolved.inserted, &resolved
+	default:
+		rows, err = store.CopyRows(r.Context(), table.ref(), columns, next)
+	}
+	if err != nil {
+		var inputErr *importError
+		if errors.As(err, &inputErr) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error importing records: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !validateOnly {
+		addRows(r.Context(), rows)
+	}
+	if counts != nil {
+		addRows(r.Context(), counts.updated)
+	}
+	writeImportResult(w, rows, validateOnly, skipped, counts)
+}
+
+// countRows reads the rows of next without loading them.
+func countRows(next func() ([]interface{}, error)) (int64, error) {
+	var n int64
+	for {
+		row, err := next()
+		if err != nil || row == nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// importParts returns the optional "mapping" part of a multipart upload,
+// which has to come first, and its "file" part, read as it arrives rather
+// than buffered.
+func importParts(r *http.Request) ([]byte, io.Reader, error) {
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errors.New("expected a multipart upload with a file field")
+	}
+	var mapping []byte
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return nil, nil, errors.New("expected a multipart upload with a file field")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch part.FormName() {
+		case "mapping":
+			if mapping, err = io.ReadAll(io.LimitReader(part, maxMappingSize)); err != nil {
+				return nil, nil, err
+			}
+		case "file":
+			return mapping, part, nil
+		}
+	}
+}
+
+// importRow converts a CSV record into the values of a new row, checked
+// like the body of a single insert.
+func (de *DbExplorer) importRow(table *Table, fields []*Column, record []string, injected map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(fields)+len(injected))
+	for i, column := range fields {
+		if column.Generated {
+			continue
+		}
+		value, err := de.importValue(column, record[i])
+		if err != nil {
+			return nil, err
+		}
+		data[column.Name] = value
+	}
+	for column, value := range injected {
+		data[column] = value
+	}
+	if err := checkRequired(table, data); err != nil {
+		return nil, err
+	}
+	if err := de.encryptValues(table.Name, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// importValue converts a CSV cell for column. Cells of json columns hold
+// JSON text rather than a string to encode, those of array columns a JSON
+// array. Cells of spatial columns are left to PostGIS, which reads WKT,
+// EWKT and hex WKB, as COPY takes no GeoJSON.
+func (de *DbExplorer) importValue(column *Column, cell string) (interface{}, error) {
+	if cell == "" {
+		return nil, nil
+	}
+	var value interface{} = cell
+	switch columnKind(column.DataType) {
+	case "json":
+		if !json.Valid([]byte(cell)) {
+			return nil, &fieldError{column.Name, fmt.Sprintf("field %s have invalid type", column.Name)}
+		}
+		return cell, nil
+	case "geometry":
+		return cell, nil
+	case "array":
+		decoder := json.NewDecoder(strings.NewReader(cell))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, &fieldError{column.Name, fmt.Sprintf("field %s have invalid type", column.Name)}
+		}
+	}
+	value, ok := de.convertValue(column, value, false)
+	if !ok {
+		return nil, &fieldError{column.Name, fmt.Sprintf("field %s have invalid type", column.Name)}
+	}
+	if err := checkEnum(column, value); err != nil {
+		return nil, err
+	}
+	if err := checkRange(column, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
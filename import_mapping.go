@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// importMapping fills the columns of the table, its keys, from the columns
+// of an imported CSV, so files exported by other systems load as they are.
+// Columns of the file the mapping doesn't use are ignored.
+type importMapping map[string]importRule
+
+// importRule fills a column of the table.
+type importRule struct {
+	// From is the header of the column of the file; without it, every row
+	// takes Default.
+	From string `json:"from"`
+	// Trim strips the spaces around the values.
+	Trim bool `json:"trim"`
+	// DateFormat is the Go time layout of the values, e.g. "02/01/2006".
+	DateFormat string `json:"date_format"`
+	// Default replaces empty values.
+	Default *string `json:"default"`
+}
+
+// parseImportMapping reads the mapping of an import.
+func parseImportMapping(data []byte) (importMapping, error) {
+	var mapping importMapping
+	if err := json.Unmarshal(data, &mapping); err != nil || len(mapping) == 0 {
+		return nil, fmt.Errorf("mapping must be a JSON object of column rules")
+	}
+	return mapping, nil
+}
+
+// mappedColumn is a column of the table with the position of its source
+// in the rows of the file, -1 for none.
+type mappedColumn struct {
+	column *Column
+	source int
+	rule   importRule
+}
+
+// resolve checks mapping against the table and the header of the file and
+// returns the columns it fills, in table order.
+func (mapping importMapping) resolve(table *Table, header []string) ([]mappedColumn, error) {
+	var columns []mappedColumn
+	for name := range mapping {
+		if _, ok := table.Column(name); !ok {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+	}
+	for _, column := range table.Columns {
+		rule, ok := mapping[column.Name]
+		if !ok {
+			continue
+		}
+		mapped := mappedColumn{column: column, source: -1, rule: rule}
+		if rule.From != "" {
+			for i, name := range header {
+				if name == rule.From {
+					mapped.source = i
+					break
+				}
+			}
+			if mapped.source < 0 {
+				return nil, fmt.Errorf("mapping of %s: no column %s in the file", column.Name, rule.From)
+			}
+		} else if rule.Default == nil {
+			return nil, fmt.Errorf("mapping of %s: from or default is required", column.Name)
+		}
+		columns = append(columns, mapped)
+	}
+	return columns, nil
+}
+
+// cell returns the value of the mapped column in a row of the file.
+func (m mappedColumn) cell(record []string) (string, error) {
+	value := ""
+	if m.source >= 0 {
+		value = record[m.source]
+	}
+	if m.rule.Trim {
+		value = strings.TrimSpace(value)
+	}
+	if value == "" {
+		if m.rule.Default != nil {
+			return *m.rule.Default, nil
+		}
+		return "", nil
+	}
+	if m.rule.DateFormat == "" {
+		return value, nil
+	}
+	parsed, err := time.Parse(m.rule.DateFormat, value)
+	if err != nil {
+		return "", &fieldError{m.column.Name, fmt.Sprintf("field %s: %q doesn't match %s", m.column.Name, value, m.rule.DateFormat)}
+	}
+	switch m.column.DataType {
+	case "date":
+		return parsed.Format("2006-01-02"), nil
+	case "timestamp without time zone":
+		return parsed.Format("2006-01-02T15:04:05.999999999"), nil
+	}
+	return parsed.Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultImportBatchSize is the batch size of NDJSON imports when the
+	// configuration doesn't set one.
+	defaultImportBatchSize = 500
+	// maxImportBatchSize caps the batch_size a request may ask for.
+	maxImportBatchSize = 10000
+)
+
+// importBatch is the outcome of a batch of an NDJSON import: every record
+// of the lines from FirstLine to LastLine was inserted, or updated or
+// skipped as a duplicate, or none was and Error tells why, with the line
+// and field at fault when a record was.
+type importBatch struct {
+	FirstLine int    `json:"first_line"`
+	LastLine  int    `json:"last_line"`
+	Inserted  int64  `json:"inserted"`
+	Updated   int64  `json:"updated,omitempty"`
+	Skipped   int64  `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Field     string `json:"field,omitempty"`
+}
+
+// handleNDJSONImport serves POST /{table}/_import with an NDJSON body, one
+// record per line, checked like the body of a single insert. Records are
+// inserted in batches of ?batch_size=, each in its own transaction: a bad
+// record or a failed insert rolls its batch back and the import goes on
+// with the next one. Duplicates are resolved with strategy, per batch. The
+// response sums up every batch. With validateOnly, every record is checked
+// and nothing is inserted; the response then details the records at fault
+// as a CSV import does.
+func (de *DbExplorer) handleNDJSONImport(w http.ResponseWriter, r *http.Request, table *Table, validateOnly bool, strategy string) {
+	size, err := de.importBatchSize(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	lines := &ndjsonReader{r: bufio.NewReader(r.Body)}
+	if validateOnly {
+		de.validateNDJSON(w, r, table, lines)
+		return
+	}
+
+	batches := []importBatch{}
+	var total duplicateCounts
+	failed := 0
+	for done := false; !done; {
+		batch := importBatch{}
+		records := make([]map[string]interface{}, 0, size)
+		for len(records) < size {
+			line, data, err := lines.next()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if data == nil {
+				done = true
+				break
+			}
+			if batch.FirstLine == 0 {
+				batch.FirstLine = line
+			}
+			batch.LastLine = line
+			record, err := de.importRecord(r, table, data)
+			if err != nil && batch.Error == "" {
+				batch.Error, batch.Line = err.Error(), line
+				var fe *fieldError
+				if errors.As(err, &fe) {
+					batch.Field = fe.Field
+				}
+			}
+			records = append(records, record)
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		if batch.Error == "" {
+			counts, err := de.insertBatch(r, table, records, strategy)
+			if err != nil {
+				batch.Error = err.Error()
+			}
+			batch.Inserted, batch.Updated, batch.Skipped = counts.inserted, counts.updated, counts.skipped
+			total.add(counts)
+		}
+		if batch.Error != "" {
+			failed += len(records)
+		}
+		batches = append(batches, batch)
+		progressOf(w).add(int64(len(records)))
+	}
+	addRows(r.Context(), total.inserted+total.updated)
+
+	result := map[string]interface{}{
+		"inserted": total.inserted,
+		"failed":   failed,
+		"batches":  batches,
+	}
+	if strategy != duplicateFail {
+		result["updated"] = total.updated
+		result["skipped"] = total.skipped
+	}
+	response := map[string]interface{}{
+		"response": result,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// validateNDJSON checks every record of an NDJSON import.
+func (de *DbExplorer) validateNDJSON(w http.ResponseWriter, r *http.Request, table *Table, lines *ndjsonReader) {
+	skipped := &importErrors{}
+	var valid int64
+	for {
+		line, data, err := lines.next()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if data == nil {
+			break
+		}
+		progressOf(w).add(1)
+		if _, err := de.importRecord(r, table, data); err != nil {
+			skipped.add(line, err)
+			continue
+		}
+		valid++
+	}
+	writeImportResult(w, valid, true, skipped, nil)
+}
+
+// ndjsonReader reads the lines of an NDJSON body.
+type ndjsonReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// next returns the next line that isn't blank with its number, or no line
+// at the end of the body.
+func (nr *ndjsonReader) next() (int, []byte, error) {
+	for {
+		data, err := nr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, nil, fmt.Errorf("reading line %d: %v", nr.line+1, err)
+		}
+		nr.line++
+		if len(bytes.TrimSpace(data)) > 0 {
+			return nr.line, data, nil
+		}
+		if err == io.EOF {
+			return 0, nil, nil
+		}
+	}
+}
+
+// importBatchSize returns the ?batch_size= of r, or the configured one.
+func (de *DbExplorer) importBatchSize(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("batch_size")
+	if raw == "" {
+		if de.cfg.ImportBatchSize > 0 {
+			return de.cfg.ImportBatchSize, nil
+		}
+		return defaultImportBatchSize, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 1 || size > maxImportBatchSize {
+		return 0, fmt.Errorf("batch_size must be between 1 and %d", maxImportBatchSize)
+	}
+	return size, nil
+}
+
+// importRecord decodes a line of an NDJSON import into the values of a new
+// row.
+func (de *DbExplorer) importRecord(r *http.Request, table *Table, line []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	data, err := de.prepareInsert(r, table, object)
+	if err != nil {
+		return nil, err
+	}
+	if err := de.encryptValues(table.Name, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// insertBatch inserts the records of a batch in one transaction, resolving
+// duplicates with strategy, and counts them; nothing is counted when the
+// batch fails.
+func (de *DbExplorer) insertBatch(r *http.Request, table *Table, records []map[string]interface{}, strategy string) (duplicateCounts, error) {
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		return duplicateCounts{}, err
+	}
+	defer tx.Rollback()
+	counts := duplicateCounts{inserted: int64(len(records))}
+	if strategy == duplicateFail {
+		_, err = insertRecords(r.Context(), tx, table, records)
+	} else {
+		counts, err = upsertRecords(r.Context(), tx, table, records, strategy)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return duplicateCounts{}, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+func importRequest(t *testing.T, csv string) *http.Request {
+	return mappedImportRequest(t, "", csv)
+}
+
+// mappedImportRequest uploads csv with mapping, unless it is empty.
+func mappedImportRequest(t *testing.T, mapping, csv string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if mapping != "" {
+		form.WriteField("mapping", mapping)
+	}
+	part, err := form.CreateFormFile("file", "items.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(csv))
+	form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/items/_import", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestImport(t *testing.T) {
+	backend := &fakeStore{}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, importRequest(t, "id,title,price,extra\n"+
+		"9,memcache,1.50,\n"+
+		"10,,2,\n"+
+		"11,redis,cheap,\n"+
+		"12,\"tab\tbed\",,\"{\"\"a\"\":1}\"\n"+
+		"13,short\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"inserted": float64(2),
+			"failed":   float64(3),
+			"errors": []interface{}{
+				map[string]interface{}{"line": float64(3), "error": "missing required fields: title"},
+				map[string]interface{}{"line": float64(4), "field": "price", "error": "field price have invalid type"},
+				map[string]interface{}{"line": float64(6), "error": "wrong number of fields"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+
+	// The generated id is left to the database.
+	if want := []string{"title", "price", "extra"}; !reflect.DeepEqual(backend.columns, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.columns, want)
+	}
+	wantRows := [][]interface{}{
+		{"memcache", "1.50", nil},
+		{"tab\tbed", nil, `{"a":1}`},
+	}
+	if !reflect.DeepEqual(backend.copied, wantRows) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.copied, wantRows)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	cases := []struct {
+		csv string
+		err string
+	}{
+		{"", "reading the header row: EOF"},
+		{"id,colour\n", "unknown field colour"},
+		{"title\n\"unterminated\n", `parse error on line 2, column 15: extraneous or missing " in quoted-field`},
+	}
+	for _, item := range cases {
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, importRequest(t, item.csv))
+		var got map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if w.Code != http.StatusBadRequest || got["error"] != item.err {
+			t.Fatalf("[%q] results not match\nGot : %d %v\nWant: 400 %s", item.csv, w.Code, got["error"], item.err)
+		}
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	backend := &fakeStore{}
+	de := backendExplorer(backend)
+
+	body := `{"title": "memcache", "price": "1.50"}
+{"title": "redis"}
+
+{"title": "mongo", "price": "cheap"}
+{"price": 3}
+{"title": "etcd", "extra": {"a": 1}}
+`
+	r := httptest.NewRequest(http.MethodPost, "/items/_import?batch_size=2", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"inserted": float64(3),
+			"failed":   float64(2),
+			"batches": []interface{}{
+				map[string]interface{}{"first_line": float64(1), "last_line": float64(2), "inserted": float64(2)},
+				map[string]interface{}{"first_line": float64(4), "last_line": float64(5), "inserted": float64(0),
+					"error": "field price have invalid type", "line": float64(4), "field": "price"},
+				map[string]interface{}{"first_line": float64(6), "last_line": float64(6), "inserted": float64(1)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	if len(backend.inserted) != 3 {
+		t.Fatalf("results not match\nGot : %#v\nWant: 3 rows", backend.inserted)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/items/_import?batch_size=0", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d\nWant: 400", w.Code)
+	}
+}
+
+func TestImportMapping(t *testing.T) {
+	backend := &fakeStore{}
+	de := backendExplorer(backend)
+
+	mapping := `{
+		"title": {"from": "Product Name", "trim": true},
+		"price": {"from": "Cost", "default": "0"},
+		"created": {"from": "Added", "date_format": "02/01/2006 15:04 MST"}
+	}`
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, mappedImportRequest(t, mapping, "Ref,Product Name,Cost,Added\n"+
+		"A1,  memcache ,1.50,01/05/2024 12:30 UTC\n"+
+		"A2,redis,,\n"+
+		"A3,mongo,2,2024-05-01\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	wantErrors := []interface{}{
+		map[string]interface{}{"line": float64(4), "field": "created", "error": `field created: "2024-05-01" doesn't match 02/01/2006 15:04 MST`},
+	}
+	if response := got["response"].(map[string]interface{}); response["inserted"] != float64(2) || !reflect.DeepEqual(response["errors"], wantErrors) {
+		t.Fatalf("unexpected response %s", w.Body)
+	}
+	if want := []string{"title", "price", "created"}; !reflect.DeepEqual(backend.columns, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.columns, want)
+	}
+	wantRows := [][]interface{}{
+		{"memcache", "1.50", "2024-05-01T12:30:00Z"},
+		{"redis", "0", nil},
+	}
+	if !reflect.DeepEqual(backend.copied, wantRows) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.copied, wantRows)
+	}
+
+	for mapping, want := range map[string]string{
+		`{"colour": {"from": "Ref"}}`: "unknown field colour",
+		`{"title": {"from": "Name"}}`: "mapping of title: no column Name in the file",
+		`{"title": {}}`:               "mapping of title: from or default is required",
+		`[]`:                          "mapping must be a JSON object of column rules",
+	} {
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, mappedImportRequest(t, mapping, "Ref,Product Name\nA1,memcache\n"))
+		var got map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if w.Code != http.StatusBadRequest || got["error"] != want {
+			t.Fatalf("[%s] results not match\nGot : %d %v\nWant: 400 %s", mapping, w.Code, got["error"], want)
+		}
+	}
+}
+
+func TestImportValidateOnly(t *testing.T) {
+	backend := &fakeStore{}
+	de := backendExplorer(backend)
+
+	r := importRequest(t, "title,price\nmemcache,1.50\nredis,cheap\n")
+	r.URL.RawQuery = "validate_only=true"
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"valid":  float64(1),
+			"failed": float64(1),
+			"errors": []interface{}{
+				map[string]interface{}{"line": float64(3), "field": "price", "error": "field price have invalid type"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/items/_import?validate_only=true", strings.NewReader(`{"title": "memcache"}
+{"price": 3}
+{"title": "redis", "colour": "red"}
+{"title": "etcd"}`))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	got = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{
+		"response": map[string]interface{}{
+			"valid":  float64(2),
+			"failed": float64(2),
+			"errors": []interface{}{
+				map[string]interface{}{"line": float64(2), "error": "missing required fields: title"},
+				map[string]interface{}{"line": float64(3), "field": "colour", "error": "unknown field colour"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	if backend.copied != nil || backend.inserted != nil {
+		t.Fatalf("results not match\nGot : %#v %#v\nWant: nothing written", backend.copied, backend.inserted)
+	}
+}
+
+func TestCopyText(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, `\N`},
+		{"a\tb\nc\\d", `a\tb\nc\\d`},
+		{int64(42), "42"},
+		{true, "t"},
+		{[]byte(`{"a":1}`), `{"a":1}`},
+	}
+	for _, item := range cases {
+		if got := copyText(item.value); got != item.want {
+			t.Fatalf("[%#v] results not match\nGot : %s\nWant: %s", item.value, got, item.want)
+		}
+	}
+}
+
+func TestImportDuplicates(t *testing.T) {
+	backend := &fakeStore{duplicate: func(columns []string, row []interface{}) bool {
+		for i, column := range columns {
+			if column == "title" {
+				return row[i] == "memcache"
+			}
+		}
+		return false
+	}}
+	de := backendExplorer(backend)
+
+	r := importRequest(t, "title,price\nmemcache,2\nredis,3\n")
+	r.URL.RawQuery = "on_duplicate=update"
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"inserted": float64(1),
+			"updated":  float64(1),
+			"skipped":  float64(0),
+			"failed":   float64(0),
+			"errors":   []interface{}{},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	wantConflict := &querybuilder.OnConflict{Columns: []string{"title"}, Update: []string{"price"}}
+	if !reflect.DeepEqual(backend.conflict, wantConflict) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.conflict, wantConflict)
+	}
+	if backend.copied != nil || len(backend.inserted) != 1 {
+		t.Fatalf("results not match\nGot : %#v %#v\nWant: 1 row inserted", backend.copied, backend.inserted)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/items/_import?on_duplicate=skip&batch_size=2", strings.NewReader(`{"title": "memcache"}
+{"title": "redis"}
+{"title": "etcd"}`))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	got = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{
+		"response": map[string]interface{}{
+			"inserted": float64(2),
+			"updated":  float64(0),
+			"skipped":  float64(1),
+			"failed":   float64(0),
+			"batches": []interface{}{
+				map[string]interface{}{"first_line": float64(1), "last_line": float64(2), "inserted": float64(1), "skipped": float64(1)},
+				map[string]interface{}{"first_line": float64(3), "last_line": float64(3), "inserted": float64(1)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	if !reflect.DeepEqual(backend.conflict, &querybuilder.OnConflict{}) {
+		t.Fatalf("results not match\nGot : %#v\nWant: no conflict target", backend.conflict)
+	}
+
+	// Updating needs a unique key among the imported columns.
+	r = importRequest(t, "price\n2\n")
+	r.URL.RawQuery = "on_duplicate=update"
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d %s\nWant: 400", w.Code, w.Body)
+	}
+
+	r = importRequest(t, "title\nmemcache\n")
+	r.URL.RawQuery = "on_duplicate=replace"
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d\nWant: 400", w.Code)
+	}
+}
+
+func TestImportNested(t *testing.T) {
+	backend := &fakeStore{lastID: 40}
+	de := backendExplorer(backend)
+
+	body := `[
+		{"title": "memcache", "order_items": [{"order_id": 7, "line": 1}, {"order_id": 7, "line": 2}]},
+		{"title": "redis", "order_items": []}
+	]`
+	r := httptest.NewRequest(http.MethodPost, "/items/_import", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"inserted": map[string]interface{}{"items": float64(2), "order_items": float64(2)},
+			"ids":      []interface{}{float64(41), float64(42)},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	// The line items reference the generated key of their item.
+	wantRows := [][]interface{}{
+		{"memcache"},
+		{int64(7), int64(1), int64(41)},
+		{int64(7), int64(2), int64(41)},
+		{"redis"},
+	}
+	if !reflect.DeepEqual(backend.inserted, wantRows) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.inserted, wantRows)
+	}
+
+	cases := []struct {
+		body   string
+		status int
+		error  string
+	}{
+		{`{"title": "etcd", "order_items": [{"order_id": 7, "line": 1, "item_id": 3}]}`, http.StatusBadRequest, "[0].order_items[0]: item_id is set by the parent record"},
+		{`{"title": "etcd", "order_items": [{"order_id": 7, "line": "one"}]}`, http.StatusBadRequest, "[0].order_items[0]: field line have invalid type"},
+		{`{"title": "etcd", "order_items": {"order_id": 7}}`, http.StatusBadRequest, "[0]: order_items must be an array of records"},
+	}
+	for _, item := range cases {
+		backend.inserted = nil
+		r := httptest.NewRequest(http.MethodPost, "/items/_import", strings.NewReader(item.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, r)
+		if w.Code != item.status || !strings.Contains(w.Body.String(), item.error) {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.body, w.Code, w.Body, item.status, item.error)
+		}
+		if backend.inserted != nil {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: nothing committed", item.body, backend.inserted)
+		}
+	}
+}
+
+func TestPostRecordNested(t *testing.T) {
+	backend := &fakeStore{lastID: 40}
+	de := backendExplorer(backend)
+
+	body := `{"title": "memcache", "order_items": [
+		{"_op": "create", "order_id": 7, "line": 3},
+		{"_op": "delete", "order_id": 8, "line": 2}
+	]}`
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/5", strings.NewReader(body)))
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"updated": float64(1),
+			"children": map[string]interface{}{
+				"order_items": []interface{}{
+					map[string]interface{}{"id": map[string]interface{}{"order_id": float64(7), "line": float64(3)}, "status": "created"},
+					map[string]interface{}{"id": map[string]interface{}{"order_id": float64(8), "line": float64(2)}, "status": "deleted"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	// The children are scoped to the record.
+	wantChanged := []string{
+		`UPDATE "public"."items" SET "title" = $1 WHERE "id" = $2 [memcache 5]`,
+		`DELETE FROM "public"."order_items" WHERE "order_id" = $1 AND "line" = $2 AND "item_id" = $3 [8 2 5]`,
+	}
+	if !reflect.DeepEqual(backend.changed, wantChanged) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.changed, wantChanged)
+	}
+	if want := [][]interface{}{{int64(7), int64(3), int64(5)}}; !reflect.DeepEqual(backend.inserted, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.inserted, want)
+	}
+
+	cases := []struct {
+		body   string
+		absent string
+		status int
+		error  string
+	}{
+		{`{"order_items": [{"order_id": 7, "line": 1, "item_id": 3}]}`, "", http.StatusBadRequest, "order_items[0]: item_id is set by the parent record"},
+		{`{"order_items": [{"_op": "merge", "order_id": 7, "line": 1}]}`, "", http.StatusBadRequest, "order_items[0]: _op must be create, update or delete"},
+		{`{"order_items": [{"_op": "delete", "order_id": 7}]}`, "", http.StatusBadRequest, "order_items[0]: delete needs the primary key"},
+		{`{"order_items": [{"order_id": 7, "line": 1}]}`, "", http.StatusBadRequest, "order_items[0]: no fields to update"},
+		{`{"order_items": [{"_op": "create", "order_id": 7, "line": 4}, {"_op": "delete", "order_id": 7, "line": 2}]}`, "order_items", http.StatusNotFound, `"status":"rolled_back"`},
+		{`{"title": "redis", "order_items": []}`, "items", http.StatusNotFound, "record not found"},
+	}
+	// The record the children without an update of its own are checked
+	// against.
+	backend.records = []map[string]interface{}{{"id": int64(5)}}
+	for _, item := range cases {
+		backend.changed, backend.absent = nil, item.absent
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/5", strings.NewReader(item.body)))
+		if w.Code != item.status || !strings.Contains(w.Body.String(), item.error) {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.body, w.Code, w.Body, item.status, item.error)
+		}
+		if backend.changed != nil {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: nothing committed", item.body, backend.changed)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// injectValues overwrites the columns configured in Config.Inject with values
+// taken from the request, so clients can't forge ownership columns. Rules
+// for columns table doesn't have are skipped, those of "*" in particular.
+func (de *DbExplorer) injectValues(r *http.Request, table *Table, data map[string]interface{}) error {
+	for _, rules := range []map[string]string{de.cfg.Inject["*"], de.cfg.Inject[table.Name]} {
+		for column, tmpl := range rules {
+			if _, ok := table.Column(column); !ok {
+				continue
+			}
+			value, err := resolveTemplate(r, tmpl)
+			if err != nil {
+				return fmt.Errorf("%s: %v", column, err)
+			}
+			data[column] = value
+		}
+	}
+	return nil
+}
+
+// resolveTemplate expands a single {{source.name}} placeholder; anything else
+// is used as a literal value.
+func resolveTemplate(r *http.Request, tmpl string) (string, error) {
+	if !strings.HasPrefix(tmpl, "{{") || !strings.HasSuffix(tmpl, "}}") {
+		return tmpl, nil
+	}
+	expr := strings.TrimSpace(tmpl[2 : len(tmpl)-2])
+	source, name, _ := strings.Cut(expr, ".")
+
+	var value string
+	switch source {
+	case "header":
+		value = r.Header.Get(name)
+	case "auth":
+		id := identityFromRequest(r)
+		if id == nil {
+			return "", fmt.Errorf("request is not authenticated")
+		}
+		if name == "subject" {
+			value = id.Subject
+		} else {
+			value = id.Attributes[name]
+		}
+	default:
+		return "", fmt.Errorf("unknown template source %q", source)
+	}
+	if value == "" {
+		return "", fmt.Errorf("no value for %s", expr)
+	}
+	return value, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInjectValues(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	de.cfg.Inject = map[string]map[string]string{
+		"*":     {"tenant": "{{header.X-Tenant}}", "owner": "{{auth.subject}}", "source": "api"},
+		"items": {"owner": "{{auth.team}}"},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/items", nil)
+	r.Header.Set("X-Tenant", "acme")
+	r = withIdentity(r, &Identity{Subject: "ann", Attributes: map[string]string{"team": "sales"}})
+	columns := func(names ...string) []*Column {
+		var columns []*Column
+		for _, name := range names {
+			columns = append(columns, &Column{Name: name, DataType: "text"})
+		}
+		return columns
+	}
+
+	// Table rules win over the ones for every table, and both over the
+	// values the client sent. Columns the table lacks aren't injected.
+	cases := []struct {
+		table *Table
+		want  map[string]interface{}
+	}{
+		{&Table{Name: "items", Columns: columns("title", "tenant", "owner", "source")}, map[string]interface{}{"title": "memcache", "tenant": "acme", "owner": "sales", "source": "api"}},
+		{&Table{Name: "order_items", Columns: columns("title", "tenant", "owner")}, map[string]interface{}{"title": "memcache", "tenant": "acme", "owner": "ann"}},
+	}
+	for _, item := range cases {
+		data := map[string]interface{}{"title": "memcache", "tenant": "forged", "owner": "eve"}
+		if err := de.injectValues(r, item.table, data); err != nil || !reflect.DeepEqual(data, item.want) {
+			t.Fatalf("[%s] results not match\nGot : %v %v\nWant: %v", item.table.Name, data, err, item.want)
+		}
+	}
+}
+
+func TestInjectUpdateNothing(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	de.cfg.Inject = map[string]map[string]string{"*": {"owner": "{{auth.subject}}"}}
+	r := withIdentity(httptest.NewRequest(http.MethodPost, "/order_items/1,2", strings.NewReader(`{}`)), &Identity{Subject: "ann"})
+	w := httptest.NewRecorder()
+	de.route(w, r)
+	if want := `{"error":"no fields to update"}` + "\n"; w.Code != http.StatusBadRequest || w.Body.String() != want {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d %s", w.Code, w.Body, http.StatusBadRequest, want)
+	}
+}
+
+func TestResolveTemplate(t *testing.T) {
+	anonymous := httptest.NewRequest(http.MethodPost, "/items", nil)
+	anonymous.Header.Set("X-Tenant", "acme")
+	authenticated := withIdentity(anonymous, &Identity{Subject: "ann"})
+
+	cases := []struct {
+		r     *http.Request
+		tmpl  string
+		value string
+		fails bool
+	}{
+		{anonymous, "literal", "literal", false},
+		{anonymous, "{{ header.X-Tenant }}", "acme", false},
+		{anonymous, "{{header.X-Region}}", "", true},
+		{anonymous, "{{auth.subject}}", "", true},
+		{authenticated, "{{auth.subject}}", "ann", false},
+		{authenticated, "{{auth.team}}", "", true},
+		{authenticated, "{{query.owner}}", "", true},
+	}
+	for _, item := range cases {
+		value, err := resolveTemplate(item.r, item.tmpl)
+		if value != item.value || (err != nil) != item.fails {
+			t.Fatalf("[%s] results not match\nGot : %q %v\nWant: %q, failing %v", item.tmpl, value, err, item.value, item.fails)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Package querybuilder renders SQL from a small typed syntax tree, so the
+// explorer never assembles statements by hand: identifiers are always quoted
+// by the dialect and values always travel as arguments.
+package querybuilder
+
+// Table names a table, optionally qualified by its schema.
+type Table struct {
+	Schema string
+	Name   string
+}
+
+// Statement is a complete SQL statement: Select, Insert, Update, Delete,
+// Refresh or Invoke.
+type Statement interface {
+	statement(b *builder)
+}
+
+// Select reads Columns of the rows of From matching Where.
+type Select struct {
+	Columns []Projection
+	From    Table
+	// Where is optional; an empty And selects every row.
+	Where   Expr
+	GroupBy []string
+	OrderBy []Sort
+	// Page is optional; without it every matching row is returned.
+	Page *Page
+}
+
+// Insert adds Rows of values for Columns; a row value may be DefaultValue.
+// Without columns a single row of defaults is inserted.
+type Insert struct {
+	Into    Table
+	Columns []string
+	Rows    [][]interface{}
+	// OnConflict is optional; without it a duplicate row fails the insert.
+	OnConflict *OnConflict
+	Returning  []Projection
+}
+
+// OnConflict resolves the rows of an Insert that duplicate the unique key
+// of Columns: they are skipped, unless Update names the columns they set on
+// the existing row. Without Columns, rows duplicating any unique key are
+// skipped.
+type OnConflict struct {
+	Columns []string
+	Update  []string
+}
+
+// Update assigns Set on the rows of Table matching Where.
+type Update struct {
+	Table Table
+	Set   []Assign
+	Where Expr
+}
+
+// Delete removes the rows of From matching Where.
+type Delete struct {
+	From  Table
+	Where Expr
+}
+
+// Refresh recomputes the materialized view View, without locking out its
+// readers when Concurrently, which needs a unique index on the view. It is
+// a PostgreSQL statement.
+type Refresh struct {
+	View         Table
+	Concurrently bool
+}
+
+// Invoke reads the rows returned by the stored function Function called
+// with Args, passed by name so that their order doesn't matter and the
+// arguments left out take their defaults. Where, OrderBy and Page apply to
+// those rows as they do to the rows of a Select. It is a PostgreSQL
+// statement.
+type Invoke struct {
+	Function Table
+	Args     []NamedArg
+	Where    Expr
+	OrderBy  []Sort
+	Page     *Page
+}
+
+// NamedArg is an argument of Invoke, sent as an argument of the statement.
+type NamedArg struct {
+	Name  string
+	Value interface{}
+}
+
+// Assign sets Column to Value in an Update. Value is sent as an argument,
+// unless it is a Scalar the database computes.
+type Assign struct {
+	Column string
+	Value  interface{}
+}
+
+// Scalar is a value computed from the columns of the row: Col, Param,
+// Arith, Neg or Call.
+type Scalar interface {
+	scalar(b *builder)
+}
+
+// Param is a Value sent as an argument, cast to Type when set.
+type Param struct {
+	Value interface{}
+	Type  string
+}
+
+// ArithOp is an arithmetic operator.
+type ArithOp string
+
+const (
+	Add ArithOp = "+"
+	Sub ArithOp = "-"
+	Mul ArithOp = "*"
+	Div ArithOp = "/"
+)
+
+// Arith is Left Op Right.
+type Arith struct {
+	Left  Scalar
+	Op    ArithOp
+	Right Scalar
+}
+
+// Neg is -Value.
+type Neg struct {
+	Value Scalar
+}
+
+// Func is a function of Call.
+type Func string
+
+const (
+	Lower    Func = "LOWER"
+	Upper    Func = "UPPER"
+	Trim     Func = "TRIM"
+	Abs      Func = "ABS"
+	Round    Func = "ROUND"
+	Coalesce Func = "COALESCE"
+)
+
+// Call is Func applied to Args.
+type Call struct {
+	Func Func
+	Args []Scalar
+}
+
+// DefaultValue stands for the column default in an Insert row.
+type DefaultValue struct{}
+
+// GeoJSON is a GeoJSON geometry, stored as a value of a spatial column
+// through ST_GeomFromGeoJSON.
+type GeoJSON string
+
+// Projection is a selected or returned value.
+type Projection interface {
+	projection(b *builder)
+}
+
+// Col is a column.
+type Col string
+
+// Cols turns column names into projections.
+func Cols(names ...string) []Projection {
+	projections := make([]Projection, len(names))
+	for i, name := range names {
+		projections[i] = Col(name)
+	}
+	return projections
+}
+
+// Count is COUNT(*), named As when set.
+type Count struct {
+	As string
+}
+
+// Inserted is true for a row an Insert added and false for one it updated
+// on conflict, named As.
+type Inserted struct {
+	As string
+}
+
+// AsGeoJSON is the spatial Column as a GeoJSON geometry, named after it.
+type AsGeoJSON struct {
+	Column string
+}
+
+// Lit is an integer constant.
+type Lit int
+
+// Rank is the full-text rank of the concatenated Columns against Query,
+// named As.
+type Rank struct {
+	Columns []string
+	Query   string
+	As      string
+}
+
+// Sort orders by Column, ascending unless Desc.
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// Page is LIMIT Limit OFFSET Offset; a negative Limit skips Offset rows and
+// returns all the others.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// Expr is a condition.
+type Expr interface {
+	expr(b *builder)
+}
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	Eq    Op = "="
+	Neq   Op = "<>"
+	Gt    Op = ">"
+	Gte   Op = ">="
+	Lt    Op = "<"
+	Lte   Op = "<="
+	Like  Op = "LIKE"
+	ILike Op = "ILIKE"
+)
+
+// Compare is Column Op Value.
+type Compare struct {
+	Column string
+	Op     Op
+	Value  interface{}
+}
+
+// In matches Column against a list of values.
+type In struct {
+	Column string
+	Values []interface{}
+}
+
+// AnyOf matches Column against Values given as text and cast to Type, so
+// every key type shares one statement.
+type AnyOf struct {
+	Column string
+	Type   string
+	Values []string
+}
+
+// IsNull is Column IS NULL.
+type IsNull struct {
+	Column string
+}
+
+// IsBool is Column IS TRUE or IS FALSE.
+type IsBool struct {
+	Column string
+	Value  bool
+}
+
+// TextSearch matches the concatenated Columns against a full-text Query.
+type TextSearch struct {
+	Columns []string
+	Query   string
+}
+
+// BBox holds when the bounding box of the spatial Column intersects the box
+// of WGS 84 coordinates MinX, MinY, MaxX, MaxY. Geography is set for
+// geography columns, whose boxes are compared as such.
+type BBox struct {
+	Column                 string
+	MinX, MinY, MaxX, MaxY float64
+	Geography              bool
+}
+
+// Orphaned holds for the rows of Table whose Columns are all set but match
+// no row of Parent on RefColumns, the rows a foreign key would reject.
+type Orphaned struct {
+	Table      Table
+	Columns    []string
+	Parent     Table
+	RefColumns []string
+}
+
+// And holds when every condition does; an empty And always holds.
+type And []Expr
+
+// Or holds when any condition does.
+type Or []Expr
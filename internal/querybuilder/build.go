@@ -0,0 +1,384 @@
+package querybuilder
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Build renders stmt for d, returning the SQL and its arguments in
+// placeholder order.
+func Build(d Dialect, stmt Statement) (string, []interface{}) {
+	b := &builder{dialect: d}
+	stmt.statement(b)
+	return b.sql.String(), b.args
+}
+
+type builder struct {
+	dialect Dialect
+	sql     strings.Builder
+	args    []interface{}
+}
+
+func (b *builder) write(s string) {
+	b.sql.WriteString(s)
+}
+
+func (b *builder) ident(name string) {
+	b.write(b.dialect.QuoteIdent(name))
+}
+
+func (b *builder) identList(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(name)
+	}
+}
+
+func (b *builder) table(t Table) {
+	if t.Schema != "" {
+		b.ident(t.Schema)
+		b.write(".")
+	}
+	b.ident(t.Name)
+}
+
+// arg adds value as the next argument and writes its placeholder.
+func (b *builder) arg(value interface{}) {
+	if geometry, ok := value.(GeoJSON); ok {
+		b.write("ST_GeomFromGeoJSON(")
+		defer b.write(")")
+		value = string(geometry)
+	}
+	b.args = append(b.args, value)
+	b.write(b.dialect.Placeholder(len(b.args)))
+}
+
+func (b *builder) projections(projections []Projection) {
+	for i, projection := range projections {
+		if i > 0 {
+			b.write(", ")
+		}
+		projection.projection(b)
+	}
+}
+
+// where writes the WHERE clause, nothing for a missing or empty condition.
+// A top-level And needs no parentheses.
+func (b *builder) where(e Expr) {
+	if isEmpty(e) {
+		return
+	}
+	b.write(" WHERE ")
+	if and, ok := e.(And); ok {
+		b.junction(and, " AND ", false)
+		return
+	}
+	e.expr(b)
+}
+
+func isEmpty(e Expr) bool {
+	switch e := e.(type) {
+	case nil:
+		return true
+	case And:
+		for _, item := range e {
+			if !isEmpty(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// junction joins the non-empty items with sep, parenthesized when there
+// is more than one.
+func (b *builder) junction(items []Expr, sep string, parens bool) {
+	var live []Expr
+	for _, item := range items {
+		if !isEmpty(item) {
+			live = append(live, item)
+		}
+	}
+	if parens && len(live) > 1 {
+		b.write("(")
+		defer b.write(")")
+	}
+	for i, item := range live {
+		if i > 0 {
+			b.write(sep)
+		}
+		item.expr(b)
+	}
+}
+
+func (s Select) statement(b *builder) {
+	b.write("SELECT ")
+	b.projections(s.Columns)
+	b.write(" FROM ")
+	b.table(s.From)
+	b.where(s.Where)
+	if len(s.GroupBy) > 0 {
+		b.write(" GROUP BY ")
+		b.identList(s.GroupBy)
+	}
+	b.orderBy(s.OrderBy)
+	b.page(s.Page)
+}
+
+func (b *builder) orderBy(terms []Sort) {
+	for i, sort := range terms {
+		if i == 0 {
+			b.write(" ORDER BY ")
+		} else {
+			b.write(", ")
+		}
+		b.ident(sort.Column)
+		if sort.Desc {
+			b.write(" DESC")
+		} else {
+			b.write(" ASC")
+		}
+	}
+}
+
+func (b *builder) page(page *Page) {
+	if page == nil {
+		return
+	}
+	limit := strconv.Itoa(page.Limit)
+	if page.Limit < 0 {
+		limit = b.dialect.noLimit()
+	}
+	b.write(" LIMIT " + limit + " OFFSET " + strconv.Itoa(page.Offset))
+}
+
+func (s Insert) statement(b *builder) {
+	b.write("INSERT INTO ")
+	b.table(s.Into)
+	if len(s.Columns) == 0 {
+		b.dialect.defaultRow(b)
+	} else {
+		b.write(" (")
+		b.identList(s.Columns)
+		b.write(") VALUES ")
+		for i, row := range s.Rows {
+			if i > 0 {
+				b.write(", ")
+			}
+			b.write("(")
+			for j, value := range row {
+				if j > 0 {
+					b.write(", ")
+				}
+				if _, ok := value.(DefaultValue); ok {
+					b.write("DEFAULT")
+				} else {
+					b.arg(value)
+				}
+			}
+			b.write(")")
+		}
+	}
+	if s.OnConflict != nil {
+		b.dialect.onConflict(b, s.Columns, *s.OnConflict)
+	}
+	b.dialect.returning(b, s.Returning)
+}
+
+func (s Update) statement(b *builder) {
+	b.write("UPDATE ")
+	b.table(s.Table)
+	b.write(" SET ")
+	for i, assign := range s.Set {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(assign.Column)
+		b.write(" = ")
+		if scalar, ok := assign.Value.(Scalar); ok {
+			scalar.scalar(b)
+			continue
+		}
+		b.arg(assign.Value)
+	}
+	b.where(s.Where)
+}
+
+func (s Delete) statement(b *builder) {
+	b.write("DELETE FROM ")
+	b.table(s.From)
+	b.where(s.Where)
+}
+
+func (s Refresh) statement(b *builder) {
+	b.write("REFRESH MATERIALIZED VIEW ")
+	if s.Concurrently {
+		b.write("CONCURRENTLY ")
+	}
+	b.table(s.View)
+}
+
+func (s Invoke) statement(b *builder) {
+	b.write("SELECT * FROM ")
+	b.table(s.Function)
+	b.write("(")
+	for i, arg := range s.Args {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(arg.Name)
+		b.write(" => ")
+		b.arg(arg.Value)
+	}
+	b.write(")")
+	b.where(s.Where)
+	b.orderBy(s.OrderBy)
+	b.page(s.Page)
+}
+
+func (c Col) projection(b *builder) { b.ident(string(c)) }
+
+func (c Col) scalar(b *builder) { b.ident(string(c)) }
+
+func (p Param) scalar(b *builder) {
+	if p.Type == "" {
+		b.arg(p.Value)
+		return
+	}
+	b.write("CAST(")
+	b.arg(p.Value)
+	b.write(" AS " + p.Type + ")")
+}
+
+func (a Arith) scalar(b *builder) {
+	b.write("(")
+	a.Left.scalar(b)
+	b.write(" " + string(a.Op) + " ")
+	a.Right.scalar(b)
+	b.write(")")
+}
+
+// Neg is parenthesized, since two minus signs in a row start a comment.
+func (n Neg) scalar(b *builder) {
+	b.write("(-")
+	n.Value.scalar(b)
+	b.write(")")
+}
+
+func (c Call) scalar(b *builder) {
+	b.write(string(c.Func) + "(")
+	for i, arg := range c.Args {
+		if i > 0 {
+			b.write(", ")
+		}
+		arg.scalar(b)
+	}
+	b.write(")")
+}
+
+func (c Count) projection(b *builder) {
+	b.write("COUNT(*)")
+	if c.As != "" {
+		b.write(" AS ")
+		b.ident(c.As)
+	}
+}
+
+func (g AsGeoJSON) projection(b *builder) {
+	b.dialect.asGeoJSON(b, g.Column)
+	b.write(" AS ")
+	b.ident(g.Column)
+}
+
+func (l Lit) projection(b *builder) { b.write(strconv.Itoa(int(l))) }
+
+func (i Inserted) projection(b *builder) {
+	b.dialect.inserted(b)
+	b.write(" AS ")
+	b.ident(i.As)
+}
+
+func (r Rank) projection(b *builder) {
+	b.dialect.rank(b, r.Columns, r.Query)
+	b.write(" AS ")
+	b.ident(r.As)
+}
+
+func (c Compare) expr(b *builder) {
+	if c.Op == ILike {
+		b.dialect.ilike(b, c.Column, c.Value)
+		return
+	}
+	b.ident(c.Column)
+	b.write(" " + string(c.Op) + " ")
+	b.arg(c.Value)
+}
+
+func (c In) expr(b *builder) {
+	b.ident(c.Column)
+	b.write(" IN (")
+	for i, value := range c.Values {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.arg(value)
+	}
+	b.write(")")
+}
+
+func (c AnyOf) expr(b *builder) { b.dialect.anyOf(b, c) }
+
+func (c IsNull) expr(b *builder) {
+	b.ident(c.Column)
+	b.write(" IS NULL")
+}
+
+func (c IsBool) expr(b *builder) {
+	b.ident(c.Column)
+	if c.Value {
+		b.write(" IS TRUE")
+	} else {
+		b.write(" IS FALSE")
+	}
+}
+
+func (c TextSearch) expr(b *builder) { b.dialect.textSearch(b, c.Columns, c.Query) }
+
+func (c BBox) expr(b *builder) { b.dialect.bbox(b, c) }
+
+// parentAlias names the parent of Orphaned in its subquery, which may be
+// the same table.
+const parentAlias = "_parent"
+
+func (c Orphaned) expr(b *builder) {
+	b.write("(")
+	for _, column := range c.Columns {
+		b.ident(column)
+		b.write(" IS NOT NULL AND ")
+	}
+	b.write("NOT EXISTS (SELECT 1 FROM ")
+	b.table(c.Parent)
+	b.write(" AS ")
+	b.ident(parentAlias)
+	b.write(" WHERE ")
+	for i, column := range c.Columns {
+		if i > 0 {
+			b.write(" AND ")
+		}
+		b.ident(parentAlias)
+		b.write(".")
+		b.ident(c.RefColumns[i])
+		b.write(" = ")
+		b.table(c.Table)
+		b.write(".")
+		b.ident(column)
+	}
+	b.write("))")
+}
+
+func (c And) expr(b *builder) { b.junction(c, " AND ", true) }
+
+func (c Or) expr(b *builder) { b.junction(c, " OR ", true) }
@@ -0,0 +1,145 @@
+package querybuilder
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+var items = Table{Schema: "public", Name: "items"}
+
+// statements covers every node; each dialect's rendering of them is kept in
+// testdata/<dialect>.golden.
+var statements = []struct {
+	name string
+	stmt Statement
+}{
+	{"select all", Select{Columns: Cols("id", "title"), From: Table{Name: "items"}}},
+	{"select filtered", Select{
+		Columns: Cols("id"),
+		From:    items,
+		Where: And{
+			Compare{"age", Gt, int64(30)},
+			Compare{"title", ILike, "mem%"},
+			In{"id", []interface{}{int64(1), int64(2)}},
+			IsNull{"updated"},
+			IsBool{"active", false},
+		},
+		OrderBy: []Sort{{"title", false}, {"id", true}},
+		Page:    &Page{Limit: 10, Offset: 20},
+	}},
+	{"select empty where", Select{Columns: Cols("id"), From: items, Where: And{And{}}, Page: &Page{Limit: 0}}},
+	{"select offset only", Select{Columns: Cols("id"), From: items, Page: &Page{Limit: -1, Offset: 20}}},
+	{"select keyset", Select{
+		Columns: Cols("id", "title"),
+		From:    items,
+		Where: And{
+			Compare{"title", Like, "a%"},
+			Or{
+				And{Compare{"title", Lt, "m"}},
+				And{Compare{"title", Eq, "m"}, Compare{"id", Gt, int64(7)}},
+			},
+		},
+		OrderBy: []Sort{{"title", true}, {"id", false}},
+	}},
+	{"count", Select{Columns: []Projection{Count{}}, From: items, Where: And{Compare{"id", Neq, int64(1)}}}},
+	{"distinct", Select{
+		Columns: []Projection{Col("title"), Count{As: "count"}},
+		From:    items,
+		Where:   And{IsNull{"updated"}},
+		GroupBy: []string{"title"},
+		OrderBy: []Sort{{"title", false}},
+		Page:    &Page{Limit: 50},
+	}},
+	{"search", Select{
+		Columns: append(Cols("id"), Rank{Columns: []string{"title", "description"}, Query: "fast cache", As: "_rank"}),
+		From:    items,
+		Where:   And{TextSearch{Columns: []string{"title", "description"}, Query: "fast cache"}, Compare{"id", Gte, int64(2)}},
+		OrderBy: []Sort{{"_rank", true}},
+		Page:    &Page{Limit: 5},
+	}},
+	{"insert", Insert{Into: items, Columns: []string{"title", "price"}, Rows: [][]interface{}{{"a", "1.5"}}, Returning: Cols("id")}},
+	{"insert bulk", Insert{
+		Into:      items,
+		Columns:   []string{"title", "price"},
+		Rows:      [][]interface{}{{"a", DefaultValue{}}, {"b", "2"}},
+		Returning: []Projection{Lit(1)},
+	}},
+	{"insert defaults", Insert{Into: items, Returning: Cols("id")}},
+	{"insert skip duplicates", Insert{
+		Into:       items,
+		Columns:    []string{"title", "price"},
+		Rows:       [][]interface{}{{"a", "1.5"}},
+		OnConflict: &OnConflict{},
+		Returning:  []Projection{Inserted{As: "inserted"}},
+	}},
+	{"insert update duplicates", Insert{
+		Into:       items,
+		Columns:    []string{"title", "price"},
+		Rows:       [][]interface{}{{"a", "1.5"}},
+		OnConflict: &OnConflict{Columns: []string{"title"}, Update: []string{"price"}},
+		Returning:  []Projection{Inserted{As: "inserted"}},
+	}},
+	{"spatial", Select{
+		Columns: append(Cols("id"), AsGeoJSON{"location"}),
+		From:    items,
+		Where:   And{BBox{Column: "location", MinX: 13.3, MinY: 52.4, MaxX: 13.5, MaxY: 52.6}, BBox{Column: "area", MaxX: 1, MaxY: 1, Geography: true}},
+	}},
+	{"insert geometry", Insert{Into: items, Columns: []string{"location"}, Rows: [][]interface{}{{GeoJSON(`{"type":"Point","coordinates":[13.4,52.5]}`)}}}},
+	{"orphans", Select{
+		Columns: Cols("id"),
+		From:    items,
+		Where:   And{Orphaned{Table: items, Columns: []string{"order_id", "line"}, Parent: Table{Schema: "public", Name: "lines"}, RefColumns: []string{"order", "no"}}},
+		Page:    &Page{Limit: 500},
+	}},
+	{"update", Update{Table: items, Set: []Assign{{"title", "x"}, {"price", nil}}, Where: And{Compare{"id", Eq, int64(3)}, Compare{"line", Eq, int64(1)}}}},
+	{"update expression", Update{Table: items, Set: []Assign{
+		{"price", Arith{Col("price"), Mul, Param{"1.1", "numeric"}}},
+		{"title", Call{Upper, []Scalar{Call{Trim, []Scalar{Col("title")}}}}},
+		{"stock", Neg{Neg{Call{Coalesce, []Scalar{Col("stock"), Param{int64(0), ""}}}}}},
+	}, Where: And{Compare{"price", Gt, int64(10)}}}},
+	{"delete", Delete{From: items, Where: And{Compare{"id", Eq, int64(3)}}}},
+	{"delete any", Delete{From: items, Where: AnyOf{Column: "id", Type: "integer", Values: []string{"1", "2"}}}},
+	{"refresh", Refresh{View: Table{Schema: "public", Name: "sales"}, Concurrently: true}},
+	{"invoke", Invoke{Function: Table{Schema: "public", Name: "sales_since"}, Args: []NamedArg{{"since", "2024-01-01"}, {"region", "EU"}}}},
+	{"invoke without arguments", Invoke{Function: Table{Schema: "public", Name: "now"}}},
+	{"invoke filtered", Invoke{
+		Function: Table{Schema: "public", Name: "sales_since"},
+		Args:     []NamedArg{{"since", "2024-01-01"}},
+		Where:    And{Compare{"total", Gt, int64(10)}},
+		OrderBy:  []Sort{{Column: "total", Desc: true}},
+		Page:     &Page{Limit: 20, Offset: 40},
+	}},
+	{"quoting", Select{Columns: Cols(`we"ird`, "se`lect"), From: Table{Schema: "my schema", Name: "t"}}},
+}
+
+func TestGolden(t *testing.T) {
+	dialects := map[string]Dialect{"postgres": Postgres{}, "mysql": MySQL{}}
+	for name, dialect := range dialects {
+		var out strings.Builder
+		for _, item := range statements {
+			query, args := Build(dialect, item.stmt)
+			fmt.Fprintf(&out, "-- %s\n%s\n%#v\n\n", item.name, query, args)
+		}
+
+		path := filepath.Join("testdata", name+".golden")
+		if *update {
+			if err := os.WriteFile(path, []byte(out.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(want) {
+			t.Fatalf("%s: results not match, rerun with -update and review the diff\nGot :\n%s", name, out.String())
+		}
+	}
+}
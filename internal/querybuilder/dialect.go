@@ -0,0 +1,228 @@
+package querybuilder
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Dialect is the SQL flavor statements are rendered for. Besides quoting and
+// placeholders, it renders the forms without a portable syntax.
+type Dialect interface {
+	// QuoteIdent quotes a single identifier.
+	QuoteIdent(name string) string
+	// Placeholder is the placeholder of the nth argument, counted from 1.
+	Placeholder(n int) string
+
+	ilike(b *builder, column string, value interface{})
+	anyOf(b *builder, node AnyOf)
+	textSearch(b *builder, columns []string, query string)
+	rank(b *builder, columns []string, query string)
+	defaultRow(b *builder)
+	onConflict(b *builder, columns []string, conflict OnConflict)
+	inserted(b *builder)
+	returning(b *builder, projections []Projection)
+	asGeoJSON(b *builder, column string)
+	bbox(b *builder, node BBox)
+	// noLimit is the LIMIT of a page without one.
+	noLimit() string
+}
+
+// Postgres renders PostgreSQL.
+type Postgres struct{}
+
+func (Postgres) QuoteIdent(name string) string { return pq.QuoteIdentifier(name) }
+
+func (Postgres) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (Postgres) ilike(b *builder, column string, value interface{}) {
+	b.ident(column)
+	b.write(" ILIKE ")
+	b.arg(value)
+}
+
+func (Postgres) anyOf(b *builder, node AnyOf) {
+	b.ident(node.Column)
+	b.write(" = ANY(")
+	b.arg(pq.StringArray(node.Values))
+	b.write("::" + node.Type + "[])")
+}
+
+func (d Postgres) document(b *builder, columns []string) {
+	b.write("to_tsvector(concat_ws(' ', ")
+	b.identList(columns)
+	b.write("))")
+}
+
+func (d Postgres) textSearch(b *builder, columns []string, query string) {
+	d.document(b, columns)
+	b.write(" @@ plainto_tsquery(")
+	b.arg(query)
+	b.write(")")
+}
+
+func (d Postgres) rank(b *builder, columns []string, query string) {
+	b.write("ts_rank(")
+	d.document(b, columns)
+	b.write(", plainto_tsquery(")
+	b.arg(query)
+	b.write("))")
+}
+
+func (Postgres) defaultRow(b *builder) { b.write(" DEFAULT VALUES") }
+
+func (Postgres) noLimit() string { return "ALL" }
+
+func (Postgres) onConflict(b *builder, columns []string, conflict OnConflict) {
+	b.write(" ON CONFLICT")
+	if len(conflict.Columns) > 0 {
+		b.write(" (")
+		b.identList(conflict.Columns)
+		b.write(")")
+	}
+	if len(conflict.Update) == 0 {
+		b.write(" DO NOTHING")
+		return
+	}
+	b.write(" DO UPDATE SET ")
+	for i, column := range conflict.Update {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(column)
+		b.write(" = EXCLUDED.")
+		b.ident(column)
+	}
+}
+
+// inserted tells the rows an upsert added: they have no deleting
+// transaction yet, while updating a row sets its xmax.
+func (Postgres) inserted(b *builder) { b.write("(xmax = 0)") }
+
+func (Postgres) returning(b *builder, projections []Projection) {
+	if len(projections) == 0 {
+		return
+	}
+	b.write(" RETURNING ")
+	b.projections(projections)
+}
+
+// asGeoJSON casts to jsonb, which the drivers type as JSON, unlike the
+// text ST_AsGeoJSON returns.
+func (Postgres) asGeoJSON(b *builder, column string) {
+	b.write("ST_AsGeoJSON(")
+	b.ident(column)
+	b.write(")::jsonb")
+}
+
+func (Postgres) bbox(b *builder, node BBox) {
+	b.ident(node.Column)
+	b.write(" && ST_MakeEnvelope(")
+	for _, value := range []float64{node.MinX, node.MinY, node.MaxX, node.MaxY} {
+		b.arg(value)
+		b.write(", ")
+	}
+	b.write("4326)")
+	if node.Geography {
+		b.write("::geography")
+	}
+}
+
+// MySQL renders MySQL and MariaDB. It has no RETURNING, so inserted keys
+// have to be read back by the caller.
+type MySQL struct{}
+
+func (MySQL) QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (MySQL) Placeholder(n int) string { return "?" }
+
+func (MySQL) ilike(b *builder, column string, value interface{}) {
+	b.write("LOWER(")
+	b.ident(column)
+	b.write(") LIKE LOWER(")
+	b.arg(value)
+	b.write(")")
+}
+
+func (MySQL) anyOf(b *builder, node AnyOf) {
+	values := make([]interface{}, len(node.Values))
+	for i, value := range node.Values {
+		values[i] = value
+	}
+	In{node.Column, values}.expr(b)
+}
+
+func (MySQL) match(b *builder, columns []string, query string) {
+	b.write("MATCH(")
+	b.identList(columns)
+	b.write(") AGAINST (")
+	b.arg(query)
+	b.write(" IN NATURAL LANGUAGE MODE)")
+}
+
+func (d MySQL) textSearch(b *builder, columns []string, query string) {
+	d.match(b, columns, query)
+}
+
+func (d MySQL) rank(b *builder, columns []string, query string) {
+	d.match(b, columns, query)
+}
+
+func (MySQL) defaultRow(b *builder) { b.write(" () VALUES ()") }
+
+func (MySQL) returning(b *builder, projections []Projection) {}
+
+// onConflict resolves duplicates of any unique key, MySQL takes no target.
+// Assigning a column of the insert to itself skips the row.
+func (MySQL) onConflict(b *builder, columns []string, conflict OnConflict) {
+	if len(conflict.Update) == 0 {
+		if len(columns) == 0 {
+			return
+		}
+		b.write(" ON DUPLICATE KEY UPDATE ")
+		b.ident(columns[0])
+		b.write(" = ")
+		b.ident(columns[0])
+		return
+	}
+	b.write(" ON DUPLICATE KEY UPDATE ")
+	for i, column := range conflict.Update {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(column)
+		b.write(" = VALUES(")
+		b.ident(column)
+		b.write(")")
+	}
+}
+
+// inserted can't be told apart without RETURNING.
+func (MySQL) inserted(b *builder) { b.write("NULL") }
+
+func (MySQL) asGeoJSON(b *builder, column string) {
+	b.write("ST_AsGeoJSON(")
+	b.ident(column)
+	b.write(")")
+}
+
+// bbox compares minimum bounding rectangles, MySQL has no geography type.
+func (MySQL) bbox(b *builder, node BBox) {
+	b.write("MBRIntersects(")
+	b.ident(node.Column)
+	b.write(", ST_MakeEnvelope(Point(")
+	b.arg(node.MinX)
+	b.write(", ")
+	b.arg(node.MinY)
+	b.write("), Point(")
+	b.arg(node.MaxX)
+	b.write(", ")
+	b.arg(node.MaxY)
+	b.write(")))")
+}
+
+// noLimit is the largest LIMIT, MySQL has no LIMIT ALL.
+func (MySQL) noLimit() string { return "18446744073709551615" }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+const invalidationChannel = "invalidate"
+
+// announceSchema tells the other replicas to serve the Postgres schema name.
+// Messages carry the sender, so a replica ignores its own.
+func (de *DbExplorer) announceSchema(ctx context.Context, name string) {
+	if err := de.store.Publish(ctx, invalidationChannel, de.instance+" schema "+name); err != nil {
+		log.Printf("invalidation: %v", err)
+	}
+}
+
+// watchInvalidations reloads the schema snapshot when another replica
+// switched schemas, so every replica serves the same tables.
+func (de *DbExplorer) watchInvalidations(ctx context.Context) {
+	err := de.store.Subscribe(ctx, invalidationChannel, func(message string) {
+		fields := strings.Fields(message)
+		if len(fields) != 3 || fields[0] == de.instance || fields[1] != "schema" {
+			return
+		}
+		schema, err := de.loadSchema(fields[2])
+		if err == nil && de.cfg.WarmUp {
+			err = de.warmUp(ctx, schema)
+		}
+		if err != nil {
+			log.Printf("invalidation: reloading schema %s: %v", fields[2], err)
+			return
+		}
+		de.schema.Swap(schema).retire()
+		de.recordSchema(schema)
+		log.Printf("switched to schema %s", schema.Name)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("invalidation: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/lib/pq"
+)
+
+// pgxTypes names the types of the columns pgx describes by OID.
+var pgxTypes = pgtype.NewMap()
+
+// pgxTypeName is the name of the type oid as DatabaseTypeName reports it
+// through lib/pq, empty for types pgx doesn't know.
+func pgxTypeName(oid uint32) string {
+	if t, ok := pgxTypes.TypeForOID(oid); ok {
+		return strings.ToUpper(t.Name)
+	}
+	return ""
+}
+
+// jsonValue types a value scanned from a column of databaseType, as
+// DatabaseTypeName reports it, the way it reads in JSON: the text lib/pq
+// scans numerics as becomes a number, json and jsonb documents are embedded
+// as they are, bytea stays bytes, which JSON encodes as base64, and the
+// text of any other type is a string. Numbers, booleans and times are
+// scanned as such already; times encode as RFC 3339. Arrays, whose type
+// names start with an underscore, are JSON arrays of such values.
+func jsonValue(databaseType string, value interface{}) interface{} {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+	if strings.HasPrefix(databaseType, "_") {
+		if items, err := arrayValue(databaseType[1:], b); err == nil {
+			return items
+		}
+	}
+	switch databaseType {
+	case "BYTEA":
+		return b
+	case "JSON", "JSONB":
+		if json.Valid(b) {
+			return json.RawMessage(b)
+		}
+	case "NUMERIC":
+		// NaN and the infinities have no JSON number.
+		if _, err := strconv.ParseFloat(string(b), 64); err == nil && !strings.ContainsAny(string(b), "nN") {
+			return json.Number(b)
+		}
+	}
+	return string(b)
+}
+
+// arrayValue parses the text of a one-dimensional array of elementType.
+// Other arrays stay text.
+func arrayValue(elementType string, b []byte) ([]interface{}, error) {
+	var elements []driver.Valuer
+	switch elementType {
+	case "INT2", "INT4", "INT8":
+		var a []sql.NullInt64
+		if err := pq.Array(&a).Scan(b); err != nil {
+			return nil, err
+		}
+		for _, element := range a {
+			elements = append(elements, element)
+		}
+	case "FLOAT4", "FLOAT8":
+		var a []sql.NullFloat64
+		if err := pq.Array(&a).Scan(b); err != nil {
+			return nil, err
+		}
+		for _, element := range a {
+			elements = append(elements, element)
+		}
+	case "BOOL":
+		var a []sql.NullBool
+		if err := pq.Array(&a).Scan(b); err != nil {
+			return nil, err
+		}
+		for _, element := range a {
+			elements = append(elements, element)
+		}
+	default:
+		var a []sql.NullString
+		if err := pq.Array(&a).Scan(b); err != nil {
+			return nil, err
+		}
+		for _, element := range a {
+			elements = append(elements, element)
+		}
+	}
+	items := make([]interface{}, len(elements))
+	for i, element := range elements {
+		value, _ := element.Value()
+		if text, ok := value.(string); ok {
+			value = jsonValue(elementType, []byte(text))
+		}
+		items[i] = value
+	}
+	return items, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestJSONValue(t *testing.T) {
+	created := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	cases := []struct {
+		databaseType string
+		value        interface{}
+		want         string
+	}{
+		{"NUMERIC", []byte("1.50"), `1.50`},
+		{"NUMERIC", []byte("-12"), `-12`},
+		{"NUMERIC", []byte("NaN"), `"NaN"`},
+		{"NUMERIC", []byte("Infinity"), `"Infinity"`},
+		{"NUMERIC", nil, `null`},
+		{"TEXT", []byte("memcache"), `"memcache"`},
+		{"UUID", []byte("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"), `"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"`},
+		{"BYTEA", []byte{0xde, 0xad, 0xbe, 0xef}, `"3q2+7w=="`},
+		{"JSONB", []byte(`{"a":[1,"x"],"b":null}`), `{"a":[1,"x"],"b":null}`},
+		{"JSON", []byte(`"memcache"`), `"memcache"`},
+		{"INT4", int64(7), `7`},
+		{"_INT4", []byte("{1,NULL,3}"), `[1,null,3]`},
+		{"_TEXT", []byte(`{a,"b c",NULL}`), `["a","b c",null]`},
+		{"_UUID", []byte("{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11}"), `["a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"]`},
+		{"_NUMERIC", []byte("{1.50,NaN}"), `[1.50,"NaN"]`},
+		{"_BOOL", []byte("{t,f}"), `[true,false]`},
+		{"_FLOAT8", []byte("{}"), `[]`},
+		// Only one-dimensional arrays are parsed.
+		{"_INT4", []byte("{{1,2},{3,4}}"), `"{{1,2},{3,4}}"`},
+		{"BOOL", true, `true`},
+		{"TIMESTAMPTZ", created, `"2024-05-01T14:00:00Z"`},
+	}
+	for _, item := range cases {
+		encoded, err := json.Marshal(jsonValue(item.databaseType, item.value))
+		if err != nil {
+			t.Fatalf("[%s %#v] unexpected error: %v", item.databaseType, item.value, err)
+		}
+		if got := string(encoded); got != item.want {
+			t.Fatalf("[%s %#v] results not match\nGot : %s\nWant: %s", item.databaseType, item.value, got, item.want)
+		}
+	}
+}
+
+func TestPgxValueArrays(t *testing.T) {
+	got, err := pgxValue("_INT4", []interface{}{int32(1), nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{int64(1), nil}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	// jsonb arrays are documents, not Postgres arrays.
+	got, err = pgxValue("JSONB", []interface{}{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := json.RawMessage(`["x"]`); !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+}
+
+func TestCSVCellEmbedsJSON(t *testing.T) {
+	got, err := csvCell(json.RawMessage(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":1}`; got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+}
+
+func TestPgxTypeName(t *testing.T) {
+	got := []string{pgxTypeName(pgtype.NumericOID), pgxTypeName(pgtype.ByteaOID), pgxTypeName(pgtype.TimestamptzOID), pgxTypeName(0)}
+	want := []string{"NUMERIC", "BYTEA", "TIMESTAMPTZ", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %v\nWant: %v", got, want)
+	}
+}
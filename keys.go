@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// recordKey holds the primary key values of a record in the order of
+// Table.PrimaryKey.
+type recordKey []interface{}
+
+var errNoPrimaryKey = errors.New("table has no primary key")
+
+// parseKey converts a raw path segment to primary key values. Composite keys
+// are written comma separated in key column order, e.g. /order_items/15,3;
+// a single-column key takes the whole segment, commas included.
+func (t *Table) parseKey(raw string) (recordKey, error) {
+	if len(t.PrimaryKey) == 0 {
+		return nil, errNoPrimaryKey
+	}
+	parts := []string{raw}
+	if len(t.PrimaryKey) > 1 {
+		parts = strings.Split(raw, ",")
+		if len(parts) != len(t.PrimaryKey) {
+			return nil, fmt.Errorf("expected %d key values for %s", len(t.PrimaryKey), strings.Join(t.PrimaryKey, ","))
+		}
+	}
+
+	key := make(recordKey, len(parts))
+	for i, part := range parts {
+		value, err := t.parseKeyValue(t.PrimaryKey[i], part)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = value
+	}
+	return key, nil
+}
+
+// parseKeyQuery reads a key given as "order_id:15,line:3", the form used by
+// the ?key= parameter.
+func (t *Table) parseKeyQuery(raw string) (recordKey, error) {
+	if len(t.PrimaryKey) == 0 {
+		return nil, errNoPrimaryKey
+	}
+	values := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("expected key=column:value,...")
+		}
+		values[name] = value
+	}
+	if len(values) != len(t.PrimaryKey) {
+		return nil, fmt.Errorf("expected key columns %s", strings.Join(t.PrimaryKey, ","))
+	}
+
+	key := make(recordKey, len(t.PrimaryKey))
+	for i, name := range t.PrimaryKey {
+		raw, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("missing key column %s", name)
+		}
+		value, err := t.parseKeyValue(name, raw)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = value
+	}
+	return key, nil
+}
+
+// keyFromJSON reads a key from a decoded JSON value: a scalar for single
+// column keys, an array or "a,b" string for composite ones.
+func (t *Table) keyFromJSON(value interface{}) (recordKey, error) {
+	if values, ok := value.([]interface{}); ok {
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = fmt.Sprint(v)
+		}
+		return t.parseKey(strings.Join(parts, ","))
+	}
+	if value == nil {
+		return nil, errors.New("missing id")
+	}
+	return t.parseKey(fmt.Sprint(value))
+}
+
+// parseKeyValue converts one raw key value by its column type, so negative
+// numbers and arbitrary text ids are handled by the column instead of the
+// URL shape.
+func (t *Table) parseKeyValue(name, raw string) (interface{}, error) {
+	column, ok := t.Column(name)
+	if !ok {
+		return raw, nil
+	}
+
+	var err error
+	switch columnKind(column.DataType) {
+	case "int":
+		var n int64
+		if n, err = strconv.ParseInt(raw, 10, 64); err == nil {
+			return n, nil
+		}
+	case "float":
+		var f float64
+		if f, err = strconv.ParseFloat(raw, 64); err == nil {
+			return f, nil
+		}
+	case "uuid":
+		// Checked here, a malformed one would fail the query with 22P02.
+		if isUUID(raw) {
+			return raw, nil
+		}
+	default:
+		return raw, nil
+	}
+	return nil, fmt.Errorf("invalid value for primary key %s", column.Name)
+}
+
+// keyCondition matches every primary key column to its value in key. A nil
+// key still yields the conditions, with nil values.
+func keyCondition(table *Table, key recordKey) querybuilder.And {
+	conditions := make(querybuilder.And, len(table.PrimaryKey))
+	for i, name := range table.PrimaryKey {
+		var value interface{}
+		if i < len(key) {
+			value = key[i]
+		}
+		conditions[i] = querybuilder.Compare{Column: name, Op: querybuilder.Eq, Value: value}
+	}
+	return conditions
+}
+
+// returningKey returns the primary key, or a constant when the table has
+// none.
+func returningKey(table *Table) []querybuilder.Projection {
+	if len(table.PrimaryKey) == 0 {
+		return []querybuilder.Projection{querybuilder.Lit(1)}
+	}
+	return querybuilder.Cols(table.PrimaryKey...)
+}
+
+// keyValue presents a returned key: the bare value for single-column keys
+// and a column → value object for composite ones.
+func keyValue(table *Table, key recordKey) interface{} {
+	if len(key) == 1 {
+		return key[0]
+	}
+	object := make(map[string]interface{}, len(key))
+	for i, name := range table.PrimaryKey {
+		object[name] = key[i]
+	}
+	return object
+}
+
+// scanKey prepares destinations for the values of returningKey.
+func scanKey(table *Table) (recordKey, []interface{}) {
+	n := len(table.PrimaryKey)
+	if n == 0 {
+		n = 1
+	}
+	key := make(recordKey, n)
+	dest := make([]interface{}, n)
+	for i := range key {
+		dest[i] = &key[i]
+	}
+	return key, dest
+}
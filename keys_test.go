@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+func TestParseKey(t *testing.T) {
+	orderItems := &Table{
+		Name: "order_items",
+		Columns: []*Column{
+			{Name: "order_id", DataType: "integer"},
+			{Name: "line", DataType: "smallint"},
+		},
+		PrimaryKey: []string{"order_id", "line"},
+	}
+	tags := &Table{
+		Name:       "tags",
+		Columns:    []*Column{{Name: "name", DataType: "text"}},
+		PrimaryKey: []string{"name"},
+	}
+	documents := &Table{
+		Name:       "documents",
+		Columns:    []*Column{{Name: "id", DataType: "uuid", Default: "gen_random_uuid()"}},
+		PrimaryKey: []string{"id"},
+	}
+
+	cases := []struct {
+		table *Table
+		raw   string
+		query bool
+		key   recordKey
+		err   bool
+	}{
+		{orderItems, "15,3", false, recordKey{int64(15), int64(3)}, false},
+		{orderItems, "-15,3", false, recordKey{int64(-15), int64(3)}, false},
+		{orderItems, "15", false, nil, true},
+		{orderItems, "15,x", false, nil, true},
+		{orderItems, "line:3,order_id:15", true, recordKey{int64(15), int64(3)}, false},
+		{orderItems, "order_id:15", true, nil, true},
+		{tags, "a,b 'c'", false, recordKey{"a,b 'c'"}, false},
+		{documents, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", false, recordKey{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"}, false},
+		{documents, "id:A0EEBC999C0B4EF8BB6D6BB9BD380A11", true, recordKey{"A0EEBC999C0B4EF8BB6D6BB9BD380A11"}, false},
+		{documents, "a0eebc99-9c0b-4ef8-bb6d", false, nil, true},
+		{documents, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1z", false, nil, true},
+	}
+	for idx, item := range cases {
+		var key recordKey
+		var err error
+		if item.query {
+			key, err = item.table.parseKeyQuery(item.raw)
+		} else {
+			key, err = item.table.parseKey(item.raw)
+		}
+		if item.err {
+			if err == nil {
+				t.Fatalf("case %d: expected error for %q", idx, item.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", idx, err)
+		}
+		if !reflect.DeepEqual(key, item.key) {
+			t.Fatalf("case %d: results not match\nGot : %#v\nWant: %#v", idx, key, item.key)
+		}
+	}
+
+	query, args := buildSQL(querybuilder.Delete{From: orderItems.ref(), Where: keyCondition(orderItems, recordKey{int64(15), int64(3)})})
+	if query != `DELETE FROM "order_items" WHERE "order_id" = $1 AND "line" = $2` || len(args) != 2 {
+		t.Fatalf("unexpected key condition %q %v", query, args)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig configures authentication against LDAP or Active Directory with
+// HTTP basic credentials.
+type LDAPConfig struct {
+	// URL of the directory, e.g. "ldaps://ad.corp.example:636".
+	URL string `json:"url"`
+	// BindDN and BindPassword (a secret reference) are the service account
+	// used to look users up.
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	// UserFilter finds the user entry; %s is replaced by the escaped login.
+	// Defaults to the Active Directory "(sAMAccountName=%s)".
+	UserFilter string `json:"user_filter"`
+	// GroupAttribute lists the user's groups; defaults to "memberOf".
+	GroupAttribute string `json:"group_attribute"`
+	// GroupRoles maps group DNs to explorer roles.
+	GroupRoles map[string][]string `json:"group_roles"`
+}
+
+// ldapAuthenticator looks the user up with the service account, verifies the
+// password with a bind as the user and maps its groups to roles.
+func ldapAuthenticator(cfg *LDAPConfig) (Authenticator, error) {
+	bindPassword, err := resolveSecret(cfg.BindPassword)
+	if err != nil {
+		return nil, err
+	}
+	filter := cfg.UserFilter
+	if filter == "" {
+		filter = "(sAMAccountName=%s)"
+	}
+	groupAttribute := cfg.GroupAttribute
+	if groupAttribute == "" {
+		groupAttribute = "memberOf"
+	}
+
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		login, password, ok := r.BasicAuth()
+		if !ok {
+			return nil, nil
+		}
+		if password == "" {
+			// An empty password would be an unauthenticated bind that
+			// many directories accept.
+			return nil, errors.New("invalid credentials")
+		}
+
+		conn, err := ldap.DialURL(cfg.URL)
+		if err != nil {
+			log.Printf("ldap: %v", err)
+			return nil, errAuthUnavailable
+		}
+		defer conn.Close()
+
+		if err := conn.Bind(cfg.BindDN, bindPassword); err != nil {
+			log.Printf("ldap service bind: %v", err)
+			return nil, errAuthUnavailable
+		}
+		result, err := conn.Search(ldap.NewSearchRequest(
+			cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+			fmt.Sprintf(filter, ldap.EscapeFilter(login)),
+			[]string{"dn", groupAttribute}, nil,
+		))
+		if err != nil {
+			log.Printf("ldap search: %v", err)
+			return nil, errAuthUnavailable
+		}
+		if len(result.Entries) != 1 {
+			return nil, errors.New("invalid credentials")
+		}
+		entry := result.Entries[0]
+		if err := conn.Bind(entry.DN, password); err != nil {
+			if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+				log.Printf("ldap bind: %v", err)
+				return nil, errAuthUnavailable
+			}
+			return nil, errors.New("invalid credentials")
+		}
+
+		id := &Identity{Subject: login, Method: "ldap", Attributes: map[string]string{"dn": entry.DN}}
+		id.Roles = groupRoles(cfg.GroupRoles, entry.GetAttributeValues(groupAttribute))
+		return id, nil
+	}), nil
+}
+
+// groupRoles maps the groups of a user to roles; group DNs compare case
+// insensitively, as directories do.
+func groupRoles(mapping map[string][]string, groups []string) []string {
+	var roles []string
+	for _, group := range groups {
+		for dn, mapped := range mapping {
+			if strings.EqualFold(dn, group) {
+				roles = append(roles, mapped...)
+			}
+		}
+	}
+	return roles
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGroupRoles(t *testing.T) {
+	mapping := map[string][]string{
+		"CN=Analysts,OU=Groups,DC=corp": {"analyst"},
+		"cn=admins,ou=groups,dc=corp":   {"admin", "analyst"},
+	}
+	cases := []struct {
+		groups []string
+		roles  []string
+	}{
+		{nil, nil},
+		{[]string{"CN=Sales,OU=Groups,DC=corp"}, nil},
+		{[]string{"cn=analysts,ou=groups,dc=corp"}, []string{"analyst"}},
+		{[]string{"CN=Analysts,OU=Groups,DC=corp", "CN=Admins,OU=Groups,DC=corp"}, []string{"admin", "analyst", "analyst"}},
+	}
+	for _, item := range cases {
+		roles := groupRoles(mapping, item.groups)
+		sort.Strings(roles)
+		if !reflect.DeepEqual(roles, item.roles) {
+			t.Fatalf("[%v] results not match\nGot : %v\nWant: %v", item.groups, roles, item.roles)
+		}
+	}
+}
+
+func TestLDAPUnavailable(t *testing.T) {
+	// A port nothing listens on stands in for a directory outage.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	authenticator, err := ldapAuthenticator(&LDAPConfig{URL: "ldap://" + listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	if id, err := authenticator.Authenticate(r); id != nil || err != nil {
+		t.Fatalf("results not match\nGot : %v %v\nWant: no identity without basic credentials", id, err)
+	}
+	r.SetBasicAuth("ann", "")
+	if _, err := authenticator.Authenticate(r); err == nil || err == errAuthUnavailable {
+		t.Fatalf("results not match\nGot : %v\nWant: invalid credentials for an empty password", err)
+	}
+
+	// The outage is neither reported to clients in detail nor held against
+	// them: no number of attempts locks them out.
+	de := backendExplorer(&fakeStore{})
+	de.authenticators = []Authenticator{authenticator}
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/items", nil)
+		r.SetBasicAuth("ann", "secret")
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, r)
+		if w.Code != http.StatusServiceUnavailable || strings.Contains(w.Body.String(), "refused") {
+			t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusServiceUnavailable)
+		}
+		if wait := de.lockout.lockedFor(r); wait != 0 {
+			t.Fatalf("results not match\nGot : locked for %v\nWant: no lockout", wait)
+		}
+	}
+}
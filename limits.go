@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// Limits guard against requests that would be explosive for the database.
+// Zero values disable the corresponding check.
+type Limits struct {
+	// MaxExpandDepth caps how many levels of related records may be embedded.
+	MaxExpandDepth int `json:"max_expand_depth"`
+	// MaxJoinedRows caps the planner's row estimate for a single query.
+	MaxJoinedRows float64 `json:"max_joined_rows"`
+	// MaxQueryCost caps the planner's total cost estimate for a single query.
+	MaxQueryCost float64 `json:"max_query_cost"`
+}
+
+// limitError reports a request rejected by Limits; it maps to a 400.
+type limitError struct {
+	msg string
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+func (de *DbExplorer) checkExpandDepth(depth int) error {
+	if max := de.cfg.Limits.MaxExpandDepth; max > 0 && depth > max {
+		return &limitError{fmt.Sprintf("expansion depth %d exceeds limit %d", depth, max)}
+	}
+	return nil
+}
+
+// checkQueryCost asks the store for its estimates of query and rejects it
+// when they exceed the configured limits. Every query a read runs is checked:
+// listings, searches, distinct values, expansions and function calls.
+// Nothing is executed; stores that can't estimate aren't checked.
+func (de *DbExplorer) checkQueryCost(ctx context.Context, query querybuilder.Statement) error {
+	limits := de.cfg.Limits
+	if limits.MaxQueryCost <= 0 && limits.MaxJoinedRows <= 0 {
+		return nil
+	}
+	estimator, ok := de.backend.(costEstimator)
+	if !ok {
+		return nil
+	}
+
+	cost, rows, err := estimator.EstimateCost(ctx, query)
+	if err != nil {
+		return err
+	}
+	if limits.MaxQueryCost > 0 && cost > limits.MaxQueryCost {
+		return &limitError{fmt.Sprintf("query cost %.0f exceeds limit %.0f", cost, limits.MaxQueryCost)}
+	}
+	if limits.MaxJoinedRows > 0 && rows > limits.MaxJoinedRows {
+		return &limitError{fmt.Sprintf("query would return about %.0f rows, limit is %.0f", rows, limits.MaxJoinedRows)}
+	}
+	return nil
+}
+
+// writeQueryError answers a query that failed, as a 400 when Limits
+// rejected it.
+func writeQueryError(w http.ResponseWriter, err error) {
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// estimatingStore estimates every query at cost and rows, or only the
+// queries of the table only when set, the others at nothing.
+type estimatingStore struct {
+	fakeStore
+	cost, rows float64
+	err        error
+	estimated  int
+	only       string
+}
+
+func (s *estimatingStore) EstimateCost(ctx context.Context, query querybuilder.Statement) (float64, float64, error) {
+	s.estimated++
+	if selected, ok := query.(querybuilder.Select); ok && s.only != "" && selected.From.Name != s.only {
+		return 0, 0, nil
+	}
+	return s.cost, s.rows, s.err
+}
+
+// estimatingInvoker estimates function calls at cost.
+type estimatingInvoker struct {
+	invokeStore
+	cost float64
+}
+
+func (s *estimatingInvoker) EstimateCost(ctx context.Context, query querybuilder.Statement) (float64, float64, error) {
+	if _, ok := query.(querybuilder.Invoke); ok {
+		return s.cost, 0, nil
+	}
+	return 0, 0, nil
+}
+
+func TestLimits(t *testing.T) {
+	backend := &estimatingStore{cost: 5000, rows: 200}
+	de := backendExplorer(backend)
+	backend.records = []map[string]interface{}{{"id": 1}}
+
+	cases := []struct {
+		limits Limits
+		path   string
+		code   int
+		body   string
+	}{
+		{Limits{}, "/items", http.StatusOK, `"records"`},
+		{Limits{MaxQueryCost: 10000, MaxJoinedRows: 1000}, "/items", http.StatusOK, `"records"`},
+		{Limits{MaxQueryCost: 1000}, "/items", http.StatusBadRequest, "query cost 5000 exceeds limit 1000"},
+		{Limits{MaxJoinedRows: 100}, "/items", http.StatusBadRequest, "query would return about 200 rows, limit is 100"},
+		{Limits{MaxExpandDepth: 1}, "/order_items?expand=item_id.owner", http.StatusBadRequest, "expansion depth 2 exceeds limit 1"},
+	}
+	for _, item := range cases {
+		de.cfg.Limits = item.limits
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, item.path, nil))
+		if w.Code != item.code || !strings.Contains(w.Body.String(), item.body) {
+			t.Fatalf("[%+v] results not match\nGot : %d %s\nWant: %d %s", item.limits, w.Code, w.Body, item.code, item.body)
+		}
+	}
+
+	// Without cost limits nothing is estimated; estimates that fail are
+	// errors of the server.
+	backend.estimated = 0
+	de.cfg.Limits = Limits{MaxExpandDepth: 3}
+	if err := de.checkQueryCost(context.Background(), querybuilder.Select{}); err != nil || backend.estimated != 0 {
+		t.Fatalf("results not match\nGot : %v after %d estimates\nWant: none", err, backend.estimated)
+	}
+	backend.err = errors.New("explain failed")
+	de.cfg.Limits = Limits{MaxQueryCost: 1000}
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusInternalServerError)
+	}
+}
+
+func TestLimitsBeyondListings(t *testing.T) {
+	// The referenced records of an expansion are a query of their own.
+	backend := &estimatingStore{cost: 5000, only: "items"}
+	backend.records = []map[string]interface{}{{"order_id": 1, "line": 1, "item_id": 1}}
+	de := backendExplorer(backend)
+	de.cfg.Limits = Limits{MaxQueryCost: 1000}
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order_items?expand=item_id", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "query cost 5000 exceeds limit 1000") {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+
+	// So is a function call.
+	invoker := &estimatingInvoker{cost: 5000}
+	de = backendExplorer(invoker)
+	schema, err := de.loadSchema("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	de.schema.Store(schema)
+	de.cfg.Limits = Limits{MaxQueryCost: 1000}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_rpc/sales_since", strings.NewReader(`{"since": "2024-01-01"}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "query cost 5000 exceeds limit 1000") || len(invoker.calls) != 0 {
+		t.Fatalf("results not match\nGot : %d %s after %d calls\nWant: %d", w.Code, w.Body, len(invoker.calls), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockoutConfig controls brute-force protection of authentication.
+type LockoutConfig struct {
+	// MaxFailures before a client is locked out; defaults to 5, a negative
+	// value disables lockouts.
+	MaxFailures int `json:"max_failures"`
+	// BaseLockout is the first lockout duration (default 1m); it doubles
+	// with every further failure up to MaxLockout (default 1h).
+	BaseLockout Duration `json:"base_lockout"`
+	MaxLockout  Duration `json:"max_lockout"`
+}
+
+// lockoutTracker counts failed authentications per client IP and per
+// presented credential, so both a single attacker and a distributed attack
+// on one account are slowed down. Counters live in the shared store, so a
+// lockout holds on every replica.
+type lockoutTracker struct {
+	cfg   LockoutConfig
+	store SharedStore
+}
+
+func newLockoutTracker(cfg LockoutConfig, store SharedStore) *lockoutTracker {
+	if cfg.MaxFailures == 0 {
+		cfg.MaxFailures = 5
+	}
+	if cfg.BaseLockout <= 0 {
+		cfg.BaseLockout = Duration(time.Minute)
+	}
+	if cfg.MaxLockout <= 0 {
+		cfg.MaxLockout = Duration(time.Hour)
+	}
+	return &lockoutTracker{cfg: cfg, store: store}
+}
+
+// lockoutKeys identifies the client and, when present, the credential.
+func lockoutKeys(r *http.Request) []string {
+	keys := []string{"ip:" + clientIP(r)}
+	credential := r.Header.Get("X-Api-Key")
+	if login, _, ok := r.BasicAuth(); ok {
+		credential = "basic:" + login
+	} else if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		credential = token
+	}
+	if credential != "" {
+		sum := sha256.Sum256([]byte(credential))
+		keys = append(keys, "cred:"+hex.EncodeToString(sum[:8]))
+	}
+	return keys
+}
+
+// lockedFor returns how long the request's client or credential stays locked.
+func (t *lockoutTracker) lockedFor(r *http.Request) time.Duration {
+	if t.cfg.MaxFailures < 0 {
+		return 0
+	}
+	var wait time.Duration
+	for _, key := range lockoutKeys(r) {
+		raw, ok, err := t.store.Get(r.Context(), "lockout:until:"+key)
+		if err != nil {
+			log.Printf("lockout: %v", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		until, _ := strconv.ParseInt(raw, 10, 64)
+		if d := time.Until(time.Unix(0, until)); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt and returns the lockout it triggered, if any.
+// Failures are forgotten after a quiet period as long as the longest lockout.
+func (t *lockoutTracker) fail(r *http.Request) time.Duration {
+	if t.cfg.MaxFailures < 0 {
+		return 0
+	}
+	now := time.Now()
+	maxLockout := time.Duration(t.cfg.MaxLockout)
+	var locked time.Duration
+	for _, key := range lockoutKeys(r) {
+		failures, err := t.store.IncrBy(r.Context(), "lockout:failures:"+key, 1, maxLockout)
+		if err != nil {
+			log.Printf("lockout: %v", err)
+			continue
+		}
+		if excess := int(failures) - t.cfg.MaxFailures; excess >= 0 {
+			d := time.Duration(t.cfg.BaseLockout)
+			for i := 0; i < excess && d < maxLockout; i++ {
+				d *= 2
+			}
+			if d > maxLockout {
+				d = maxLockout
+			}
+			until := strconv.FormatInt(now.Add(d).UnixNano(), 10)
+			if err := t.store.Set(r.Context(), "lockout:until:"+key, until, d); err != nil {
+				log.Printf("lockout: %v", err)
+			}
+			if d > locked {
+				locked = d
+			}
+		}
+	}
+	return locked
+}
+
+// succeed forgets the failures of the credential that authenticated. Those
+// of the client IP stay: a valid credential must not reset the count of an
+// attacker spraying passwords for other accounts from the same address.
+func (t *lockoutTracker) succeed(r *http.Request) {
+	var keys []string
+	for _, key := range lockoutKeys(r) {
+		if strings.HasPrefix(key, "cred:") {
+			keys = append(keys, "lockout:failures:"+key, "lockout:until:"+key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := t.store.Delete(r.Context(), keys...); err != nil {
+		log.Printf("lockout: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func lockoutExplorer() *DbExplorer {
+	de := backendExplorer(&fakeStore{})
+	de.lockout = newLockoutTracker(LockoutConfig{MaxFailures: 3}, de.store)
+	de.authenticators = []Authenticator{
+		apiKeyAuthenticator(map[string]APIKey{"valid": {Subject: "svc"}}),
+		AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+			login, password, ok := r.BasicAuth()
+			if !ok {
+				return nil, nil
+			}
+			if password != "right" {
+				return nil, errors.New("invalid credentials")
+			}
+			return &Identity{Subject: login}, nil
+		}),
+	}
+	return de
+}
+
+func lockoutRequest(de *DbExplorer, ip string, credential func(r *http.Request)) int {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.RemoteAddr = ip + ":4321"
+	credential(r)
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestLockoutCredential(t *testing.T) {
+	de := lockoutExplorer()
+	password := func(password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth("ann", password) }
+	}
+
+	// Failures from every address count against the account, and a success
+	// forgets them.
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if code := lockoutRequest(de, ip, password("wrong")); code != http.StatusUnauthorized {
+			t.Fatalf("[%d] results not match\nGot : %d\nWant: %d", i, code, http.StatusUnauthorized)
+		}
+	}
+	if code := lockoutRequest(de, "10.0.0.3", password("right")); code != http.StatusOK {
+		t.Fatalf("results not match\nGot : %d\nWant: %d", code, http.StatusOK)
+	}
+	for i, ip := range []string{"10.0.0.4", "10.0.0.5"} {
+		if code := lockoutRequest(de, ip, password("wrong")); code != http.StatusUnauthorized {
+			t.Fatalf("[%d] results not match\nGot : %d\nWant: %d after the success", i, code, http.StatusUnauthorized)
+		}
+	}
+
+	// The third failure in a row locks the account out, from anywhere and
+	// even with the right password.
+	lockoutRequest(de, "10.0.0.6", password("wrong"))
+	if code := lockoutRequest(de, "10.0.0.7", password("right")); code != http.StatusTooManyRequests {
+		t.Fatalf("results not match\nGot : %d\nWant: %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLockoutSpray(t *testing.T) {
+	de := lockoutExplorer()
+	valid := func(r *http.Request) { r.Header.Set("X-Api-Key", "valid") }
+
+	// A valid key of its own doesn't reset the failures of an address
+	// trying the passwords of other accounts.
+	for i, login := range []string{"ann", "bob", "eve"} {
+		if code := lockoutRequest(de, "10.0.0.1", func(r *http.Request) { r.SetBasicAuth(login, "guess") }); code != http.StatusUnauthorized {
+			t.Fatalf("[%d] results not match\nGot : %d\nWant: %d", i, code, http.StatusUnauthorized)
+		}
+		if i < 2 {
+			if code := lockoutRequest(de, "10.0.0.1", valid); code != http.StatusOK {
+				t.Fatalf("[%d] results not match\nGot : %d\nWant: %d", i, code, http.StatusOK)
+			}
+		}
+	}
+	if code := lockoutRequest(de, "10.0.0.1", valid); code != http.StatusTooManyRequests {
+		t.Fatalf("results not match\nGot : %d\nWant: the address locked out", code)
+	}
+	if code := lockoutRequest(de, "10.0.0.2", valid); code != http.StatusOK {
+		t.Fatalf("results not match\nGot : %d\nWant: other addresses unaffected", code)
+	}
+}
@@ -1,34 +1,83 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 	_ "github.com/lib/pq"
 )
 
 var (
-	DSN = "user=postgres password=********** dbname=db_go sslmode=disable"
+	// DSN is used when the config has no dsn; the password is taken from
+	// PGPASSWORD or the db_password secret reference.
+	DSN = "user=postgres dbname=db_go sslmode=disable"
 )
 
 func main() {
-	db, err := sql.Open("postgres", DSN)
+	configPath := flag.String("config", "", "path to a JSON config file")
+	exposeTables := flag.String("expose-tables", os.Getenv("EXPLORER_EXPOSE_TABLES"), "comma separated globs of the tables served, e.g. public.*")
+	hideTables := flag.String("hide-tables", os.Getenv("EXPLORER_HIDE_TABLES"), "comma separated globs of the tables not served, e.g. public.audit_*")
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		panic(err)
+	}
+	if *exposeTables != "" {
+		cfg.ExposeTables = splitPatterns(*exposeTables)
+	}
+	if *hideTables != "" {
+		cfg.HideTables = splitPatterns(*hideTables)
+	}
+
+	dsn, err := buildDSN(cfg, DSN)
 	if err != nil {
 		panic(err)
 	}
+	connector := newRotatingConnector(dsn)
+	db := sql.OpenDB(connector)
+	if cfg.SecretRefresh > 0 {
+		go connector.watchSecrets(db, cfg, DSN, time.Duration(cfg.SecretRefresh))
+	}
 
 	err = db.Ping()
 	if err != nil {
 		panic(err)
 	}
 
-	handler, err := NewDbExplorer(db)
+	backend, err := openDriverStore(context.Background(), cfg, connector, db)
+	if err != nil {
+		panic(err)
+	}
+	if backend != nil {
+		cfg.Backend = backend
+	}
+
+	handler, err := NewDbExplorerWithConfig(db, cfg)
 	if err != nil {
 		panic(err)
 	}
 
 	defer db.Close()
 
+	server := &http.Server{Addr: ":8082", Handler: handler}
+	if cfg.TLS != nil {
+		server.TLSConfig, err = buildTLSConfig(cfg.TLS)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	ln, err := listen(server.Addr)
+	if err != nil {
+		panic(err)
+	}
 	fmt.Println("starting server at :8082")
-	http.ListenAndServe(":8082", handler)
+	if err := serve(server, ln, cfg.TLS); err != nil && err != http.ErrServerClosed {
+		panic(err)
+	}
 }
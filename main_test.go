@@ -94,11 +94,17 @@ func TestApis(t *testing.T) {
 		t.Fatalf("error pinging database: %v", err)
 	}
 
+	testApis(t, db, &Config{})
+}
+
+// testApis runs the API cases against db; the conformance suite reuses it
+// for every database it starts.
+func testApis(t *testing.T, db *sql.DB, cfg *Config) {
 	PrepareTestApis(db)
 
 	defer CleanupTestApis(db)
 
-	handler, err := NewDbExplorer(db)
+	handler, err := NewDbExplorerWithConfig(db, cfg)
 	if err != nil {
 		t.Fatalf("error initializing handler: %v", err)
 	}
@@ -142,6 +148,22 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		Case{
+			Path:  "/items/",
+			Query: "limit=1",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
 		Case{
 			Path: "/users",
 			Result: CR{
@@ -175,6 +197,171 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		Case{
+			Path:  "/items",
+			Query: "title=eq.memcache&updated=is.null",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "id=in.(1,100500)&title=ilike.*SQL",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "order=id.desc&limit=1",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "fields=title,id&order=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1, "title": "database/sql"},
+						CR{"id": 2, "title": "memcache"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/users/1",
+			Query: "fields=login",
+			Result: CR{
+				"response": CR{
+					"record": CR{"login": "rvasily"},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "fields=id,secret",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown field secret",
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "count=true&limit=1&offset=1&fields=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 2},
+					},
+					"total":  2,
+					"limit":  1,
+					"offset": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "limit=1%20OFFSET%201",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid limit",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "cursor=&offset=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "cursor and offset can't be combined",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "cursor=&fields=title",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "fields must include id for cursor pagination",
+			},
+		},
+		Case{
+			Path:  "/items/_distinct/updated",
+			Query: "counts=true",
+			Result: CR{
+				"response": CR{
+					"values": []CR{
+						CR{"value": "rvasily", "count": 1},
+						CR{"value": nil, "count": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items/_distinct/title",
+			Query: "updated=is.null",
+			Result: CR{
+				"response": CR{
+					"values": []interface{}{"memcache"},
+				},
+			},
+		},
+		Case{
+			Path:   "/items/_distinct/password",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown column",
+			},
+		},
+		Case{
+			Path:   "/items/1/users",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown resource",
+			},
+		},
+		Case{
+			Path:   "/items/_search",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "missing q",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "id=gt.abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid value for filter id",
+			},
+		},
 		Case{
 			Path: "/items/1",
 			Result: CR{
@@ -188,6 +375,21 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		Case{
+			Path: "/users/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id":  1,
+						"login":    "rvasily",
+						"password": "love",
+						"email":    "rvasily@example.com",
+						"info":     "none",
+						"updated":  nil,
+					},
+				},
+			},
+		},
 		Case{
 			Path:   "/items/100500",
 			Status: http.StatusNotFound,
@@ -195,6 +397,263 @@ func TestApis(t *testing.T) {
 				"error": "record not found",
 			},
 		},
+		Case{
+			Path:   "/items/-1",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/items/abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid value for primary key id",
+			},
+		},
+		Case{
+			Path:   "/items/1/extra",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown resource",
+			},
+		},
+		Case{
+			Path:   "/items/1/extra/deeper",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown resource",
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/items",
+			Body: CR{
+				"id":          42,
+				"title":       "db_crud",
+				"description": "",
+			},
+			Result: CR{
+				"response": CR{
+					"id": 3,
+				},
+			},
+		},
+		Case{
+			Path: "/items/3",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          3,
+						"title":       "db_crud",
+						"description": "",
+						"updated":     nil,
+					},
+				},
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/items",
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title":              "x",
+				"description":        "y",
+				"title = 'x', admin": true,
+			},
+			Result: CR{
+				"error": "unknown field title = 'x', admin",
+				"field": "title = 'x', admin",
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/items",
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title":       CR{"nested": true},
+				"description": "y",
+			},
+			Result: CR{
+				"error": "field title have invalid type",
+				"field": "title",
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/items",
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"updated": "x",
+			},
+			Result: CR{
+				"error":  "missing required fields: title, description",
+				"fields": []string{"title", "description"},
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/items",
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title":       nil,
+				"description": "y",
+			},
+			Result: CR{
+				"error":  "missing required fields: title",
+				"fields": []string{"title"},
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/users",
+			Body: CR{
+				"login":    "qwerty",
+				"password": "love",
+				"email":    "qwerty@example.com",
+				"info":     "",
+			},
+			Result: CR{
+				"response": CR{
+					"user_id": 2,
+				},
+			},
+		},
+		Case{
+			Method: http.MethodPut,
+			Path:   "/items",
+			Body: []CR{
+				CR{"title": "bulk 1", "description": "first"},
+				CR{"title": "bulk 2", "description": "second", "updated": "bulk"},
+			},
+			Result: CR{
+				"response": CR{
+					"inserted": 2,
+					"ids":      []int{4, 5},
+				},
+			},
+		},
+		Case{
+			Method: http.MethodPost,
+			Path:   "/items/_batch",
+			Body: []CR{
+				CR{"id": 4, "fields": CR{"updated": "batch"}},
+				CR{"id": 5, "fields": CR{"title": "bulk 2 renamed"}},
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 2,
+					"results": []CR{
+						CR{"id": 4, "status": "updated", "updated": 1},
+						CR{"id": 5, "status": "updated", "updated": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Method: http.MethodPost,
+			Path:   "/items/_batch",
+			Status: http.StatusBadRequest,
+			Body: []CR{
+				CR{"id": 4, "fields": CR{"updated": "rolled back"}},
+				CR{"id": 5, "fields": CR{"id": 6}},
+				CR{"id": 1, "fields": CR{"updated": "never"}},
+			},
+			Result: CR{
+				"error": "entry 1 failed, batch rolled back",
+				"results": []CR{
+					CR{"id": 4, "status": "rolled_back", "updated": 1},
+					CR{"id": 5, "status": "failed", "error": "primary key field id can't be updated"},
+					CR{"id": 1, "status": "skipped"},
+				},
+			},
+		},
+		Case{
+			Method: http.MethodPost,
+			Path:   "/items/1",
+			Body: CR{
+				"updated": "love",
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/items/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          1,
+						"title":       "database/sql",
+						"description": "Рассказать про базы данных",
+						"updated":     "love",
+					},
+				},
+			},
+		},
+		Case{
+			Method: http.MethodPost,
+			Path:   "/items/1",
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"id": 4,
+			},
+			Result: CR{
+				"error": "primary key field id can't be updated",
+				"field": "id",
+			},
+		},
+		Case{
+			Method: http.MethodPost,
+			Path:   "/items/1",
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title = 'x', admin": true,
+			},
+			Result: CR{
+				"error": "unknown field title = 'x', admin",
+				"field": "title = 'x', admin",
+			},
+		},
+		Case{
+			Method: http.MethodDelete,
+			Path:   "/items",
+			Body: CR{
+				"ids": []int{4, 5, 100500},
+			},
+			Result: CR{
+				"response": CR{
+					"deleted": 2,
+				},
+			},
+		},
+		Case{
+			Method: http.MethodDelete,
+			Path:   "/items/2",
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+		Case{
+			Method: http.MethodDelete,
+			Path:   "/items/2",
+			Result: CR{
+				"response": CR{
+					"deleted": 0,
+				},
+			},
+		},
+		Case{
+			Path:   "/items/2",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
 	}
 
 	runCases(t, ts, db, cases)
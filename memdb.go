@@ -0,0 +1,766 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// memDB is a Store keeping its tables in memory, for the tests of
+// applications embedding the explorer, which then run without a PostgreSQL
+// server. It evaluates the statements of the explorer itself: filters,
+// ordering, paging, counts, upserts and update expressions. Column defaults
+// other than generated keys, foreign keys, full-text search, spatial filters
+// and orphan checks need a database and aren't supported.
+type memDB struct {
+	mu     sync.Mutex
+	tables map[string]*memTable
+}
+
+// memTable is a table of a memDB with its rows and the last value of its
+// generated columns.
+type memTable struct {
+	meta *Table
+	rows []map[string]interface{}
+	last int64
+}
+
+// newMemDB returns a memDB holding tables, empty.
+func newMemDB(tables ...*Table) *memDB {
+	m := &memDB{tables: make(map[string]*memTable, len(tables))}
+	for _, table := range tables {
+		m.tables[table.Name] = &memTable{meta: table}
+	}
+	return m
+}
+
+func (m *memDB) ListTables(ctx context.Context, schema string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name, table := range m.tables {
+		if table.meta.Schema == schema {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memDB) Introspect(ctx context.Context, schema string) (map[string]*Table, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tables := make(map[string]*Table)
+	for name, table := range m.tables {
+		if table.meta.Schema == schema {
+			meta := *table.meta
+			tables[name] = &meta
+		}
+	}
+	return tables, nil
+}
+
+func (m *memDB) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	m.mu.Lock()
+	records, err := memRecords(m.tables).selectRows(query)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// The rows are copies: each runs without holding the tables.
+	for _, record := range records {
+		if err := each(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memDB) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return memRecords(m.tables).insert(insert)
+}
+
+func (m *memDB) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return memRecords(m.tables).update(update)
+}
+
+func (m *memDB) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return memRecords(m.tables).delete(del)
+}
+
+// Begin starts a transaction on a copy of the tables, which replaces them
+// on Commit: of two transactions writing at once, the last one to commit
+// wins.
+func (m *memDB) Begin(ctx context.Context) (Tx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tables := make(map[string]*memTable, len(m.tables))
+	for name, table := range m.tables {
+		rows := make([]map[string]interface{}, len(table.rows))
+		for i, row := range table.rows {
+			rows[i] = copyRecord(row)
+		}
+		tables[name] = &memTable{meta: table.meta, rows: rows, last: table.last}
+	}
+	return &memTx{db: m, tables: tables}, nil
+}
+
+// memTx is a transaction of a memDB, used by one request at a time.
+type memTx struct {
+	db     *memDB
+	tables map[string]*memTable
+	done   bool
+}
+
+func (t *memTx) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	records, err := memRecords(t.tables).selectRows(query)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := each(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *memTx) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	return memRecords(t.tables).insert(insert)
+}
+
+func (t *memTx) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	return memRecords(t.tables).update(update)
+}
+
+func (t *memTx) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	return memRecords(t.tables).delete(del)
+}
+
+func (t *memTx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.db.mu.Lock()
+	t.db.tables = t.tables
+	t.db.mu.Unlock()
+	return nil
+}
+
+func (t *memTx) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	return nil
+}
+
+// memRecords runs statements on the tables of a memDB or of one of its
+// transactions; the caller guards them.
+type memRecords map[string]*memTable
+
+func (tables memRecords) table(name querybuilder.Table) (*memTable, error) {
+	table, ok := tables[name.Name]
+	if !ok {
+		return nil, fmt.Errorf("memdb: relation %q does not exist", name.Name)
+	}
+	return table, nil
+}
+
+func (tables memRecords) selectRows(query querybuilder.Select) ([]map[string]interface{}, error) {
+	table, err := tables.table(query.From)
+	if err != nil {
+		return nil, err
+	}
+	var matched []map[string]interface{}
+	for _, row := range table.rows {
+		ok, err := memMatch(query.Where, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, row)
+		}
+	}
+
+	var records []map[string]interface{}
+	switch {
+	case len(query.GroupBy) > 0:
+		groups := make(map[string][]map[string]interface{})
+		var order []string
+		for _, row := range matched {
+			values := make([]interface{}, len(query.GroupBy))
+			for i, column := range query.GroupBy {
+				values[i] = row[column]
+			}
+			encoded, _ := json.Marshal(values)
+			key := string(encoded)
+			if _, ok := groups[key]; !ok {
+				order = append(order, key)
+			}
+			groups[key] = append(groups[key], row)
+		}
+		for _, key := range order {
+			record, err := memProject(query.Columns, groups[key][0], len(groups[key]))
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		memSort(records, query.OrderBy)
+	case memAggregates(query.Columns):
+		record, err := memProject(query.Columns, nil, len(matched))
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{record}, nil
+	default:
+		// Rows are sorted before the projection, which may leave out the
+		// columns they are sorted by.
+		memSort(matched, query.OrderBy)
+		for _, row := range matched {
+			record, err := memProject(query.Columns, row, 0)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	if query.Page != nil {
+		offset := query.Page.Offset
+		if offset > len(records) {
+			offset = len(records)
+		}
+		records = records[offset:]
+		if query.Page.Limit >= 0 && query.Page.Limit < len(records) {
+			records = records[:query.Page.Limit]
+		}
+	}
+	return records, nil
+}
+
+func memSort(rows []map[string]interface{}, terms []querybuilder.Sort) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, term := range terms {
+			if c := memOrder(rows[i][term.Column], rows[j][term.Column]); c != 0 {
+				return c < 0 != term.Desc
+			}
+		}
+		return false
+	})
+}
+
+// memAggregates reports whether projections count rows instead of reading
+// them.
+func memAggregates(projections []querybuilder.Projection) bool {
+	for _, projection := range projections {
+		if _, ok := projection.(querybuilder.Count); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// memProject returns the projections of row, count being the rows of its
+// group for Count.
+func memProject(projections []querybuilder.Projection, row map[string]interface{}, count int) (map[string]interface{}, error) {
+	record := make(map[string]interface{}, len(projections))
+	for _, projection := range projections {
+		switch p := projection.(type) {
+		case querybuilder.Col:
+			record[string(p)] = row[string(p)]
+		case querybuilder.Count:
+			name := p.As
+			if name == "" {
+				name = "count"
+			}
+			record[name] = int64(count)
+		case querybuilder.Lit:
+			record["?column?"] = int64(p)
+		default:
+			return nil, fmt.Errorf("memdb: %T is not supported", projection)
+		}
+	}
+	return record, nil
+}
+
+func (tables memRecords) insert(insert querybuilder.Insert) ([][]interface{}, error) {
+	table, err := tables.table(insert.Into)
+	if err != nil {
+		return nil, err
+	}
+	rows := insert.Rows
+	if len(insert.Columns) == 0 {
+		rows = [][]interface{}{nil}
+	}
+	var returned [][]interface{}
+	for _, values := range rows {
+		row := make(map[string]interface{}, len(table.meta.Columns))
+		for i, column := range insert.Columns {
+			if _, ok := values[i].(querybuilder.DefaultValue); !ok {
+				row[column] = values[i]
+			}
+		}
+		last := table.last
+		for _, column := range table.meta.Columns {
+			if _, ok := row[column.Name]; !ok && column.Generated {
+				last++
+				row[column.Name] = last
+			}
+		}
+		if err := table.check(row); err != nil {
+			return nil, err
+		}
+
+		inserted := true
+		existing := table.conflict(row, nil)
+		if existing != nil && insert.OnConflict != nil && insert.OnConflict.Columns != nil {
+			// Only duplicates of the named key are resolved.
+			existing = table.conflict(row, insert.OnConflict.Columns)
+			if existing == nil {
+				return nil, fmt.Errorf("memdb: duplicate key value violates unique constraint on %s", table.meta.Name)
+			}
+		}
+		if existing != nil {
+			if insert.OnConflict == nil {
+				return nil, fmt.Errorf("memdb: duplicate key value violates unique constraint on %s", table.meta.Name)
+			}
+			if len(insert.OnConflict.Update) == 0 {
+				continue
+			}
+			for _, column := range insert.OnConflict.Update {
+				existing[column] = row[column]
+			}
+			row, inserted = existing, false
+		} else {
+			table.last = last
+			table.rows = append(table.rows, row)
+		}
+
+		if len(insert.Returning) > 0 {
+			values := make([]interface{}, len(insert.Returning))
+			for i, projection := range insert.Returning {
+				switch p := projection.(type) {
+				case querybuilder.Col:
+					values[i] = row[string(p)]
+				case querybuilder.Inserted:
+					values[i] = inserted
+				default:
+					return nil, fmt.Errorf("memdb: %T is not supported", projection)
+				}
+			}
+			returned = append(returned, values)
+		}
+	}
+	return returned, nil
+}
+
+// check rejects the rows that leave a column without a value it requires.
+func (table *memTable) check(row map[string]interface{}) error {
+	for _, column := range table.meta.Columns {
+		if row[column.Name] == nil && !column.Nullable && column.Default == "" {
+			return fmt.Errorf("memdb: null value in column %q of relation %q violates not-null constraint", column.Name, table.meta.Name)
+		}
+	}
+	for name := range row {
+		if _, ok := table.meta.Column(name); !ok {
+			return fmt.Errorf("memdb: column %q of relation %q does not exist", name, table.meta.Name)
+		}
+	}
+	return nil
+}
+
+// conflict returns the row that row duplicates on the unique key columns,
+// or on any unique key when columns is nil.
+func (table *memTable) conflict(row map[string]interface{}, columns []string) map[string]interface{} {
+	keys := [][]string{columns}
+	if columns == nil {
+		keys = [][]string{table.meta.PrimaryKey}
+		for _, key := range table.meta.UniqueKeys {
+			keys = append(keys, key.Columns)
+		}
+	}
+	for _, existing := range table.rows {
+		for _, key := range keys {
+			if len(key) > 0 && memSameKey(key, row, existing) {
+				return existing
+			}
+		}
+	}
+	return nil
+}
+
+func memSameKey(key []string, a, b map[string]interface{}) bool {
+	for _, column := range key {
+		if a[column] == nil || b[column] == nil || memOrder(a[column], b[column]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (tables memRecords) update(update querybuilder.Update) (int64, error) {
+	table, err := tables.table(update.Table)
+	if err != nil {
+		return 0, err
+	}
+	var updated []map[string]interface{}
+	var positions []int
+	for i, row := range table.rows {
+		ok, err := memMatch(update.Where, row)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		// Every assignment reads the row as it was.
+		changed := copyRecord(row)
+		for _, assign := range update.Set {
+			value := assign.Value
+			if scalar, ok := value.(querybuilder.Scalar); ok {
+				if value, err = memScalar(scalar, row); err != nil {
+					return 0, err
+				}
+			}
+			changed[assign.Column] = value
+		}
+		if err := table.check(changed); err != nil {
+			return 0, err
+		}
+		updated = append(updated, changed)
+		positions = append(positions, i)
+	}
+	for i, changed := range updated {
+		original := table.rows[positions[i]]
+		table.rows[positions[i]] = nil
+		if table.conflict(changed, nil) != nil {
+			table.rows[positions[i]] = original
+			return 0, fmt.Errorf("memdb: duplicate key value violates unique constraint on %s", table.meta.Name)
+		}
+		table.rows[positions[i]] = changed
+	}
+	return int64(len(updated)), nil
+}
+
+func (tables memRecords) delete(del querybuilder.Delete) (int64, error) {
+	table, err := tables.table(del.From)
+	if err != nil {
+		return 0, err
+	}
+	kept := table.rows[:0]
+	var deleted int64
+	for _, row := range table.rows {
+		ok, err := memMatch(del.Where, row)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			deleted++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	table.rows = kept
+	return deleted, nil
+}
+
+func copyRecord(row map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		copied[column] = value
+	}
+	return copied
+}
+
+// memMatch reports whether row holds for where, nil or empty holding for
+// every row. Comparisons with NULL don't hold, as in SQL.
+func memMatch(where querybuilder.Expr, row map[string]interface{}) (bool, error) {
+	switch e := where.(type) {
+	case nil:
+		return true, nil
+	case querybuilder.And:
+		for _, item := range e {
+			if ok, err := memMatch(item, row); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case querybuilder.Or:
+		for _, item := range e {
+			if ok, err := memMatch(item, row); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	case querybuilder.Compare:
+		value := row[e.Column]
+		if value == nil || e.Value == nil {
+			return false, nil
+		}
+		switch e.Op {
+		case querybuilder.Like, querybuilder.ILike:
+			pattern, err := likePattern(fmt.Sprint(e.Value), e.Op == querybuilder.ILike)
+			if err != nil {
+				return false, err
+			}
+			return pattern.MatchString(fmt.Sprint(value)), nil
+		}
+		c := memOrder(value, e.Value)
+		switch e.Op {
+		case querybuilder.Eq:
+			return c == 0, nil
+		case querybuilder.Neq:
+			return c != 0, nil
+		case querybuilder.Gt:
+			return c > 0, nil
+		case querybuilder.Gte:
+			return c >= 0, nil
+		case querybuilder.Lt:
+			return c < 0, nil
+		case querybuilder.Lte:
+			return c <= 0, nil
+		}
+		return false, fmt.Errorf("memdb: operator %s is not supported", e.Op)
+	case querybuilder.In:
+		for _, candidate := range e.Values {
+			if row[e.Column] != nil && candidate != nil && memOrder(row[e.Column], candidate) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case querybuilder.AnyOf:
+		for _, candidate := range e.Values {
+			if row[e.Column] != nil && memOrder(row[e.Column], candidate) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case querybuilder.IsNull:
+		return row[e.Column] == nil, nil
+	case querybuilder.IsBool:
+		value, ok := row[e.Column].(bool)
+		return ok && value == e.Value, nil
+	}
+	return false, fmt.Errorf("memdb: %T is not supported", where)
+}
+
+// likePattern turns a LIKE pattern into a regular expression.
+func likePattern(like string, insensitive bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if insensitive {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	escaped := false
+	for _, r := range like {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteString("(?s:.*)")
+		case r == '_':
+			b.WriteString("(?s:.)")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// memOrder compares a and b as numbers when both read as one, as times
+// when both do and as text otherwise. NULL sorts last, as in PostgreSQL.
+func memOrder(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if x, ok := memNumber(a); ok {
+		if y, ok := memNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+	x, y := memText(a), memText(b)
+	if tx, err := time.Parse(time.RFC3339Nano, x); err == nil {
+		if ty, err := time.Parse(time.RFC3339Nano, y); err == nil {
+			return tx.Compare(ty)
+		}
+	}
+	return strings.Compare(x, y)
+}
+
+func memText(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// memNumber reads value as a number, numeric text included.
+func memNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// memScalar computes the value of an update expression on row.
+func memScalar(scalar querybuilder.Scalar, row map[string]interface{}) (interface{}, error) {
+	switch s := scalar.(type) {
+	case querybuilder.Col:
+		return row[string(s)], nil
+	case querybuilder.Param:
+		return s.Value, nil
+	case querybuilder.Neg:
+		value, err := memScalar(s.Value, row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		n, ok := memNumber(value)
+		if !ok {
+			return nil, fmt.Errorf("memdb: %v is not a number", value)
+		}
+		return memNumberOf(-n, value), nil
+	case querybuilder.Arith:
+		left, err := memScalar(s.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		right, err := memScalar(s.Right, row)
+		if err != nil || left == nil || right == nil {
+			return nil, err
+		}
+		x, xok := memNumber(left)
+		y, yok := memNumber(right)
+		if !xok || !yok {
+			return nil, fmt.Errorf("memdb: %v %s %v is not arithmetic on numbers", left, s.Op, right)
+		}
+		var n float64
+		switch s.Op {
+		case querybuilder.Add:
+			n = x + y
+		case querybuilder.Sub:
+			n = x - y
+		case querybuilder.Mul:
+			n = x * y
+		case querybuilder.Div:
+			if y == 0 {
+				return nil, fmt.Errorf("memdb: division by zero")
+			}
+			n = x / y
+		}
+		return memNumberOf(n, left), nil
+	case querybuilder.Call:
+		args := make([]interface{}, len(s.Args))
+		for i, arg := range s.Args {
+			value, err := memScalar(arg, row)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		if s.Func == querybuilder.Coalesce {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		switch s.Func {
+		case querybuilder.Lower:
+			return strings.ToLower(memText(args[0])), nil
+		case querybuilder.Upper:
+			return strings.ToUpper(memText(args[0])), nil
+		case querybuilder.Trim:
+			return strings.TrimSpace(memText(args[0])), nil
+		}
+		n, ok := memNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("memdb: %v is not a number", args[0])
+		}
+		switch s.Func {
+		case querybuilder.Abs:
+			return memNumberOf(math.Abs(n), args[0]), nil
+		case querybuilder.Round:
+			return memNumberOf(math.Round(n), args[0]), nil
+		}
+		return nil, fmt.Errorf("memdb: function %s is not supported", s.Func)
+	}
+	return nil, fmt.Errorf("memdb: %T is not supported", scalar)
+}
+
+// memNumberOf returns n typed like like: integral for an integer, text for
+// numeric text.
+func memNumberOf(n float64, like interface{}) interface{} {
+	switch like.(type) {
+	case int, int32, int64:
+		if n == math.Trunc(n) {
+			return int64(n)
+		}
+	case string, json.Number:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return n
+}
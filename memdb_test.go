@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// memExplorer is an explorer over the tables of fuzzSchema held by a memDB,
+// as an embedding application would set it up.
+func memExplorer(t *testing.T) (*DbExplorer, *memDB) {
+	var tables []*Table
+	for _, table := range fuzzSchema().Tables {
+		tables = append(tables, table)
+	}
+	backend := newMemDB(tables...)
+	de, err := NewDbExplorerWithConfig(nil, &Config{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return de, backend
+}
+
+func TestMemDBRecords(t *testing.T) {
+	de, _ := memExplorer(t)
+	cases := []struct {
+		method, path, body string
+		status             int
+		response           string
+	}{
+		{"PUT", "/items", `{"title":"memcache","price":"1.5"}`, http.StatusOK, `{"response":{"id":1}}`},
+		{"PUT", "/items", `{"title":"redis","price":2}`, http.StatusOK, `{"response":{"id":2}}`},
+		{"PUT", "/items", `{"title":"redis"}`, http.StatusInternalServerError, "Error inserting record: memdb: duplicate key value violates unique constraint on items\n"},
+		{"GET", "/items?title=eq.redis&fields=id,title", "", http.StatusOK, `{"response":{"records":[{"id":2,"title":"redis"}]}}`},
+		{"GET", "/items?order=price.desc&limit=1&fields=title", "", http.StatusOK, `{"response":{"records":[{"title":"redis"}]}}`},
+		{"POST", "/items/1", `{"title":"memcached"}`, http.StatusOK, `{"response":{"updated":1}}`},
+		{"GET", "/items/1?fields=title", "", http.StatusOK, `{"response":{"record":{"title":"memcached"}}}`},
+		{"GET", "/items/_distinct/title?counts=true", "", http.StatusOK, `{"response":{"values":[{"count":1,"value":"memcached"},{"count":1,"value":"redis"}]}}`},
+		{"DELETE", "/items/2", "", http.StatusOK, `{"response":{"deleted":1}}`},
+		{"GET", "/items?fields=id&count=true", "", http.StatusOK, `{"response":{"limit":100,"offset":0,"records":[{"id":1}],"total":1}}`},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, r)
+		if w.Code != c.status || strings.TrimSuffix(w.Body.String(), "\n") != strings.TrimSuffix(c.response, "\n") {
+			t.Fatalf("[%s %s] results not match\nGot : %d %s\nWant: %d %s", c.method, c.path, w.Code, w.Body, c.status, c.response)
+		}
+	}
+}
+
+func TestMemDBTransactions(t *testing.T) {
+	ctx := context.Background()
+	_, backend := memExplorer(t)
+	items := querybuilder.Table{Schema: "public", Name: "items"}
+	titles := func() []interface{} {
+		var titles []interface{}
+		backend.Select(ctx, querybuilder.Select{Columns: querybuilder.Cols("title"), From: items, OrderBy: []querybuilder.Sort{{Column: "id"}}}, func(record map[string]interface{}) error {
+			titles = append(titles, record["title"])
+			return nil
+		})
+		return titles
+	}
+
+	tx, _ := backend.Begin(ctx)
+	tx.Insert(ctx, querybuilder.Insert{Into: items, Columns: []string{"title"}, Rows: [][]interface{}{{"lost"}}})
+	tx.Rollback()
+	tx, _ = backend.Begin(ctx)
+	tx.Insert(ctx, querybuilder.Insert{Into: items, Columns: []string{"title", "price"}, Rows: [][]interface{}{{"kept", "2"}}})
+	if got := titles(); len(got) != 0 {
+		t.Fatalf("results not match\nGot : %v\nWant: nothing before the commit", got)
+	}
+	tx.Commit()
+	if got, want := titles(), []interface{}{"kept"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %v\nWant: %v", got, want)
+	}
+
+	// An upsert updates the row it duplicates, an update computes its
+	// expressions on the row as it was.
+	returned, err := backend.Insert(ctx, querybuilder.Insert{
+		Into: items, Columns: []string{"title", "price"}, Rows: [][]interface{}{{"kept", "3"}, {"new", nil}},
+		OnConflict: &querybuilder.OnConflict{Columns: []string{"title"}, Update: []string{"price"}},
+		Returning:  []querybuilder.Projection{querybuilder.Col("id"), querybuilder.Inserted{As: "inserted"}},
+	})
+	if want := [][]interface{}{{int64(1), false}, {int64(2), true}}; err != nil || !reflect.DeepEqual(returned, want) {
+		t.Fatalf("results not match\nGot : %v %v\nWant: %v", returned, err, want)
+	}
+	n, err := backend.Update(ctx, querybuilder.Update{
+		Table: items,
+		Set: []querybuilder.Assign{
+			{Column: "price", Value: querybuilder.Arith{Left: querybuilder.Col("price"), Op: querybuilder.Mul, Right: querybuilder.Param{Value: int64(2)}}},
+			{Column: "title", Value: querybuilder.Call{Func: querybuilder.Upper, Args: []querybuilder.Scalar{querybuilder.Col("title")}}},
+		},
+		Where: querybuilder.Compare{Column: "title", Op: querybuilder.ILike, Value: "K%"},
+	})
+	if got, want := titles(), []interface{}{"KEPT", "new"}; n != 1 || err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %d %v %v\nWant: %v", n, err, got, want)
+	}
+	var price interface{}
+	backend.Select(ctx, querybuilder.Select{Columns: querybuilder.Cols("price"), From: items, Where: querybuilder.Compare{Column: "id", Op: querybuilder.Eq, Value: "1"}}, func(record map[string]interface{}) error {
+		price = record["price"]
+		return nil
+	})
+	if price != "6" {
+		t.Fatalf("results not match\nGot : %v\nWant: 6", price)
+	}
+
+	if _, err := backend.Delete(ctx, querybuilder.Delete{From: items, Where: querybuilder.TextSearch{Columns: []string{"title"}, Query: "kept"}}); err == nil {
+		t.Fatalf("expected full-text search to be unsupported")
+	}
+}
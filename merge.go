@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// mergeRequest is the body of POST /{table}/_merge. Coalesce is true for
+// every column, or lists the columns to coalesce.
+type mergeRequest struct {
+	Winner   interface{}   `json:"winner"`
+	Losers   []interface{} `json:"losers"`
+	Coalesce interface{}   `json:"coalesce"`
+}
+
+// handleMerge serves POST /{table}/_merge, which merges duplicate records
+// into one: {"winner": 1, "losers": [2, 3], "coalesce": true}. The rows of
+// every table referencing a loser, through a constraint or a declared
+// relation, are repointed to the winner, then the losers are deleted. With
+// coalesce, the columns of the winner that are null take the value of the
+// first loser that has one, either every column or the ones listed;
+// primary key, generated and encrypted columns are left alone. It all
+// happens in one transaction.
+func (de *DbExplorer) handleMerge(w http.ResponseWriter, r *http.Request, table *Table) {
+	if len(table.PrimaryKey) == 0 {
+		writeError(w, http.StatusBadRequest, errNoPrimaryKey.Error())
+		return
+	}
+	if !de.authorize(w, r, table, actionDelete) {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var request mergeRequest
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if len(request.Losers) == 0 {
+		writeError(w, http.StatusBadRequest, "losers must list the records to merge into the winner")
+		return
+	}
+	winner, err := table.keyFromJSON(request.Winner)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "winner: "+err.Error())
+		return
+	}
+	losers := make([]recordKey, len(request.Losers))
+	for i, raw := range request.Losers {
+		if losers[i], err = table.keyFromJSON(raw); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("losers[%d]: %v", i, err))
+			return
+		}
+		if fmt.Sprint(losers[i]) == fmt.Sprint(winner) {
+			writeError(w, http.StatusBadRequest, "the winner can't be a loser")
+			return
+		}
+	}
+	coalesce, err := de.coalesceColumns(table, request.Coalesce)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	schema := de.requestSchema(r.Context())
+	children := referencingKeys(schema, table)
+	for _, ref := range children {
+		if !de.authorize(w, r, ref.table, actionUpdate) {
+			return
+		}
+	}
+
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	columns := table.ColumnNames()
+	records := make([]map[string]interface{}, 0, len(losers)+1)
+	for _, key := range append([]recordKey{winner}, losers...) {
+		var found map[string]interface{}
+		err := tx.Select(r.Context(), selectRecord(table, columns, key), func(record map[string]interface{}) error {
+			found = record
+			return nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error merging records: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if found == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("record %v not found", keyValue(table, key)))
+			return
+		}
+		records = append(records, found)
+	}
+
+	repointed := make(map[string]int64)
+	for _, ref := range children {
+		set := make([]querybuilder.Assign, len(ref.fk.Columns))
+		for i, column := range ref.fk.Columns {
+			set[i] = querybuilder.Assign{Column: column, Value: records[0][ref.fk.RefColumns[i]]}
+		}
+		where := referencing(ref.fk, records[1:])
+		if where == nil {
+			continue
+		}
+		affected, err := tx.Update(r.Context(), querybuilder.Update{Table: ref.table.ref(), Set: set, Where: where})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error repointing %s: %v", ref.table.Name, err), http.StatusInternalServerError)
+			return
+		}
+		repointed[ref.table.Name] += affected
+	}
+
+	var deleted int64
+	for _, key := range losers {
+		affected, err := tx.Delete(r.Context(), querybuilder.Delete{From: table.ref(), Where: keyCondition(table, key)})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting records: %v", err), http.StatusInternalServerError)
+			return
+		}
+		deleted += affected
+	}
+
+	// The winner takes the values once the losers are gone, so that unique
+	// ones don't conflict.
+	data, err := de.coalesced(table, coalesce, records)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	coalesced := sortedColumns(data)
+	if len(data) > 0 {
+		if _, err := tx.Update(r.Context(), updateRecord(table, data, winner)); err != nil {
+			http.Error(w, fmt.Sprintf("Error updating record: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	total := deleted
+	for _, n := range repointed {
+		total += n
+	}
+	addRows(r.Context(), total)
+
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"winner":    keyValue(table, winner),
+			"deleted":   deleted,
+			"repointed": repointed,
+			"coalesced": coalesced,
+		},
+	}, false)
+}
+
+// coalesceColumns resolves the coalesce option of a merge to columns.
+func (de *DbExplorer) coalesceColumns(table *Table, option interface{}) ([]*Column, error) {
+	var names []string
+	switch v := option.(type) {
+	case nil, bool:
+		if v != true {
+			return nil, nil
+		}
+		for _, column := range table.Columns {
+			if !containsString(table.PrimaryKey, column.Name) && !column.Generated && !de.isEncrypted(table.Name, column.Name) {
+				names = append(names, column.Name)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			name, _ := item.(string)
+			column, ok := table.Column(name)
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("coalesce: unknown field %v", item)
+			case containsString(table.PrimaryKey, name), column.Generated:
+				return nil, fmt.Errorf("coalesce: %s is set by the database", name)
+			case de.isEncrypted(table.Name, name):
+				return nil, fmt.Errorf("coalesce: %s is encrypted", name)
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, errors.New("coalesce must be true or a list of columns")
+	}
+	columns := make([]*Column, len(names))
+	for i, name := range names {
+		columns[i], _ = table.Column(name)
+	}
+	return columns, nil
+}
+
+// coalesced returns the values the winner, records[0], takes from the
+// losers: those of the first loser setting a column the winner leaves null.
+func (de *DbExplorer) coalesced(table *Table, columns []*Column, records []map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, column := range columns {
+		if records[0][column.Name] != nil {
+			continue
+		}
+		for _, loser := range records[1:] {
+			value := loser[column.Name]
+			if value == nil {
+				continue
+			}
+			converted, err := de.copyValue(column, value)
+			if err != nil {
+				return nil, &fieldError{column.Name, fmt.Sprintf("field %s can't be coalesced", column.Name)}
+			}
+			data[column.Name] = converted
+			break
+		}
+	}
+	return data, nil
+}
+
+// copyValue converts a value read from column back into one it can be
+// written with. Values are read as JSON, so they go through JSON and are
+// converted as a body would be.
+func (de *DbExplorer) copyValue(column *Column, value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	converted, ok := de.convertValue(column, value, false)
+	if !ok {
+		return nil, fmt.Errorf("field %s can't be copied", column.Name)
+	}
+	return converted, nil
+}
+
+// tableReference is a foreign key of table.
+type tableReference struct {
+	table *Table
+	fk    *ForeignKey
+}
+
+// referencingKeys lists the foreign keys referencing table, by table.
+func referencingKeys(schema *Schema, table *Table) []tableReference {
+	names := make([]string, 0, len(schema.Tables))
+	for name := range schema.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var refs []tableReference
+	for _, name := range names {
+		for _, fk := range schema.Tables[name].ForeignKeys {
+			if fk.RefTable == table.Name {
+				refs = append(refs, tableReference{schema.Tables[name], fk})
+			}
+		}
+	}
+	return refs
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	newBackend := func() *tableStore {
+		return &tableStore{rows: map[string][]map[string]interface{}{
+			"items": {
+				{"id": int64(1), "title": "memcache", "price": nil},
+				{"id": int64(2), "title": "memcached", "price": json.Number("9.50")},
+				{"id": int64(3), "title": "memcache 2", "price": json.Number("7")},
+			},
+		}}
+	}
+	backend := newBackend()
+	de := backendExplorer(backend)
+
+	body := `{"winner": 1, "losers": [2, 3], "coalesce": true}`
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/_merge", strings.NewReader(body)))
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"winner":    float64(1),
+			"deleted":   float64(2),
+			"repointed": map[string]interface{}{"order_items": float64(1)},
+			"coalesced": []interface{}{"price"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	// The children are repointed before the losers are deleted, the winner
+	// takes the first price after.
+	wantUpdates := []string{
+		`UPDATE "public"."order_items" SET "item_id" = $1 WHERE "item_id" IN ($2, $3) [1 2 3]`,
+		`UPDATE "public"."items" SET "price" = $1 WHERE "id" = $2 [9.50 1]`,
+	}
+	if !reflect.DeepEqual(backend.updates, wantUpdates) || len(backend.deletes) != 2 {
+		t.Fatalf("results not match\nGot : %#v %#v\nWant: %#v", backend.updates, backend.deletes, wantUpdates)
+	}
+
+	cases := []struct {
+		body   string
+		status int
+		error  string
+	}{
+		{`{"winner": 1, "losers": []}`, http.StatusBadRequest, "losers must list the records to merge into the winner"},
+		{`{"winner": 1, "losers": [1]}`, http.StatusBadRequest, "the winner can't be a loser"},
+		{`{"winner": 1, "losers": ["x"]}`, http.StatusBadRequest, "losers[0]: invalid value for primary key id"},
+		{`{"winner": 1, "losers": [4]}`, http.StatusNotFound, "record 4 not found"},
+		{`{"winner": 1, "losers": [2], "coalesce": ["id"]}`, http.StatusBadRequest, "coalesce: id is set by the database"},
+		{`{"winner": 1, "losers": [2], "coalesce": "price"}`, http.StatusBadRequest, "coalesce must be true or a list of columns"},
+	}
+	for _, item := range cases {
+		backend := newBackend()
+		de := backendExplorer(backend)
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items/_merge", strings.NewReader(item.body)))
+		if w.Code != item.status || !strings.Contains(w.Body.String(), item.error) {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.body, w.Code, w.Body, item.status, item.error)
+		}
+		if backend.updates != nil || backend.deletes != nil {
+			t.Fatalf("[%s] results not match\nGot : %v %v\nWant: nothing written", item.body, backend.updates, backend.deletes)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// features reports which optional capabilities are available in the current
+// mode, with the reason when one is degraded.
+func (de *DbExplorer) features() map[string]string {
+	features := map[string]string{
+		"prepared_statements": "enabled",
+		"session_settings":    "enabled",
+	}
+	if de.cfg.PgBouncer {
+		// Transaction pooling hands every transaction to a different server
+		// session, so nothing may outlive a single transaction.
+		features["prepared_statements"] = "disabled: pgbouncer transaction pooling"
+		features["session_settings"] = "disabled: pgbouncer transaction pooling, SET LOCAL only inside transactions"
+	}
+	return features
+}
+
+func (de *DbExplorer) handleMeta(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"pgbouncer": de.cfg.PgBouncer,
+			"features":  de.features(),
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
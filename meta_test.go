@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMeta(t *testing.T) {
+	cases := []struct {
+		pgbouncer bool
+		body      string
+	}{
+		{false, `{"response":{"features":{"prepared_statements":"enabled","session_settings":"enabled"},"pgbouncer":false}}`},
+		{true, `{"response":{"features":{"prepared_statements":"disabled: pgbouncer transaction pooling","session_settings":"disabled: pgbouncer transaction pooling, SET LOCAL only inside transactions"},"pgbouncer":true}}`},
+	}
+	for _, item := range cases {
+		de := backendExplorer(&fakeStore{})
+		de.cfg.PgBouncer = item.pgbouncer
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_meta", nil))
+		if w.Code != http.StatusOK || w.Body.String() != item.body+"\n" {
+			t.Fatalf("[pgbouncer %v] results not match\nGot : %d %s\nWant: %s", item.pgbouncer, w.Code, w.Body, item.body)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// NamedQuery is a reviewed query callers run by name with GET
+// /_queries/{name}, giving them their own parameter values only.
+type NamedQuery struct {
+	// SQL is a single SELECT taking the parameters as $1, $2, ... in the
+	// order of Params.
+	SQL         string       `json:"sql"`
+	Description string       `json:"description"`
+	Params      []QueryParam `json:"params"`
+	// Roles are the roles of the callers besides admins that may run the
+	// query; without any, every caller may.
+	Roles []string `json:"roles"`
+}
+
+// QueryParam is a parameter of a named query, read from the query string.
+type QueryParam struct {
+	Name string `json:"name"`
+	// Type is the PostgreSQL type the value is checked against as a filter
+	// value would be, e.g. integer, numeric, boolean, uuid, date or text.
+	Type string `json:"type"`
+	// Enum lists the values the parameter may take, if restricted.
+	Enum []string `json:"enum"`
+	// Default is the value of a parameter left out; without it the
+	// parameter is required.
+	Default *string `json:"default"`
+}
+
+// column types the parameter as a filter on a column of its type.
+func (p QueryParam) column() *Column {
+	return &Column{Name: p.Name, DataType: p.Type, EnumValues: p.Enum}
+}
+
+// checkNamedQueries rejects named queries that could never run.
+func checkNamedQueries(queries map[string]NamedQuery) error {
+	for name, query := range queries {
+		if err := checkReadQuery(query.SQL); err != nil {
+			return fmt.Errorf("query %s: %v", name, err)
+		}
+		seen := make(map[string]bool, len(query.Params))
+		for _, param := range query.Params {
+			if param.Name == "" || seen[param.Name] {
+				return fmt.Errorf("query %s: parameters need distinct names", name)
+			}
+			seen[param.Name] = true
+			if param.Default != nil {
+				if _, err := filterValue(param.column(), *param.Default); err != nil {
+					return fmt.Errorf("query %s: invalid default for parameter %s", name, param.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// handleNamedQueries serves GET /_queries, the named queries the caller may
+// run with their parameters, and GET /_queries/{name}?param=value, which
+// runs one. Parameter values are checked against their declared types, so
+// a bad one is a 400 naming it, and parameters the query doesn't declare
+// are rejected.
+func (de *DbExplorer) handleNamedQueries(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "" {
+		de.listNamedQueries(w, r)
+		return
+	}
+	query, ok := de.cfg.Queries[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown query")
+		return
+	}
+	if !de.mayRunNamed(r, query) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("query %s is not allowed", name))
+		return
+	}
+
+	values := r.URL.Query()
+	for param := range values {
+		if !query.hasParam(param) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown parameter %s", param))
+			return
+		}
+	}
+	args := make([]interface{}, len(query.Params))
+	for i, param := range query.Params {
+		raw, ok := values.Get(param.Name), values.Has(param.Name)
+		switch {
+		case !ok && param.Default == nil:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("missing parameter %s", param.Name))
+			return
+		case !ok:
+			raw = *param.Default
+		}
+		if len(param.Enum) > 0 && !containsString(param.Enum, raw) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("parameter %s must be one of: %s", param.Name, strings.Join(param.Enum, ", ")))
+			return
+		}
+		value, err := filterValue(param.column(), raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("parameter %s must be of type %s", param.Name, param.Type))
+			return
+		}
+		args[i] = value
+	}
+	de.runQuery(w, r, query.SQL, args, map[string]interface{}{"query": name})
+}
+
+func (de *DbExplorer) listNamedQueries(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(de.cfg.Queries))
+	for name, query := range de.cfg.Queries {
+		if de.mayRunNamed(r, query) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	queries := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		query := de.cfg.Queries[name]
+		params := query.Params
+		if params == nil {
+			params = []QueryParam{}
+		}
+		queries[i] = map[string]interface{}{
+			"name":        name,
+			"description": query.Description,
+			"params":      params,
+		}
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"queries": queries,
+		},
+	}, false)
+}
+
+// mayRunNamed reports whether the caller is an admin or has one of the
+// roles of query, when it names any.
+func (de *DbExplorer) mayRunNamed(r *http.Request, query NamedQuery) bool {
+	if len(query.Roles) == 0 || de.isAdmin(r) {
+		return true
+	}
+	id := identityFromRequest(r)
+	for _, role := range query.Roles {
+		if id != nil && id.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q NamedQuery) hasParam(name string) bool {
+	for _, param := range q.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNamedQueries(t *testing.T) {
+	backend := &queryStore{fakeStore: fakeStore{records: []map[string]interface{}{
+		{"id": 1, "title": "database/sql"},
+	}}}
+	de := backendExplorer(backend)
+	limit := "10"
+	de.cfg.Queries = map[string]NamedQuery{
+		"cheap_items": {
+			SQL:         "SELECT id, title FROM items WHERE price < $1 AND created >= $2 LIMIT $3",
+			Description: "Items below a price",
+			Params: []QueryParam{
+				{Name: "below", Type: "numeric"},
+				{Name: "since", Type: "date"},
+				{Name: "limit", Type: "integer", Default: &limit},
+			},
+		},
+		"payroll": {SQL: "SELECT * FROM salaries", Roles: []string{"hr"}},
+	}
+	de.cfg.Auth.Roles = map[string][]Permission{"*": {{Table: "*", Actions: []string{actionRead}}}}
+	if err := checkNamedQueries(de.cfg.Queries); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_queries/cheap_items?below=9.5&since=2024-01-01", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"rows":[[1,"database/sql"]]`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+	if want := []interface{}{"9.5", "2024-01-01", int64(10)}; !reflect.DeepEqual(backend.args, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.args, want)
+	}
+
+	cases := []struct {
+		path  string
+		code  int
+		error string
+	}{
+		{"/_queries/everything", http.StatusNotFound, "unknown query"},
+		{"/_queries/payroll", http.StatusForbidden, "query payroll is not allowed"},
+		{"/_queries/cheap_items?since=2024-01-01", http.StatusBadRequest, "missing parameter below"},
+		{"/_queries/cheap_items?below=cheap&since=2024-01-01", http.StatusBadRequest, "parameter below must be of type numeric"},
+		{"/_queries/cheap_items?below=1&since=2024-01-01&order=id", http.StatusBadRequest, "unknown parameter order"},
+	}
+	for _, item := range cases {
+		backend.query = ""
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, item.path, nil))
+		if w.Code != item.code || !strings.Contains(w.Body.String(), item.error) || backend.query != "" {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.path, w.Code, w.Body, item.code, item.error)
+		}
+	}
+
+	// The list leaves out the queries the caller may not run.
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_queries", nil))
+	if !strings.Contains(w.Body.String(), `"name":"cheap_items"`) || strings.Contains(w.Body.String(), "payroll") {
+		t.Fatalf("results not match\nGot : %d %s\nWant: cheap_items only", w.Code, w.Body)
+	}
+
+	if err := checkNamedQueries(map[string]NamedQuery{"purge": {SQL: "DELETE FROM items"}}); err == nil {
+		t.Fatal("results not match\nGot : nil\nWant: an error for a query that isn't a SELECT")
+	}
+}
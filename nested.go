@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// nestedError rejects a record of a nested write, at path in the body.
+type nestedError struct {
+	status int
+	path   string
+	err    error
+}
+
+func (e *nestedError) Error() string {
+	if e.path == "" {
+		return e.err.Error()
+	}
+	return e.path + ": " + e.err.Error()
+}
+
+// nestedWrite writes the records of a nested document in tx.
+type nestedWrite struct {
+	de       *DbExplorer
+	r        *http.Request
+	tx       Tx
+	schema   *Schema
+	inserted map[string]int
+}
+
+// handleNestedImport serves POST /{table}/_import with a JSON body: a
+// document, or an array of them, whose keys naming a child table hold the
+// records of that table, which may hold their own children the same way.
+// A child table is one whose foreign key references the primary key of its
+// parent, see childReference; the key of the parent, generated or not, is
+// set on the foreign key of its children. Everything is inserted in one
+// transaction that the first bad record rolls back, e.g. an order with its
+// line items. The response counts the records inserted per table and lists
+// the keys of the documents.
+func (de *DbExplorer) handleNestedImport(w http.ResponseWriter, r *http.Request, table *Table) {
+	body, err := de.readBody(r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	documents, ok := body.([]interface{})
+	if !ok {
+		documents = []interface{}{body}
+	}
+	if len(documents) == 0 {
+		writeError(w, http.StatusBadRequest, "no records to insert")
+		return
+	}
+
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	nested := &nestedWrite{de: de, r: r, tx: tx, schema: de.requestSchema(r.Context()), inserted: map[string]int{}}
+	ids := []interface{}{}
+	for i, document := range documents {
+		key, err := nested.insert(fmt.Sprintf("[%d]", i), table, document, nil)
+		var ne *nestedError
+		switch {
+		case errors.As(err, &ne):
+			writeError(w, ne.status, err.Error())
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Error inserting records: %v", err), http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, keyValue(table, key))
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	total := 0
+	for _, n := range nested.inserted {
+		total += n
+	}
+	addRows(r.Context(), int64(total))
+
+	result := map[string]interface{}{"inserted": nested.inserted}
+	if len(table.PrimaryKey) > 0 {
+		result["ids"] = ids
+	}
+	writeResponse(w, map[string]interface{}{"response": result}, false)
+}
+
+// insert inserts the record at path of the body into table, then its
+// children, and returns its key. set holds the foreign key to the parent.
+func (n *nestedWrite) insert(path string, table *Table, value interface{}, set map[string]interface{}) (recordKey, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &nestedError{http.StatusBadRequest, path, errors.New("expected a JSON object")}
+	}
+	children, err := n.children(path, table, object)
+	if err != nil {
+		return nil, err
+	}
+	for column := range set {
+		if _, ok := object[column]; ok {
+			return nil, &nestedError{http.StatusBadRequest, path, fmt.Errorf("%s is set by the parent record", column)}
+		}
+	}
+	data, err := n.de.prepareRecord(n.r, table, object, set)
+	if err == nil {
+		err = n.de.encryptValues(table.Name, data)
+	}
+	if err != nil {
+		return nil, &nestedError{http.StatusBadRequest, path, err}
+	}
+
+	returned, err := n.tx.Insert(n.r.Context(), insertRecord(table, data))
+	if err == nil && len(returned) != 1 {
+		err = fmt.Errorf("%d rows returned", len(returned))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	key := recordKey(returned[0])
+	n.inserted[table.Name]++
+
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := n.schema.Tables[name]
+		if err := n.authorize(path, child, actionCreate); err != nil {
+			return nil, err
+		}
+		parent := parentValues(table, key, child)
+		for i, record := range children[name] {
+			if _, err := n.insert(fmt.Sprintf("%s.%s[%d]", path, name, i), child, record, parent); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return key, nil
+}
+
+// children takes the keys of object that name child tables of table out of
+// it, with their records. Other keys are left to fail as unknown fields.
+func (n *nestedWrite) children(path string, table *Table, object map[string]interface{}) (map[string][]interface{}, error) {
+	children := make(map[string][]interface{})
+	for name, value := range object {
+		if _, ok := table.Column(name); ok {
+			continue
+		}
+		child, ok := n.schema.Tables[name]
+		if !ok {
+			continue
+		}
+		if _, ok, err := childReference(table, child); err != nil || !ok {
+			if err == nil {
+				err = fmt.Errorf("%s doesn't reference %s", name, table.Name)
+			}
+			return nil, &nestedError{http.StatusBadRequest, path, err}
+		}
+		records, ok := value.([]interface{})
+		if !ok {
+			return nil, &nestedError{http.StatusBadRequest, path, fmt.Errorf("%s must be an array of records", name)}
+		}
+		children[name] = records
+	}
+	for name := range children {
+		delete(object, name)
+	}
+	return children, nil
+}
+
+// authorize rejects the actions on the child tables the caller may not
+// perform, as authorize does for the table of the request.
+func (n *nestedWrite) authorize(path string, table *Table, action string) error {
+	var roles []string
+	if id := identityFromRequest(n.r); id != nil {
+		roles = id.Roles
+	}
+	if !n.de.decide(roles, table.Name, action).Allowed {
+		return &nestedError{http.StatusForbidden, path, fmt.Errorf("%s on %s is not allowed", action, table.Name)}
+	}
+	return nil
+}
+
+// parentValues are the values of the foreign key of child referencing the
+// record of table with key.
+func parentValues(table *Table, key recordKey, child *Table) map[string]interface{} {
+	fk, _, _ := childReference(table, child)
+	values := make(map[string]interface{}, len(fk.Columns))
+	for i, column := range fk.Columns {
+		for j, pk := range table.PrimaryKey {
+			if pk == fk.RefColumns[i] {
+				values[column] = key[j]
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// Operations on a child record of a nested update, given as its "_op".
+const (
+	childCreate = "create"
+	childUpdate = "update"
+	childDelete = "delete"
+)
+
+// hasChildren reports whether object names a table besides the columns of
+// table, i.e. holds child records.
+func (de *DbExplorer) hasChildren(table *Table, object map[string]interface{}) bool {
+	tables := de.snapshot().Tables
+	for name := range object {
+		if _, ok := table.Column(name); ok {
+			continue
+		}
+		if _, ok := tables[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handleNestedUpdate serves POST /{table}/{id} with a body that holds,
+// next to the columns to update, arrays of records of child tables as
+// nested imports do. Each child record is created, updated or deleted as
+// its "_op" says; without one it is updated when it holds its primary key
+// and created otherwise. The foreign key to the record is set on created
+// children and scopes the others: a child of another record is not found.
+// Everything happens in one transaction; the response reports the outcome
+// of every child in order, like batch updates, and the first failing one
+// rolls everything back.
+func (de *DbExplorer) handleNestedUpdate(w http.ResponseWriter, r *http.Request, table *Table, key recordKey, object map[string]interface{}) {
+	tx, err := de.backend.Begin(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	n := &nestedWrite{de: de, r: r, tx: tx, schema: de.requestSchema(r.Context()), inserted: map[string]int{}}
+
+	children, err := n.children("", table, object)
+	if err != nil {
+		var ne *nestedError
+		errors.As(err, &ne)
+		writeError(w, ne.status, err.Error())
+		return
+	}
+	names := make([]string, 0, len(children))
+	results := make(map[string][]batchResult, len(children))
+	for name, records := range children {
+		names = append(names, name)
+		results[name] = make([]batchResult, len(records))
+		for i := range results[name] {
+			results[name][i] = batchResult{Status: "skipped"}
+		}
+	}
+	sort.Strings(names)
+	var done []*batchResult
+	fail := func(status int, err error) {
+		for _, result := range done {
+			result.Status = "rolled_back"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    err.Error(),
+			"children": results,
+		})
+	}
+
+	updated, err := n.updateParent(table, key, object)
+	if err != nil {
+		var ne *nestedError
+		if errors.As(err, &ne) {
+			fail(ne.status, err)
+		} else {
+			fail(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	var total int64
+	for _, name := range names {
+		child := n.schema.Tables[name]
+		parent := parentValues(table, key, child)
+		for i, record := range children[name] {
+			result := &results[name][i]
+			path := fmt.Sprintf("%s[%d]", name, i)
+			affected, err := n.writeChild(path, child, record, parent, result)
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+				var ne *nestedError
+				if errors.As(err, &ne) {
+					fail(ne.status, err)
+				} else {
+					fail(http.StatusInternalServerError, err)
+				}
+				return
+			}
+			total += affected
+			done = append(done, result)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), updated+total)
+
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"updated":  updated,
+			"children": results,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// updateParent updates the columns of the body on the record, if any, and
+// makes sure the record exists either way.
+func (n *nestedWrite) updateParent(table *Table, key recordKey, object map[string]interface{}) (int64, error) {
+	if len(object) == 0 {
+		found := false
+		err := n.tx.Select(n.r.Context(), selectRecord(table, table.PrimaryKey, key), func(map[string]interface{}) error {
+			found = true
+			return nil
+		})
+		if err == nil && !found {
+			err = &nestedError{http.StatusNotFound, "", errors.New("record not found")}
+		}
+		return 0, err
+	}
+	data, err := n.de.prepareUpdate(n.r, table, object)
+	if err != nil {
+		return 0, &nestedError{http.StatusBadRequest, "", err}
+	}
+	if err := n.de.encryptValues(table.Name, data); err != nil {
+		return 0, err
+	}
+	affected, err := n.tx.Update(n.r.Context(), updateRecord(table, data, key))
+	if err == nil && affected == 0 {
+		err = &nestedError{http.StatusNotFound, "", errors.New("record not found")}
+	}
+	return affected, err
+}
+
+// writeChild applies the operation of a child record at path, whose
+// foreign key to the record takes the values of parent, and reports it in
+// result.
+func (n *nestedWrite) writeChild(path string, child *Table, value interface{}, parent map[string]interface{}, result *batchResult) (int64, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return 0, &nestedError{http.StatusBadRequest, path, errors.New("expected a JSON object")}
+	}
+	op, _ := object["_op"].(string)
+	delete(object, "_op")
+	for column := range parent {
+		if _, ok := object[column]; ok {
+			return 0, &nestedError{http.StatusBadRequest, path, fmt.Errorf("%s is set by the parent record", column)}
+		}
+	}
+	key, err := n.childKey(child, object, parent)
+	if err != nil {
+		return 0, &nestedError{http.StatusBadRequest, path, err}
+	}
+	if op == "" {
+		op = childCreate
+		if key != nil {
+			op = childUpdate
+		}
+	}
+	action := map[string]string{childCreate: actionCreate, childUpdate: actionUpdate, childDelete: actionDelete}[op]
+	if action == "" {
+		return 0, &nestedError{http.StatusBadRequest, path, errors.New("_op must be create, update or delete")}
+	}
+	if err := n.authorize(path, child, action); err != nil {
+		return 0, err
+	}
+	if op != childCreate && key == nil {
+		return 0, &nestedError{http.StatusBadRequest, path, fmt.Errorf("%s needs the primary key", op)}
+	}
+
+	if op == childCreate {
+		created, err := n.insert(path, child, object, parent)
+		if err != nil {
+			return 0, err
+		}
+		result.ID, result.Status = keyValue(child, created), "created"
+		return 1, nil
+	}
+	result.ID = keyValue(child, key)
+	// The key identifies the child, the foreign key scopes it to the record.
+	where := keyCondition(child, key)
+	for _, column := range sortedColumns(parent) {
+		where = append(where, querybuilder.Compare{Column: column, Op: querybuilder.Eq, Value: parent[column]})
+	}
+	for _, pk := range child.PrimaryKey {
+		delete(object, pk)
+	}
+
+	var affected int64
+	if op == childDelete {
+		if len(object) > 0 {
+			return 0, &nestedError{http.StatusBadRequest, path, errors.New("a deleted record takes its primary key only")}
+		}
+		affected, err = n.tx.Delete(n.r.Context(), querybuilder.Delete{From: child.ref(), Where: where})
+		result.Status = "deleted"
+	} else {
+		data, prepareErr := n.de.prepareUpdate(n.r, child, object)
+		if prepareErr != nil {
+			return 0, &nestedError{http.StatusBadRequest, path, prepareErr}
+		}
+		if err := n.de.encryptValues(child.Name, data); err != nil {
+			return 0, err
+		}
+		update := updateRecord(child, data, key)
+		update.Where = where
+		affected, err = n.tx.Update(n.r.Context(), update)
+		result.Status, result.Updated = "updated", affected
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	if affected == 0 {
+		return 0, &nestedError{http.StatusNotFound, path, errors.New("record not found")}
+	}
+	return affected, nil
+}
+
+// childKey returns the primary key of a child record, taken from the
+// object or from the foreign key to the record, or nil when it is
+// incomplete.
+func (n *nestedWrite) childKey(child *Table, object map[string]interface{}, parent map[string]interface{}) (recordKey, error) {
+	if len(child.PrimaryKey) == 0 {
+		return nil, nil
+	}
+	key := make(recordKey, len(child.PrimaryKey))
+	for i, pk := range child.PrimaryKey {
+		if value, ok := parent[pk]; ok {
+			key[i] = value
+			continue
+		}
+		value, ok := object[pk]
+		if !ok || value == nil {
+			return nil, nil
+		}
+		column, _ := child.Column(pk)
+		converted, ok := n.de.convertValue(column, value, false)
+		if !ok {
+			return nil, &fieldError{pk, fmt.Sprintf("field %s have invalid type", pk)}
+		}
+		key[i] = converted
+	}
+	return key, nil
+}
+
+func sortedColumns(values map[string]interface{}) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig enables OpenID Connect single sign-on for browser users with
+// the authorization code flow and PKCE.
+type OIDCConfig struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL must point at /_auth/callback of this explorer.
+	RedirectURL string   `json:"redirect_url"`
+	Scopes      []string `json:"scopes"`
+	// RolesClaim names the ID token claim holding the roles; defaults to
+	// "roles".
+	RolesClaim string `json:"roles_claim"`
+	// SessionTTL defaults to 8 hours.
+	SessionTTL Duration `json:"session_ttl"`
+}
+
+// oidcProvider holds the discovered provider endpoints and the login
+// attempts in flight.
+type oidcProvider struct {
+	cfg          *OIDCConfig
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	jwksURL      string
+
+	mu      sync.Mutex
+	pending map[string]*oidcLogin
+	keys    map[string]*rsa.PublicKey
+}
+
+// oidcLogin is an authorization request waiting for its callback.
+type oidcLogin struct {
+	verifier string
+	nonce    string
+	returnTo string
+	expires  time.Time
+}
+
+func newOIDCProvider(cfg *OIDCConfig) (*oidcProvider, error) {
+	secret, err := resolveSecret(cfg.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	var discovery struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := getJSON(strings.TrimRight(cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	return &oidcProvider{
+		cfg:          cfg,
+		clientSecret: secret,
+		authURL:      discovery.AuthorizationEndpoint,
+		tokenURL:     discovery.TokenEndpoint,
+		jwksURL:      discovery.JWKSURI,
+		pending:      make(map[string]*oidcLogin),
+	}, nil
+}
+
+func getJSON(url string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// handleLogin redirects the browser to the provider with a fresh state,
+// nonce and PKCE challenge.
+func (de *DbExplorer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	p := de.oidc
+	state, verifier := randomToken(16), randomToken(32)
+	login := &oidcLogin{
+		verifier: verifier,
+		nonce:    randomToken(16),
+		returnTo: "/",
+		expires:  time.Now().Add(10 * time.Minute),
+	}
+	// Only local paths, so the login can't be used as an open redirect.
+	if next := r.URL.Query().Get("next"); strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") {
+		login.returnTo = next
+	}
+
+	p.mu.Lock()
+	for key, l := range p.pending {
+		if time.Now().After(l.expires) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[state] = login
+	p.mu.Unlock()
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, p.authURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// handleCallback exchanges the authorization code, verifies the ID token and
+// starts a cookie session.
+func (de *DbExplorer) handleCallback(w http.ResponseWriter, r *http.Request) {
+	p := de.oidc
+	state := r.URL.Query().Get("state")
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		writeError(w, http.StatusBadRequest, "unknown or expired login state")
+		return
+	}
+	if msg := r.URL.Query().Get("error"); msg != "" {
+		writeError(w, http.StatusUnauthorized, "login failed: "+msg)
+		return
+	}
+
+	claims, err := p.exchange(r.Context(), r.URL.Query().Get("code"), login)
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		writeError(w, http.StatusUnauthorized, "login failed")
+		return
+	}
+	rolesClaim := p.cfg.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	claims["roles"] = claims[rolesClaim]
+	// The session outlives the short-lived ID token, whose expiry was
+	// already checked by verifyIDToken.
+	delete(claims, "exp")
+	id, err := identityFromClaims(claims, "oidc")
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	ttl := time.Duration(p.cfg.SessionTTL)
+	if ttl <= 0 {
+		ttl = 8 * time.Hour
+	}
+	token, sess := de.sessions.create(id, ttl)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  sess.expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, login.returnTo, http.StatusFound)
+}
+
+func (de *DbExplorer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if token, _ := de.sessionFromRequest(r); token != "" {
+		de.sessions.delete(token)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"response": "logged out"})
+}
+
+// exchange trades the code for tokens and returns the verified ID token
+// claims.
+func (p *oidcProvider) exchange(ctx context.Context, code string, login *oidcLogin) (map[string]interface{}, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+
+	claims, err := p.verifyIDToken(tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims["nonce"] != login.nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// verifyIDToken checks the RS256 signature against the provider keys and the
+// issuer, audience and expiry claims.
+func (p *oidcProvider) verifyIDToken(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return nil, errors.New("unsupported id token algorithm")
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("invalid id token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims["iss"] != p.cfg.Issuer {
+		return nil, errors.New("id token issuer mismatch")
+	}
+	if !audienceContains(claims["aud"], p.cfg.ClientID) {
+		return nil, errors.New("id token audience mismatch")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || float64(time.Now().Unix()) >= exp {
+		return nil, errors.New("id token expired")
+	}
+	return claims, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the provider signing key kid, refetching the key set once when
+// it is unknown (e.g. after a key rotation).
+func (p *oidcProvider) key(kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(p.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("fetching provider keys: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is an OpenID provider whose token endpoint checks the PKCE
+// verifier of the codes it authorized and signs ID tokens with key.
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// codes holds the challenge and nonce each code was authorized with.
+	codes map[string][2]string
+	// claims override those of the next ID tokens.
+	claims map[string]interface{}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{key: key, codes: map[string][2]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		code, ok := issuer.codes[r.Form.Get("code")]
+		challenge := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != code[0] {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":   issuer.URL,
+			"aud":   "explorer",
+			"sub":   "ann",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": code[1],
+			"roles": []string{"analyst"},
+		}
+		for name, value := range issuer.claims {
+			claims[name] = value
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.sign(t, claims)})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (f *fakeIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize starts a login and has the issuer authorize it as code; it
+// returns the state of the login.
+func (f *fakeIssuer) authorize(t *testing.T, de *DbExplorer, path, code string) string {
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || err != nil {
+		t.Fatalf("results not match\nGot : %d %v\nWant: a redirect to the issuer", w.Code, w.Header())
+	}
+	query := location.Query()
+	if location.Path != "/authorize" || query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "explorer" {
+		t.Fatalf("results not match\nGot : %s\nWant: an S256 authorization request", location)
+	}
+	f.codes[code] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+	return query.Get("state")
+}
+
+func oidcExplorer(t *testing.T, issuer *fakeIssuer) *DbExplorer {
+	provider, err := newOIDCProvider(&OIDCConfig{Issuer: issuer.URL, ClientID: "explorer", RedirectURL: "http://explorer/_auth/callback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	de := backendExplorer(&fakeStore{})
+	de.oidc = provider
+	de.authenticators = []Authenticator{de.sessionAuthenticator()}
+	return de
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	de := oidcExplorer(t, issuer)
+
+	state := issuer.authorize(t, de, "/_auth/login?next=/items", "c1")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_auth/callback?code=c1&state="+state, nil))
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/items" || len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("results not match\nGot : %d %v\nWant: a session cookie and a redirect to /items", w.Code, w.Header())
+	}
+	session := cookies[0]
+
+	// The session authenticates the browser with the roles of the token.
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.AddCookie(session)
+	id, err := de.authenticate(r)
+	if err != nil || id == nil || id.Subject != "ann" || !id.HasRole("analyst") {
+		t.Fatalf("results not match\nGot : %#v %v\nWant: ann, analyst", id, err)
+	}
+
+	// The state is spent by the callback.
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_auth/callback?code=c1&state="+state, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+
+	// Logging out, with the CSRF token of the session, ends it.
+	r = httptest.NewRequest(http.MethodPost, "/_auth/logout", nil)
+	r.AddCookie(session)
+	r.Header.Set(csrfHeader, de.sessions.get(session.Value).csrf)
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || de.sessions.get(session.Value) != nil {
+		t.Fatalf("results not match\nGot : %d %s\nWant: the session ended", w.Code, w.Body)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.AddCookie(session)
+	if id, _ := de.authenticate(r); id != nil {
+		t.Fatalf("results not match\nGot : %#v\nWant: no identity after logout", id)
+	}
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	de := oidcExplorer(t, issuer)
+
+	cases := []struct {
+		name   string
+		claims map[string]interface{}
+		// callback builds the callback query from the state and code.
+		callback func(state string) string
+		code     int
+	}{
+		{"unknown state", nil, func(string) string { return "code=c&state=forged" }, http.StatusBadRequest},
+		{"provider error", nil, func(state string) string { return "error=access_denied&state=" + state }, http.StatusUnauthorized},
+		{"unknown code", nil, func(state string) string { return "code=unauthorized&state=" + state }, http.StatusUnauthorized},
+		{"wrong verifier", nil, func(state string) string {
+			// A code authorized for another login's challenge.
+			issuer.codes["stolen"] = [2]string{"another-challenge", ""}
+			return "code=stolen&state=" + state
+		}, http.StatusUnauthorized},
+		{"nonce mismatch", map[string]interface{}{"nonce": "replayed"}, nil, http.StatusUnauthorized},
+		{"wrong audience", map[string]interface{}{"aud": "other-client"}, nil, http.StatusUnauthorized},
+		{"wrong issuer", map[string]interface{}{"iss": "https://evil.example"}, nil, http.StatusUnauthorized},
+		{"expired token", map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}, nil, http.StatusUnauthorized},
+		{"no subject", map[string]interface{}{"sub": ""}, nil, http.StatusUnauthorized},
+	}
+	for _, item := range cases {
+		issuer.claims = item.claims
+		state := issuer.authorize(t, de, "/_auth/login", "c-"+item.name)
+		query := "code=" + url.QueryEscape("c-"+item.name) + "&state=" + state
+		if item.callback != nil {
+			query = item.callback(state)
+		}
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_auth/callback?"+query, nil))
+		if w.Code != item.code || len(w.Result().Cookies()) != 0 {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d without a session", item.name, w.Code, w.Body, item.code)
+		}
+	}
+
+	// Logins expire, and only return to local paths.
+	issuer.claims = nil
+	state := issuer.authorize(t, de, "/_auth/login?next=//evil.example", "c-late")
+	de.oidc.pending[state].expires = time.Now().Add(-time.Second)
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_auth/callback?code=c-late&state="+state, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+	state = issuer.authorize(t, de, "/_auth/login?next=//evil.example", "c-open")
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_auth/callback?code=c-open&state="+state, nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("results not match\nGot : %d %v\nWant: a redirect to /", w.Code, w.Header())
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	sessions := newSessionStore()
+	token, _ := sessions.create(&Identity{Subject: "ann"}, -time.Second)
+	if sessions.get(token) != nil {
+		t.Fatal("results not match\nGot : a session\nWant: none past its expiry")
+	}
+	live, _ := sessions.create(&Identity{Subject: "bob"}, time.Hour)
+	if sessions.get(live) == nil || len(sessions.sessions) != 1 {
+		t.Fatalf("results not match\nGot : %d sessions\nWant: only the live one", len(sessions.sessions))
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"db_explorer/internal/querybuilder"
+)
+
+const (
+	// defaultOrphanLimit caps the rows one cleanup deletes per relation.
+	defaultOrphanLimit = 10000
+	// defaultOrphanBatch is the rows deleted per statement.
+	defaultOrphanBatch = 500
+	maxOrphanBatch     = 10000
+)
+
+// orphanReport is what a cleanup found, or did, for one declared relation.
+type orphanReport struct {
+	Table      string   `json:"table"`
+	Relation   string   `json:"relation"`
+	Columns    []string `json:"columns"`
+	References string   `json:"references"`
+	// Orphans counts the rows referencing nothing, after the cleanup
+	// unless it is a dry run.
+	Orphans int64  `json:"orphans"`
+	Deleted int64  `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleOrphans serves /_admin/orphans, which finds the rows of the
+// relations declared in the configuration whose parent doesn't exist, as
+// nothing keeps the database from deleting it. GET and ?dry_run=true only
+// count them; DELETE deletes them batch_size rows per statement, 500 by
+// default, up to limit rows per relation, 10000 by default, so that a
+// large cleanup runs in several calls rather than one long lock. ?table=
+// restricts it to the relations of one table. ?progress= streams the
+// progress of a cleanup, see progressWriter.
+func (de *DbExplorer) handleOrphans(w http.ResponseWriter, r *http.Request) {
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	params := r.URL.Query()
+	dryRun := r.Method == http.MethodGet
+	if raw := params.Get("dry_run"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+		dryRun = dryRun || value
+	}
+	limit, err := positiveParam(params.Get("limit"), defaultOrphanLimit, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "limit "+err.Error())
+		return
+	}
+	batch, err := positiveParam(params.Get("batch_size"), defaultOrphanBatch, maxOrphanBatch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "batch_size "+err.Error())
+		return
+	}
+	progress, err := newProgress(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if progress != nil {
+		defer progress.finish()
+		w = progress
+	}
+
+	schema := de.requestSchema(r.Context())
+	var names []string
+	if name := params.Get("table"); name != "" {
+		if _, ok := schema.Tables[name]; !ok {
+			writeError(w, http.StatusNotFound, "unknown table")
+			return
+		}
+		names = []string{name}
+	} else {
+		for name := range schema.Tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var relations []tableReference
+	for _, name := range names {
+		for _, fk := range schema.Tables[name].ForeignKeys {
+			if fk.Declared {
+				relations = append(relations, tableReference{schema.Tables[name], fk})
+			}
+		}
+	}
+	// The progress of a cleanup is measured against the orphans found
+	// first, up to the limit.
+	if progress != nil && !dryRun {
+		for _, relation := range relations {
+			where := querybuilder.And{orphaned(schema, relation.table, relation.fk)}
+			if n, err := de.countRecords(r.Context(), relation.table, "exact", where); err == nil && len(relation.table.PrimaryKey) > 0 {
+				if n > int64(limit) {
+					n = int64(limit)
+				}
+				progress.total += n
+			}
+		}
+	}
+
+	reports := []orphanReport{}
+	for _, relation := range relations {
+		table, fk := relation.table, relation.fk
+		report := orphanReport{Table: table.Name, Relation: fk.Name, Columns: fk.Columns, References: fk.RefTable}
+		where := querybuilder.And{orphaned(schema, table, fk)}
+		if !dryRun {
+			report.Deleted, err = de.deleteOrphans(r.Context(), table, where, limit, batch, progress)
+			addRows(r.Context(), report.Deleted)
+		}
+		if err == nil {
+			report.Orphans, err = de.countRecords(r.Context(), table, "exact", where)
+		}
+		if err != nil {
+			// The batches deleted so far stay deleted.
+			report.Error = err.Error()
+			err = nil
+		}
+		reports = append(reports, report)
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"dry_run":   dryRun,
+			"relations": reports,
+		},
+	}, false)
+}
+
+// positiveParam reads a positive integer parameter, fallback when it is
+// empty, at most ceiling unless that is 0.
+func positiveParam(raw string, fallback, ceiling int) (int, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("must be a positive integer")
+	}
+	if ceiling > 0 && n > ceiling {
+		return 0, fmt.Errorf("must be at most %d", ceiling)
+	}
+	return n, nil
+}
+
+// orphaned matches the rows of table whose foreign key fk references no row.
+func orphaned(schema *Schema, table *Table, fk *ForeignKey) querybuilder.Orphaned {
+	parent := querybuilder.Table{Schema: table.Schema, Name: fk.RefTable}
+	if ref, ok := schema.Tables[fk.RefTable]; ok {
+		parent = ref.ref()
+	}
+	return querybuilder.Orphaned{Table: table.ref(), Columns: fk.Columns, Parent: parent, RefColumns: fk.RefColumns}
+}
+
+// deleteOrphans deletes up to limit rows of table matching where, batch of
+// them per statement, each of which commits on its own and counts towards
+// progress. The rows of a batch are picked by primary key and still have
+// to match where when they are deleted, in case their parent was inserted
+// meanwhile.
+func (de *DbExplorer) deleteOrphans(ctx context.Context, table *Table, where querybuilder.And, limit, batch int, progress *progressWriter) (int64, error) {
+	if len(table.PrimaryKey) == 0 {
+		return 0, fmt.Errorf("%s has no primary key to delete by", table.Name)
+	}
+	var deleted int64
+	for deleted < int64(limit) {
+		size := batch
+		if remaining := int64(limit) - deleted; remaining < int64(size) {
+			size = int(remaining)
+		}
+		query := querybuilder.Select{
+			Columns: querybuilder.Cols(table.PrimaryKey...),
+			From:    table.ref(),
+			Where:   where,
+			Page:    &querybuilder.Page{Limit: size},
+		}
+		var keys querybuilder.Or
+		err := de.backend.Select(ctx, query, func(record map[string]interface{}) error {
+			key := make(recordKey, len(table.PrimaryKey))
+			for i, pk := range table.PrimaryKey {
+				key[i] = record[pk]
+			}
+			keys = append(keys, keyCondition(table, key))
+			return nil
+		})
+		if err != nil || len(keys) == 0 {
+			return deleted, err
+		}
+		affected, err := de.backend.Delete(ctx, querybuilder.Delete{
+			From:  table.ref(),
+			Where: append(querybuilder.And{keys}, where...),
+		})
+		deleted += affected
+		progress.add(affected)
+		if err != nil || len(keys) < size {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
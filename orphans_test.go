@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDeclareRelations(t *testing.T) {
+	tables := fuzzSchema().Tables
+	relations := map[string][]RelationConfig{
+		"order_items": {{Columns: []string{"order_id"}, References: "items"}},
+		"missing":     {{Columns: []string{"x"}, References: "items"}},
+	}
+	if err := declareRelations(tables, relations); err != nil {
+		t.Fatal(err)
+	}
+	fks := tables["order_items"].ForeignKeys
+	want := &ForeignKey{Name: "order_items_order_id_declared", Columns: []string{"order_id"}, RefTable: "items", RefColumns: []string{"id"}, Declared: true}
+	if len(fks) != 2 || !reflect.DeepEqual(fks[1], want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", fks, want)
+	}
+
+	cases := []struct {
+		relation RelationConfig
+		err      string
+	}{
+		{RelationConfig{Columns: []string{"order_id", "line"}, References: "items"}, "relation of order_items to items: columns don't match the referenced columns"},
+		{RelationConfig{Columns: []string{"nope"}, References: "items"}, "relation of order_items to items: unknown column nope"},
+		{RelationConfig{Columns: []string{"item_id"}, References: "items", RefColumns: []string{"nope"}}, "relation of order_items to items: unknown column nope"},
+	}
+	for _, item := range cases {
+		err := declareRelations(fuzzSchema().Tables, map[string][]RelationConfig{"order_items": {item.relation}})
+		if err == nil || err.Error() != item.err {
+			t.Fatalf("[%v] results not match\nGot : %v\nWant: %s", item.relation, err, item.err)
+		}
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	backend := &tableStore{rows: map[string][]map[string]interface{}{
+		"order_items": {{"order_id": int64(7), "line": int64(1)}, {"order_id": int64(7), "line": int64(2)}},
+	}}
+	de := backendExplorer(backend)
+	schema := fuzzSchema()
+	if err := declareRelations(schema.Tables, map[string][]RelationConfig{
+		"order_items": {{Name: "order_items_order", Columns: []string{"order_id"}, References: "items"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	de.schema.Store(schema)
+
+	report := func(method, target string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		var got map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+		return got
+	}
+	relation := func(orphans, deleted float64) map[string]interface{} {
+		return map[string]interface{}{
+			"table": "order_items", "relation": "order_items_order", "columns": []interface{}{"order_id"},
+			"references": "items", "orphans": orphans, "deleted": deleted,
+		}
+	}
+
+	// Only the declared relation is checked, not order_items_item_id_fkey.
+	got := report(http.MethodDelete, "/_admin/orphans?dry_run=true")
+	want := map[string]interface{}{"response": map[string]interface{}{"dry_run": true, "relations": []interface{}{relation(2, 0)}}}
+	if !reflect.DeepEqual(got, want) || backend.deletes != nil {
+		t.Fatalf("results not match\nGot : %#v %v\nWant: %#v", got, backend.deletes, want)
+	}
+
+	got = report(http.MethodDelete, "/_admin/orphans?table=order_items&batch_size=10")
+	want = map[string]interface{}{"response": map[string]interface{}{"dry_run": false, "relations": []interface{}{relation(0, 2)}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+	wantDeletes := []string{`DELETE FROM "public"."order_items" WHERE (("order_id" = $1 AND "line" = $2) OR ("order_id" = $3 AND "line" = $4)) AND ` +
+		`("order_id" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "public"."items" AS "_parent" WHERE "_parent"."id" = "public"."order_items"."order_id"))`}
+	if !reflect.DeepEqual(backend.deletes, wantDeletes) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.deletes, wantDeletes)
+	}
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/_admin/orphans?batch_size=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+const parquetType = "application/vnd.apache.parquet"
+
+// parquetRowGroupRows is how many records a row group holds. Row groups are
+// buffered until they are complete; the footer that indexes them goes last.
+const parquetRowGroupRows = 64 * 1024
+
+// parquetEncoder writes a Parquet file with a column per selected column,
+// typed after its Postgres type by arrowType. Records are gathered into an
+// Arrow batch that is handed to the file at each flush. Like CSV, a failed
+// stream is aborted: a file without its footer can't be read.
+type parquetEncoder struct {
+	out     io.Writer
+	table   *Table
+	columns []string
+	file    *pqarrow.FileWriter
+	batch   *array.RecordBuilder
+}
+
+func (e *parquetEncoder) start(h http.Header) {
+	h.Set("Content-Type", parquetType)
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.table.Name + ".parquet"}))
+}
+
+// open builds the schema of the file on the first record.
+func (e *parquetEncoder) open() error {
+	if e.file != nil {
+		return nil
+	}
+	fields := make([]arrow.Field, len(e.columns))
+	for i, name := range e.columns {
+		dataType := ""
+		if column, ok := e.table.Column(name); ok {
+			dataType = column.DataType
+		}
+		fields[i] = arrow.Field{Name: name, Type: arrowType(dataType), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	props := parquet.NewWriterProperties(
+		parquet.WithCompression(compress.Codecs.Snappy),
+		parquet.WithMaxRowGroupLength(parquetRowGroupRows),
+	)
+	file, err := pqarrow.NewFileWriter(schema, e.out, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return err
+	}
+	e.file = file
+	e.batch = array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	return nil
+}
+
+func (e *parquetEncoder) encode(record map[string]interface{}) error {
+	if err := e.open(); err != nil {
+		return err
+	}
+	for i, name := range e.columns {
+		if err := appendArrow(e.batch.Field(i), record[name]); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (e *parquetEncoder) fail(err error) {
+	panic(http.ErrAbortHandler)
+}
+
+// flush adds the batch to the current row group, which is only written out
+// once it is full.
+func (e *parquetEncoder) flush() error {
+	if e.file == nil {
+		return nil
+	}
+	batch := e.batch.NewRecord()
+	defer batch.Release()
+	if batch.NumRows() == 0 {
+		return nil
+	}
+	return e.file.WriteBuffered(batch)
+}
+
+func (e *parquetEncoder) close() error {
+	if err := e.open(); err != nil {
+		return err
+	}
+	defer e.batch.Release()
+	if err := e.flush(); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
+
+// arrowType is the Arrow type of a Postgres type, which the file writer
+// maps to Parquet. Numerics have no precision and scale to declare a
+// decimal with, they stay text like uuids, json and the types that have no
+// equivalent. Timestamps without time zone aren't adjusted to UTC.
+func arrowType(dataType string) arrow.DataType {
+	switch dataType {
+	case "smallint":
+		return arrow.PrimitiveTypes.Int16
+	case "integer":
+		return arrow.PrimitiveTypes.Int32
+	case "bigint":
+		return arrow.PrimitiveTypes.Int64
+	case "real":
+		return arrow.PrimitiveTypes.Float32
+	case "double precision":
+		return arrow.PrimitiveTypes.Float64
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean
+	case "date":
+		return arrow.FixedWidthTypes.Date32
+	case "timestamp without time zone":
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	case "timestamp with time zone":
+		return arrow.FixedWidthTypes.Timestamp_us
+	case "bytea":
+		return arrow.BinaryTypes.Binary
+	}
+	return arrow.BinaryTypes.String
+}
+
+// appendArrow appends a record value to the column builder b.
+func appendArrow(b array.Builder, value interface{}) error {
+	if value == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int16Builder:
+		if v, ok := value.(int64); ok {
+			b.Append(int16(v))
+			return nil
+		}
+	case *array.Int32Builder:
+		if v, ok := value.(int64); ok {
+			b.Append(int32(v))
+			return nil
+		}
+	case *array.Int64Builder:
+		if v, ok := value.(int64); ok {
+			b.Append(v)
+			return nil
+		}
+	case *array.Float32Builder:
+		if v, ok := value.(float64); ok {
+			b.Append(float32(v))
+			return nil
+		}
+	case *array.Float64Builder:
+		if v, ok := value.(float64); ok {
+			b.Append(v)
+			return nil
+		}
+	case *array.BooleanBuilder:
+		if v, ok := value.(bool); ok {
+			b.Append(v)
+			return nil
+		}
+	case *array.Date32Builder:
+		if v, ok := value.(time.Time); ok {
+			b.Append(arrow.Date32FromTime(v))
+			return nil
+		}
+	case *array.TimestampBuilder:
+		if v, ok := value.(time.Time); ok {
+			if b.Type().(*arrow.TimestampType).TimeZone == "" {
+				v = wallClock(v)
+			}
+			b.Append(arrow.Timestamp(v.UnixMicro()))
+			return nil
+		}
+	case *array.BinaryBuilder:
+		if v, ok := value.([]byte); ok {
+			b.Append(v)
+			return nil
+		}
+	case *array.StringBuilder:
+		text, err := csvCell(value)
+		if err != nil {
+			return err
+		}
+		b.Append(text)
+		return nil
+	}
+	return fmt.Errorf("unexpected %T for %s", value, b.Type())
+}
+
+// wallClock returns the wall clock of t in UTC, for the columns that have
+// no time zone.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+func TestStreamParquet(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(1), "title": "memcache", "price": []byte("1.50"), "created": time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("", 7200)), "extra": []byte(`{"a":1}`)},
+		{"id": int64(2), "title": "redis", "price": nil, "created": nil, "extra": nil},
+	}}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?format=parquet", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != parquetType {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, parquetType)
+	}
+
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(w.Body.Bytes()), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Release()
+	want := "id int32, title utf8, price utf8, created timestamp[us, tz=UTC], extra utf8"
+	var got string
+	for i, field := range table.Schema().Fields() {
+		if i > 0 {
+			got += ", "
+		}
+		got += field.Name + " " + field.Type.String()
+	}
+	if got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+	if table.NumRows() != 2 {
+		t.Fatalf("results not match\nGot : %d rows\nWant: 2 rows", table.NumRows())
+	}
+
+	ids := table.Column(0).Data().Chunk(0).(*array.Int32)
+	titles := table.Column(1).Data().Chunk(0).(*array.String)
+	prices := table.Column(2).Data().Chunk(0).(*array.String)
+	created := table.Column(3).Data().Chunk(0).(*array.Timestamp)
+	extra := table.Column(4).Data().Chunk(0).(*array.String)
+	if ids.Value(0) != 1 || titles.Value(0) != "memcache" || prices.Value(0) != "1.50" || extra.Value(0) != `{"a":1}` {
+		t.Fatalf("unexpected first row %v %v %v %v", ids, titles, prices, extra)
+	}
+	if got, want := created.Value(0).ToTime(arrow.Microsecond), time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+	if ids.Value(1) != 2 || !prices.IsNull(1) || !created.IsNull(1) || !extra.IsNull(1) {
+		t.Fatalf("unexpected second row %v %v %v %v", ids, prices, created, extra)
+	}
+}
+
+func TestAppendArrow(t *testing.T) {
+	cases := []struct {
+		dataType string
+		value    interface{}
+		want     string
+	}{
+		{"smallint", int64(-3), "[-3]"},
+		{"real", 1.5, "[1.5]"},
+		{"boolean", true, "[true]"},
+		{"date", time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), "[-1]"},
+		// The wall clock: the column has no time zone.
+		{"timestamp without time zone", time.Date(1970, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600)), "[3600000000]"},
+		{"uuid", []byte("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"), `["a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"]`},
+		{"text", nil, "[(null)]"},
+	}
+	for _, c := range cases {
+		b := array.NewBuilder(memory.DefaultAllocator, arrowType(c.dataType))
+		if err := appendArrow(b, c.value); err != nil {
+			t.Fatalf("%s: %v", c.dataType, err)
+		}
+		values := b.NewArray()
+		if got := values.String(); got != c.want {
+			t.Fatalf("results not match for %s\nGot : %s\nWant: %s", c.dataType, got, c.want)
+		}
+		values.Release()
+		b.Release()
+	}
+
+	b := array.NewBuilder(memory.DefaultAllocator, arrowType("integer"))
+	defer b.Release()
+	if err := appendArrow(b, "1"); err == nil {
+		t.Fatalf("expected an error for a string in an integer column")
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lib/pq"
+)
+
+// pgxQueryer is what *pgxpool.Pool and pgx.Tx have in common.
+type pgxQueryer interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// pgxRecords runs statements through pgx, whose binary protocol and type map
+// skip the text round trip of lib/pq. Values are converted to the types
+// lib/pq scans, then typed for JSON alike, so the handlers see the same
+// records with either driver.
+type pgxRecords struct {
+	conn pgxQueryer
+}
+
+func (s pgxRecords) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	sqlQuery, args := buildSQL(query)
+	args = pgxArgs(args)
+	rows, err := s.conn.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		return err
+	}
+	return pgxScanRecords(rows, each)
+}
+
+func (s pgxRecords) Invoke(ctx context.Context, call querybuilder.Invoke, each func(record map[string]interface{}) error) error {
+	query, args := buildSQL(call)
+	rows, err := s.conn.Query(ctx, query, pgxArgs(args)...)
+	if err != nil {
+		return err
+	}
+	return pgxScanRecords(rows, each)
+}
+
+// pgxScanRecords calls each with every row of rows, as a column → value
+// map, and closes them.
+func pgxScanRecords(rows pgx.Rows, each func(record map[string]interface{}) error) error {
+	defer rows.Close()
+	fields := rows.FieldDescriptions()
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return err
+		}
+		record := make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			if record[field.Name], err = pgxValue(pgxTypeName(field.DataTypeOID), values[i]); err != nil {
+				return fmt.Errorf("%s: %v", field.Name, err)
+			}
+		}
+		if err := each(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s pgxRecords) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	query, args := buildSQL(insert)
+	args = pgxArgs(args)
+	if len(insert.Returning) == 0 {
+		_, err := s.conn.Exec(ctx, query, args...)
+		return nil, err
+	}
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	var returned [][]interface{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		for i, field := range fields {
+			if values[i], err = pgxValue(pgxTypeName(field.DataTypeOID), values[i]); err != nil {
+				return nil, err
+			}
+		}
+		returned = append(returned, values)
+	}
+	return returned, rows.Err()
+}
+
+func (s pgxRecords) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	return s.exec(ctx, update)
+}
+
+func (s pgxRecords) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	return s.exec(ctx, del)
+}
+
+func (s pgxRecords) exec(ctx context.Context, stmt querybuilder.Statement) (int64, error) {
+	query, args := buildSQL(stmt)
+	args = pgxArgs(args)
+	tag, err := s.conn.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// pgxArgs converts the lib/pq array arguments of the Postgres dialect to
+// slices, which pgx encodes natively.
+func pgxArgs(args []interface{}) []interface{} {
+	for i, arg := range args {
+		if array, ok := arg.(pq.StringArray); ok {
+			args[i] = []string(array)
+		}
+	}
+	return args
+}
+
+// pqValue converts a value decoded by pgx to the type lib/pq scans it as:
+// int64 and float64 for every width, and the text of the types pgx decodes
+// into its own structures, such as numeric, uuid and json.
+func pqValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, int64, float64, string, []byte:
+		return v, nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case [16]byte:
+		return []byte(fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])), nil
+	case driver.Valuer:
+		text, err := v.Value()
+		if s, ok := text.(string); ok {
+			return []byte(s), err
+		}
+		return text, err
+	case map[string]interface{}, []interface{}:
+		return json.Marshal(v)
+	}
+	return value, nil
+}
+
+// pgxValue types a value decoded by pgx from a column of databaseType as
+// jsonValue types the values lib/pq scans. pgx decodes arrays into slices,
+// which are typed element by element.
+func pgxValue(databaseType string, value interface{}) (interface{}, error) {
+	if items, ok := value.([]interface{}); ok && strings.HasPrefix(databaseType, "_") {
+		for i, item := range items {
+			element, err := pqValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = jsonValue(databaseType[1:], element)
+		}
+		return items, nil
+	}
+	value, err := pqValue(value)
+	return jsonValue(databaseType, value), err
+}
+
+// pgxStore is the Store of a PostgreSQL database read and written through
+// pgx. Schema metadata and query plans still come from meta: they are read
+// at start and on reloads only.
+type pgxStore struct {
+	pgxRecords
+	pool *pgxpool.Pool
+	meta *sqlStore
+}
+
+// newPgxStore opens a pgx pool on the database of connector, taking the
+// credentials it holds at the time of each new connection.
+func newPgxStore(ctx context.Context, connector *rotatingConnector, db *sql.DB, cfg *Config) (*pgxStore, error) {
+	poolConfig, err := pgxpool.ParseConfig(connector.currentDSN())
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.BeforeConnect = func(ctx context.Context, conn *pgx.ConnConfig) error {
+		current, err := pgx.ParseConfig(connector.currentDSN())
+		if err != nil {
+			return err
+		}
+		conn.User = current.User
+		conn.Password = current.Password
+		return nil
+	}
+	// The statement cache prepares named statements, which don't survive
+	// transaction pooling.
+	if cfg.PgBouncer {
+		poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &pgxStore{pgxRecords: pgxRecords{conn: pool}, pool: pool, meta: newSQLStore(db, nil)}, nil
+}
+
+// records returns the records of the session of ctx, if any.
+func (s *pgxStore) records(ctx context.Context) pgxRecords {
+	if tx, ok := ctx.Value(sessionKey{}).(pgx.Tx); ok {
+		return pgxRecords{conn: tx}
+	}
+	return s.pgxRecords
+}
+
+func (s *pgxStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	return s.records(ctx).Select(ctx, query, each)
+}
+
+func (s *pgxStore) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	return s.records(ctx).Insert(ctx, insert)
+}
+
+func (s *pgxStore) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	return s.records(ctx).Update(ctx, update)
+}
+
+func (s *pgxStore) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	return s.records(ctx).Delete(ctx, del)
+}
+
+// Begin starts a transaction, or a savepoint within a session.
+func (s *pgxStore) Begin(ctx context.Context) (Tx, error) {
+	var tx pgx.Tx
+	var err error
+	if session, ok := ctx.Value(sessionKey{}).(pgx.Tx); ok {
+		tx, err = session.Begin(ctx)
+	} else {
+		tx, err = s.pool.Begin(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pgxTx{pgxRecords{conn: tx}, ctx, tx}, nil
+}
+
+// Session begins the transaction of a request and applies the settings of
+// options to it.
+func (s *pgxStore) Session(ctx context.Context, options sessionOptions) (context.Context, Tx, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.TxIsoLevel(options.isolation)})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, setting := range options.settings {
+		if _, err := tx.Exec(ctx, setLocal, setting.name, setting.value); err != nil {
+			tx.Rollback(ctx)
+			return nil, nil, fmt.Errorf("setting %s: %v", setting.name, err)
+		}
+	}
+	return context.WithValue(ctx, sessionKey{}, tx), pgxTx{pgxRecords{conn: tx}, ctx, tx}, nil
+}
+
+// pgxTx keeps the context of Begin: Commit and Rollback need one.
+type pgxTx struct {
+	pgxRecords
+	ctx context.Context
+	tx  pgx.Tx
+}
+
+func (t pgxTx) Commit() error   { return t.tx.Commit(t.ctx) }
+func (t pgxTx) Rollback() error { return t.tx.Rollback(t.ctx) }
+
+// CopyRows streams rows to COPY in its text format, on the connection of
+// the session if there is one.
+func (s *pgxStore) CopyRows(ctx context.Context, table querybuilder.Table, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	var conn *pgconn.PgConn
+	if session, ok := ctx.Value(sessionKey{}).(pgx.Tx); ok {
+		conn = session.Conn().PgConn()
+	} else {
+		pooled, err := s.pool.Acquire(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer pooled.Release()
+		conn = pooled.Conn().PgConn()
+	}
+
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgx.Identifier{column}.Sanitize()
+	}
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", pgx.Identifier{table.Schema, table.Name}.Sanitize(), strings.Join(quoted, ", "))
+
+	reader, writer := io.Pipe()
+	var rowsErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rowsErr = writeCopyText(writer, next)
+		writer.CloseWithError(rowsErr)
+	}()
+	tag, err := conn.CopyFrom(ctx, reader, query)
+	// Unblocks the writer when COPY failed before reading every row.
+	reader.Close()
+	<-done
+	if rowsErr != nil && rowsErr != io.ErrClosedPipe {
+		return 0, rowsErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// writeCopyText writes the rows of next to w, one line each with tab
+// separated values.
+func writeCopyText(w io.Writer, next func() ([]interface{}, error)) error {
+	buffered := bufio.NewWriter(w)
+	for {
+		row, err := next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return buffered.Flush()
+		}
+		for i, value := range row {
+			if i > 0 {
+				buffered.WriteByte('\t')
+			}
+			buffered.WriteString(copyText(value))
+		}
+		if err := buffered.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+}
+
+var copyEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+
+// copyText formats a value for the text format of COPY, where \N is NULL.
+func copyText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "\\N"
+	case string:
+		return copyEscaper.Replace(v)
+	case []byte:
+		return copyEscaper.Replace(string(v))
+	case bool:
+		if v {
+			return "t"
+		}
+		return "f"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return copyEscaper.Replace(fmt.Sprint(value))
+}
+
+func (s *pgxStore) ListTables(ctx context.Context, schema string) ([]string, error) {
+	return s.meta.ListTables(ctx, schema)
+}
+
+func (s *pgxStore) Introspect(ctx context.Context, schema string) (map[string]*Table, error) {
+	return s.meta.Introspect(ctx, schema)
+}
+
+func (s *pgxStore) Refresh(ctx context.Context, refresh querybuilder.Refresh) error {
+	_, err := s.records(ctx).exec(ctx, refresh)
+	return err
+}
+
+func (s *pgxStore) Functions(ctx context.Context, schema string) (map[string]*Function, error) {
+	return s.meta.Functions(ctx, schema)
+}
+
+func (s *pgxStore) Invoke(ctx context.Context, call querybuilder.Invoke, each func(record map[string]interface{}) error) error {
+	return s.records(ctx).Invoke(ctx, call, each)
+}
+
+func (s *pgxStore) ReadOnlyQuery(ctx context.Context, query string, args []interface{}, each func(values []interface{}) error) ([]string, error) {
+	var tx pgx.Tx
+	var err error
+	if session, ok := ctx.Value(sessionKey{}).(pgx.Tx); ok {
+		// A savepoint, whose rollback undoes turning it read-only.
+		if tx, err = session.Begin(ctx); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(context.Background())
+		if _, err := tx.Exec(ctx, setLocal, "transaction_read_only", "on"); err != nil {
+			return nil, err
+		}
+	} else {
+		if tx, err = s.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly}); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(context.Background())
+	}
+
+	rows, err := tx.Query(ctx, query, pgxArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fields := rows.FieldDescriptions()
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name
+	}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		for i, field := range fields {
+			if values[i], err = pgxValue(pgxTypeName(field.DataTypeOID), values[i]); err != nil {
+				return nil, fmt.Errorf("%s: %v", field.Name, err)
+			}
+		}
+		if err := each(values); err != nil {
+			return names, err
+		}
+	}
+	return names, rows.Err()
+}
+
+func (s *pgxStore) Catalog(ctx context.Context, schema string) (map[string]TableStats, error) {
+	return s.meta.Catalog(ctx, schema)
+}
+
+func (s *pgxStore) ResetPool() {
+	s.pool.Reset()
+}
+
+func (s *pgxStore) EstimateCost(ctx context.Context, query querybuilder.Statement) (float64, float64, error) {
+	return s.meta.EstimateCost(ctx, query)
+}
+
+// openDriverStore opens the Store of cfg.Driver; nil keeps the database/sql
+// one of db.
+func openDriverStore(ctx context.Context, cfg *Config, connector *rotatingConnector, db *sql.DB) (Store, error) {
+	switch cfg.Driver {
+	case "", "pq":
+		return nil, nil
+	case "pgx":
+		return newPgxStore(ctx, connector, db, cfg)
+	}
+	return nil, fmt.Errorf("unknown driver %q", cfg.Driver)
+}
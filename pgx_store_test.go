@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestPqValue(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{nil, nil},
+		{int32(7), int64(7)},
+		{int16(-1), int64(-1)},
+		{float32(0.5), float64(0.5)},
+		{"memcache", "memcache"},
+		{[16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}, []byte("12345678-9abc-def0-1234-56789abcdef0")},
+		{pgtype.Numeric{Int: big.NewInt(150), Exp: -2, Valid: true}, []byte("1.50")},
+		{map[string]interface{}{"a": float64(1)}, []byte(`{"a":1}`)},
+		{[]interface{}{"x"}, []byte(`["x"]`)},
+	}
+	for _, item := range cases {
+		got, err := pqValue(item.value)
+		if err != nil {
+			t.Fatalf("[%#v] unexpected error: %v", item.value, err)
+		}
+		if !reflect.DeepEqual(got, item.want) {
+			t.Fatalf("[%#v] results not match\nGot : %#v\nWant: %#v", item.value, got, item.want)
+		}
+	}
+}
+
+// fakePostgres accepts connections without authentication and holds them
+// until the client leaves, counting how many it closed.
+func fakePostgres(t *testing.T) (dsn string, closed *int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed = new(int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() {
+					conn.Close()
+					atomic.AddInt32(closed, 1)
+				}()
+				backend := pgproto3.NewBackend(conn, conn)
+				if _, err := backend.ReceiveStartupMessage(); err != nil {
+					return
+				}
+				backend.Send(&pgproto3.AuthenticationOk{})
+				backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+				if err := backend.Flush(); err != nil {
+					return
+				}
+				for {
+					msg, err := backend.Receive()
+					if _, done := msg.(*pgproto3.Terminate); done || err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+	return fmt.Sprintf("host=127.0.0.1 port=%d user=explorer dbname=explorer sslmode=disable", port), closed
+}
+
+func TestPgxResetPool(t *testing.T) {
+	ctx := context.Background()
+	dsn, closed := fakePostgres(t)
+	store, err := newPgxStore(ctx, newRotatingConnector(dsn), nil, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.pool.Close()
+	inUse, err := store.pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, err := store.pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle.Release()
+
+	counter := &countingConnector{ping: errors.New("connection refused")}
+	db := sql.OpenDB(counter)
+	defer db.Close()
+	de := backendExplorer(store)
+	de.db = db
+	waitClosed := func(want int32) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(closed) != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := atomic.LoadInt32(closed); got != want {
+			t.Fatalf("results not match\nGot : %d connections closed\nWant: %d", got, want)
+		}
+	}
+
+	// The failing ping flushes the pgx pool: the idle connection at once,
+	// the one in use when it is released.
+	de.probe(time.Second, 0, 1)
+	waitClosed(1)
+	inUse.Release()
+	waitClosed(2)
+	if total := store.pool.Stat().TotalConns(); total != 0 {
+		t.Fatalf("results not match\nGot : %d connections\nWant: 0", total)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// policyBlocks returns the static policy entry of Config.TablePolicies that
+// forbids action on table, or "" when none does. Entries of "*" apply to
+// every table. Views the database can't write through are read-only
+// whatever the configuration says, though materialized ones may still be
+// refreshed.
+func (de *DbExplorer) policyBlocks(table, action string) string {
+	if schema := de.snapshot(); schema != nil {
+		if t, ok := schema.Tables[table]; ok && t.ReadOnly && action != actionRead && action != actionRefresh {
+			return "read-only"
+		}
+	}
+	for _, name := range []string{"*", table} {
+		for _, entry := range strings.Split(de.cfg.TablePolicies[name], ",") {
+			switch strings.TrimSpace(entry) {
+			case "read-only":
+				if action != actionRead {
+					return "read-only"
+				}
+			case "no-" + action:
+				return "no-" + action
+			}
+		}
+	}
+	return ""
+}
+
+// checkTablePolicies rejects policy entries that would otherwise be ignored.
+func checkTablePolicies(policies map[string]string) error {
+	for table, policy := range policies {
+		for _, entry := range strings.Split(policy, ",") {
+			switch strings.TrimSpace(entry) {
+			case "read-only", "no-create", "no-update", "no-delete", "no-refresh":
+			default:
+				return fmt.Errorf("table policy %s: unknown entry %q", table, entry)
+			}
+		}
+	}
+	return nil
+}
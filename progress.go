@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// progressInterval is the least time between two progress events.
+const progressInterval = time.Second
+
+// progressWriter streams the progress of a long operation, a bulk import or
+// an orphan cleanup, to a client that asked for it with ?progress=sse,
+// Server-Sent Events, or ?progress=ndjson, one JSON object per line. Events
+// count the rows processed so far with the time elapsed and, when the size
+// of the work is known, the time left.
+//
+// The response of the handler is held back meanwhile. An operation done
+// before its first event answers as without progress, errors about the
+// request included; otherwise the response is the last event: done for a
+// success, error for a failure, with its status and body.
+type progressWriter struct {
+	http.ResponseWriter
+	format string
+	header http.Header
+	status int
+	body   bytes.Buffer
+
+	interval  time.Duration
+	start     time.Time
+	last      time.Time
+	streaming bool
+	processed int64
+	// total is the rows of the operation when known up front.
+	total int64
+	// input counts the bytes of the request body read, of inputSize, for
+	// operations whose rows are only known once the body is read.
+	input     *countingBody
+	inputSize int64
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// newProgress reads ?progress= and returns the writer standing in for w,
+// nil when the client didn't ask for progress. The caller has to finish it.
+func newProgress(w http.ResponseWriter, r *http.Request) (*progressWriter, error) {
+	format := r.URL.Query().Get("progress")
+	switch format {
+	case "":
+		return nil, nil
+	case "sse", "ndjson":
+	default:
+		return nil, errors.New("progress must be sse or ndjson")
+	}
+	now := time.Now()
+	p := &progressWriter{ResponseWriter: w, format: format, header: make(http.Header), interval: progressInterval, start: now, last: now}
+	if r.ContentLength > 0 {
+		p.input = &countingBody{ReadCloser: r.Body}
+		p.inputSize = r.ContentLength
+		r.Body = p.input
+	}
+	return p, nil
+}
+
+// progressOf returns the progress writer of w, nil when there is none; the
+// methods of a nil one do nothing.
+func progressOf(w http.ResponseWriter) *progressWriter {
+	p, _ := w.(*progressWriter)
+	return p
+}
+
+func (p *progressWriter) Header() http.Header {
+	return p.header
+}
+
+func (p *progressWriter) WriteHeader(status int) {
+	if p.status == 0 {
+		p.status = status
+	}
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	return p.body.Write(data)
+}
+
+// add counts n more rows processed and sends an event when the last one
+// is old enough.
+func (p *progressWriter) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.processed += n
+	now := time.Now()
+	if now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+
+	elapsed := now.Sub(p.start)
+	event := map[string]interface{}{
+		"processed":  p.processed,
+		"elapsed_ms": elapsed.Milliseconds(),
+	}
+	var done float64
+	switch {
+	case p.total > 0:
+		event["total"] = p.total
+		done = float64(p.processed) / float64(p.total)
+	case p.input != nil:
+		event["read_bytes"] = p.input.n
+		event["total_bytes"] = p.inputSize
+		done = float64(p.input.n) / float64(p.inputSize)
+	}
+	if done > 0 && done <= 1 {
+		event["eta_ms"] = int64(float64(elapsed.Milliseconds()) * (1 - done) / done)
+	}
+	p.event("progress", event)
+}
+
+// event writes an event, starting the stream with the first one.
+func (p *progressWriter) event(name string, data map[string]interface{}) {
+	if !p.streaming {
+		p.streaming = true
+		h := p.ResponseWriter.Header()
+		if p.format == "sse" {
+			h.Set("Content-Type", "text/event-stream")
+		} else {
+			h.Set("Content-Type", ndjsonType)
+		}
+		h.Set("Cache-Control", "no-cache")
+		// Proxies would otherwise buffer the events.
+		h.Set("X-Accel-Buffering", "no")
+		p.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	if p.format == "sse" {
+		encoded, _ := json.Marshal(data)
+		io.WriteString(p.ResponseWriter, "event: "+name+"\ndata: "+string(encoded)+"\n\n")
+	} else {
+		data["event"] = name
+		json.NewEncoder(p.ResponseWriter).Encode(data)
+	}
+	http.NewResponseController(p.ResponseWriter).Flush()
+}
+
+// finish sends the response of the handler, as it is or as the last
+// event.
+func (p *progressWriter) finish() {
+	status := p.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !p.streaming {
+		for name, values := range p.header {
+			p.ResponseWriter.Header()[name] = values
+		}
+		p.ResponseWriter.WriteHeader(status)
+		p.ResponseWriter.Write(p.body.Bytes())
+		return
+	}
+	var body interface{} = json.RawMessage(p.body.Bytes())
+	if !json.Valid(p.body.Bytes()) {
+		body = map[string]interface{}{"error": string(bytes.TrimSpace(p.body.Bytes()))}
+	}
+	name := "done"
+	if status >= 300 {
+		name = "error"
+	}
+	p.event(name, map[string]interface{}{"status": status, "body": body})
+}
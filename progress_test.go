@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProgressEvents(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/items/_import?progress=ndjson", strings.NewReader("0123456789"))
+	w := httptest.NewRecorder()
+	p, err := newProgress(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.interval = 0
+	r.Body.Read(make([]byte, 4))
+	p.add(2)
+	writeError(p, http.StatusBadRequest, "line 3: expected a JSON object")
+	p.finish()
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != ndjsonType {
+		t.Fatalf("results not match\nGot : %d %v\nWant: %d %s", w.Code, w.Header(), http.StatusOK, ndjsonType)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("results not match\nGot : %q\nWant: a progress and an error event", lines)
+	}
+	var progress, last map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &progress)
+	json.Unmarshal([]byte(lines[1]), &last)
+	if progress["event"] != "progress" || progress["processed"] != float64(2) || progress["read_bytes"] != float64(4) || progress["total_bytes"] != float64(10) {
+		t.Fatalf("results not match\nGot : %v\nWant: 2 rows and 4 of 10 bytes processed", progress)
+	}
+	body, _ := last["body"].(map[string]interface{})
+	if last["event"] != "error" || last["status"] != float64(http.StatusBadRequest) || body["error"] != "line 3: expected a JSON object" {
+		t.Fatalf("results not match\nGot : %v\nWant: the error as the last event", last)
+	}
+
+	// Server-Sent Events, with a known total.
+	r = httptest.NewRequest(http.MethodDelete, "/_admin/orphans?progress=sse", nil)
+	w = httptest.NewRecorder()
+	p, _ = newProgress(w, r)
+	p.interval = 0
+	p.total = 4
+	p.add(4)
+	http.Error(p, "connection reset", http.StatusInternalServerError)
+	p.finish()
+	events := strings.Split(w.Body.String(), "\n\n")
+	if w.Header().Get("Content-Type") != "text/event-stream" || len(events) != 3 ||
+		!strings.HasPrefix(events[0], `event: progress`+"\n"+`data: {"elapsed_ms":`) || !strings.Contains(events[0], `"eta_ms":0,"processed":4,"total":4}`) ||
+		events[1] != `event: error`+"\n"+`data: {"body":{"error":"connection reset"},"status":500}` {
+		t.Fatalf("results not match\nGot : %q", w.Body)
+	}
+}
+
+func TestProgressIdempotent(t *testing.T) {
+	de := &DbExplorer{cfg: &Config{}, store: newMemoryStore()}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		p, _ := newProgress(w, r)
+		p.interval = 0
+		p.add(1)
+		writeResponse(p, map[string]interface{}{"response": map[string]interface{}{"deleted": 1}}, false)
+		p.finish()
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/_admin/orphans?progress=ndjson", nil)
+	r.Header.Set(idempotencyHeader, "cleanup")
+	w := httptest.NewRecorder()
+	de.idempotent(w, r, handler)
+	if !w.Flushed || strings.Count(w.Body.String(), "\n") != 2 {
+		t.Fatalf("results not match\nGot : flushed %v %q\nWant: two flushed events", w.Flushed, w.Body)
+	}
+	if raw, _, _ := de.store.Get(r.Context(), "idempotency:anonymous:cleanup"); strings.Contains(raw, "progress") {
+		t.Fatalf("results not match\nGot : %s\nWant: the stream not stored", raw)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/_admin/orphans?progress=ndjson", nil)
+	r.Header.Set(idempotencyHeader, "cleanup")
+	w = httptest.NewRecorder()
+	de.idempotent(w, r, handler)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusConflict)
+	}
+}
+
+func TestProgressPassThrough(t *testing.T) {
+	backend := &fakeStore{}
+	de := backendExplorer(backend)
+
+	// An import done before the first event answers as without progress.
+	r := httptest.NewRequest(http.MethodPost, "/items/_import?progress=sse", strings.NewReader(`{"title": "memcache"}`+"\n"))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || !strings.Contains(w.Body.String(), `"inserted":1`) {
+		t.Fatalf("results not match\nGot : %d %v %s\nWant: the plain response", w.Code, w.Header(), w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/items/_import?progress=yes", strings.NewReader(""))
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "progress must be sse or ndjson") {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// QueryConfig enables POST /_query; its limits also apply to the named
+// queries of Config.Queries.
+type QueryConfig struct {
+	// Roles are the roles of the callers besides admins that may run
+	// queries.
+	Roles []string `json:"roles"`
+	// MaxRows caps the rows of a result, which is flagged truncated when
+	// there were more; defaults to 1000.
+	MaxRows int `json:"max_rows"`
+	// Timeout caps the time a query may run; defaults to 30s.
+	Timeout Duration `json:"timeout"`
+}
+
+// errEnoughRows stops reading a result at the row limit.
+var errEnoughRows = errors.New("row limit reached")
+
+// queryRequest is the body of POST /_query.
+type queryRequest struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params"`
+}
+
+// handleQuery serves POST /_query, ad-hoc SQL for analysts without psql
+// access: {"sql": "SELECT ... WHERE region = $1", "params": ["EU"]}. Only a
+// single SELECT is accepted, and it runs in a read-only transaction, so
+// neither a data-modifying WITH nor a function can write. The response
+// lists the columns and the rows as arrays in their order, so columns of
+// the same name don't collide.
+func (de *DbExplorer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if de.cfg.Query == nil {
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+		return
+	}
+	if !de.mayQuery(r) {
+		writeError(w, http.StatusForbidden, "query role required")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var request queryRequest
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if err := checkReadQuery(request.SQL); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	args := make([]interface{}, len(request.Params))
+	for i, param := range request.Params {
+		args[i] = sqlArg(param)
+	}
+	de.runQuery(w, r, request.SQL, args, map[string]interface{}{"sql": request.SQL})
+}
+
+// runQuery answers with the result of a read-only query, cut at the row
+// and time limits of QueryConfig, and audits it with fields.
+func (de *DbExplorer) runQuery(w http.ResponseWriter, r *http.Request, query string, args []interface{}, fields map[string]interface{}) {
+	querier, ok := de.backend.(readOnlyQuerier)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "queries are not supported by this store")
+		return
+	}
+	maxRows, timeout := 1000, 30*time.Second
+	if cfg := de.cfg.Query; cfg != nil {
+		if cfg.MaxRows > 0 {
+			maxRows = cfg.MaxRows
+		}
+		if cfg.Timeout > 0 {
+			timeout = time.Duration(cfg.Timeout)
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	rows := [][]interface{}{}
+	truncated := false
+	columns, err := querier.ReadOnlyQuery(ctx, query, args, func(values []interface{}) error {
+		if len(rows) == maxRows {
+			truncated = true
+			return errEnoughRows
+		}
+		rows = append(rows, values)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errEnoughRows):
+	case err != nil && ctx.Err() == context.DeadlineExceeded:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("query exceeded the time limit of %s", timeout))
+		return
+	case isStatementError(err):
+		// The database's own message is the one telling the analyst what
+		// is wrong with the query.
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Error running query: %v", err), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), int64(len(rows)))
+	fields["rows"] = len(rows)
+	audit("query", r, fields)
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"columns":   columns,
+			"rows":      rows,
+			"truncated": truncated,
+		},
+	}, false)
+}
+
+// isStatementError reports whether err is the database rejecting a
+// statement, as opposed to failing to run it.
+func isStatementError(err error) bool {
+	var pqErr *pq.Error
+	var pgxErr *pgconn.PgError
+	return errors.As(err, &pqErr) || errors.As(err, &pgxErr)
+}
+
+// sqlArg is a decoded JSON value as a statement argument: numbers are sent
+// as their text and objects and arrays as JSON, for the database to read as
+// the type it expects.
+func sqlArg(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	return value
+}
+
+// mayQuery reports whether the caller is an admin or has one of the roles
+// of QueryConfig.
+func (de *DbExplorer) mayQuery(r *http.Request) bool {
+	if de.isAdmin(r) {
+		return true
+	}
+	id := identityFromRequest(r)
+	for _, role := range de.cfg.Query.Roles {
+		if id != nil && id.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReadQuery accepts a single SELECT statement, possibly led by WITH
+// and followed by a semicolon. It reads the query as PostgreSQL does, past
+// comments, strings, quoted identifiers and dollar quoting, but it is only
+// there to reject other statements with a clear message: the read-only
+// transaction keeps the database unchanged and the extended protocol
+// refuses a second statement.
+func checkReadQuery(query string) error {
+	first := ""
+	ended := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return checkFirstWord(first)
+			}
+			i += end + 1
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			// Block comments nest.
+			depth := 0
+			for i < len(query) {
+				switch {
+				case strings.HasPrefix(query[i:], "/*"):
+					depth++
+					i += 2
+				case strings.HasPrefix(query[i:], "*/"):
+					depth--
+					i += 2
+				default:
+					i++
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			continue
+		}
+		if ended {
+			return errors.New("only a single statement is allowed")
+		}
+
+		switch {
+		case c == ';':
+			ended = true
+			i++
+		case c == '\'':
+			// Backslashes escape in E'' strings only.
+			escapes := i > 0 && (query[i-1] == 'e' || query[i-1] == 'E') && (i == 1 || !isWordByte(query[i-2]))
+			i = quotedEnd(query, i, '\'', escapes)
+		case c == '"':
+			i = quotedEnd(query, i, '"', false)
+		case c == '$':
+			tag := dollarTag(query[i:])
+			if tag == "" {
+				i++
+				continue
+			}
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return errors.New("unterminated dollar-quoted string")
+			}
+			i += len(tag) + end + len(tag)
+		case isWordByte(c):
+			j := i
+			// Identifiers may go on with dollar signs.
+			for j < len(query) && (isWordByte(query[j]) || query[j] == '$') {
+				j++
+			}
+			if first == "" {
+				first = strings.ToLower(query[i:j])
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return checkFirstWord(first)
+}
+
+func checkFirstWord(word string) error {
+	if word != "select" && word != "with" {
+		return errors.New("only SELECT queries are allowed")
+	}
+	return nil
+}
+
+// quotedEnd returns the index past the quote closing the string or
+// identifier starting at start; doubled quotes stand for one.
+func quotedEnd(query string, start int, quote byte, escapes bool) int {
+	for i := start + 1; i < len(query); i++ {
+		switch {
+		case escapes && query[i] == '\\':
+			i++
+		case query[i] == quote && i+1 < len(query) && query[i+1] == quote:
+			i++
+		case query[i] == quote:
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted string at the start
+// of s, "" when s starts with a parameter such as $1 instead.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case s[i] >= '0' && s[i] <= '9' && i == 1, !isWordByte(s[i]):
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// queryStore is a fakeStore answering queries with its records.
+type queryStore struct {
+	fakeStore
+	query string
+	args  []interface{}
+}
+
+func (s *queryStore) ReadOnlyQuery(ctx context.Context, query string, args []interface{}, each func(values []interface{}) error) ([]string, error) {
+	s.query, s.args = query, args
+	for _, record := range s.records {
+		if err := each([]interface{}{record["id"], record["title"]}); err != nil {
+			return []string{"id", "title"}, err
+		}
+	}
+	return []string{"id", "title"}, nil
+}
+
+func TestQuery(t *testing.T) {
+	backend := &queryStore{fakeStore: fakeStore{records: []map[string]interface{}{
+		{"id": 1, "title": "database/sql"},
+		{"id": 2, "title": "memcache"},
+		{"id": 3, "title": "redis"},
+	}}}
+	de := backendExplorer(backend)
+	body := `{"sql": "SELECT id, title FROM items WHERE price > $1", "params": [10]}`
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_query", strings.NewReader(body)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d while not configured", w.Code, w.Body, http.StatusNotFound)
+	}
+
+	de.cfg.Query = &QueryConfig{MaxRows: 2}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_query", strings.NewReader(body)))
+	want := `{"response":{"columns":["id","title"],"rows":[[1,"database/sql"],[2,"memcache"]],"truncated":true}}` + "\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %s", w.Code, w.Body, want)
+	}
+	if !reflect.DeepEqual(backend.args, []interface{}{"10"}) {
+		t.Fatalf("results not match\nGot : %#v\nWant: the parameter as text", backend.args)
+	}
+
+	backend.query = ""
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_query", strings.NewReader(`{"sql": "DELETE FROM items"}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "only SELECT queries are allowed") || backend.query != "" {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
+
+func TestCheckReadQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		error string
+	}{
+		{"SELECT 1", ""},
+		{"  -- totals\n with t AS (SELECT 1) SELECT * FROM t;  ", ""},
+		{"(select 1) UNION (select 2)", ""},
+		{`SELECT 'a;b', "c;d", $x$ ; $x$, $1 /* ; /* nested */ ; */ FROM a$b$`, ""},
+		{"SELECT 'it''s'; DROP TABLE items", "only a single statement is allowed"},
+		{`SELECT E'\''; DELETE FROM items; --'`, "only a single statement is allowed"},
+		{"SELECT 1; -- done", ""},
+		{"SELECT 1;;", "only a single statement is allowed"},
+		{"UPDATE items SET price = 0", "only SELECT queries are allowed"},
+		{"/* SELECT */ COPY items TO PROGRAM 'sh'", "only SELECT queries are allowed"},
+		{"", "only SELECT queries are allowed"},
+		{"SELECT $tag$ unterminated", "unterminated dollar-quoted string"},
+	}
+	for _, item := range cases {
+		got := ""
+		if err := checkReadQuery(item.query); err != nil {
+			got = err.Error()
+		}
+		if got != item.error {
+			t.Fatalf("[%s] results not match\nGot : %q\nWant: %q", item.query, got, item.error)
+		}
+	}
+}
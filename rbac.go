@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	actionRead   = "read"
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+	// actionRefresh refreshes a materialized view.
+	actionRefresh = "refresh"
+	// actionExecute calls a stored function; the rules name the function
+	// in place of a table.
+	actionExecute = "execute"
+)
+
+// Permission is a single access rule of a role.
+type Permission struct {
+	// Table is a table name, a function name for execute, or "*" for
+	// every table and function.
+	Table string `json:"table"`
+	// Actions lists read, create, update, delete, refresh and execute; "*"
+	// covers all of them.
+	Actions []string `json:"actions"`
+	// Deny turns the rule into an explicit denial, which wins over grants
+	// from any role.
+	Deny bool `json:"deny,omitempty"`
+}
+
+func (p *Permission) matches(table, action string) bool {
+	if p.Table != "*" && p.Table != table {
+		return false
+	}
+	for _, a := range p.Actions {
+		if a == "*" || a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// accessDecision is the outcome of evaluating the role rules for one action,
+// together with the rule that decided it.
+type accessDecision struct {
+	Allowed bool        `json:"allowed"`
+	Role    string      `json:"role,omitempty"`
+	Rule    *Permission `json:"rule,omitempty"`
+	Reason  string      `json:"reason"`
+}
+
+// decide evaluates the configured rules of roles for action on table. The
+// static table policy is checked first and can't be overridden by any role.
+// The rules of the "*" role apply to every caller, anonymous ones included.
+// Any matching deny wins, otherwise the first matching grant does. Without
+// configured roles access control is off and everything is allowed.
+func (de *DbExplorer) decide(roles []string, table, action string) accessDecision {
+	if policy := de.policyBlocks(table, action); policy != "" {
+		return accessDecision{Reason: fmt.Sprintf("table %s is %s", table, policy)}
+	}
+	rules := de.cfg.Auth.Roles
+	if len(rules) == 0 {
+		return accessDecision{Allowed: true, Reason: "access control is not configured"}
+	}
+
+	var grant *accessDecision
+	for _, role := range append([]string{"*"}, roles...) {
+		for i := range rules[role] {
+			p := &rules[role][i]
+			if !p.matches(table, action) {
+				continue
+			}
+			if p.Deny {
+				return accessDecision{Role: role, Rule: p, Reason: fmt.Sprintf("denied by role %s", role)}
+			}
+			if grant == nil {
+				grant = &accessDecision{Allowed: true, Role: role, Rule: p, Reason: fmt.Sprintf("granted by role %s", role)}
+			}
+		}
+	}
+	if grant != nil {
+		return *grant
+	}
+	return accessDecision{Reason: fmt.Sprintf("no rule grants %s on %s", action, table)}
+}
+
+// authorize checks the caller's access to table and writes a 403 when it is
+// denied.
+func (de *DbExplorer) authorize(w http.ResponseWriter, r *http.Request, table *Table, action string) bool {
+	return de.authorizeName(w, r, table.Name, action)
+}
+
+// authorizeName is authorize for the table or function name.
+func (de *DbExplorer) authorizeName(w http.ResponseWriter, r *http.Request, name, action string) bool {
+	var roles []string
+	if id := identityFromRequest(r); id != nil {
+		roles = id.Roles
+	}
+	if decision := de.decide(roles, name, action); !decision.Allowed {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%s on %s is not allowed", action, name))
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether the caller may use the administrative endpoints:
+// anyone while access control is off, otherwise holders of the admin role.
+func (de *DbExplorer) isAdmin(r *http.Request) bool {
+	if len(de.cfg.Auth.Roles) == 0 {
+		return true
+	}
+	id := identityFromRequest(r)
+	return id != nil && id.HasRole(de.adminRole())
+}
+
+// adminRole is Auth.AdminRole, "admin" by default.
+func (de *DbExplorer) adminRole() string {
+	if de.cfg.Auth.AdminRole != "" {
+		return de.cfg.Auth.AdminRole
+	}
+	return "admin"
+}
+
+// handleCan simulates an access check, e.g.
+// /_auth/can?role=analyst&action=update&table=users, and explains the
+// decision. Without a role it evaluates the caller's own roles.
+func (de *DbExplorer) handleCan(w http.ResponseWriter, r *http.Request) {
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	query := r.URL.Query()
+	action, tableName := query.Get("action"), query.Get("table")
+	switch action {
+	case actionRead, actionCreate, actionUpdate, actionDelete, actionRefresh:
+	default:
+		writeError(w, http.StatusBadRequest, "action must be one of read, create, update, delete, refresh")
+		return
+	}
+	if _, ok := de.requestSchema(r.Context()).Tables[tableName]; !ok {
+		writeError(w, http.StatusNotFound, "unknown table")
+		return
+	}
+
+	roles := []string{}
+	if role := query.Get("role"); role != "" {
+		roles = []string{role}
+	} else if id := identityFromRequest(r); id != nil {
+		roles = id.Roles
+	}
+	decision := de.decide(roles, tableName, action)
+
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"roles":    roles,
+			"action":   action,
+			"table":    tableName,
+			"decision": decision,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	de := &DbExplorer{cfg: &Config{Auth: AuthConfig{Roles: map[string][]Permission{
+		"*":       {{Table: "items", Actions: []string{"read"}}},
+		"analyst": {{Table: "*", Actions: []string{"read"}}, {Table: "users", Actions: []string{"*"}, Deny: true}},
+		"editor":  {{Table: "users", Actions: []string{"update", "create"}}},
+	}}}}
+
+	cases := []struct {
+		roles   []string
+		table   string
+		action  string
+		allowed bool
+		reason  string
+	}{
+		{nil, "items", "read", true, "granted by role *"},
+		{nil, "users", "read", false, "no rule grants read on users"},
+		{[]string{"editor"}, "users", "update", true, "granted by role editor"},
+		{[]string{"editor"}, "users", "delete", false, "no rule grants delete on users"},
+		{[]string{"editor", "analyst"}, "users", "update", false, "denied by role analyst"},
+		{[]string{"analyst"}, "items", "update", false, "no rule grants update on items"},
+	}
+	for _, c := range cases {
+		got := de.decide(c.roles, c.table, c.action)
+		if got.Allowed != c.allowed || got.Reason != c.reason {
+			t.Fatalf("%v %s %s: results not match\nGot : %v %q\nWant: %v %q", c.roles, c.action, c.table, got.Allowed, got.Reason, c.allowed, c.reason)
+		}
+	}
+
+	open := &DbExplorer{cfg: &Config{}}
+	if !open.decide(nil, "users", "delete").Allowed {
+		t.Fatalf("expected everything to be allowed without configured roles")
+	}
+	de.cfg.TablePolicies = map[string]string{"items": "read-only", "users": "no-delete, no-create"}
+	open.cfg.TablePolicies = de.cfg.TablePolicies
+	policyCases := []struct {
+		de      *DbExplorer
+		roles   []string
+		table   string
+		action  string
+		allowed bool
+		reason  string
+	}{
+		{de, nil, "items", "read", true, "granted by role *"},
+		{de, []string{"analyst"}, "items", "update", false, "table items is read-only"},
+		{open, nil, "items", "create", false, "table items is read-only"},
+		{open, nil, "users", "delete", false, "table users is no-delete"},
+		{open, nil, "users", "update", true, "access control is not configured"},
+	}
+	for _, c := range policyCases {
+		got := c.de.decide(c.roles, c.table, c.action)
+		if got.Allowed != c.allowed || got.Reason != c.reason {
+			t.Fatalf("policy %s %s: results not match\nGot : %v %q\nWant: %v %q", c.action, c.table, got.Allowed, got.Reason, c.allowed, c.reason)
+		}
+	}
+	if err := checkTablePolicies(map[string]string{"events": "readonly"}); err == nil {
+		t.Fatalf("expected unknown policy entry to be rejected")
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	de := &DbExplorer{cfg: &Config{Auth: AuthConfig{
+		ImpersonateRole: "support",
+		APIKeys: map[string]APIKey{
+			"k1": {Subject: "user@corp", Roles: []string{"analyst"}},
+			"k2": {Subject: "user@corp", Roles: []string{"analyst", "editor"}},
+			"k3": {Subject: "root@corp", Roles: []string{"analyst", "admin"}},
+			"k4": {Subject: "lead@corp", Roles: []string{"support"}},
+		},
+	}}}
+
+	r := httptest.NewRequest("GET", "/users", nil)
+	r.Header.Set(impersonateHeader, "user@corp")
+	if _, err := de.impersonate(withIdentity(r, &Identity{Subject: "eve", Roles: []string{"analyst"}})); err == nil {
+		t.Fatalf("expected impersonation without the support role to be rejected")
+	}
+
+	got, err := de.impersonate(withIdentity(r, &Identity{Subject: "sam", Roles: []string{"support"}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	id := identityFromRequest(got)
+	if id.Subject != "user@corp" || !reflect.DeepEqual(id.Roles, []string{"analyst", "editor"}) || id.Attributes["impersonated_by"] != "sam" {
+		t.Fatalf("results not match\nGot : %#v", id)
+	}
+
+	// Impersonating a privileged user would be an escalation.
+	for _, subject := range []string{"root@corp", "lead@corp"} {
+		r.Header.Set(impersonateHeader, subject)
+		if _, err := de.impersonate(withIdentity(r, &Identity{Subject: "sam", Roles: []string{"support"}})); err == nil {
+			t.Fatalf("expected impersonating %s to be rejected", subject)
+		}
+	}
+
+	r.Header.Set(impersonateHeader, "nobody@corp")
+	if _, err := de.impersonate(withIdentity(r, &Identity{Subject: "sam", Roles: []string{"support"}})); err == nil {
+		t.Fatalf("expected unknown user to be rejected")
+	}
+}
+
+func TestImportUpdateNeedsUpdate(t *testing.T) {
+	backend := &fakeStore{duplicate: func(columns []string, row []interface{}) bool { return true }}
+	de := backendExplorer(backend)
+	de.cfg.Auth.Roles = map[string][]Permission{"*": {{Table: "items", Actions: []string{actionCreate}}}}
+
+	r := importRequest(t, "title,price\nmemcache,2\n")
+	r.URL.RawQuery = "on_duplicate=update"
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || backend.conflict != nil || backend.inserted != nil {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusForbidden)
+	}
+
+	// Skipping duplicates only inserts.
+	r = importRequest(t, "title,price\nmemcache,2\n")
+	r.URL.RawQuery = "on_duplicate=skip"
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// handleRefresh serves POST /{view}/_refresh, refreshing a materialized
+// view so that dashboards can trigger it through the API. With
+// ?concurrently=true reads of the view aren't blocked meanwhile; the
+// database requires a unique index on it for that.
+func (de *DbExplorer) handleRefresh(w http.ResponseWriter, r *http.Request, table *Table) {
+	if table.Kind != "materialized_view" {
+		writeError(w, http.StatusBadRequest, "not a materialized view")
+		return
+	}
+	concurrently := false
+	if raw := r.URL.Query().Get("concurrently"); raw != "" {
+		var err error
+		if concurrently, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "concurrently must be true or false")
+			return
+		}
+	}
+	refresher, ok := de.backend.(refresher)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "refreshing views is not supported by this store")
+		return
+	}
+
+	if err := refresher.Refresh(r.Context(), querybuilder.Refresh{View: table.ref(), Concurrently: concurrently}); err != nil {
+		http.Error(w, fmt.Sprintf("Error refreshing view: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"refreshed": table.Name,
+		},
+	}, false)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// refreshStore is a fakeStore that refreshes materialized views.
+type refreshStore struct {
+	fakeStore
+	refreshed []string
+}
+
+func (s *refreshStore) Refresh(ctx context.Context, refresh querybuilder.Refresh) error {
+	query, _ := buildSQL(refresh)
+	s.refreshed = append(s.refreshed, query)
+	return nil
+}
+
+func TestRefresh(t *testing.T) {
+	backend := &refreshStore{}
+	de := backendExplorer(backend)
+	schema := de.snapshot()
+	schema.Tables["item_totals"] = &Table{Schema: "public", Name: "item_totals", Kind: "materialized_view", ReadOnly: true, Columns: []*Column{
+		{Name: "item_id", DataType: "integer", Nullable: true},
+		{Name: "total", DataType: "numeric", Nullable: true},
+	}}
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/item_totals/_refresh?concurrently=true", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"refreshed":"item_totals"`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+	want := []string{`REFRESH MATERIALIZED VIEW CONCURRENTLY "public"."item_totals"`}
+	if !reflect.DeepEqual(backend.refreshed, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.refreshed, want)
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+		error  string
+	}{
+		{http.MethodPost, "/items/_refresh", "", http.StatusBadRequest, "not a materialized view"},
+		{http.MethodPost, "/item_totals/_refresh?concurrently=maybe", "", http.StatusBadRequest, "concurrently must be true or false"},
+		// Views the database can't write through are read-only.
+		{http.MethodPut, "/item_totals", `{"total": 1}`, http.StatusForbidden, "on item_totals is not allowed"},
+		{http.MethodPost, "/item_totals/_update_expr?total=gt.1", `{"set": ["total = 0"]}`, http.StatusForbidden, "on item_totals is not allowed"},
+	}
+	for _, item := range cases {
+		backend.refreshed = nil
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(item.method, item.path, strings.NewReader(item.body)))
+		if w.Code != item.code || !strings.Contains(w.Body.String(), item.error) || backend.refreshed != nil {
+			t.Fatalf("[%s %s] results not match\nGot : %d %s\nWant: %d %s", item.method, item.path, w.Code, w.Body, item.code, item.error)
+		}
+	}
+
+	// A configured read-only policy also keeps the view from refreshing.
+	de.cfg.TablePolicies = map[string]string{"item_totals": "read-only"}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/item_totals/_refresh", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusForbidden)
+	}
+
+	de = backendExplorer(&fakeStore{})
+	de.snapshot().Tables["item_totals"] = schema.Tables["item_totals"]
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/item_totals/_refresh", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusNotImplemented)
+	}
+}
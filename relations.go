@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// childReference returns the foreign key of child that references the
+// primary key of parent; ok is false when there is none.
+func childReference(parent, child *Table) (fk *ForeignKey, ok bool, err error) {
+	for _, candidate := range child.ForeignKeys {
+		if candidate.RefTable != parent.Name || !sameColumns(candidate.RefColumns, parent.PrimaryKey) {
+			continue
+		}
+		if fk != nil {
+			return nil, false, fmt.Errorf("%s references %s more than once", child.Name, parent.Name)
+		}
+		fk = candidate
+	}
+	return fk, fk != nil, nil
+}
+
+// sameColumns reports whether a and b hold the same columns in any order.
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, name := range a {
+		if !containsString(b, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleGetChildren serves GET /{table}/{id}/{child}, the records of child
+// whose foreign key points at the record. It is a listing of child, with
+// the same filters, ordering and pagination.
+func (de *DbExplorer) handleGetChildren(w http.ResponseWriter, r *http.Request, parent *Table, key recordKey, child *Table) {
+	fk, ok, err := childReference(parent, child)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown resource")
+		return
+	}
+
+	scope := make(querybuilder.And, len(fk.Columns))
+	for i, column := range fk.Columns {
+		for j, pk := range parent.PrimaryKey {
+			if pk == fk.RefColumns[i] {
+				scope[i] = querybuilder.Compare{Column: column, Op: querybuilder.Eq, Value: key[j]}
+			}
+		}
+	}
+	de.handleGetTable(w, r, child, scope)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// reloadSchema introspects the Postgres schema served again and swaps the
+// new snapshot in when its tables or functions changed, reporting whether
+// they did. An unchanged schema keeps the snapshot served, and with it the
+// statements of the warm-up. A schema switch racing the reload wins.
+func (de *DbExplorer) reloadSchema(ctx context.Context) (*Schema, bool, error) {
+	current := de.snapshot()
+	schema, err := de.loadSchema(current.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	if reflect.DeepEqual(schema.Tables, current.Tables) && reflect.DeepEqual(schema.Functions, current.Functions) {
+		return current, false, nil
+	}
+	if de.cfg.WarmUp {
+		if err := de.warmUp(ctx, schema); err != nil {
+			return nil, false, err
+		}
+	}
+	if !de.schema.CompareAndSwap(current, schema) {
+		schema.retire()
+		return de.snapshot(), false, nil
+	}
+	current.retire()
+	de.recordSchema(schema)
+	return schema, true, nil
+}
+
+// handleReload serves POST /_reload, picking up tables, columns and
+// functions created or altered since the schema was loaded without a
+// restart. The other replicas reload too when the schema changed.
+func (de *DbExplorer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	schema, changed, err := de.reloadSchema(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changed {
+		de.announceSchema(r.Context(), schema.Name)
+	}
+	audit("schema_reloaded", r, map[string]interface{}{"schema": schema.Name, "changed": changed})
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"schema":  schema.Name,
+			"changed": changed,
+			"tables":  schema.TableNames(),
+		},
+	}, false)
+}
+
+// refreshSchema reloads the schema every interval, see
+// Config.SchemaRefresh. Every replica polls on its own, so changes aren't
+// announced.
+func (de *DbExplorer) refreshSchema(interval time.Duration) {
+	for range time.Tick(interval) {
+		schema, changed, err := de.reloadSchema(context.Background())
+		switch {
+		case err != nil:
+			log.Printf("schema refresh: %v", err)
+		case changed:
+			log.Printf("reloaded schema %s", schema.Name)
+		}
+	}
+}
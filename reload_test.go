@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reloadStore is a fakeStore whose introspection returns the tables of
+// fuzzSchema and those created since.
+type reloadStore struct {
+	fakeStore
+	created map[string]*Table
+}
+
+func (s *reloadStore) Introspect(ctx context.Context, schema string) (map[string]*Table, error) {
+	tables := fuzzSchema().Tables
+	for name, table := range s.created {
+		tables[name] = table
+	}
+	return tables, nil
+}
+
+func TestReload(t *testing.T) {
+	backend := &reloadStore{}
+	de := backendExplorer(backend)
+	de.history, _ = loadSchemaHistory("")
+	de.recordSchema(de.snapshot())
+	served := de.snapshot()
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_reload", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"changed":false`) || de.snapshot() != served {
+		t.Fatalf("results not match\nGot : %d %s\nWant: the snapshot served kept", w.Code, w.Body)
+	}
+
+	backend.created = map[string]*Table{"notes": {Schema: "public", Name: "notes", Columns: []*Column{{Name: "id", DataType: "integer"}}, PrimaryKey: []string{"id"}}}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_reload", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"changed":true`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+	if _, ok := de.snapshot().Tables["notes"]; !ok {
+		t.Fatal("results not match\nGot : no notes table\nWant: the table created since served")
+	}
+	if changes, _ := de.history.changes(time.Time{}); len(changes) != 1 || changes[0].Change != "table_added" || changes[0].Table != "notes" {
+		t.Fatalf("results not match\nGot : %+v\nWant: notes added", changes)
+	}
+
+	de.cfg.Auth.Roles = map[string][]Permission{"*": {{Table: "*", Actions: []string{actionRead}}}}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_reload", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// splitPath returns the decoded path segments of u. Segments are split on
+// the escaped path, so an encoded slash stays part of a text id, and empty
+// segments are dropped: /items/ and /items route identically.
+func splitPath(u *url.URL) ([]string, error) {
+	var parts []string
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		if segment == "" {
+			continue
+		}
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, decoded)
+	}
+	return parts, nil
+}
+
+// route dispatches a request by its path segments:
+//
+//	/                      table list
+//	/_name/...             system endpoints
+//	/{table}               table listing and creation
+//	/{table}/_action/...   table level sub-resources
+//	/{table}/{id}          a single record
+//	/{table}/{id}/{child}  records of child referencing the record
+//	/{table}/{id}/_impact  what deleting the record would do
+//	/{table}/{id}/_clone   a copy of the record
+func (de *DbExplorer) route(w http.ResponseWriter, r *http.Request) {
+	parts, err := splitPath(r.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+
+	de.announceDeprecation(w, parts)
+	if len(parts) == 0 {
+		de.handleRoot(w, r)
+		return
+	}
+
+	if strings.HasPrefix(parts[0], "_") {
+		de.routeSystem(w, r, parts)
+		return
+	}
+
+	table, ok := de.requestSchema(r.Context()).Tables[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown table")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		de.routeTable(w, r, table)
+	case strings.HasPrefix(parts[1], "_"):
+		de.routeTableAction(w, r, table, parts[1], parts[2:])
+	case len(parts) == 2:
+		de.routeRecord(w, r, table, parts[1])
+	default:
+		de.routeRecordAction(w, r, table, parts[1], parts[2:])
+	}
+}
+
+// isPublicPath reports whether path is served without authentication.
+func isPublicPath(path string) bool {
+	switch strings.TrimRight(path, "/") {
+	case "/_ready", "/_auth/login", "/_auth/callback":
+		return true
+	}
+	return false
+}
+
+func (de *DbExplorer) routeSystem(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 1 && parts[0] == "_ready":
+		de.handleReady(w, r)
+	case len(parts) == 1 && parts[0] == "_meta":
+		de.handleMeta(w, r)
+	case len(parts) == 2 && parts[0] == "_schema" && parts[1] == "status":
+		de.handleSchemaStatus(w, r)
+	case len(parts) == 2 && parts[0] == "_schema" && parts[1] == "changes" && r.Method == http.MethodGet:
+		de.handleSchemaChanges(w, r)
+	case len(parts) == 1 && parts[0] == "_reload" && r.Method == http.MethodPost:
+		de.handleReload(w, r)
+	case len(parts) == 1 && parts[0] == "_usage":
+		de.handleUsage(w, r, "")
+	case len(parts) == 2 && parts[0] == "_usage":
+		de.handleUsage(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "_admin" && parts[1] == "schema":
+		de.handleAdminSchema(w, r)
+	case len(parts) == 2 && parts[0] == "_admin" && parts[1] == "field_usage" && r.Method == http.MethodGet:
+		de.handleFieldUsage(w, r)
+	case len(parts) == 2 && parts[0] == "_admin" && parts[1] == "orphans":
+		de.handleOrphans(w, r)
+	case len(parts) >= 2 && parts[0] == "_admin" && parts[1] == "keys":
+		de.routeAdminKeys(w, r, parts[2:])
+	case len(parts) == 1 && parts[0] == "_queries" && r.Method == http.MethodGet:
+		de.handleNamedQueries(w, r, "")
+	case len(parts) == 2 && parts[0] == "_queries" && r.Method == http.MethodGet:
+		de.handleNamedQueries(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "_query" && r.Method == http.MethodPost:
+		de.handleQuery(w, r)
+	case len(parts) == 2 && parts[0] == "_rpc" && r.Method == http.MethodPost:
+		de.handleRPC(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "_auth":
+		de.routeAuth(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func (de *DbExplorer) routeAuth(w http.ResponseWriter, r *http.Request, action string) {
+	sso := de.oidc != nil
+	switch {
+	case action == "can" && r.Method == http.MethodGet:
+		de.handleCan(w, r)
+	case sso && action == "login" && r.Method == http.MethodGet:
+		de.handleLogin(w, r)
+	case sso && action == "callback" && r.Method == http.MethodGet:
+		de.handleCallback(w, r)
+	case sso && action == "logout" && r.Method == http.MethodPost:
+		de.handleLogout(w, r)
+	case sso && action == "csrf" && r.Method == http.MethodGet:
+		de.handleCSRFToken(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func (de *DbExplorer) routeTable(w http.ResponseWriter, r *http.Request, table *Table) {
+	// ?key=col:value,... addresses a single record, the query form of
+	// composite keys.
+	if raw := r.URL.Query().Get("key"); raw != "" {
+		key, err := table.parseKeyQuery(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		de.routeRecordKey(w, r, table, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if de.authorize(w, r, table, actionRead) {
+			de.handleGetTable(w, r, table, nil)
+		}
+	case http.MethodPut, http.MethodPost:
+		if de.authorize(w, r, table, actionCreate) {
+			de.handleCreateRecord(w, r, table)
+		}
+	case http.MethodDelete:
+		if de.authorize(w, r, table, actionDelete) {
+			de.handleBatchDelete(w, r, table)
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (de *DbExplorer) routeTableAction(w http.ResponseWriter, r *http.Request, table *Table, action string, rest []string) {
+	switch {
+	case action == "_search" && len(rest) == 0 && r.Method == http.MethodGet:
+		if de.authorize(w, r, table, actionRead) {
+			de.handleSearch(w, r, table)
+		}
+	case action == "_schema" && len(rest) == 0 && r.Method == http.MethodGet:
+		if de.authorize(w, r, table, actionRead) {
+			de.handleTableSchema(w, r, table)
+		}
+	case action == "_distinct" && len(rest) == 1 && r.Method == http.MethodGet:
+		if de.authorize(w, r, table, actionRead) {
+			de.handleDistinct(w, r, table, rest[0])
+		}
+	case action == "_import" && len(rest) == 0 && r.Method == http.MethodPost:
+		if de.authorize(w, r, table, actionCreate) {
+			de.handleImport(w, r, table)
+		}
+	case action == "_merge" && len(rest) == 0 && r.Method == http.MethodPost:
+		if de.authorize(w, r, table, actionUpdate) {
+			de.handleMerge(w, r, table)
+		}
+	case action == "_refresh" && len(rest) == 0 && r.Method == http.MethodPost:
+		if de.authorize(w, r, table, actionRefresh) {
+			de.handleRefresh(w, r, table)
+		}
+	case action == "_update_expr" && len(rest) == 0 && r.Method == http.MethodPost:
+		if de.authorize(w, r, table, actionUpdate) {
+			de.handleUpdateExpr(w, r, table)
+		}
+	case action == "_batch" && len(rest) == 0 && r.Method == http.MethodPost:
+		if de.authorize(w, r, table, actionUpdate) {
+			de.handleBatchUpdate(w, r, table)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "unknown resource")
+	}
+}
+
+func (de *DbExplorer) routeRecord(w http.ResponseWriter, r *http.Request, table *Table, rawID string) {
+	key, err := table.parseKey(rawID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	de.routeRecordKey(w, r, table, key)
+}
+
+func (de *DbExplorer) routeRecordKey(w http.ResponseWriter, r *http.Request, table *Table, key recordKey) {
+	switch r.Method {
+	case http.MethodGet:
+		if de.authorize(w, r, table, actionRead) {
+			de.handleGetRecord(w, r, table, key)
+		}
+	case http.MethodPost:
+		if de.authorize(w, r, table, actionUpdate) {
+			de.handlePostRecord(w, r, table, key)
+		}
+	case http.MethodDelete:
+		if de.authorize(w, r, table, actionDelete) {
+			de.handleDeleteRecord(w, r, table, key)
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (de *DbExplorer) routeRecordAction(w http.ResponseWriter, r *http.Request, table *Table, id string, rest []string) {
+	if len(rest) == 1 && rest[0] == "_impact" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		key, err := table.parseKey(id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if de.authorize(w, r, table, actionRead) {
+			de.handleImpact(w, r, table, key)
+		}
+		return
+	}
+	if len(rest) == 1 && rest[0] == "_clone" {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		key, err := table.parseKey(id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if de.authorize(w, r, table, actionRead) && de.authorize(w, r, table, actionCreate) {
+			de.handleClone(w, r, table, key)
+		}
+		return
+	}
+	child, ok := de.requestSchema(r.Context()).Tables[rest[0]]
+	if len(rest) != 1 || !ok {
+		writeError(w, http.StatusNotFound, "unknown resource")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	key, err := table.parseKey(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if de.authorize(w, r, table, actionRead) && de.authorize(w, r, child, actionRead) {
+		de.handleGetChildren(w, r, table, key, child)
+	}
+}
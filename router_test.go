@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPath(t *testing.T) {
+	cases := []struct {
+		path  string
+		parts []string
+	}{
+		{"/", nil},
+		{"/items", []string{"items"}},
+		{"/items/", []string{"items"}},
+		{"/items//1/", []string{"items", "1"}},
+		{"/tags/hello%20world", []string{"tags", "hello world"}},
+		{"/files/a%2Fb", []string{"files", "a/b"}},
+	}
+	for _, item := range cases {
+		u, err := url.Parse(item.path)
+		if err != nil {
+			t.Fatalf("[%s] parse error: %v", item.path, err)
+		}
+		parts, err := splitPath(u)
+		if err != nil {
+			t.Fatalf("[%s] unexpected error: %v", item.path, err)
+		}
+		if !reflect.DeepEqual(parts, item.parts) {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: %#v", item.path, parts, item.parts)
+		}
+	}
+}
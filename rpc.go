@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// handleRPC serves POST /_rpc/{function}, calling a stored function of the
+// schema with the arguments of the JSON body, by name: {"since":
+// "2024-01-01"} calls sales_since(since => '2024-01-01'). Arguments with a
+// default may be left out, as may an empty body. The rows the function
+// returns are the records of the response, one for a function returning a
+// single value. They are paged with ?limit= and ?offset= and may be
+// filtered and ordered by the function's output columns, as table records
+// are.
+func (de *DbExplorer) handleRPC(w http.ResponseWriter, r *http.Request, name string) {
+	invoker, ok := de.backend.(invoker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "calling functions is not supported by this store")
+		return
+	}
+	function, ok := de.requestSchema(r.Context()).Functions[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown function")
+		return
+	}
+	if !de.authorizeName(w, r, function.Name, actionExecute) {
+		return
+	}
+
+	values := map[string]interface{}{}
+	if r.ContentLength != 0 {
+		body, err := de.readBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if values, ok = body.(map[string]interface{}); !ok {
+			writeError(w, http.StatusBadRequest, "expected a JSON object of arguments")
+			return
+		}
+	}
+	args, err := de.functionArgs(r, function, values)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	params := r.URL.Query()
+	limit, offset, err := pagination(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results := function.results()
+	if _, keyset := params["cursor"]; keyset {
+		// Function results have no key to resume from.
+		if _, err := keysetTerms(results, nil); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	where, err := de.whereClause(results, params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	terms, err := de.parseOrder(results, params.Get("order"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records := []map[string]interface{}{}
+	call := querybuilder.Invoke{
+		Function: querybuilder.Table{Schema: function.Schema, Name: function.Name},
+		Args:     args,
+		Where:    where,
+		OrderBy:  terms,
+		Page:     &querybuilder.Page{Limit: limit, Offset: offset},
+	}
+	if err := de.checkQueryCost(r.Context(), call); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	err = invoker.Invoke(r.Context(), call, func(record map[string]interface{}) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error calling function: %v", err), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), int64(len(records)))
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"records": records,
+		},
+	}, false)
+}
+
+// functionArgs binds the decoded body values to the arguments of function,
+// in declaration order, converted for their types as record fields are for
+// their columns, so that a bad value is reported by argument rather than as
+// a failed cast.
+func (de *DbExplorer) functionArgs(r *http.Request, function *Function, values map[string]interface{}) ([]querybuilder.NamedArg, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !function.hasArg(name) {
+			return nil, &fieldError{name, fmt.Sprintf("unknown argument %s", name)}
+		}
+	}
+
+	strict := de.bodyMode(r) == bodyModeStrict
+	var args []querybuilder.NamedArg
+	for _, arg := range function.Args {
+		value, ok := values[arg.Name]
+		if !ok {
+			if !arg.HasDefault {
+				return nil, &fieldError{arg.Name, fmt.Sprintf("missing argument %s", arg.Name)}
+			}
+			continue
+		}
+		converted, ok := de.convertValue(&arg.Column, value, strict)
+		if !ok {
+			return nil, &fieldError{arg.Name, fmt.Sprintf("argument %s must be of type %s", arg.Name, arg.typeName())}
+		}
+		if checkEnum(&arg.Column, converted) != nil {
+			return nil, &fieldError{arg.Name, fmt.Sprintf("argument %s must be one of: %s", arg.Name, strings.Join(arg.EnumValues, ", "))}
+		}
+		if checkRange(&arg.Column, converted) != nil {
+			return nil, &fieldError{arg.Name, fmt.Sprintf("argument %s is out of range for type %s", arg.Name, arg.typeName())}
+		}
+		args = append(args, querybuilder.NamedArg{Name: arg.Name, Value: converted})
+	}
+	return args, nil
+}
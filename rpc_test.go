@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// invokeStore is a fakeStore over the tables of fuzzSchema whose
+// functions return rows.
+type invokeStore struct {
+	fakeStore
+	rows  []map[string]interface{}
+	calls []string
+}
+
+func (s *invokeStore) Introspect(ctx context.Context, schema string) (map[string]*Table, error) {
+	return fuzzSchema().Tables, nil
+}
+
+func (s *invokeStore) Functions(ctx context.Context, schema string) (map[string]*Function, error) {
+	return map[string]*Function{
+		"sales_since": {Schema: schema, Name: "sales_since", Args: []*FunctionArg{
+			{Column: Column{Name: "since", DataType: "date", Nullable: true}},
+			{Column: Column{Name: "region", DataType: "USER-DEFINED", Nullable: true, Enum: "region", EnumValues: []string{"EU", "US"}}, HasDefault: true},
+			{Column: Column{Name: "stores", DataType: "ARRAY", ElementType: "integer", Nullable: true}, HasDefault: true},
+			{Column: Column{Name: "options", DataType: "jsonb", Nullable: true}, HasDefault: true},
+		}, Columns: []*Column{
+			{Name: "region", DataType: "text", Nullable: true},
+			{Name: "total", DataType: "numeric", Nullable: true},
+		}},
+	}, nil
+}
+
+func (s *invokeStore) Invoke(ctx context.Context, call querybuilder.Invoke, each func(record map[string]interface{}) error) error {
+	query, args := buildSQL(call)
+	s.calls = append(s.calls, fmt.Sprint(query, " ", args))
+	for _, row := range s.rows {
+		if err := each(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRPC(t *testing.T) {
+	backend := &invokeStore{rows: []map[string]interface{}{{"region": "EU", "total": 12.5}}}
+	de := backendExplorer(backend)
+	schema, err := de.loadSchema("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	de.schema.Store(schema)
+
+	w := httptest.NewRecorder()
+	body := `{"options": {"net": true}, "since": "2024-01-01", "stores": [1, "2"]}`
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_rpc/sales_since", strings.NewReader(body)))
+	if w.Code != http.StatusOK || w.Body.String() != `{"response":{"records":[{"region":"EU","total":12.5}]}}`+"\n" {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+	want := []string{`SELECT * FROM "public"."sales_since"("since" => $1, "stores" => $2, "options" => $3) LIMIT 100 OFFSET 0 [2024-01-01 {[1 2]} {"net":true}]`}
+	if !reflect.DeepEqual(backend.calls, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", backend.calls, want)
+	}
+
+	cases := []struct {
+		path  string
+		body  string
+		code  int
+		error string
+	}{
+		{"/_rpc/pg_sleep", `{}`, http.StatusNotFound, "unknown function"},
+		{"/_rpc/sales_since", ``, http.StatusBadRequest, "missing argument since"},
+		{"/_rpc/sales_since", `{"since": "2024-01-01", "country": "DE"}`, http.StatusBadRequest, "unknown argument country"},
+		{"/_rpc/sales_since", `["2024-01-01"]`, http.StatusBadRequest, "expected a JSON object of arguments"},
+		// Arguments are checked for their types before the database casts
+		// them.
+		{"/_rpc/sales_since", `{"since": "last week"}`, http.StatusBadRequest, `"argument since must be of type date","field":"since"`},
+		{"/_rpc/sales_since", `{"since": "2024-01-01", "stores": [1, "x"]}`, http.StatusBadRequest, "argument stores must be of type integer[]"},
+		{"/_rpc/sales_since", `{"since": "2024-01-01", "region": "APAC"}`, http.StatusBadRequest, "argument region must be one of: EU, US"},
+	}
+	for _, item := range cases {
+		backend.calls = nil
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, item.path, strings.NewReader(item.body)))
+		if w.Code != item.code || !strings.Contains(w.Body.String(), item.error) || backend.calls != nil {
+			t.Fatalf("[%s %s] results not match\nGot : %d %s\nWant: %d %s", item.path, item.body, w.Code, w.Body, item.code, item.error)
+		}
+	}
+
+	// The rows returned are paged, filtered and ordered as table records
+	// are.
+	backend.calls = nil
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_rpc/sales_since?region=eq.EU&total=gt.10&order=total.desc&limit=20&offset=40", strings.NewReader(`{"since": "2024-01-01"}`)))
+	want = []string{`SELECT * FROM "public"."sales_since"("since" => $1) WHERE "region" = $2 AND "total" > $3 ORDER BY "total" DESC LIMIT 20 OFFSET 40 [2024-01-01 EU 10]`}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(backend.calls, want) {
+		t.Fatalf("results not match\nGot : %d %s %#v\nWant: %#v", w.Code, w.Body, backend.calls, want)
+	}
+	for query, message := range map[string]string{
+		"country=eq.DE":  "unknown filter column country",
+		"order=since":    "unknown order column since",
+		"limit=-1":       "invalid limit",
+		"cursor=":        "cursor pagination needs a primary key",
+		"total=gt.ten":   "total",
+		"region=between": "expected operator.value",
+	} {
+		backend.calls = nil
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_rpc/sales_since?"+query, strings.NewReader(`{"since": "2024-01-01"}`)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), message) || backend.calls != nil {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", query, w.Code, w.Body, http.StatusBadRequest, message)
+		}
+	}
+
+	// Functions are executed under their own name.
+	de.cfg.Auth.Roles = map[string][]Permission{"*": {{Table: "*", Actions: []string{actionRead}}}}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_rpc/sales_since", strings.NewReader(`{"since": "2024-01-01"}`)))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "execute on sales_since is not allowed") {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusForbidden)
+	}
+}
+
+func TestFunctionOf(t *testing.T) {
+	// f(a integer, b text DEFAULT '', OUT total numeric)
+	types := []Column{{DataType: "integer"}, {DataType: "text"}, {DataType: "numeric"}}
+	function, ok := functionOf("public", "f", []string{"a", "b", "total"}, []string{"i", "i", "o"}, types, 1)
+	want := &Function{Schema: "public", Name: "f", Args: []*FunctionArg{
+		{Column: Column{Name: "a", DataType: "integer", Nullable: true}},
+		{Column: Column{Name: "b", DataType: "text", Nullable: true}, HasDefault: true},
+	}, Columns: []*Column{{Name: "total", DataType: "numeric", Nullable: true}}}
+	if !ok || !reflect.DeepEqual(function, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", function, want)
+	}
+	if _, ok := functionOf("public", "f", nil, nil, types[:1], 0); ok {
+		t.Fatal("results not match\nGot : a function with an unnamed argument\nWant: none")
+	}
+	if _, ok := functionOf("public", "f", []string{"xs"}, []string{"v"}, []Column{{DataType: "ARRAY", ElementType: "integer"}}, 0); ok {
+		t.Fatal("results not match\nGot : a variadic function\nWant: none")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+)
+
+const (
+	environmentHeader  = "X-Environment"
+	sandboxEnvironment = "sandbox"
+)
+
+// SandboxConfig is a second database with the same schema that requests
+// with X-Environment: sandbox read and write through the same endpoints,
+// for integrators testing writes.
+type SandboxConfig struct {
+	// DSN accepts secret references as Config.DSN does. The sandbox is
+	// always accessed through lib/pq.
+	DSN string `json:"dsn"`
+	// AllowedRoles are the roles of the callers that may use the sandbox;
+	// without any, every caller may.
+	AllowedRoles []string `json:"allowed_roles"`
+}
+
+// newSandbox opens the sandbox database and an explorer serving it with
+// the configuration of the primary one. Authentication, quotas and usage
+// stay with the primary explorer; the schema history and field usage only
+// cover the primary database.
+func newSandbox(cfg *Config) (*DbExplorer, error) {
+	dsn, err := resolveSecret(cfg.Sandbox.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %v", err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sandbox: %v", err)
+	}
+	sandboxCfg := *cfg
+	sandboxCfg.Sandbox = nil
+	sandboxCfg.Backend = nil
+	sandboxCfg.SchemaHistory = ""
+	sandboxCfg.FieldUsage = false
+	sandbox, err := NewDbExplorerWithConfig(db, &sandboxCfg)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sandbox: %v", err)
+	}
+	sandbox.environment = sandboxEnvironment
+	return sandbox, nil
+}
+
+// environmentFor returns the explorer serving the environment named by the
+// X-Environment header: the primary one for none or "production", the
+// sandbox for "sandbox". Sandbox responses carry the header back.
+func (de *DbExplorer) environmentFor(w http.ResponseWriter, r *http.Request) (*DbExplorer, bool) {
+	switch name := r.Header.Get(environmentHeader); name {
+	case "", "production":
+		return de, true
+	case sandboxEnvironment:
+		if de.sandbox == nil {
+			writeError(w, http.StatusBadRequest, "no sandbox environment is configured")
+			return nil, false
+		}
+		if roles := de.cfg.Sandbox.AllowedRoles; len(roles) > 0 {
+			id := identityFromRequest(r)
+			allowed := false
+			for _, role := range roles {
+				allowed = allowed || id != nil && id.HasRole(role)
+			}
+			if !allowed {
+				writeError(w, http.StatusForbidden, "sandbox environment not allowed")
+				return nil, false
+			}
+		}
+		w.Header().Set(environmentHeader, sandboxEnvironment)
+		return de.sandbox, true
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown environment %s", name))
+		return nil, false
+	}
+}
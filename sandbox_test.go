@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSandboxEnvironment(t *testing.T) {
+	de := backendExplorer(&fakeStore{records: []map[string]interface{}{{"id": 1, "title": "production"}}})
+	sandbox := backendExplorer(&fakeStore{records: []map[string]interface{}{{"id": 1, "title": "sandbox"}}})
+	sandbox.environment = sandboxEnvironment
+
+	cases := []struct {
+		environment string
+		code        int
+		body        string
+	}{
+		{"", http.StatusOK, `"title":"production"`},
+		{"production", http.StatusOK, `"title":"production"`},
+		{"sandbox", http.StatusBadRequest, "no sandbox environment is configured"},
+		{"staging", http.StatusBadRequest, "unknown environment staging"},
+	}
+	for _, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items", nil)
+		r.Header.Set(environmentHeader, item.environment)
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, r)
+		if w.Code != item.code || !strings.Contains(w.Body.String(), item.body) {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.environment, w.Code, w.Body, item.code, item.body)
+		}
+	}
+
+	de.cfg.Sandbox = &SandboxConfig{}
+	de.sandbox = sandbox
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set(environmentHeader, "sandbox")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"sandbox"`) || w.Header().Get(environmentHeader) != "sandbox" {
+		t.Fatalf("results not match\nGot : %d %v %s\nWant: the sandbox records", w.Code, w.Header(), w.Body)
+	}
+
+	// With allowed roles, only callers having one may use the sandbox.
+	de.cfg.Sandbox.AllowedRoles = []string{"integrator"}
+	for role, code := range map[string]int{"integrator": http.StatusOK, "viewer": http.StatusForbidden} {
+		r := withIdentity(httptest.NewRequest(http.MethodGet, "/items", nil), &Identity{Subject: "ann", Roles: []string{role}})
+		r.Header.Set(environmentHeader, "sandbox")
+		w := httptest.NewRecorder()
+		target, ok := de.environmentFor(w, r)
+		if ok != (code == http.StatusOK) || ok && target != sandbox || !ok && w.Code != code {
+			t.Fatalf("[%s] results not match\nGot : %v %d %s\nWant: %d", role, ok, w.Code, w.Body, code)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The priority classes every scheduler knows, see lowPriority.
+const (
+	classInteractive = "interactive"
+	classBulk        = "bulk"
+)
+
+// SchedulingConfig admits at most MaxConcurrent requests at a time. The
+// others wait in the queue of their priority class, and the queues take
+// turns in proportion to their weights as requests finish, so interactive
+// reads get ahead of bulk exports under contention.
+type SchedulingConfig struct {
+	MaxConcurrent int `json:"max_concurrent"`
+	// MaxWait is how long a request may wait before it is turned away with
+	// a 503; defaults to 30s.
+	MaxWait Duration `json:"max_wait"`
+	// Weights are the shares of the classes; "interactive" defaults to 8
+	// and "bulk" to 1. Other classes may be added.
+	Weights map[string]int `json:"weights"`
+	// Endpoints assign classes by "[METHOD ]/path" patterns, matched with
+	// path.Match, e.g. {"GET /reports/*": "bulk"}.
+	Endpoints map[string]string `json:"endpoints"`
+	// Subjects assign classes to callers, e.g. the subject of an API key.
+	// Endpoints take precedence, then subjects; requests matching neither
+	// are bulk if lowPriority says so and interactive otherwise.
+	Subjects map[string]string `json:"subjects"`
+}
+
+func (cfg *SchedulingConfig) maxWait() time.Duration {
+	if cfg.MaxWait <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(cfg.MaxWait)
+}
+
+func (cfg *SchedulingConfig) weights() map[string]int {
+	weights := map[string]int{classInteractive: 8, classBulk: 1}
+	for class, weight := range cfg.Weights {
+		weights[class] = weight
+	}
+	return weights
+}
+
+// checkScheduling rejects a scheduling configuration that could never
+// admit some requests.
+func checkScheduling(cfg *SchedulingConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxConcurrent < 1 {
+		return errors.New("scheduling: max_concurrent must be at least 1")
+	}
+	weights := cfg.weights()
+	for class, weight := range weights {
+		if weight < 1 {
+			return fmt.Errorf("scheduling: class %s: weight must be at least 1", class)
+		}
+	}
+	for _, assigned := range []map[string]string{cfg.Endpoints, cfg.Subjects} {
+		for name, class := range assigned {
+			if _, ok := weights[class]; !ok {
+				return fmt.Errorf("scheduling: %s: unknown class %s", name, class)
+			}
+		}
+	}
+	for pattern := range cfg.Endpoints {
+		if _, err := path.Match(endpointPath(pattern), ""); err != nil {
+			return fmt.Errorf("scheduling: endpoint %s: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// endpointPath returns the path pattern of an endpoint, without its method.
+func endpointPath(pattern string) string {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		return pattern[i+1:]
+	}
+	return pattern
+}
+
+// priorityClass returns the class r is queued in.
+func (cfg *SchedulingConfig) priorityClass(r *http.Request) string {
+	// The longest matching pattern wins, so specific endpoints can be
+	// carved out of broad ones.
+	class, longest := "", -1
+	for pattern, assigned := range cfg.Endpoints {
+		method := ""
+		if i := strings.IndexByte(pattern, ' '); i >= 0 {
+			method = pattern[:i]
+		}
+		if method != "" && method != r.Method {
+			continue
+		}
+		if ok, _ := path.Match(endpointPath(pattern), r.URL.Path); ok && len(pattern) > longest {
+			class, longest = assigned, len(pattern)
+		}
+	}
+	if class != "" {
+		return class
+	}
+	if id := identityFromRequest(r); id != nil {
+		if class, ok := cfg.Subjects[id.Subject]; ok {
+			return class
+		}
+	}
+	if lowPriority(r) {
+		return classBulk
+	}
+	return classInteractive
+}
+
+// scheduler hands out a fixed number of slots. Waiters queue by class and
+// a freed slot goes to the class picked by smooth weighted round robin:
+// each class with waiters earns its weight, the richest one is served and
+// pays the sum of the weights back.
+type scheduler struct {
+	mu      sync.Mutex
+	free    int
+	weights map[string]int
+	credit  map[string]int
+	queues  map[string][]chan struct{}
+}
+
+func newScheduler(slots int, weights map[string]int) *scheduler {
+	return &scheduler{
+		free:    slots,
+		weights: weights,
+		credit:  make(map[string]int),
+		queues:  make(map[string][]chan struct{}),
+	}
+}
+
+var errQueueTimeout = errors.New("too many requests in progress, try again later")
+
+// acquire waits up to maxWait for a slot for a request of class.
+func (s *scheduler) acquire(ctx context.Context, class string, maxWait time.Duration) error {
+	s.mu.Lock()
+	if s.free > 0 && s.waiting() == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.queues[class] = append(s.queues[class], ready)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queues[class]
+	for i, waiter := range queue {
+		if waiter == ready {
+			s.queues[class] = append(queue[:i:i], queue[i+1:]...)
+			return err
+		}
+	}
+	// The slot was handed over while giving up.
+	return nil
+}
+
+// release hands the slot of a finished request to the next waiter.
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	class := s.next()
+	if class == "" {
+		s.free++
+		return
+	}
+	ready := s.queues[class][0]
+	s.queues[class] = s.queues[class][1:]
+	close(ready)
+}
+
+// next picks the class served next, empty when nobody waits.
+func (s *scheduler) next() string {
+	picked, total := "", 0
+	for class, queue := range s.queues {
+		if len(queue) == 0 {
+			continue
+		}
+		weight := s.weights[class]
+		s.credit[class] += weight
+		total += weight
+		if picked == "" || s.credit[class] > s.credit[picked] || s.credit[class] == s.credit[picked] && class < picked {
+			picked = class
+		}
+	}
+	if picked != "" {
+		s.credit[picked] -= total
+	}
+	return picked
+}
+
+func (s *scheduler) waiting() int {
+	n := 0
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// admit waits for a slot for r when scheduling is configured; it reports
+// whether r was admitted, in which case done must be called once it is
+// served. Public paths such as the readiness probe never wait.
+func (de *DbExplorer) admit(w http.ResponseWriter, r *http.Request) (done func(), ok bool) {
+	cfg := de.cfg.Scheduling
+	if de.admission == nil || cfg == nil || isPublicPath(r.URL.Path) {
+		return func() {}, true
+	}
+	if err := de.admission.acquire(r.Context(), cfg.priorityClass(r), cfg.maxWait()); err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(cfg.maxWait().Seconds())))
+		writeError(w, http.StatusServiceUnavailable, errQueueTimeout.Error())
+		return nil, false
+	}
+	return de.admission.release, true
+}
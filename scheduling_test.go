@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerWeights(t *testing.T) {
+	s := newScheduler(1, map[string]int{classInteractive: 2, classBulk: 1})
+	if err := s.acquire(context.Background(), classInteractive, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan string)
+	for _, class := range []string{classBulk, classBulk, classBulk, classInteractive, classInteractive, classInteractive} {
+		go func(class string) {
+			if err := s.acquire(context.Background(), class, time.Minute); err != nil {
+				t.Error(err)
+			}
+			served <- class
+		}(class)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		waiting := s.waiting()
+		s.mu.Unlock()
+		if waiting == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("results not match\nGot : %d waiting\nWant: 6 waiting", waiting)
+		}
+	}
+
+	var order []string
+	for i := 0; i < 6; i++ {
+		s.release()
+		order = append(order, <-served)
+	}
+	want := []string{classInteractive, classBulk, classInteractive, classInteractive, classBulk, classBulk}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("results not match\nGot : %v\nWant: %v", order, want)
+	}
+	s.release()
+	if s.free != 1 {
+		t.Fatalf("results not match\nGot : %d free slots\nWant: 1", s.free)
+	}
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	s := newScheduler(1, map[string]int{classInteractive: 1})
+	s.acquire(context.Background(), classInteractive, time.Second)
+	if err := s.acquire(context.Background(), classInteractive, 10*time.Millisecond); err != errQueueTimeout {
+		t.Fatalf("results not match\nGot : %v\nWant: %v", err, errQueueTimeout)
+	}
+	if s.waiting() != 0 {
+		t.Fatalf("results not match\nGot : %d waiting\nWant: 0", s.waiting())
+	}
+}
+
+func TestPriorityClass(t *testing.T) {
+	cfg := &SchedulingConfig{
+		Endpoints: map[string]string{
+			"/reports*":           classBulk,
+			"GET /reports_latest": classInteractive,
+		},
+		Subjects: map[string]string{"etl": classBulk},
+	}
+	cases := []struct {
+		method  string
+		path    string
+		subject string
+		want    string
+	}{
+		{http.MethodGet, "/items", "", classInteractive},
+		{http.MethodGet, "/items?format=csv", "", classBulk},
+		{http.MethodGet, "/items", "etl", classBulk},
+		{http.MethodGet, "/reports_2024", "", classBulk},
+		{http.MethodGet, "/reports_latest", "etl", classInteractive},
+		{http.MethodPost, "/reports_latest", "", classBulk},
+	}
+	for _, item := range cases {
+		r := httptest.NewRequest(item.method, item.path, nil)
+		if item.subject != "" {
+			r = withIdentity(r, &Identity{Subject: item.subject})
+		}
+		if got := cfg.priorityClass(r); got != item.want {
+			t.Fatalf("[%s %s %s] results not match\nGot : %s\nWant: %s", item.method, item.path, item.subject, got, item.want)
+		}
+	}
+
+	if err := checkScheduling(&SchedulingConfig{MaxConcurrent: 4, Subjects: map[string]string{"etl": "batch"}}); err == nil {
+		t.Fatalf("expected an error for an unknown class")
+	}
+}
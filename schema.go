@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// Schema is an immutable snapshot of the introspected tables. Refreshes build
+// a new snapshot and swap it in atomically, so a request always sees one
+// consistent version and never races with a reload.
+type Schema struct {
+	// Name is the Postgres schema the tables were loaded from.
+	Name   string
+	Tables map[string]*Table
+	// Functions are the stored functions POST /_rpc/{function} calls, nil
+	// when the store can't call any.
+	Functions map[string]*Function
+	// Estimates holds the planner's row count estimate per table, filled
+	// by the warm-up.
+	Estimates map[string]int64
+
+	prepared map[string]*sql.Stmt
+}
+
+func (s *Schema) TableNames() []string {
+	names := make([]string, 0, len(s.Tables))
+	for name := range s.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function is the cached metadata of a stored function, its input
+// arguments in declaration order.
+type Function struct {
+	Schema string
+	Name   string
+	Args   []*FunctionArg
+	// Columns are the OUT, INOUT and TABLE arguments, the columns of the
+	// rows the function returns that calls may filter and order by. They
+	// are empty for functions returning a single value or a table type.
+	Columns []*Column
+}
+
+// results is the table of the rows f returns, to filter and order them.
+func (f *Function) results() *Table {
+	return &Table{Schema: f.Schema, Name: f.Name, Columns: f.Columns}
+}
+
+// FunctionArg is an input argument of a function, typed as a column of
+// its type would be.
+type FunctionArg struct {
+	Column
+	// HasDefault is set for arguments a call may leave out.
+	HasDefault bool
+}
+
+// hasArg reports whether name is an input argument of f.
+func (f *Function) hasArg(name string) bool {
+	for _, arg := range f.Args {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Column is the cached metadata of a single table column.
+type Column struct {
+	Name     string
+	DataType string
+	// Type is the type as format_type renders it, qualified and quoted as
+	// needed, for casts: DataType reads "USER-DEFINED" or "ARRAY" for some.
+	Type string
+	// ElementType is the data type of the elements of an ARRAY column.
+	ElementType string
+	Nullable    bool
+	// Default is the column default expression, empty when there is none.
+	Default string
+	// Generated is set for serial and identity columns, whose values the
+	// database assigns on insert.
+	Generated bool
+	// Enum names the enum type of the column, whose labels EnumValues
+	// holds in their sort order; both are empty for other types.
+	Enum       string
+	EnumValues []string
+	// Comment is the COMMENT ON the column, empty when there is none.
+	Comment string
+	// MaxLength is the declared length of a character column, 0 when it
+	// has none.
+	MaxLength int
+}
+
+// typeName names the type of c as PostgreSQL does.
+func (c *Column) typeName() string {
+	switch {
+	case c.Enum != "":
+		return c.Enum
+	case c.DataType == "ARRAY":
+		return c.ElementType + "[]"
+	}
+	return c.DataType
+}
+
+// Table is the cached metadata of a table, columns in ordinal order.
+type Table struct {
+	Schema string
+	Name   string
+	// Kind is view or materialized_view for views, empty for tables.
+	Kind string
+	// ReadOnly is set for the views the database can't write through,
+	// materialized views included.
+	ReadOnly bool
+	// Comment is the COMMENT ON the table, empty when there is none.
+	Comment    string
+	Columns    []*Column
+	PrimaryKey []string
+	// ForeignKeys are the references to tables of the same schema.
+	ForeignKeys []*ForeignKey
+	// UniqueKeys are the unique constraints besides the primary key.
+	UniqueKeys []*UniqueKey
+	// Indexes are the indexes of the table, those of its constraints
+	// included.
+	Indexes []*Index
+}
+
+// UniqueKey is a unique constraint on Columns.
+type UniqueKey struct {
+	Name    string
+	Columns []string
+}
+
+// Index is an index on Columns; an expression takes the place of the
+// column it indexes.
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Primary bool
+}
+
+// ForeignKey is a reference from Columns to RefColumns of RefTable, in
+// matching order.
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	// OnDelete is the delete rule of the constraint: CASCADE, SET NULL,
+	// SET DEFAULT, RESTRICT or NO ACTION.
+	OnDelete string
+	// Declared is set for the relations of Config.Relations, which the
+	// database doesn't enforce.
+	Declared bool
+}
+
+// ref names the table in built statements.
+func (t *Table) ref() querybuilder.Table {
+	return querybuilder.Table{Schema: t.Schema, Name: t.Name}
+}
+
+// kind is Kind as the API reports it, table for tables.
+func (t *Table) kind() string {
+	if t.Kind == "" {
+		return "table"
+	}
+	return t.Kind
+}
+
+// projections selects columns of t, spatial ones as GeoJSON.
+func (t *Table) projections(columns []string) []querybuilder.Projection {
+	projections := querybuilder.Cols(columns...)
+	for i, name := range columns {
+		if column, ok := t.Column(name); ok && columnKind(column.DataType) == "geometry" {
+			projections[i] = querybuilder.AsGeoJSON{Column: name}
+		}
+	}
+	return projections
+}
+
+// buildSQL renders stmt for PostgreSQL, the database the explorer serves.
+func buildSQL(stmt querybuilder.Statement) (string, []interface{}) {
+	return querybuilder.Build(querybuilder.Postgres{}, stmt)
+}
+
+func (t *Table) Column(name string) (*Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// foreignKey returns the single-column foreign key on column.
+func (t *Table) foreignKey(column string) (*ForeignKey, bool) {
+	for _, fk := range t.ForeignKeys {
+		if len(fk.Columns) == 1 && fk.Columns[0] == column {
+			return fk, true
+		}
+	}
+	return nil, false
+}
+
+func (t *Table) ColumnNames() []string {
+	names := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func (de *DbExplorer) snapshot() *Schema {
+	return de.schema.Load()
+}
+
+// schemaKey carries the snapshot a request is served from.
+type schemaKey struct{}
+
+// requestSchema returns the snapshot of the request of ctx: the one served
+// when it came in, so that a reload while it runs doesn't change its tables
+// halfway. Outside of a request it is the current one.
+func (de *DbExplorer) requestSchema(ctx context.Context) *Schema {
+	if schema, ok := ctx.Value(schemaKey{}).(*Schema); ok {
+		return schema
+	}
+	return de.snapshot()
+}
+
+// activeSchema is the Postgres schema served at startup.
+func (de *DbExplorer) activeSchema() string {
+	if de.cfg.ActiveSchema != "" {
+		return de.cfg.ActiveSchema
+	}
+	return "public"
+}
+
+// loadSchema introspects the tables of the Postgres schema name into a new
+// snapshot without touching the one currently served.
+func (de *DbExplorer) loadSchema(name string) (*Schema, error) {
+	tables, err := de.backend.Introspect(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	tables = exposedTables(tables, de.cfg.ExposeTables, de.cfg.HideTables)
+	if err := declareRelations(tables, de.cfg.Relations); err != nil {
+		return nil, err
+	}
+	var functions map[string]*Function
+	if invoker, ok := de.backend.(invoker); ok {
+		if functions, err = invoker.Functions(context.Background(), name); err != nil {
+			return nil, err
+		}
+	}
+	return &Schema{Name: name, Tables: tables, Functions: functions}, nil
+}
+
+// declareRelations adds the relations of the configuration to the foreign
+// keys of tables. Relations of tables the schema lacks are left out, as the
+// configuration may cover several schemas.
+func declareRelations(tables map[string]*Table, relations map[string][]RelationConfig) error {
+	names := make([]string, 0, len(relations))
+	for name := range relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		table, ok := tables[name]
+		if !ok {
+			continue
+		}
+		for _, relation := range relations[name] {
+			ref, ok := tables[relation.References]
+			if !ok {
+				continue
+			}
+			refColumns := relation.RefColumns
+			if len(refColumns) == 0 {
+				refColumns = ref.PrimaryKey
+			}
+			if len(relation.Columns) == 0 || len(relation.Columns) != len(refColumns) {
+				return fmt.Errorf("relation of %s to %s: columns don't match the referenced columns", name, ref.Name)
+			}
+			for _, column := range relation.Columns {
+				if _, ok := table.Column(column); !ok {
+					return fmt.Errorf("relation of %s to %s: unknown column %s", name, ref.Name, column)
+				}
+			}
+			for _, column := range refColumns {
+				if _, ok := ref.Column(column); !ok {
+					return fmt.Errorf("relation of %s to %s: unknown column %s", name, ref.Name, column)
+				}
+			}
+			fk := &ForeignKey{
+				Name:       relation.Name,
+				Columns:    relation.Columns,
+				RefTable:   ref.Name,
+				RefColumns: refColumns,
+				Declared:   true,
+			}
+			if fk.Name == "" {
+				fk.Name = name + "_" + strings.Join(relation.Columns, "_") + "_declared"
+			}
+			table.ForeignKeys = append(table.ForeignKeys, fk)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// schemaVersion is the API surface of a served schema snapshot: the column
+// types per table.
+type schemaVersion struct {
+	At     time.Time                    `json:"at"`
+	Schema string                       `json:"schema"`
+	Tables map[string]map[string]string `json:"tables"`
+}
+
+// schemaChange is a difference between consecutive schema versions.
+type schemaChange struct {
+	At     time.Time `json:"at"`
+	Schema string    `json:"schema"`
+	// Change is table_added, table_removed, column_added, column_removed
+	// or column_type_changed.
+	Change string `json:"change"`
+	Table  string `json:"table"`
+	Column string `json:"column,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// PreviousType is the type a column_type_changed column had.
+	PreviousType string `json:"previous_type,omitempty"`
+}
+
+// schemaHistory keeps the versions of the schema served, in the file of
+// Config.SchemaHistory when there is one so it outlives restarts.
+type schemaHistory struct {
+	path string
+
+	mu       sync.Mutex
+	versions []schemaVersion
+}
+
+func loadSchemaHistory(path string) (*schemaHistory, error) {
+	history := &schemaHistory{path: path}
+	if path == "" {
+		return history, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &history.versions); err != nil {
+		return nil, fmt.Errorf("parsing schema history: %v", err)
+	}
+	return history, nil
+}
+
+// record adds schema as the latest version unless its surface is the one
+// of the latest already, so restarts and reloads of an unchanged schema
+// don't add any.
+func (h *schemaHistory) record(schema *Schema, at time.Time) error {
+	version := schemaVersion{At: at.UTC(), Schema: schema.Name, Tables: make(map[string]map[string]string, len(schema.Tables))}
+	for name, table := range schema.Tables {
+		columns := make(map[string]string, len(table.Columns))
+		for _, column := range table.Columns {
+			columns[column.Name] = column.typeName()
+		}
+		version.Tables[name] = columns
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n := len(h.versions); n > 0 && h.versions[n-1].Schema == version.Schema && reflect.DeepEqual(h.versions[n-1].Tables, version.Tables) {
+		return nil
+	}
+	h.versions = append(h.versions, version)
+	if h.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(h.versions)
+	if err != nil {
+		return err
+	}
+	// Write aside and rename, so a crash never leaves half a history.
+	if err := os.WriteFile(h.path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(h.path+".tmp", h.path)
+}
+
+// changes lists the differences between consecutive versions recorded
+// after since, oldest first, and when the history starts.
+func (h *schemaHistory) changes(since time.Time) ([]schemaChange, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes := []schemaChange{}
+	if len(h.versions) == 0 {
+		return changes, time.Time{}
+	}
+	for i := 1; i < len(h.versions); i++ {
+		if h.versions[i].At.After(since) {
+			changes = append(changes, diffVersions(h.versions[i-1], h.versions[i])...)
+		}
+	}
+	return changes, h.versions[0].At
+}
+
+// diffVersions lists what changed from previous to next, by table and
+// column name.
+func diffVersions(previous, next schemaVersion) []schemaChange {
+	var changes []schemaChange
+	change := func(kind, table, column, typ, previousType string) {
+		changes = append(changes, schemaChange{next.At, next.Schema, kind, table, column, typ, previousType})
+	}
+	var tables []string
+	for table := range previous.Tables {
+		tables = append(tables, table)
+	}
+	for table := range next.Tables {
+		tables = append(tables, table)
+	}
+	for _, table := range distinctSorted(tables) {
+		before, existed := previous.Tables[table]
+		after, exists := next.Tables[table]
+		switch {
+		case !existed:
+			change("table_added", table, "", "", "")
+			continue
+		case !exists:
+			change("table_removed", table, "", "", "")
+			continue
+		}
+		var columns []string
+		for column := range before {
+			columns = append(columns, column)
+		}
+		for column := range after {
+			columns = append(columns, column)
+		}
+		for _, column := range distinctSorted(columns) {
+			was, existed := before[column]
+			is, exists := after[column]
+			switch {
+			case !existed:
+				change("column_added", table, column, is, "")
+			case !exists:
+				change("column_removed", table, column, "", was)
+			case was != is:
+				change("column_type_changed", table, column, is, was)
+			}
+		}
+	}
+	return changes
+}
+
+// distinctSorted returns the names of list in order, each once.
+func distinctSorted(list []string) []string {
+	sort.Strings(list)
+	var names []string
+	for i, name := range list {
+		if i == 0 || name != list[i-1] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// recordSchema adds schema, just swapped in, to the history. A history
+// that can't be written is only logged: the schema is served regardless.
+func (de *DbExplorer) recordSchema(schema *Schema) {
+	if de.history == nil {
+		return
+	}
+	if err := de.history.record(schema, time.Now()); err != nil {
+		log.Printf("schema history: %v", err)
+	}
+}
+
+// handleSchemaChanges serves GET /_schema/changes, the tables and columns
+// added, removed or retyped in the schemas served, oldest first, for client
+// teams following the API surface. ?since= (a date or an RFC 3339 time)
+// leaves out earlier changes; tracked_since is when the history starts.
+func (de *DbExplorer) handleSchemaChanges(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = parseDateTime(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "since must be a date or an RFC 3339 time")
+			return
+		}
+	}
+	changes, start := []schemaChange{}, time.Time{}
+	if de.history != nil {
+		changes, start = de.history.changes(since)
+	}
+	var tracked interface{}
+	if !start.IsZero() {
+		tracked = start
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"tracked_since": tracked,
+			"changes":       changes,
+		},
+	}, false)
+}
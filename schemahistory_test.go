@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchemaHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	history, err := loadSchemaHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	schema := fuzzSchema()
+	for _, d := range []int{1, 2} {
+		if err := history.record(schema, day(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// order_items is dropped, items gains a column and retypes another.
+	changed := &Schema{Name: schema.Name, Tables: map[string]*Table{}}
+	for name, table := range schema.Tables {
+		if name != "order_items" {
+			changed.Tables[name] = table
+		}
+	}
+	items := *schema.Tables["items"]
+	items.Columns = append([]*Column{}, items.Columns...)
+	for i, column := range items.Columns {
+		if column.Name == "title" {
+			retyped := *column
+			retyped.DataType = "text"
+			items.Columns[i] = &retyped
+		}
+	}
+	items.Columns = append(items.Columns, &Column{Name: "archived", DataType: "boolean"})
+	changed.Tables["items"] = &items
+	if err := history.record(changed, day(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The history outlives the process through its file.
+	reloaded, err := loadSchemaHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, start := reloaded.changes(time.Time{})
+	want := []schemaChange{
+		{At: day(3), Schema: "public", Change: "column_added", Table: "items", Column: "archived", Type: "boolean"},
+		{At: day(3), Schema: "public", Change: "column_type_changed", Table: "items", Column: "title", Type: "text", PreviousType: "character varying"},
+		{At: day(3), Schema: "public", Change: "table_removed", Table: "order_items"},
+	}
+	if !reflect.DeepEqual(changes, want) || !start.Equal(day(1)) {
+		t.Fatalf("results not match\nGot : %v %+v\nWant: %v %+v", start, changes, day(1), want)
+	}
+	if changes, _ := reloaded.changes(day(3)); len(changes) != 0 {
+		t.Fatalf("results not match\nGot : %+v\nWant: none after the last version", changes)
+	}
+
+	de := backendExplorer(&fakeStore{})
+	de.history = reloaded
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_schema/changes?since=2024-03-02", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tracked_since":"2024-03-01T00:00:00Z"`) || !strings.Contains(w.Body.String(), `"change":"table_removed","table":"order_items"`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusOK)
+	}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_schema/changes?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleAdminSchema reports the active Postgres schema on GET and switches it
+// on POST {"schema": "app_v2"}, for blue/green cutovers of expand/contract
+// migrations. The new schema is introspected completely before the swap, so
+// requests see either the old or the new snapshot, never a mix. In "fail"
+// drift mode a schema that doesn't satisfy the manifest is refused.
+func (de *DbExplorer) handleAdminSchema(w http.ResponseWriter, r *http.Request) {
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var request struct {
+			Schema string `json:"schema"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Schema == "" {
+			writeError(w, http.StatusBadRequest, "expected {\"schema\": name}")
+			return
+		}
+		schema, err := de.loadSchema(request.Schema)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(schema.Tables) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("schema %s has no tables", request.Schema))
+			return
+		}
+		if de.cfg.SchemaManifest != "" && de.cfg.SchemaDriftMode == "fail" {
+			manifest, err := loadSchemaManifest(de.cfg.SchemaManifest)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if drift := schemaDrift(schema, manifest); len(drift) > 0 {
+				writeError(w, http.StatusConflict, "schema does not match manifest: "+strings.Join(drift, ", "))
+				return
+			}
+		}
+		if de.cfg.WarmUp {
+			if err := de.warmUp(r.Context(), schema); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		previous := de.schema.Swap(schema)
+		previous.retire()
+		de.recordSchema(schema)
+		de.announceSchema(r.Context(), schema.Name)
+		audit("schema_switched", r, map[string]interface{}{"from": previous.Name, "to": schema.Name})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	current := de.snapshot()
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"schema": current.Name,
+			"tables": current.TableNames(),
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// schemasStore serves the tables of fuzzSchema in public and app_v2 only.
+type schemasStore struct {
+	fakeStore
+}
+
+func (s *schemasStore) Introspect(ctx context.Context, schema string) (map[string]*Table, error) {
+	if schema != "public" && schema != "app_v2" {
+		return map[string]*Table{}, nil
+	}
+	tables := fuzzSchema().Tables
+	if schema == "app_v2" {
+		delete(tables, `we"ird`)
+	}
+	for _, table := range tables {
+		table.Schema = schema
+	}
+	return tables, nil
+}
+
+func TestAdminSchema(t *testing.T) {
+	de := backendExplorer(&schemasStore{})
+	de.cfg.Auth.Roles = map[string][]Permission{"*": {{Table: "*", Actions: []string{actionRead}}}}
+	switchTo := func(schema string, roles ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/_admin/schema", strings.NewReader(`{"schema": "`+schema+`"}`))
+		w := httptest.NewRecorder()
+		de.route(w, withIdentity(r, &Identity{Subject: "ann", Roles: roles}))
+		return w
+	}
+
+	// Only admins may look at or switch the schema.
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		r := httptest.NewRequest(method, "/_admin/schema", strings.NewReader(`{"schema": "app_v2"}`))
+		w := httptest.NewRecorder()
+		de.route(w, withIdentity(r, &Identity{Subject: "ann", Roles: []string{"analyst"}}))
+		if w.Code != http.StatusForbidden || de.snapshot().Name != "public" {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d", method, w.Code, w.Body, http.StatusForbidden)
+		}
+	}
+
+	cases := []struct {
+		schema string
+		code   int
+		body   string
+	}{
+		{"", http.StatusBadRequest, `expected {\"schema\": name}`},
+		{"app_v3", http.StatusBadRequest, "schema app_v3 has no tables"},
+		{"app_v2", http.StatusOK, `{"response":{"schema":"app_v2","tables":["items","order_items"]}}`},
+	}
+	for _, item := range cases {
+		w := switchTo(item.schema, "admin")
+		if w.Code != item.code || !strings.Contains(w.Body.String(), item.body) {
+			t.Fatalf("[%s] results not match\nGot : %d %s\nWant: %d %s", item.schema, w.Code, w.Body, item.code, item.body)
+		}
+	}
+	if schema := de.snapshot(); schema.Name != "app_v2" || schema.Tables["items"].Schema != "app_v2" {
+		t.Fatalf("results not match\nGot : %s\nWant: app_v2 served", schema.Name)
+	}
+
+	// In fail mode a schema drifting from the manifest is refused.
+	de.cfg.SchemaManifest = writeManifest(t, `{"tables": {"we\"ird": ["i'd"]}}`)
+	de.cfg.SchemaDriftMode = "fail"
+	if w := switchTo("app_v2", "admin"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `missing table we\"ird`) {
+		t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, http.StatusConflict)
+	}
+	if w := switchTo("public", "admin"); w.Code != http.StatusOK || de.snapshot().Name != "public" {
+		t.Fatalf("results not match\nGot : %d %s\nWant: public served", w.Code, w.Body)
+	}
+}
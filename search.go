@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// searchColumns returns the columns searched in table: the ones configured
+// in Config.Search, otherwise every unencrypted text column.
+func (de *DbExplorer) searchColumns(table *Table) ([]string, error) {
+	if configured, ok := de.cfg.Search[table.Name]; ok {
+		for _, name := range configured {
+			if _, ok := table.Column(name); !ok {
+				return nil, fmt.Errorf("search column %s.%s does not exist", table.Name, name)
+			}
+		}
+		return configured, nil
+	}
+	var names []string
+	for _, column := range table.Columns {
+		switch column.DataType {
+		case "text", "character varying", "character":
+			if !de.isEncrypted(table.Name, column.Name) {
+				names = append(names, column.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// handleSearch serves GET /{table}/_search?q=..., a full-text search over the
+// search columns ranked by ts_rank. Pagination, ?fields= and column filters
+// work as in the table listing; every record carries its "_rank".
+func (de *DbExplorer) handleSearch(w http.ResponseWriter, r *http.Request, table *Table) {
+	params := r.URL.Query()
+	text := params.Get("q")
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "missing q")
+		return
+	}
+	params.Del("q")
+
+	columns, err := de.searchColumns(table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(columns) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("table %s has no text columns to search", table.Name))
+		return
+	}
+
+	limit, offset, err := pagination(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := table.selectFields(params.Get("fields"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filters, err := de.whereClause(table, params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := querybuilder.Select{
+		Columns: append(table.projections(fields), querybuilder.Rank{Columns: columns, Query: text, As: "_rank"}),
+		From:    table.ref(),
+		Where:   append(querybuilder.And{querybuilder.TextSearch{Columns: columns, Query: text}}, filters...),
+		OrderBy: []querybuilder.Sort{{Column: "_rank", Desc: true}},
+		Page:    &querybuilder.Page{Limit: limit, Offset: offset},
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := de.checkQueryCost(ctx, query); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	records, err := de.selectRecords(ctx, table, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), int64(len(records)))
+	if records == nil {
+		records = []map[string]interface{}{}
+	}
+
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"records": records,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
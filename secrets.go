@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// resolveSecret turns a secret reference into its value. Supported forms are
+// "env:NAME", "file:/path" (Docker/K8s secrets) and "vault:path#field" for a
+// Vault KV v2 secret read with VAULT_ADDR and VAULT_TOKEN. Anything else is
+// returned unchanged.
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(ref, "vault:"):
+		return readVaultSecret(strings.TrimPrefix(ref, "vault:"))
+	}
+	return ref, nil
+}
+
+func readVaultSecret(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok {
+		return "", fmt.Errorf("vault reference %q has no #field", ref)
+	}
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	value, ok := body.Data.Data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+	return value, nil
+}
+
+// buildDSN resolves the configured DSN and password references. Without a
+// configured dsn, EXPLORER_DSN from the environment takes precedence over
+// fallback.
+func buildDSN(cfg *Config, fallback string) (string, error) {
+	dsn := fallback
+	if env := os.Getenv("EXPLORER_DSN"); env != "" {
+		dsn = env
+	}
+	if cfg.DSN != "" {
+		resolved, err := resolveSecret(cfg.DSN)
+		if err != nil {
+			return "", err
+		}
+		dsn = resolved
+	}
+	password := ""
+	if cfg.DBPassword != "" {
+		var err error
+		if password, err = resolveSecret(cfg.DBPassword); err != nil {
+			return "", err
+		}
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return buildURLDSN(cfg, dsn, password)
+	}
+	if password != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+		dsn += fmt.Sprintf(" password='%s'", escaped)
+	}
+	if cfg.PgBouncer {
+		// Sends parameters with the query in one round trip instead of a
+		// separate prepare, which PgBouncer may route to another backend.
+		dsn += " binary_parameters=yes"
+	}
+	return dsn, nil
+}
+
+// buildURLDSN is buildDSN for a postgres:// URL, whose password goes in its
+// user info and settings in its query.
+func buildURLDSN(cfg *Config, dsn, password string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid database URL: %v", err)
+	}
+	if password != "" {
+		u.User = url.UserPassword(u.User.Username(), password)
+	}
+	if cfg.PgBouncer {
+		query := u.Query()
+		query.Set("binary_parameters", "yes")
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// rotatingConnector dials with the most recently resolved DSN, so rotated
+// credentials are picked up by new connections without reopening the pool.
+type rotatingConnector struct {
+	mu  sync.RWMutex
+	dsn string
+	// retiring is set for the refresh after a rotation, while connections
+	// of the old credentials age out.
+	retiring bool
+}
+
+func newRotatingConnector(dsn string) *rotatingConnector {
+	return &rotatingConnector{dsn: dsn}
+}
+
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := pq.NewConnector(c.currentDSN())
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// currentDSN returns the DSN with the latest credentials.
+func (c *rotatingConnector) currentDSN() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dsn
+}
+
+func (c *rotatingConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// watchSecrets refreshes the credentials of db every interval.
+func (c *rotatingConnector) watchSecrets(db *sql.DB, cfg *Config, fallback string, interval time.Duration) {
+	for range time.Tick(interval) {
+		c.refresh(db, cfg, fallback, interval)
+	}
+}
+
+// refresh re-resolves the DSN. When it changed, the idle connections of db
+// are closed and the ones in use are retired by a ConnMaxLifetime of
+// interval, which the next refresh lifts again once they have aged out: the
+// pool otherwise keeps its connections indefinitely.
+func (c *rotatingConnector) refresh(db *sql.DB, cfg *Config, fallback string, interval time.Duration) {
+	dsn, err := buildDSN(cfg, fallback)
+	if err != nil {
+		log.Printf("refreshing database credentials: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	changed := dsn != c.dsn
+	retiring := c.retiring
+	c.dsn, c.retiring = dsn, changed
+	c.mu.Unlock()
+
+	switch {
+	case changed:
+		log.Printf("database credentials changed, rebuilding connection pool")
+		db.SetMaxIdleConns(0)
+		db.SetConnMaxLifetime(interval)
+		db.SetMaxIdleConns(defaultIdleConns)
+	case retiring:
+		db.SetConnMaxLifetime(0)
+	}
+}
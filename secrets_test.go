@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConnector opens connections that only count how many were closed
+// and answer pings with ping.
+type countingConnector struct {
+	closed int32
+	ping   error
+}
+
+type countingConn struct{ connector *countingConnector }
+
+func (c *countingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &countingConn{c}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver { return nil }
+
+func (c *countingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+
+func (c *countingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *countingConn) Ping(context.Context) error { return c.connector.ping }
+
+func (c *countingConn) Close() error {
+	atomic.AddInt32(&c.connector.closed, 1)
+	return nil
+}
+
+func TestSecretRotation(t *testing.T) {
+	counter := &countingConnector{}
+	db := sql.OpenDB(counter)
+	defer db.Close()
+	db.SetMaxIdleConns(defaultIdleConns)
+	connect := func() *sql.Conn {
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	closed := func(want int32) {
+		t.Helper()
+		if got := atomic.LoadInt32(&counter.closed); got != want {
+			t.Fatalf("results not match\nGot : %d connections closed\nWant: %d", got, want)
+		}
+	}
+
+	t.Setenv("TEST_EXPLORER_DSN", "user=explorer password=old")
+	cfg := &Config{DSN: "env:TEST_EXPLORER_DSN"}
+	connector := newRotatingConnector("user=explorer password=old")
+	const interval = 20 * time.Millisecond
+
+	busy, idle := connect(), connect()
+	idle.Close()
+	connector.refresh(db, cfg, "", interval)
+	closed(0)
+
+	// A rotation closes the idle connection right away and the busy one
+	// once it's returned after having aged out.
+	t.Setenv("TEST_EXPLORER_DSN", "user=explorer password=new")
+	connector.refresh(db, cfg, "", interval)
+	if got := connector.currentDSN(); got != "user=explorer password=new" {
+		t.Fatalf("results not match\nGot : %s\nWant: the new credentials", got)
+	}
+	closed(1)
+	time.Sleep(2 * interval)
+	busy.Close()
+	closed(2)
+
+	// The next refresh lifts the lifetime again.
+	connector.refresh(db, cfg, "", interval)
+	fresh := connect()
+	time.Sleep(2 * interval)
+	fresh.Close()
+	connect().Close()
+	closed(2)
+
+	// Credentials that can't be resolved leave the current ones in place.
+	cfg.DSN = "env:TEST_EXPLORER_MISSING"
+	connector.refresh(db, cfg, "", interval)
+	if got := connector.currentDSN(); got != "user=explorer password=new" {
+		t.Fatalf("results not match\nGot : %s\nWant: the last credentials kept", got)
+	}
+}
+
+func TestBuildDSN(t *testing.T) {
+	t.Setenv("EXPLORER_DSN", "")
+	t.Setenv("TEST_EXPLORER_PASSWORD", `s3cr'et/@:x`)
+	cases := []struct {
+		dsn  string
+		cfg  Config
+		want string
+	}{
+		{"user=explorer", Config{DBPassword: "env:TEST_EXPLORER_PASSWORD"}, `user=explorer password='s3cr\'et/@:x'`},
+		{"user=explorer", Config{PgBouncer: true}, "user=explorer binary_parameters=yes"},
+		{"postgres://explorer@db:5432/app?sslmode=disable", Config{DBPassword: "env:TEST_EXPLORER_PASSWORD"}, "postgres://explorer:s3cr%27et%2F%40%3Ax@db:5432/app?sslmode=disable"},
+		{"postgresql://explorer:old@db/app", Config{DBPassword: "env:TEST_EXPLORER_PASSWORD", PgBouncer: true}, "postgresql://explorer:s3cr%27et%2F%40%3Ax@db/app?binary_parameters=yes"},
+	}
+	for _, item := range cases {
+		got, err := buildDSN(&item.cfg, item.dsn)
+		if err != nil || got != item.want {
+			t.Fatalf("[%s] results not match\nGot : %s %v\nWant: %s", item.dsn, got, err, item.want)
+		}
+	}
+	// The password read back from the URL is the one configured.
+	got, _ := buildDSN(&Config{DBPassword: "env:TEST_EXPLORER_PASSWORD"}, "postgres://explorer@db/app")
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password, _ := u.User.Password(); password != `s3cr'et/@:x` {
+		t.Fatalf("results not match\nGot : %q\nWant: %q", password, `s3cr'et/@:x`)
+	}
+}
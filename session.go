@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "explorer_session"
+
+// session is a logged-in browser, identified by a random cookie value.
+type session struct {
+	identity *Identity
+	expires  time.Time
+	// csrf must accompany every mutating request made with the session.
+	csrf string
+}
+
+// sessionStore keeps browser sessions in memory.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*session)}
+}
+
+func randomToken(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (s *sessionStore) create(id *Identity, ttl time.Duration) (string, *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for token, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, token)
+		}
+	}
+	token := randomToken(32)
+	sess := &session{identity: id, expires: now.Add(ttl), csrf: randomToken(32)}
+	s.sessions[token] = sess
+	return token, sess
+}
+
+func (s *sessionStore) get(token string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, token)
+		return nil
+	}
+	return sess
+}
+
+func (s *sessionStore) delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+// sessionFromRequest returns the session of the request cookie, if any.
+func (de *DbExplorer) sessionFromRequest(r *http.Request) (string, *session) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", nil
+	}
+	return cookie.Value, de.sessions.get(cookie.Value)
+}
+
+// sessionAuthenticator authenticates browsers by their session cookie.
+func (de *DbExplorer) sessionAuthenticator() Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		if _, sess := de.sessionFromRequest(r); sess != nil {
+			return sess.identity, nil
+		}
+		return nil, nil
+	})
+}
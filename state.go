@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SharedStore holds the state replicas must agree on: lockout and quota
+// counters, idempotency keys and cache invalidations. A single instance uses
+// the in-memory store; replicas share one through Redis.
+type SharedStore interface {
+	// IncrBy adds delta to the counter at key and returns the new value. A
+	// positive ttl (re)sets the key's expiry.
+	IncrBy(ctx context.Context, key string, delta float64, ttl time.Duration) (float64, error)
+	// Get returns the value at key; ok is false when it doesn't exist.
+	Get(ctx context.Context, key string) (value string, ok bool, err error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX stores value only if key doesn't exist and reports whether it did.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, keys ...string) error
+	// Publish sends message to every subscriber of channel, on all replicas.
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe calls handle for each message on channel until ctx is done.
+	Subscribe(ctx context.Context, channel string, handle func(message string)) error
+}
+
+// SharedStateConfig points the replicas at their shared Redis.
+type SharedStateConfig struct {
+	// RedisURL is a secret reference to a redis:// or rediss:// URL.
+	RedisURL string `json:"redis_url"`
+	// Prefix namespaces the keys, so deployments can share a Redis.
+	Prefix string `json:"prefix"`
+}
+
+func newSharedStore(cfg *SharedStateConfig) (SharedStore, error) {
+	if cfg == nil || cfg.RedisURL == "" {
+		return newMemoryStore(), nil
+	}
+	raw, err := resolveSecret(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := redis.ParseURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "explorer:"
+	}
+	return &redisStore{client: redis.NewClient(opts), prefix: prefix}, nil
+}
+
+// memoryStore is the SharedStore of a single replica.
+type memoryStore struct {
+	mu          sync.Mutex
+	values      map[string]memoryValue
+	subscribers map[string][]chan string
+}
+
+type memoryValue struct {
+	value   string
+	expires time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: make(map[string]memoryValue), subscribers: make(map[string][]chan string)}
+}
+
+// lookup returns the live value at key, dropping it when expired. Callers
+// must hold mu.
+func (m *memoryStore) lookup(key string) (memoryValue, bool) {
+	v, ok := m.values[key]
+	if ok && !v.expires.IsZero() && time.Now().After(v.expires) {
+		delete(m.values, key)
+		return memoryValue{}, false
+	}
+	return v, ok
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (m *memoryStore) IncrBy(ctx context.Context, key string, delta float64, ttl time.Duration) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, _ := m.lookup(key)
+	n, _ := strconv.ParseFloat(v.value, 64)
+	n += delta
+	v.value = strconv.FormatFloat(n, 'f', -1, 64)
+	if ttl > 0 {
+		v.expires = expiry(ttl)
+	}
+	m.values[key] = v
+	return n, nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.lookup(key)
+	return v.value, ok, nil
+}
+
+func (m *memoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = memoryValue{value, expiry(ttl)}
+	return nil
+}
+
+func (m *memoryStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lookup(key); ok {
+		return false, nil
+	}
+	m.values[key] = memoryValue{value, expiry(ttl)}
+	return true, nil
+}
+
+func (m *memoryStore) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.values, key)
+	}
+	return nil
+}
+
+func (m *memoryStore) Publish(ctx context.Context, channel, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subscribers[channel] {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Subscribe(ctx context.Context, channel string, handle func(message string)) error {
+	ch := make(chan string, 16)
+	m.mu.Lock()
+	m.subscribers[channel] = append(m.subscribers[channel], ch)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		subs := m.subscribers[channel]
+		for i, sub := range subs {
+			if sub == ch {
+				m.subscribers[channel] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message := <-ch:
+			handle(message)
+		}
+	}
+}
+
+// redisStore shares state between replicas through Redis.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func (s *redisStore) IncrBy(ctx context.Context, key string, delta float64, ttl time.Duration) (float64, error) {
+	key = s.prefix + key
+	pipe := s.client.TxPipeline()
+	incr := pipe.IncrByFloat(ctx, key, delta)
+	if ttl > 0 {
+		pipe.PExpire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+func (s *redisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *redisStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+key, value, ttl).Result()
+}
+
+func (s *redisStore) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+func (s *redisStore) Publish(ctx context.Context, channel, message string) error {
+	return s.client.Publish(ctx, s.prefix+channel, message).Err()
+}
+
+func (s *redisStore) Subscribe(ctx context.Context, channel string, handle func(message string)) error {
+	sub := s.client.Subscribe(ctx, s.prefix+channel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			handle(message.Payload)
+		}
+	}
+}
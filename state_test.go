@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	if n, _ := store.IncrBy(ctx, "c", 1.5, time.Minute); n != 1.5 {
+		t.Fatalf("results not match\nGot : %v\nWant: 1.5", n)
+	}
+	if n, _ := store.IncrBy(ctx, "c", 2, 0); n != 3.5 {
+		t.Fatalf("results not match\nGot : %v\nWant: 3.5", n)
+	}
+	if ok, _ := store.SetNX(ctx, "k", "a", time.Minute); !ok {
+		t.Fatalf("expected first SetNX to succeed")
+	}
+	if ok, _ := store.SetNX(ctx, "k", "b", time.Minute); ok {
+		t.Fatalf("expected second SetNX to fail")
+	}
+	store.Set(ctx, "gone", "x", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := store.Get(ctx, "gone"); ok {
+		t.Fatalf("expected expired key to be gone")
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	de := &DbExplorer{cfg: &Config{}, store: newMemoryStore()}
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"response":{"id":3}}`))
+	}
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("PUT", "/items", strings.NewReader(`{"title":"a"}`))
+		r.Header.Set(idempotencyHeader, "abc")
+		w := httptest.NewRecorder()
+		de.idempotent(w, r, handler)
+		if w.Code != http.StatusOK || w.Body.String() != `{"response":{"id":3}}` {
+			t.Fatalf("attempt %d: unexpected response %d %s", i, w.Code, w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("results not match\nGot : %d calls\nWant: 1", calls)
+	}
+
+	// The key can't replay the response to another request.
+	for _, r := range []*http.Request{
+		httptest.NewRequest("PUT", "/items", strings.NewReader(`{"title":"b"}`)),
+		httptest.NewRequest("PUT", "/orders", strings.NewReader(`{"title":"a"}`)),
+		httptest.NewRequest("POST", "/items", strings.NewReader(`{"title":"a"}`)),
+	} {
+		r.Header.Set(idempotencyHeader, "abc")
+		w := httptest.NewRecorder()
+		de.idempotent(w, r, handler)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("[%s %s] expected a 422 for a reused key, got %d %s", r.Method, r.URL, w.Code, w.Body)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("results not match\nGot : %d calls\nWant: 1", calls)
+	}
+
+	de.store.Set(context.Background(), "idempotency:anonymous:busy", idempotencyPending, time.Minute)
+	r := httptest.NewRequest("PUT", "/items", nil)
+	r.Header.Set(idempotencyHeader, "busy")
+	w := httptest.NewRecorder()
+	de.idempotent(w, r, handler)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected a 409 while the first attempt is pending, got %d", w.Code)
+	}
+}
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"db_explorer/internal/querybuilder"
+	"github.com/lib/pq"
+)
+
+// Records reads and writes the rows of tables. Statements are syntax trees
+// rather than SQL, so a backend renders them in its own dialect or doesn't
+// use SQL at all.
+type Records interface {
+	// Select calls each with every row of query, as a column → value map,
+	// until each returns an error.
+	Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error
+	// Insert returns the Returning values of every inserted row.
+	Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error)
+	// Update and Delete return the number of affected rows.
+	Update(ctx context.Context, update querybuilder.Update) (int64, error)
+	Delete(ctx context.Context, del querybuilder.Delete) (int64, error)
+}
+
+// Store is the database behind the explorer. The default one works through
+// database/sql; Config.Backend plugs in another.
+type Store interface {
+	Records
+	// ListTables returns the names of the tables in schema.
+	ListTables(ctx context.Context, schema string) ([]string, error)
+	// Introspect returns the tables of schema with their columns, primary
+	// keys and foreign keys.
+	Introspect(ctx context.Context, schema string) (map[string]*Table, error)
+	// Begin starts a transaction.
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Tx is a transaction; its statements see each other's changes and take
+// effect together on Commit.
+type Tx interface {
+	Records
+	Commit() error
+	Rollback() error
+}
+
+// costEstimator is implemented by stores that can estimate a query, a
+// Select or an Invoke, before running it, which the query limits need.
+type costEstimator interface {
+	EstimateCost(ctx context.Context, query querybuilder.Statement) (cost, rows float64, err error)
+}
+
+// poolResetter is implemented by stores with a connection pool of their
+// own, which ResetPool flushes: idle connections are closed at once, those
+// in use when they are released.
+type poolResetter interface {
+	ResetPool()
+}
+
+// refresher is implemented by stores that can refresh materialized views.
+type refresher interface {
+	Refresh(ctx context.Context, refresh querybuilder.Refresh) error
+}
+
+// invoker is implemented by stores that can call the stored functions of
+// a schema. Functions lists those a call can name unambiguously: overloaded
+// functions and those with unnamed or variadic arguments are left out.
+// Invoke calls each with every row the function returns.
+type invoker interface {
+	Functions(ctx context.Context, schema string) (map[string]*Function, error)
+	Invoke(ctx context.Context, call querybuilder.Invoke, each func(record map[string]interface{}) error) error
+}
+
+// readOnlyQuerier is implemented by stores that run SQL written by the
+// caller, which POST /_query needs. ReadOnlyQuery runs query in a read-only
+// transaction, a savepoint of the session if there is one, and calls each
+// with the values of every row until it returns an error. The names of the
+// columns are returned also when each stopped the query.
+type readOnlyQuerier interface {
+	ReadOnlyQuery(ctx context.Context, query string, args []interface{}, each func(values []interface{}) error) ([]string, error)
+}
+
+// cataloger is implemented by stores that read the statistics and comments
+// of tables from the database catalog, which GET /?detail=full shows.
+type cataloger interface {
+	Catalog(ctx context.Context, schema string) (map[string]TableStats, error)
+}
+
+// TableStats is what the catalog knows about a table.
+type TableStats struct {
+	// Rows is the planner's row estimate, -1 when the table was never
+	// analyzed or is a view.
+	Rows int64
+	// Size is the disk space of the table with its indexes and TOAST data,
+	// in bytes.
+	Size    int64
+	Comment string
+}
+
+// copier is implemented by stores that load rows faster than INSERT can,
+// e.g. through COPY. next returns the rows to load, then a nil row; the
+// rows are loaded together or, on error, not at all.
+type copier interface {
+	CopyRows(ctx context.Context, table querybuilder.Table, columns []string, next func() ([]interface{}, error)) (int64, error)
+}
+
+// sessioner is implemented by stores that can run every statement of a
+// request in one transaction with its own settings. Statements whose
+// context is the returned one run in it; Begin nests a savepoint.
+type sessioner interface {
+	Session(ctx context.Context, options sessionOptions) (context.Context, Tx, error)
+}
+
+// sessionOptions are the isolation level of a session, empty for the
+// server default, and the settings applied to it in order.
+type sessionOptions struct {
+	isolation string
+	settings  []sessionSetting
+}
+
+type sessionSetting struct {
+	name, value string
+}
+
+// sessionKey carries the transaction of a session in a context, as the
+// store's own transaction type.
+type sessionKey struct{}
+
+// setLocal applies a setting for the rest of the transaction: it is SET
+// LOCAL taking the name and value as parameters.
+const setLocal = "SELECT set_config($1, $2, true)"
+
+// queryer is what *sql.DB and *sql.Tx have in common.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlRecords runs statements through database/sql as PostgreSQL.
+type sqlRecords struct {
+	conn queryer
+	// prepared returns the statement prepared for a query, if any.
+	prepared func(query string) (*sql.Stmt, bool)
+}
+
+func (s sqlRecords) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	sqlQuery, args := buildSQL(query)
+	var rows *sql.Rows
+	var err error
+	if stmt, ok := s.prepared(sqlQuery); ok {
+		rows, err = stmt.QueryContext(ctx, args...)
+	} else {
+		rows, err = s.conn.QueryContext(ctx, sqlQuery, args...)
+	}
+	if err != nil {
+		return err
+	}
+	return scanRecords(rows, each)
+}
+
+func (s sqlRecords) Invoke(ctx context.Context, call querybuilder.Invoke, each func(record map[string]interface{}) error) error {
+	query, args := buildSQL(call)
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return scanRecords(rows, each)
+}
+
+// scanRecords calls each with every row of rows, as a column → value map,
+// and closes them.
+func scanRecords(rows *sql.Rows, each func(record map[string]interface{}) error) error {
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			record[column.Name()] = jsonValue(column.DatabaseTypeName(), values[i])
+		}
+		if err := each(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s sqlRecords) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	query, args := buildSQL(insert)
+	if len(insert.Returning) == 0 {
+		_, err := s.conn.ExecContext(ctx, query, args...)
+		return nil, err
+	}
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	var returned [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(insert.Returning))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, column := range columns {
+			values[i] = jsonValue(column.DatabaseTypeName(), values[i])
+		}
+		returned = append(returned, values)
+	}
+	return returned, rows.Err()
+}
+
+func (s sqlRecords) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	return s.exec(ctx, update)
+}
+
+func (s sqlRecords) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	return s.exec(ctx, del)
+}
+
+func (s sqlRecords) exec(ctx context.Context, stmt querybuilder.Statement) (int64, error) {
+	query, args := buildSQL(stmt)
+	result, err := s.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// sqlStore is the Store of a PostgreSQL database.
+type sqlStore struct {
+	sqlRecords
+	db *sql.DB
+}
+
+// newSQLStore serves db; prepared looks up statements prepared in advance
+// and may be nil.
+func newSQLStore(db *sql.DB, prepared func(query string) (*sql.Stmt, bool)) *sqlStore {
+	if prepared == nil {
+		prepared = notPrepared
+	}
+	return &sqlStore{sqlRecords: sqlRecords{conn: db, prepared: prepared}, db: db}
+}
+
+// notPrepared is the lookup of transactions: prepared statements belong to
+// the pool.
+func notPrepared(string) (*sql.Stmt, bool) {
+	return nil, false
+}
+
+// records returns the records of the session of ctx, if any.
+func (s *sqlStore) records(ctx context.Context) sqlRecords {
+	if tx, ok := ctx.Value(sessionKey{}).(*sql.Tx); ok {
+		return sqlRecords{conn: tx, prepared: notPrepared}
+	}
+	return s.sqlRecords
+}
+
+func (s *sqlStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	return s.records(ctx).Select(ctx, query, each)
+}
+
+func (s *sqlStore) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	return s.records(ctx).Insert(ctx, insert)
+}
+
+func (s *sqlStore) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	return s.records(ctx).Update(ctx, update)
+}
+
+func (s *sqlStore) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	return s.records(ctx).Delete(ctx, del)
+}
+
+func (s *sqlStore) Begin(ctx context.Context) (Tx, error) {
+	if tx, ok := ctx.Value(sessionKey{}).(*sql.Tx); ok {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT nested"); err != nil {
+			return nil, err
+		}
+		return &savepointTx{sqlRecords{conn: tx, prepared: notPrepared}, ctx, tx, false}, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{sqlRecords{conn: tx, prepared: notPrepared}, tx}, nil
+}
+
+// Session begins the transaction of a request and applies the settings of
+// options to it.
+func (s *sqlStore) Session(ctx context.Context, options sessionOptions) (context.Context, Tx, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sqlIsolation(options.isolation)})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, setting := range options.settings {
+		if _, err := tx.ExecContext(ctx, setLocal, setting.name, setting.value); err != nil {
+			tx.Rollback()
+			return nil, nil, fmt.Errorf("setting %s: %v", setting.name, err)
+		}
+	}
+	return context.WithValue(ctx, sessionKey{}, tx), sqlTx{sqlRecords{conn: tx, prepared: notPrepared}, tx}, nil
+}
+
+func sqlIsolation(level string) sql.IsolationLevel {
+	switch level {
+	case "read committed":
+		return sql.LevelReadCommitted
+	case "repeatable read":
+		return sql.LevelRepeatableRead
+	case "serializable":
+		return sql.LevelSerializable
+	}
+	return sql.LevelDefault
+}
+
+type sqlTx struct {
+	sqlRecords
+	tx *sql.Tx
+}
+
+func (t sqlTx) Commit() error   { return t.tx.Commit() }
+func (t sqlTx) Rollback() error { return t.tx.Rollback() }
+
+// savepointTx is a transaction nested in a session. Like sql.Tx, it ignores
+// a Rollback after Commit.
+type savepointTx struct {
+	sqlRecords
+	ctx  context.Context
+	tx   *sql.Tx
+	done bool
+}
+
+func (t *savepointTx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.tx.ExecContext(t.ctx, "RELEASE SAVEPOINT nested")
+	return err
+}
+
+func (t *savepointTx) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.tx.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT nested")
+	return err
+}
+
+func (s *sqlStore) ListTables(ctx context.Context, schema string) ([]string, error) {
+	// information_schema leaves materialized views out.
+	rows, err := s.db.QueryContext(ctx, `SELECT table_name::text FROM information_schema.tables WHERE table_schema = $1
+		UNION ALL SELECT matviewname::text FROM pg_catalog.pg_matviews WHERE schemaname = $1`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *sqlStore) Introspect(ctx context.Context, schema string) (map[string]*Table, error) {
+	names, err := s.ListTables(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]*Table, len(names))
+	for _, name := range names {
+		tables[name] = &Table{Schema: schema, Name: name}
+	}
+
+	// The kinds and comments of the tables. A view takes writes when the
+	// database can insert, update and delete through it, bits 8, 4 and 16
+	// of pg_relation_is_updatable.
+	relations, err := s.db.QueryContext(ctx, `SELECT c.relname, c.relkind::text, pg_catalog.pg_relation_is_updatable(c.oid, false) & 28 <> 28,
+			COALESCE(pg_catalog.obj_description(c.oid, 'pg_class'), '')
+		FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p', 'v', 'm')`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer relations.Close()
+	for relations.Next() {
+		var name, kind, comment string
+		var readOnly bool
+		if err := relations.Scan(&name, &kind, &readOnly, &comment); err != nil {
+			return nil, err
+		}
+		table, ok := tables[name]
+		if !ok {
+			continue
+		}
+		table.Comment = comment
+		switch kind {
+		case "v":
+			table.Kind, table.ReadOnly = "view", readOnly
+		case "m":
+			table.Kind, table.ReadOnly = "materialized_view", true
+		}
+	}
+	if err := relations.Err(); err != nil {
+		return nil, err
+	}
+
+	columns, err := s.db.QueryContext(ctx, `SELECT c.table_name, c.column_name,
+			CASE WHEN c.udt_name IN ('geometry', 'geography') THEN c.udt_name::text ELSE c.data_type::text END, COALESCE(e.data_type, ''), c.is_nullable = 'YES',
+			COALESCE(c.column_default, ''), c.is_identity = 'YES' OR COALESCE(c.column_default, '') LIKE 'nextval(%',
+			c.udt_name::text, format('%I.%I', c.udt_schema, c.udt_name)::regtype::text, ARRAY(SELECT l.enumlabel::text
+				FROM pg_catalog.pg_enum l
+				JOIN pg_catalog.pg_type t ON t.oid = l.enumtypid
+				JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+				WHERE t.typname = c.udt_name AND n.nspname = c.udt_schema
+				ORDER BY l.enumsortorder),
+			COALESCE(pg_catalog.col_description(format('%I.%I', c.table_schema, c.table_name)::regclass, c.ordinal_position::int), ''),
+			COALESCE(c.character_maximum_length, 0)
+		FROM information_schema.columns c
+		LEFT JOIN information_schema.element_types e
+			ON (c.table_catalog, c.table_schema, c.table_name, 'TABLE', c.dtd_identifier)
+			= (e.object_catalog, e.object_schema, e.object_name, e.object_type, e.collection_type_identifier)
+		WHERE c.table_schema = $1
+		ORDER BY c.table_name, c.ordinal_position`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer columns.Close()
+	if err := scanColumns(columns, tables); err != nil {
+		return nil, err
+	}
+
+	// The columns of materialized views, typed as information_schema would.
+	matviewColumns, err := s.db.QueryContext(ctx, `SELECT c.relname, a.attname,
+			CASE WHEN t.typname IN ('geometry', 'geography') THEN t.typname::text
+				WHEN t.typcategory = 'A' THEN 'ARRAY'
+				WHEN t.typtype = 'e' THEN 'USER-DEFINED'
+				ELSE pg_catalog.format_type(a.atttypid, NULL) END,
+			CASE WHEN t.typcategory = 'A' THEN pg_catalog.format_type(t.typelem, NULL) ELSE '' END,
+			NOT a.attnotnull, '', false, t.typname::text, pg_catalog.format_type(a.atttypid, NULL), ARRAY(SELECT l.enumlabel::text
+				FROM pg_catalog.pg_enum l
+				WHERE l.enumtypid = t.oid
+				ORDER BY l.enumsortorder),
+			COALESCE(pg_catalog.col_description(c.oid, a.attnum), ''),
+			CASE WHEN a.atttypid IN ('varchar'::regtype, 'bpchar'::regtype) AND a.atttypmod > 4 THEN a.atttypmod - 4 ELSE 0 END
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+		WHERE n.nspname = $1 AND c.relkind = 'm'
+		ORDER BY c.relname, a.attnum`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer matviewColumns.Close()
+	if err := scanColumns(matviewColumns, tables); err != nil {
+		return nil, err
+	}
+
+	keys, err := s.db.QueryContext(ctx, `SELECT kcu.table_name, tc.constraint_type = 'PRIMARY KEY', kcu.constraint_name, kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema
+		WHERE tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE') AND tc.table_schema = $1
+		ORDER BY kcu.table_name, kcu.constraint_name, kcu.ordinal_position`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer keys.Close()
+
+	for keys.Next() {
+		var tableName, constraint, columnName string
+		var primary bool
+		if err := keys.Scan(&tableName, &primary, &constraint, &columnName); err != nil {
+			return nil, err
+		}
+		table, ok := tables[tableName]
+		switch {
+		case !ok:
+		case primary:
+			table.PrimaryKey = append(table.PrimaryKey, columnName)
+		default:
+			n := len(table.UniqueKeys)
+			if n == 0 || table.UniqueKeys[n-1].Name != constraint {
+				table.UniqueKeys = append(table.UniqueKeys, &UniqueKey{Name: constraint})
+				n++
+			}
+			table.UniqueKeys[n-1].Columns = append(table.UniqueKeys[n-1].Columns, columnName)
+		}
+	}
+	if err := keys.Err(); err != nil {
+		return nil, err
+	}
+
+	references, err := s.db.QueryContext(ctx, `SELECT kcu.table_name, kcu.constraint_name, kcu.column_name, ref.table_name, ref.column_name, rc.delete_rule
+		FROM information_schema.referential_constraints rc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_name = rc.constraint_name AND kcu.constraint_schema = rc.constraint_schema
+		JOIN information_schema.key_column_usage ref
+			ON ref.constraint_name = rc.unique_constraint_name AND ref.constraint_schema = rc.unique_constraint_schema
+			AND ref.ordinal_position = kcu.position_in_unique_constraint
+		WHERE kcu.table_schema = $1 AND ref.table_schema = $1
+		ORDER BY kcu.table_name, kcu.constraint_name, kcu.ordinal_position`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer references.Close()
+
+	for references.Next() {
+		var tableName, constraint, columnName, refTable, refColumn, onDelete string
+		if err := references.Scan(&tableName, &constraint, &columnName, &refTable, &refColumn, &onDelete); err != nil {
+			return nil, err
+		}
+		table, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+		n := len(table.ForeignKeys)
+		if n == 0 || table.ForeignKeys[n-1].Name != constraint {
+			table.ForeignKeys = append(table.ForeignKeys, &ForeignKey{Name: constraint, RefTable: refTable, OnDelete: onDelete})
+			n++
+		}
+		fk := table.ForeignKeys[n-1]
+		fk.Columns = append(fk.Columns, columnName)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+	}
+	if err := references.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes, err := s.db.QueryContext(ctx, `SELECT t.relname, i.relname, x.indisunique, x.indisprimary,
+			COALESCE(a.attname::text, pg_catalog.pg_get_indexdef(x.indexrelid, k.position::int, true))
+		FROM pg_catalog.pg_index x
+		JOIN pg_catalog.pg_class i ON i.oid = x.indexrelid
+		JOIN pg_catalog.pg_class t ON t.oid = x.indrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(x.indkey::int2[]) WITH ORDINALITY AS k(attnum, position)
+		LEFT JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = $1 AND k.position <= x.indnkeyatts
+		ORDER BY t.relname, i.relname, k.position`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer indexes.Close()
+
+	for indexes.Next() {
+		var tableName, name, columnName string
+		var unique, primary bool
+		if err := indexes.Scan(&tableName, &name, &unique, &primary, &columnName); err != nil {
+			return nil, err
+		}
+		table, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+		n := len(table.Indexes)
+		if n == 0 || table.Indexes[n-1].Name != name {
+			table.Indexes = append(table.Indexes, &Index{Name: name, Unique: unique, Primary: primary})
+			n++
+		}
+		table.Indexes[n-1].Columns = append(table.Indexes[n-1].Columns, columnName)
+	}
+	if err := indexes.Err(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// scanColumns adds the columns of rows to their tables.
+func scanColumns(rows *sql.Rows, tables map[string]*Table) error {
+	for rows.Next() {
+		var tableName, udtName string
+		column := &Column{}
+		if err := rows.Scan(&tableName, &column.Name, &column.DataType, &column.ElementType, &column.Nullable, &column.Default, &column.Generated,
+			&udtName, &column.Type, pq.Array(&column.EnumValues), &column.Comment, &column.MaxLength); err != nil {
+			return err
+		}
+		if len(column.EnumValues) > 0 {
+			column.Enum = udtName
+		} else {
+			column.EnumValues = nil
+		}
+		if table, ok := tables[tableName]; ok {
+			table.Columns = append(table.Columns, column)
+		}
+	}
+	return rows.Err()
+}
+
+// CopyRows loads rows with COPY, in a transaction as lib/pq requires: the
+// one of the session or a new one.
+func (s *sqlStore) CopyRows(ctx context.Context, table querybuilder.Table, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	tx, session := ctx.Value(sessionKey{}).(*sql.Tx)
+	if !session {
+		var err error
+		if tx, err = s.db.BeginTx(ctx, nil); err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(table.Schema, table.Name, columns...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var copied int64
+	for {
+		row, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if row == nil {
+			break
+		}
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, err
+		}
+		copied++
+	}
+	// The final Exec without arguments flushes the buffered rows.
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+	if session {
+		return copied, nil
+	}
+	return copied, tx.Commit()
+}
+
+func (s *sqlStore) Refresh(ctx context.Context, refresh querybuilder.Refresh) error {
+	_, err := s.records(ctx).exec(ctx, refresh)
+	return err
+}
+
+func (s *sqlStore) Invoke(ctx context.Context, call querybuilder.Invoke, each func(record map[string]interface{}) error) error {
+	return s.records(ctx).Invoke(ctx, call, each)
+}
+
+func (s *sqlStore) ReadOnlyQuery(ctx context.Context, query string, args []interface{}, each func(values []interface{}) error) ([]string, error) {
+	tx, ok := ctx.Value(sessionKey{}).(*sql.Tx)
+	if ok {
+		// The session may have run statements already, which rules out
+		// SET TRANSACTION but not turning the rest of it read-only.
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT read_only"); err != nil {
+			return nil, err
+		}
+		defer tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT read_only")
+		if _, err := tx.ExecContext(ctx, setLocal, "transaction_read_only", "on"); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if tx, err = s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+
+	// Unlike a query sent on its own, a prepared statement is a single
+	// one, whatever query contains.
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name()
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, column := range columns {
+			values[i] = jsonValue(column.DatabaseTypeName(), values[i])
+		}
+		if err := each(values); err != nil {
+			return names, err
+		}
+	}
+	return names, rows.Err()
+}
+
+// Functions reads the functions of schema from pg_proc, leaving out
+// aggregates, procedures, trigger functions and the functions of
+// extensions, then the types of their arguments from pg_type.
+func (s *sqlStore) Functions(ctx context.Context, schema string) (map[string]*Function, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT p.proname, p.pronargdefaults,
+			COALESCE(p.proargnames, '{}'), COALESCE(p.proargmodes::text[], '{}'),
+			COALESCE(p.proallargtypes, p.proargtypes::oid[])::int8[]
+		FROM pg_catalog.pg_proc p JOIN pg_catalog.pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $1 AND p.prokind = 'f'
+			AND p.prorettype NOT IN ('pg_catalog.trigger'::regtype, 'pg_catalog.event_trigger'::regtype, 'pg_catalog.internal'::regtype)
+			AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d
+				WHERE d.classid = 'pg_catalog.pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type proc struct {
+		name         string
+		defaults     int
+		names, modes []string
+		types        []int64
+	}
+	var procs []proc
+	var oids []int64
+	for rows.Next() {
+		var p proc
+		if err := rows.Scan(&p.name, &p.defaults, pq.Array(&p.names), pq.Array(&p.modes), pq.Array(&p.types)); err != nil {
+			return nil, err
+		}
+		procs = append(procs, p)
+		oids = append(oids, p.types...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The types of the arguments, as information_schema types columns.
+	typeRows, err := s.db.QueryContext(ctx, `SELECT t.oid::int8,
+			CASE WHEN t.typname IN ('geometry', 'geography') THEN t.typname::text
+				WHEN t.typcategory = 'A' THEN 'ARRAY'
+				WHEN t.typtype = 'e' THEN 'USER-DEFINED'
+				ELSE pg_catalog.format_type(t.oid, NULL) END,
+			CASE WHEN t.typcategory = 'A' THEN pg_catalog.format_type(t.typelem, NULL) ELSE '' END,
+			t.typname::text, ARRAY(SELECT l.enumlabel::text
+				FROM pg_catalog.pg_enum l
+				WHERE l.enumtypid = t.oid
+				ORDER BY l.enumsortorder)
+		FROM pg_catalog.pg_type t
+		WHERE t.oid::int8 = ANY($1)`, pq.Array(oids))
+	if err != nil {
+		return nil, err
+	}
+	defer typeRows.Close()
+	types := make(map[int64]Column)
+	for typeRows.Next() {
+		var oid int64
+		var typeName string
+		var column Column
+		if err := typeRows.Scan(&oid, &column.DataType, &column.ElementType, &typeName, pq.Array(&column.EnumValues)); err != nil {
+			return nil, err
+		}
+		if len(column.EnumValues) > 0 {
+			column.Enum = typeName
+		} else {
+			column.EnumValues = nil
+		}
+		types[oid] = column
+	}
+	if err := typeRows.Err(); err != nil {
+		return nil, err
+	}
+
+	functions := make(map[string]*Function)
+	overloads := make(map[string]int)
+	for _, p := range procs {
+		argTypes := make([]Column, len(p.types))
+		for i, oid := range p.types {
+			argTypes[i] = types[oid]
+		}
+		overloads[p.name]++
+		if function, ok := functionOf(schema, p.name, p.names, p.modes, argTypes, p.defaults); ok {
+			functions[p.name] = function
+		}
+	}
+	for name, n := range overloads {
+		if n > 1 {
+			delete(functions, name)
+		}
+	}
+	return functions, nil
+}
+
+// functionOf makes the Function of a pg_proc row: names and modes, when
+// set, run parallel to types, which are those of all the arguments. Only
+// the last defaults input arguments have defaults. Functions with unnamed
+// or variadic input arguments can't be called by name and aren't returned;
+// unnamed output arguments aren't columns that can be filtered on.
+func functionOf(schema, name string, names, modes []string, types []Column, defaults int) (*Function, bool) {
+	function := &Function{Schema: schema, Name: name}
+	for i, column := range types {
+		mode := "i"
+		if len(modes) > 0 {
+			mode = modes[i]
+		}
+		named := i < len(names) && names[i] != ""
+		if named {
+			column.Name, column.Nullable = names[i], true
+		}
+		switch mode {
+		case "o", "t", "b":
+			if named {
+				output := column
+				function.Columns = append(function.Columns, &output)
+			}
+			if mode != "b" {
+				continue
+			}
+		case "v":
+			return nil, false
+		}
+		if !named {
+			return nil, false
+		}
+		function.Args = append(function.Args, &FunctionArg{Column: column})
+	}
+	for i := len(function.Args) - defaults; i < len(function.Args); i++ {
+		if i >= 0 {
+			function.Args[i].HasDefault = true
+		}
+	}
+	return function, true
+}
+
+// Catalog reads the statistics and comments of the tables of schema.
+func (s *sqlStore) Catalog(ctx context.Context, schema string) (map[string]TableStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT c.relname, CASE WHEN c.relkind = 'v' THEN -1 ELSE c.reltuples::bigint END, pg_catalog.pg_total_relation_size(c.oid),
+			COALESCE(pg_catalog.obj_description(c.oid, 'pg_class'), '')
+		FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p', 'v', 'm')`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make(map[string]TableStats)
+	for rows.Next() {
+		var name string
+		var table TableStats
+		if err := rows.Scan(&name, &table.Rows, &table.Size, &table.Comment); err != nil {
+			return nil, err
+		}
+		stats[name] = table
+	}
+	return stats, rows.Err()
+}
+
+// EstimateCost asks the planner for its estimates of query; nothing is
+// executed.
+func (s *sqlStore) EstimateCost(ctx context.Context, query querybuilder.Statement) (float64, float64, error) {
+	sqlQuery, args := buildSQL(query)
+	var raw []byte
+	if err := s.records(ctx).conn.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+sqlQuery, args...).Scan(&raw); err != nil {
+		return 0, 0, err
+	}
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+			PlanRows  float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil || len(plans) == 0 {
+		return 0, 0, fmt.Errorf("reading query plan: %v", err)
+	}
+	return plans[0].Plan.TotalCost, plans[0].Plan.PlanRows, nil
+}
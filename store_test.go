@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// fakeStore serves fixed records, remembers the last query and keeps the
+// rows copied or inserted into it, numbering generated keys from lastID.
+// Inserts that resolve duplicates are remembered too; the rows duplicate
+// reports are resolved and not kept. Updates and deletes in a transaction
+// are kept as SQL and change one row, none in the table absent.
+type fakeStore struct {
+	Store
+	records   []map[string]interface{}
+	query     querybuilder.Select
+	columns   []string
+	copied    [][]interface{}
+	inserted  [][]interface{}
+	conflict  *querybuilder.OnConflict
+	duplicate func(columns []string, row []interface{}) bool
+	lastID    int64
+	changed   []string
+	absent    string
+}
+
+func (s *fakeStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	s.query = query
+	for _, record := range s.records {
+		if err := each(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backendExplorer is an explorer over the tables of fuzzSchema, without a
+// database.
+func backendExplorer(backend Store) *DbExplorer {
+	store := newMemoryStore()
+	de := &DbExplorer{
+		cfg:      &Config{},
+		usage:    newUsageTracker(),
+		sessions: newSessionStore(),
+		lockout:  newLockoutTracker(LockoutConfig{}, store),
+		store:    store,
+		backend:  backend,
+	}
+	de.schema.Store(fuzzSchema())
+	de.ready.Store(true)
+	return de
+}
+
+func (s *fakeStore) CopyRows(ctx context.Context, table querybuilder.Table, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	s.columns = columns
+	var rows [][]interface{}
+	for {
+		row, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	s.copied = append(s.copied, rows...)
+	return int64(len(rows)), nil
+}
+
+func (s *fakeStore) Begin(ctx context.Context) (Tx, error) {
+	return &fakeTx{store: s}, nil
+}
+
+// fakeTx keeps the rows it inserts and the statements changing rows until
+// it is committed.
+type fakeTx struct {
+	Records
+	store   *fakeStore
+	rows    [][]interface{}
+	changed []string
+}
+
+func (t *fakeTx) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	return t.store.Select(ctx, query, each)
+}
+
+func (t *fakeTx) Update(ctx context.Context, update querybuilder.Update) (int64, error) {
+	return t.change(update.Table, update)
+}
+
+func (t *fakeTx) Delete(ctx context.Context, del querybuilder.Delete) (int64, error) {
+	return t.change(del.From, del)
+}
+
+func (t *fakeTx) change(table querybuilder.Table, stmt querybuilder.Statement) (int64, error) {
+	if table.Name == t.store.absent {
+		return 0, nil
+	}
+	query, args := querybuilder.Build(querybuilder.Postgres{}, stmt)
+	t.changed = append(t.changed, fmt.Sprint(query, " ", args))
+	return 1, nil
+}
+
+func (t *fakeTx) Insert(ctx context.Context, insert querybuilder.Insert) ([][]interface{}, error) {
+	if insert.OnConflict == nil {
+		t.rows = append(t.rows, insert.Rows...)
+		return t.returning(insert), nil
+	}
+	t.store.conflict = insert.OnConflict
+	var returned [][]interface{}
+	for _, row := range insert.Rows {
+		switch {
+		case t.store.duplicate == nil || !t.store.duplicate(insert.Columns, row):
+			t.rows = append(t.rows, row)
+			returned = append(returned, []interface{}{true})
+		case len(insert.OnConflict.Update) > 0:
+			returned = append(returned, []interface{}{false})
+		}
+	}
+	return returned, nil
+}
+
+// returning returns the key of every row of insert: the value of the row
+// for the key columns it sets, the next id of the store for the others.
+func (t *fakeTx) returning(insert querybuilder.Insert) [][]interface{} {
+	var returned [][]interface{}
+	for _, row := range insert.Rows {
+		key := make([]interface{}, len(insert.Returning))
+	keys:
+		for i, projection := range insert.Returning {
+			for j, column := range insert.Columns {
+				if projection == querybuilder.Col(column) {
+					key[i] = row[j]
+					continue keys
+				}
+			}
+			t.store.lastID++
+			key[i] = t.store.lastID
+		}
+		returned = append(returned, key)
+	}
+	return returned
+}
+
+func (t *fakeTx) Commit() error {
+	t.store.inserted = append(t.store.inserted, t.rows...)
+	t.store.changed = append(t.store.changed, t.changed...)
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	return nil
+}
+
+func TestRecordFromBackend(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{{"id": int64(7), "title": "memcache"}}}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/7?fields=id,title", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"record": map[string]interface{}{"id": float64(7), "title": "memcache"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+
+	gotSQL, _ := buildSQL(backend.query)
+	wantSQL, _ := buildSQL(selectRecord(fuzzSchema().Tables["items"], []string{"id", "title"}, recordKey{int64(7)}))
+	if gotSQL != wantSQL {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", gotSQL, wantSQL)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+const (
+	ndjsonType = "application/x-ndjson"
+	csvType    = "text/csv"
+)
+
+// flushEvery is how many streamed records are written between flushes.
+const flushEvery = 100
+
+// listingFormat returns the format a listing is written in: "json", the
+// default page, "xml", the same page in XML, or one of the streamed
+// "ndjson", "csv", "xlsx" and "parquet". ?format=
+// takes precedence over the Accept header.
+func listingFormat(r *http.Request) (string, error) {
+	if raw := r.URL.Query().Get("format"); raw != "" {
+		switch raw {
+		case "json", "xml", "ndjson", "csv", "xlsx", "parquet":
+			return raw, nil
+		}
+		return "", fmt.Errorf("format must be json, xml, ndjson, csv, xlsx or parquet")
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return "json", nil
+		case xmlType, "text/xml":
+			return "xml", nil
+		case ndjsonType:
+			return "ndjson", nil
+		case csvType:
+			return "csv", nil
+		case xlsxType:
+			return "xlsx", nil
+		case parquetType:
+			return "parquet", nil
+		}
+	}
+	return "json", nil
+}
+
+// streamed reports whether listings in format are streamed rather than
+// written as a page.
+func streamed(format string) bool {
+	return format != "json" && format != "xml"
+}
+
+// checkStreamParams rejects the listing parameters a stream can't honor:
+// the cursor, count and expansions need the whole page, which a stream
+// never holds.
+func checkStreamParams(params url.Values) error {
+	for _, name := range []string{"cursor", "count", "expand"} {
+		if _, ok := params[name]; ok {
+			return fmt.Errorf("%s can't be combined with streaming", name)
+		}
+	}
+	if params.Get("limit") == "" && params.Get("offset") != "" {
+		return fmt.Errorf("offset requires a limit when streaming")
+	}
+	return nil
+}
+
+// resumable reports whether exports in format can be resumed with a range
+// of records: the formats whose records can be appended to a partial
+// download.
+func resumable(format string) bool {
+	return format == "csv" || format == "ndjson"
+}
+
+// recordRange is the part of an export asked for with Range:
+// records=first-last, counted from 0 in the listing; last is -1 when the
+// range is open, as in records=1000- to resume after the first 1000.
+type recordRange struct {
+	first, last int
+}
+
+// parseRecordRange reads a Range header in records. Other units, multiple
+// ranges and malformed values are ignored, which serves the whole export as
+// HTTP prescribes.
+func parseRecordRange(header string) (recordRange, bool) {
+	spec := strings.TrimPrefix(header, "records=")
+	if spec == header || strings.Contains(spec, ",") {
+		return recordRange{}, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return recordRange{}, false
+	}
+	rng := recordRange{last: -1}
+	var err error
+	if rng.first, err = strconv.Atoi(first); err != nil || rng.first < 0 {
+		return recordRange{}, false
+	}
+	if last != "" {
+		if rng.last, err = strconv.Atoi(last); err != nil || rng.last < rng.first {
+			return recordRange{}, false
+		}
+	}
+	return rng, true
+}
+
+// page narrows the page of a listing, nil when it has none, to the range.
+func (rng recordRange) page(page *querybuilder.Page) (*querybuilder.Page, error) {
+	narrowed := &querybuilder.Page{Limit: -1, Offset: rng.first}
+	if page != nil {
+		narrowed.Limit = page.Limit - rng.first
+		narrowed.Offset += page.Offset
+		if narrowed.Limit <= 0 {
+			return nil, fmt.Errorf("the export has %d records", page.Limit)
+		}
+	}
+	if n := rng.last - rng.first + 1; rng.last >= 0 && (narrowed.Limit < 0 || n < narrowed.Limit) {
+		narrowed.Limit = n
+	}
+	return narrowed, nil
+}
+
+// contentRange describes the range in a Content-Range header; the size of
+// the export isn't known.
+func (rng recordRange) contentRange() string {
+	if rng.last < 0 {
+		return fmt.Sprintf("records %d-/*", rng.first)
+	}
+	return fmt.Sprintf("records %d-%d/*", rng.first, rng.last)
+}
+
+// recordEncoder writes streamed records in one format.
+type recordEncoder interface {
+	// start sets the headers of the response.
+	start(h http.Header)
+	encode(record map[string]interface{}) error
+	// fail reports an error after records went out, when the status can't
+	// change anymore.
+	fail(err error)
+	flush() error
+	// close completes the response after the last record.
+	close() error
+}
+
+func newRecordEncoder(format string, w http.ResponseWriter, table *Table, fields []string) recordEncoder {
+	switch format {
+	case "csv":
+		return &csvEncoder{w: csv.NewWriter(w), table: table.Name, columns: fields}
+	case "xlsx":
+		return &xlsxEncoder{archive: zip.NewWriter(w), table: table, columns: fields}
+	case "parquet":
+		return &parquetEncoder{out: w, table: table, columns: fields}
+	}
+	return ndjsonEncoder{json.NewEncoder(w)}
+}
+
+// ndjsonEncoder writes a JSON object per line and ends a failed stream with
+// an {"error": ...} line.
+type ndjsonEncoder struct {
+	*json.Encoder
+}
+
+func (e ndjsonEncoder) start(h http.Header) {
+	h.Set("Content-Type", ndjsonType)
+}
+
+func (e ndjsonEncoder) encode(record map[string]interface{}) error {
+	return e.Encode(record)
+}
+
+func (e ndjsonEncoder) fail(err error) {
+	e.Encode(map[string]interface{}{"error": err.Error()})
+}
+
+func (e ndjsonEncoder) flush() error {
+	return nil
+}
+
+func (e ndjsonEncoder) close() error {
+	return nil
+}
+
+// csvEncoder writes a header row with the selected columns, then a row per
+// record. CSV has no way to report an error in band, so a failed stream is
+// aborted and the client sees a truncated response.
+type csvEncoder struct {
+	w       *csv.Writer
+	table   string
+	columns []string
+	header  bool
+}
+
+func (e *csvEncoder) start(h http.Header) {
+	h.Set("Content-Type", csvType+"; charset=utf-8")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.table + ".csv"}))
+}
+
+func (e *csvEncoder) encode(record map[string]interface{}) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	row := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		cell, err := csvCell(record[column])
+		if err != nil {
+			return fmt.Errorf("%s: %v", column, err)
+		}
+		row[i] = cell
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(e.columns)
+}
+
+func (e *csvEncoder) fail(err error) {
+	e.w.Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// csvCell formats a value as spreadsheets read it: NULL is an empty cell,
+// times are RFC 3339 and JSON values stay JSON.
+func csvCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []byte:
+		return string(v), nil
+	case json.RawMessage:
+		return string(v), nil
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// streamRecords writes the records of query as the backend reads them.
+// Writes block while the client isn't reading, which holds the backend at
+// the client's pace instead of buffering the result. A resumed export, with
+// a range, is a 206 whose CSV has no header row: it continues a file that
+// already has one. With a checksum, the manifest of the export follows the
+// body in trailers, unless the stream fails.
+func (de *DbExplorer) streamRecords(w http.ResponseWriter, r *http.Request, table *Table, fields []string, query querybuilder.Select, export exportOptions) {
+	rc := http.NewResponseController(w)
+	var hw *hashingWriter
+	if export.checksum {
+		hw = newHashingWriter(w)
+		w = hw
+	}
+	encoder := newRecordEncoder(export.format, w, table, fields)
+	start := func() {
+		encoder.start(w.Header())
+		if hw != nil {
+			declareTrailers(w.Header())
+		}
+		if export.resume != nil {
+			if csv, ok := encoder.(*csvEncoder); ok {
+				csv.header = true
+			}
+			w.Header().Set("Content-Range", export.resume.contentRange())
+			w.WriteHeader(http.StatusPartialContent)
+		}
+	}
+	var written int64
+	err := de.backend.Select(r.Context(), query, func(record map[string]interface{}) error {
+		if err := de.decryptValues(table.Name, record); err != nil {
+			return err
+		}
+		if written == 0 {
+			start()
+		}
+		if err := encoder.encode(record); err != nil {
+			return err
+		}
+		written++
+		if written%flushEvery == 0 {
+			if err := encoder.flush(); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+		return nil
+	})
+	addRows(r.Context(), written)
+	switch {
+	case err != nil && written == 0:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case err != nil:
+		encoder.fail(err)
+	default:
+		if written == 0 {
+			start()
+		}
+		if err := encoder.close(); err == nil && hw != nil {
+			hw.writeTrailers(table, fields, export, written)
+		}
+	}
+}
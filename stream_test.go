@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"db_explorer/internal/querybuilder"
+)
+
+func TestStreamRecords(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(1), "title": "memcache"},
+		{"id": int64(2), "title": "redis"},
+	}}
+	de := backendExplorer(backend)
+
+	r := httptest.NewRequest(http.MethodGet, "/items?fields=id,title", nil)
+	r.Header.Set("Accept", "application/x-ndjson, application/json;q=0.5")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != ndjsonType {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, ndjsonType)
+	}
+	want := "{\"id\":1,\"title\":\"memcache\"}\n{\"id\":2,\"title\":\"redis\"}\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("results not match\nGot : %q\nWant: %q", got, want)
+	}
+	if backend.query.Page != nil {
+		t.Fatalf("results not match\nGot : %#v\nWant: no page", backend.query.Page)
+	}
+}
+
+func TestStreamCSV(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(1), "title": "memcache", "price": []byte("1.50"), "created": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), "extra": nil},
+		{"id": int64(2), "title": "say \"hi\", bye", "price": nil, "created": nil, "extra": map[string]interface{}{"a": 1}},
+	}}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?format=csv", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename=items.csv`; got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+	want := "id,title,price,created,extra\n" +
+		"1,memcache,1.50,2024-05-01T12:00:00Z,\n" +
+		"2,\"say \"\"hi\"\", bye\",,,\"{\"\"a\"\":1}\"\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("results not match\nGot : %q\nWant: %q", got, want)
+	}
+
+	// An empty listing still has its header row.
+	backend.records = nil
+	r := httptest.NewRequest(http.MethodGet, "/items?fields=id,title", nil)
+	r.Header.Set("Accept", "text/csv")
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if got, want := w.Body.String(), "id,title\n"; got != want {
+		t.Fatalf("results not match\nGot : %q\nWant: %q", got, want)
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(3), "title": "redis"},
+	}}
+	de := backendExplorer(backend)
+
+	r := httptest.NewRequest(http.MethodGet, "/items?format=csv&fields=id,title", nil)
+	r.Header.Set("Range", "records=2-")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if got, want := w.Header().Get("Content-Range"), "records 2-/*"; got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+	// The header row went out with the first part of the export.
+	if got, want := w.Body.String(), "3,redis\n"; got != want {
+		t.Fatalf("results not match\nGot : %q\nWant: %q", got, want)
+	}
+	gotSQL, _ := buildSQL(backend.query)
+	wantSQL := `SELECT "id", "title" FROM "public"."items" ORDER BY "id" ASC LIMIT ALL OFFSET 2`
+	if gotSQL != wantSQL {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", gotSQL, wantSQL)
+	}
+
+	// Without a range the export is whole, in the same order.
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?format=ndjson&fields=id", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Accept-Ranges") != "records" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	if len(backend.query.OrderBy) != 1 || backend.query.Page != nil {
+		t.Fatalf("unexpected query %#v", backend.query)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/items?format=ndjson&limit=2", nil)
+	r.Header.Set("Range", "records=2-")
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRecordRange(t *testing.T) {
+	cases := []struct {
+		header string
+		page   *querybuilder.Page
+		want   *querybuilder.Page
+	}{
+		{"records=10-", nil, &querybuilder.Page{Limit: -1, Offset: 10}},
+		{"records=10-19", nil, &querybuilder.Page{Limit: 10, Offset: 10}},
+		{"records=10-", &querybuilder.Page{Limit: 50, Offset: 5}, &querybuilder.Page{Limit: 40, Offset: 15}},
+		{"records=10-14", &querybuilder.Page{Limit: 50, Offset: 5}, &querybuilder.Page{Limit: 5, Offset: 15}},
+		{"bytes=10-", nil, nil},
+		{"records=5-2", nil, nil},
+		{"records=1-2,4-", nil, nil},
+	}
+	for _, item := range cases {
+		rng, ok := parseRecordRange(item.header)
+		if !ok {
+			if item.want != nil {
+				t.Fatalf("[%s] unexpected invalid range", item.header)
+			}
+			continue
+		}
+		got, err := rng.page(item.page)
+		if err != nil || !reflect.DeepEqual(got, item.want) {
+			t.Fatalf("[%s] results not match\nGot : %#v %v\nWant: %#v", item.header, got, err, item.want)
+		}
+	}
+}
+
+func TestListingFormat(t *testing.T) {
+	cases := []struct {
+		query  string
+		accept string
+		format string
+		err    bool
+	}{
+		{"", "", "json", false},
+		{"", "application/json", "json", false},
+		{"", "text/csv; charset=utf-8", "csv", false},
+		{"", "text/html, application/x-ndjson", "ndjson", false},
+		{"format=json", "text/csv", "json", false},
+		{"format=csv", "", "csv", false},
+		{"", "application/vnd.apache.parquet", "parquet", false},
+		{"format=xls", "", "", true},
+		{"", "application/xml", "xml", false},
+	}
+	for _, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items?"+item.query, nil)
+		r.Header.Set("Accept", item.accept)
+		format, err := listingFormat(r)
+		if format != item.format || (err != nil) != item.err {
+			t.Fatalf("[%s %s] results not match\nGot : %q %v\nWant: %q", item.query, item.accept, format, err, item.format)
+		}
+	}
+}
+
+func TestCheckStreamParams(t *testing.T) {
+	cases := []struct {
+		query string
+		err   string
+	}{
+		{"", ""},
+		{"limit=10&offset=20", ""},
+		{"title=memcache", ""},
+		{"offset=20", "offset requires a limit when streaming"},
+		{"cursor=", "cursor can't be combined with streaming"},
+		{"count=exact", "count can't be combined with streaming"},
+		{"expand=item_id", "expand can't be combined with streaming"},
+	}
+	for _, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items?"+item.query, nil)
+		err := checkStreamParams(r.URL.Query())
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != item.err {
+			t.Fatalf("[%s] results not match\nGot : %q\nWant: %q", item.query, got, item.err)
+		}
+	}
+}
+
+// failingStore fails after its records.
+type failingStore struct {
+	fakeStore
+}
+
+func (s *failingStore) Select(ctx context.Context, query querybuilder.Select, each func(record map[string]interface{}) error) error {
+	if err := s.fakeStore.Select(ctx, query, each); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestStreamError(t *testing.T) {
+	backend := &failingStore{fakeStore{records: []map[string]interface{}{{"id": int64(1)}}}}
+	de := backendExplorer(backend)
+
+	r := httptest.NewRequest(http.MethodGet, "/items?fields=id", nil)
+	r.Header.Set("Accept", ndjsonType)
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	want := "{\"id\":1}\n{\"error\":\"connection reset\"}\n"
+	if got := w.Body.String(); w.Code != http.StatusOK || got != want {
+		t.Fatalf("results not match\nGot : %d %q\nWant: 200 %q", w.Code, got, want)
+	}
+}
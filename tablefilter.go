@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// tableMatches reports whether pattern, a glob such as "audit_*" or
+// "public.audit_*", matches table. Patterns with a dot are matched against
+// the schema-qualified name.
+func tableMatches(pattern string, table *Table) bool {
+	name := table.Name
+	if strings.Contains(pattern, ".") {
+		name = table.Schema + "." + table.Name
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// exposed reports whether table is served under Config.ExposeTables and
+// Config.HideTables.
+func exposed(table *Table, expose, hide []string) bool {
+	for _, pattern := range hide {
+		if tableMatches(pattern, table) {
+			return false
+		}
+	}
+	if len(expose) == 0 {
+		return true
+	}
+	for _, pattern := range expose {
+		if tableMatches(pattern, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// exposedTables drops the tables that aren't exposed from tables, and the
+// foreign keys to them, so that neither expansion nor child listings reach
+// them either.
+func exposedTables(tables map[string]*Table, expose, hide []string) map[string]*Table {
+	for name, table := range tables {
+		if !exposed(table, expose, hide) {
+			delete(tables, name)
+		}
+	}
+	for _, table := range tables {
+		var foreignKeys []*ForeignKey
+		for _, fk := range table.ForeignKeys {
+			if _, ok := tables[fk.RefTable]; ok {
+				foreignKeys = append(foreignKeys, fk)
+			}
+		}
+		table.ForeignKeys = foreignKeys
+	}
+	return tables
+}
+
+// checkTablePatterns rejects globs path.Match can't read, which would
+// otherwise match nothing.
+func checkTablePatterns(patterns ...[]string) error {
+	for _, list := range patterns {
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("table pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitPatterns reads the comma separated globs of the -expose-tables and
+// -hide-tables flags.
+func splitPatterns(raw string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(raw, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
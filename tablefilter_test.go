@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExposedTables(t *testing.T) {
+	cases := []struct {
+		expose, hide []string
+		tables       []string
+	}{
+		{nil, nil, []string{"items", "order_items", `we"ird`}},
+		{nil, []string{"public.we*"}, []string{"items", "order_items"}},
+		{[]string{"*items"}, []string{"order_*"}, []string{"items"}},
+		{[]string{"private.*"}, nil, []string{}},
+	}
+	for _, item := range cases {
+		de := backendExplorer(&reloadStore{})
+		de.cfg.ExposeTables, de.cfg.HideTables = item.expose, item.hide
+		schema, err := de.loadSchema("public")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schema.TableNames(); !reflect.DeepEqual(got, item.tables) {
+			t.Fatalf("[%v %v] results not match\nGot : %v\nWant: %v", item.expose, item.hide, got, item.tables)
+		}
+	}
+
+	// References to hidden tables go with them.
+	de := backendExplorer(&reloadStore{})
+	de.cfg.HideTables = []string{"items"}
+	schema, err := de.loadSchema("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fks := schema.Tables["order_items"].ForeignKeys; len(fks) != 0 {
+		t.Fatalf("results not match\nGot : %+v\nWant: no foreign keys", fks)
+	}
+
+	if err := checkTablePatterns([]string{"public.[audit"}); err == nil {
+		t.Fatal("results not match\nGot : nil\nWant: an error for a malformed glob")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// columnSchema describes a column to clients building forms.
+type columnSchema struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Kind is the JSON value the column takes: int, numeric, float, bool,
+	// uuid, timestamp, json, array, geometry or string.
+	Kind        string   `json:"kind"`
+	ElementType string   `json:"element_type,omitempty"`
+	Nullable    bool     `json:"nullable"`
+	Default     *string  `json:"default"`
+	Generated   bool     `json:"generated"`
+	Encrypted   bool     `json:"encrypted,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	// References is the table a single-column foreign key points at.
+	References string `json:"references,omitempty"`
+	// Description is the comment on the column.
+	Description string `json:"description,omitempty"`
+}
+
+type foreignKeySchema struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	References string   `json:"references"`
+	RefColumns []string `json:"ref_columns"`
+	OnDelete   string   `json:"on_delete,omitempty"`
+	Declared   bool     `json:"declared,omitempty"`
+}
+
+type uniqueKeySchema struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+type indexSchema struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+// handleTableSchema serves GET /{table}/_schema, the metadata of the table
+// from the loaded schema: its columns, keys and indexes, for clients that
+// render forms without a schema of their own. kind tells tables from views
+// and materialized views; descriptions are the comments on the table and
+// its columns. approximate_rows is the planner's estimate, null when there
+// is none.
+func (de *DbExplorer) handleTableSchema(w http.ResponseWriter, r *http.Request, table *Table) {
+	columns := make([]columnSchema, len(table.Columns))
+	for i, column := range table.Columns {
+		columns[i] = columnSchema{
+			Name:        column.Name,
+			Type:        column.DataType,
+			Kind:        columnKind(column.DataType),
+			ElementType: column.ElementType,
+			Nullable:    column.Nullable,
+			Generated:   column.Generated,
+			Encrypted:   de.isEncrypted(table.Name, column.Name),
+			Enum:        column.EnumValues,
+			Description: column.Comment,
+		}
+		if column.Default != "" {
+			columns[i].Default = &column.Default
+		}
+		if fk, ok := table.foreignKey(column.Name); ok {
+			columns[i].References = fk.RefTable
+		}
+	}
+	foreignKeys := make([]foreignKeySchema, len(table.ForeignKeys))
+	for i, fk := range table.ForeignKeys {
+		foreignKeys[i] = foreignKeySchema{fk.Name, fk.Columns, fk.RefTable, fk.RefColumns, fk.OnDelete, fk.Declared}
+	}
+	uniqueKeys := make([]uniqueKeySchema, len(table.UniqueKeys))
+	for i, key := range table.UniqueKeys {
+		uniqueKeys[i] = uniqueKeySchema{key.Name, key.Columns}
+	}
+	indexes := make([]indexSchema, len(table.Indexes))
+	for i, index := range table.Indexes {
+		indexes[i] = indexSchema{index.Name, index.Columns, index.Unique, index.Primary}
+	}
+	primaryKey := table.PrimaryKey
+	if primaryKey == nil {
+		primaryKey = []string{}
+	}
+	var description *string
+	if table.Comment != "" {
+		description = &table.Comment
+	}
+
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"name":             table.Name,
+			"schema":           table.Schema,
+			"kind":             table.kind(),
+			"read_only":        table.ReadOnly,
+			"description":      description,
+			"columns":          columns,
+			"primary_key":      primaryKey,
+			"foreign_keys":     foreignKeys,
+			"unique_keys":      uniqueKeys,
+			"indexes":          indexes,
+			"approximate_rows": de.approximateRows(r, table),
+		},
+	}, false)
+}
+
+// approximateRows is the row count the warm-up read from the planner
+// statistics or, without it, the planner's estimate for the whole table;
+// nil when neither is known. An estimate that fails isn't an error.
+func (de *DbExplorer) approximateRows(r *http.Request, table *Table) interface{} {
+	if estimate, ok := de.requestSchema(r.Context()).Estimates[table.Name]; ok {
+		return estimate
+	}
+	estimator, ok := de.backend.(costEstimator)
+	if !ok {
+		return nil
+	}
+	query := querybuilder.Select{Columns: querybuilder.Cols(table.ColumnNames()...), From: table.ref()}
+	if _, rows, err := estimator.EstimateCost(r.Context(), query); err == nil {
+		return int64(rows)
+	}
+	return nil
+}
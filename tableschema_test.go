@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTableSchema(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	schema := fuzzSchema()
+	schema.Tables["order_items"].Indexes = []*Index{
+		{Name: "order_items_pkey", Columns: []string{"order_id", "line"}, Unique: true, Primary: true},
+		{Name: "order_items_lower_idx", Columns: []string{"(item_id + 1)"}},
+	}
+	schema.Tables["order_items"].Comment = "Lines of the orders"
+	schema.Tables["order_items"].Columns[1].Comment = "Position in the order, from 1"
+	schema.Estimates = map[string]int64{"order_items": 1200}
+	de.schema.Store(schema)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order_items/_schema", nil))
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	column := func(name string, references interface{}) map[string]interface{} {
+		c := map[string]interface{}{"name": name, "type": "integer", "kind": "int", "nullable": false, "default": nil, "generated": false}
+		if references != nil {
+			c["references"] = references
+		}
+		return c
+	}
+	line := column("line", nil)
+	line["description"] = "Position in the order, from 1"
+	want := map[string]interface{}{
+		"response": map[string]interface{}{
+			"name":        "order_items",
+			"schema":      "public",
+			"kind":        "table",
+			"read_only":   false,
+			"description": "Lines of the orders",
+			"columns": []interface{}{
+				column("order_id", nil),
+				line,
+				column("item_id", "items"),
+			},
+			"primary_key": []interface{}{"order_id", "line"},
+			"foreign_keys": []interface{}{
+				map[string]interface{}{"name": "order_items_item_id_fkey", "columns": []interface{}{"item_id"}, "references": "items", "ref_columns": []interface{}{"id"}},
+			},
+			"unique_keys": []interface{}{},
+			"indexes": []interface{}{
+				map[string]interface{}{"name": "order_items_pkey", "columns": []interface{}{"order_id", "line"}, "unique": true, "primary": true},
+				map[string]interface{}{"name": "order_items_lower_idx", "columns": []interface{}{"(item_id + 1)"}, "unique": false, "primary": false},
+			},
+			"approximate_rows": float64(1200),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", got, want)
+	}
+
+	// Without statistics nor a planner to ask, the count is unknown.
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/_schema", nil))
+	got = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	response := got["response"].(map[string]interface{})
+	if rows, ok := response["approximate_rows"]; !ok || rows != nil {
+		t.Fatalf("results not match\nGot : %#v\nWant: null approximate_rows", response)
+	}
+	title := response["columns"].([]interface{})[1]
+	if !reflect.DeepEqual(title, map[string]interface{}{"name": "title", "type": "character varying", "kind": "string", "nullable": false, "default": nil, "generated": false}) {
+		t.Fatalf("results not match\nGot : %#v", title)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// TLSConfig serves the explorer over HTTPS and optionally verifies client
+// certificates against ClientCAFile.
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"`
+	// RequireClientCert rejects connections without a valid certificate;
+	// otherwise a certificate is verified only when presented.
+	RequireClientCert bool `json:"require_client_cert"`
+	// ClientRoles maps a certificate common name or SAN (DNS name, email or
+	// URI) to explorer roles.
+	ClientRoles map[string][]string `json:"client_roles"`
+}
+
+func buildTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile == "" {
+		if cfg.RequireClientCert {
+			return nil, errors.New("require_client_cert needs client_ca_file")
+		}
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in client_ca_file")
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// clientCertAuthenticator maps a verified client certificate to an identity.
+// The subject is the common name, or the first SAN when it has none; roles
+// are collected for every name the certificate carries.
+func clientCertAuthenticator(roles map[string][]string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return nil, nil
+		}
+		leaf := r.TLS.VerifiedChains[0][0]
+
+		names := []string{}
+		if leaf.Subject.CommonName != "" {
+			names = append(names, leaf.Subject.CommonName)
+		}
+		names = append(names, leaf.DNSNames...)
+		names = append(names, leaf.EmailAddresses...)
+		for _, uri := range leaf.URIs {
+			names = append(names, uri.String())
+		}
+		if len(names) == 0 {
+			return nil, errors.New("client certificate has no usable name")
+		}
+
+		id := &Identity{Subject: names[0], Method: "mtls", Attributes: map[string]string{
+			"serial": leaf.SerialNumber.String(),
+		}}
+		for _, name := range names {
+			id.Roles = append(id.Roles, roles[name]...)
+		}
+		return id, nil
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues client certificates for the mTLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "explorer test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// mtlsServer serves the identity the client certificate authenticates as.
+func mtlsServer(t *testing.T, ca *testCA, cfg *TLSConfig) *httptest.Server {
+	cfg.ClientCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(cfg.ClientCAFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := clientCertAuthenticator(cfg.ClientRoles)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := authenticator.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if id == nil {
+			fmt.Fprint(w, "anonymous")
+			return
+		}
+		sort.Strings(id.Roles)
+		fmt.Fprintf(w, "%s %s %v %s", id.Subject, id.Method, id.Roles, id.Attributes["serial"])
+	}))
+	server.TLS = tlsConfig
+	// Refused handshakes are expected.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func mtlsGet(server *httptest.Server, certs ...tls.Certificate) (string, error) {
+	// A transport per request, so that no connection carries over another
+	// certificate.
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = certs
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return strings.TrimSpace(resp.Status + " " + string(body)), err
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	ca := newTestCA(t)
+	server := mtlsServer(t, ca, &TLSConfig{ClientRoles: map[string][]string{
+		"reporting":    {"analyst"},
+		"reports.corp": {"exporter"},
+	}})
+
+	cases := []struct {
+		name  string
+		certs []tls.Certificate
+		want  string
+	}{
+		{"no certificate", nil, "200 OK anonymous"},
+		{"common name and SAN", []tls.Certificate{ca.issue(t, 7, "reporting", "reports.corp")}, "200 OK reporting mtls [analyst exporter] 7"},
+		{"SAN only", []tls.Certificate{ca.issue(t, 8, "", "reports.corp")}, "200 OK reports.corp mtls [exporter] 8"},
+		{"unmapped", []tls.Certificate{ca.issue(t, 9, "billing")}, "200 OK billing mtls [] 9"},
+		{"no name", []tls.Certificate{ca.issue(t, 10, "")}, "401 Unauthorized client certificate has no usable name"},
+	}
+	for _, item := range cases {
+		got, err := mtlsGet(server, item.certs...)
+		if err != nil || got != item.want {
+			t.Fatalf("[%s] results not match\nGot : %q %v\nWant: %q", item.name, got, err, item.want)
+		}
+	}
+
+	// Certificates of another CA never reach the handler.
+	if got, err := mtlsGet(server, newTestCA(t).issue(t, 11, "reporting")); err == nil {
+		t.Fatalf("results not match\nGot : %q\nWant: a failed handshake", got)
+	}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	if _, err := buildTLSConfig(&TLSConfig{RequireClientCert: true}); err == nil {
+		t.Fatal("results not match\nGot : nil\nWant: an error without client_ca_file")
+	}
+
+	ca := newTestCA(t)
+	server := mtlsServer(t, ca, &TLSConfig{RequireClientCert: true})
+	if got, err := mtlsGet(server); err == nil {
+		t.Fatalf("results not match\nGot : %q\nWant: a failed handshake without a certificate", got)
+	}
+	if got, err := mtlsGet(server, ca.issue(t, 12, "reporting")); err != nil || got != "200 OK reporting mtls [] 12" {
+		t.Fatalf("results not match\nGot : %q %v\nWant: reporting", got, err)
+	}
+}
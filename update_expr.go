@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"db_explorer/internal/querybuilder"
+)
+
+// maxExprDepth caps the nesting of an update expression.
+const maxExprDepth = 32
+
+// exprFuncs are the functions update expressions may call, with the
+// number of arguments they take and how many more they may; an arity of -1
+// is two or more.
+var exprFuncs = map[string]struct {
+	fn         querybuilder.Func
+	arity, opt int
+}{
+	"lower":    {querybuilder.Lower, 1, 0},
+	"upper":    {querybuilder.Upper, 1, 0},
+	"trim":     {querybuilder.Trim, 1, 0},
+	"abs":      {querybuilder.Abs, 1, 0},
+	"round":    {querybuilder.Round, 1, 1},
+	"coalesce": {querybuilder.Coalesce, -1, 0},
+}
+
+// updateExprRequest is the body of POST /{table}/_update_expr.
+type updateExprRequest struct {
+	Set []string `json:"set"`
+	All bool     `json:"all"`
+}
+
+// handleUpdateExpr serves POST /{table}/_update_expr, an admin's mass
+// correction: {"set": ["price = price * 1.1"]} recalculates the columns of
+// the rows the filter parameters match, as one UPDATE. Expressions take
+// the columns of the row, number and string literals, null, + - * /,
+// parentheses and the functions of exprFuncs. Without filters, "all": true
+// has to confirm that every row is updated.
+func (de *DbExplorer) handleUpdateExpr(w http.ResponseWriter, r *http.Request, table *Table) {
+	if !de.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+	var request updateExprRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if len(request.Set) == 0 {
+		writeError(w, http.StatusBadRequest, "set must list the assignments")
+		return
+	}
+	where, err := de.whereClause(table, r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(where) == 0 && !request.All {
+		writeError(w, http.StatusBadRequest, `no filters, set "all": true to update every row`)
+		return
+	}
+
+	data := make(map[string]interface{}, len(request.Set))
+	for _, raw := range request.Set {
+		name, value, err := de.parseAssignment(table, raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("set %q: %v", raw, err))
+			return
+		}
+		if _, ok := data[name]; ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("set %q: %s is assigned twice", raw, name))
+			return
+		}
+		data[name] = value
+	}
+	if err := de.injectValues(r, table, data); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	update := querybuilder.Update{Table: table.ref(), Where: where}
+	for _, column := range table.Columns {
+		if value, ok := data[column.Name]; ok {
+			update.Set = append(update.Set, querybuilder.Assign{Column: column.Name, Value: value})
+		}
+	}
+
+	affected, err := de.backend.Update(r.Context(), update)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating records: %v", err), http.StatusInternalServerError)
+		return
+	}
+	addRows(r.Context(), affected)
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"updated": affected,
+		},
+	}, false)
+}
+
+// parseAssignment reads "column = expression".
+func (de *DbExplorer) parseAssignment(table *Table, raw string) (string, querybuilder.Scalar, error) {
+	p := &exprParser{de: de, table: table, tokens: tokenizeExpr(raw)}
+	target, err := p.column()
+	if err != nil {
+		return "", nil, err
+	}
+	column, _ := table.Column(string(target))
+	if containsString(table.PrimaryKey, column.Name) || column.Generated {
+		return "", nil, fmt.Errorf("%s is set by the database", column.Name)
+	}
+	if !p.accept("=") {
+		return "", nil, errors.New("expected column = expression")
+	}
+	value, err := p.expr(0)
+	if err != nil {
+		return "", nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return "", nil, fmt.Errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+	return column.Name, value, nil
+}
+
+// exprToken is a token of an update expression: an identifier, a quoted
+// identifier, a number, a string or a symbol, told apart by kind.
+type exprToken struct {
+	kind byte
+	text string
+}
+
+// tokenizeExpr splits s into tokens; a character that starts no token is
+// a symbol of its own, which the parser rejects.
+func tokenizeExpr(s string) []exprToken {
+	var tokens []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, exprToken{'i', s[i:j]})
+			i = j
+		case c >= '0' && c <= '9' || c == '.':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{'n', s[i:j]})
+			i = j
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling them, as in SQL.
+			var text strings.Builder
+			j := i + 1
+			closed := false
+			for j < len(s) {
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						text.WriteByte(c)
+						j += 2
+						continue
+					}
+					closed = true
+					j++
+					break
+				}
+				text.WriteByte(s[j])
+				j++
+			}
+			if !closed {
+				return append(tokens, exprToken{'?', s[i:]})
+			}
+			kind := byte('s')
+			if c == '"' {
+				kind = 'q'
+			}
+			tokens = append(tokens, exprToken{kind, text.String()})
+			i = j
+		default:
+			tokens = append(tokens, exprToken{'?', string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// exprParser parses the tokens of an update expression by recursive
+// descent.
+type exprParser struct {
+	de     *DbExplorer
+	table  *Table
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return exprToken{}, false
+}
+
+// accept consumes the symbol s if it comes next.
+func (p *exprParser) accept(s string) bool {
+	if token, ok := p.peek(); ok && token.kind == '?' && token.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// column reads an identifier naming a column of the table that can be
+// read.
+func (p *exprParser) column() (querybuilder.Col, error) {
+	token, ok := p.peek()
+	if !ok || token.kind != 'i' && token.kind != 'q' {
+		return "", errors.New("expected a column")
+	}
+	p.pos++
+	if _, ok := p.table.Column(token.text); !ok {
+		return "", fmt.Errorf("unknown column %s", token.text)
+	}
+	// Encrypted values are ciphertext to the database.
+	if p.de.isEncrypted(p.table.Name, token.text) {
+		return "", fmt.Errorf("%s is encrypted", token.text)
+	}
+	return querybuilder.Col(token.text), nil
+}
+
+// expr reads a sum of terms.
+func (p *exprParser) expr(depth int) (querybuilder.Scalar, error) {
+	if depth > maxExprDepth {
+		return nil, errors.New("expression too deep")
+	}
+	left, err := p.term(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := querybuilder.Add
+		switch {
+		case p.accept("+"):
+		case p.accept("-"):
+			op = querybuilder.Sub
+		default:
+			return left, nil
+		}
+		right, err := p.term(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = querybuilder.Arith{Left: left, Op: op, Right: right}
+	}
+}
+
+// term reads a product of factors.
+func (p *exprParser) term(depth int) (querybuilder.Scalar, error) {
+	left, err := p.factor(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := querybuilder.Mul
+		switch {
+		case p.accept("*"):
+		case p.accept("/"):
+			op = querybuilder.Div
+		default:
+			return left, nil
+		}
+		right, err := p.factor(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = querybuilder.Arith{Left: left, Op: op, Right: right}
+	}
+}
+
+// factor reads a negation, a parenthesized expression, a call, a column or
+// a literal.
+func (p *exprParser) factor(depth int) (querybuilder.Scalar, error) {
+	if depth > maxExprDepth {
+		return nil, errors.New("expression too deep")
+	}
+	if p.accept("-") {
+		value, err := p.factor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return querybuilder.Neg{Value: value}, nil
+	}
+	if p.accept("(") {
+		value, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, errors.New("expected )")
+		}
+		return value, nil
+	}
+	token, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of expression")
+	}
+	switch token.kind {
+	case '?':
+		return nil, fmt.Errorf("unexpected %s", token.text)
+	case 'n':
+		p.pos++
+		if n, err := strconv.ParseInt(token.text, 10, 64); err == nil {
+			return querybuilder.Param{Value: n}, nil
+		}
+		if _, err := strconv.ParseFloat(token.text, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %s", token.text)
+		}
+		return querybuilder.Param{Value: token.text, Type: "numeric"}, nil
+	case 's':
+		p.pos++
+		return querybuilder.Param{Value: token.text}, nil
+	case 'i':
+		name := strings.ToLower(token.text)
+		if name == "null" {
+			p.pos++
+			return querybuilder.Param{}, nil
+		}
+		if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == (exprToken{'?', "("}) {
+			p.pos += 2
+			return p.call(name, depth)
+		}
+	}
+	return p.column()
+}
+
+// call reads the arguments of the function name, past its parenthesis.
+func (p *exprParser) call(name string, depth int) (querybuilder.Scalar, error) {
+	spec, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	var args []querybuilder.Scalar
+	for !p.accept(")") {
+		if len(args) > 0 && !p.accept(",") {
+			return nil, fmt.Errorf("%s: expected , or )", name)
+		}
+		arg, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if spec.arity < 0 && len(args) < 2 || spec.arity >= 0 && (len(args) < spec.arity || len(args) > spec.arity+spec.opt) {
+		return nil, fmt.Errorf("%s: wrong number of arguments", name)
+	}
+	return querybuilder.Call{Func: spec.fn, Args: args}, nil
+}
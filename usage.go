@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// requestCost collects what a single request consumed.
+type requestCost struct {
+	mu   sync.Mutex
+	rows int64
+}
+
+type requestCostKey struct{}
+
+// addRows attributes n scanned or affected rows to the request of ctx.
+func addRows(ctx context.Context, n int64) {
+	if cost, ok := ctx.Value(requestCostKey{}).(*requestCost); ok {
+		cost.mu.Lock()
+		cost.rows += n
+		cost.mu.Unlock()
+	}
+}
+
+// KeyUsage is the accumulated consumption of one caller in the current month.
+type KeyUsage struct {
+	Requests   int64   `json:"requests"`
+	Rows       int64   `json:"rows"`
+	DurationMs float64 `json:"duration_ms"`
+	Cost       float64 `json:"cost"`
+}
+
+// usageTracker keeps per-caller usage for the current calendar month.
+type usageTracker struct {
+	mu     sync.Mutex
+	period string
+	keys   map[string]*KeyUsage
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{keys: make(map[string]*KeyUsage)}
+}
+
+// rotate starts a new accounting period at the beginning of each month.
+// Callers must hold mu.
+func (u *usageTracker) rotate(now time.Time) {
+	period := now.UTC().Format("2006-01")
+	if period != u.period {
+		u.period = period
+		u.keys = make(map[string]*KeyUsage)
+	}
+}
+
+// record accounts a request to key and returns its cost.
+func (u *usageTracker) record(key string, rows int64, duration time.Duration) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rotate(time.Now())
+
+	usage, ok := u.keys[key]
+	if !ok {
+		usage = &KeyUsage{}
+		u.keys[key] = usage
+	}
+	ms := float64(duration) / float64(time.Millisecond)
+	// One cost unit per row touched plus one per millisecond spent.
+	cost := float64(rows) + ms
+	usage.Requests++
+	usage.Rows += rows
+	usage.DurationMs += ms
+	usage.Cost += cost
+	return cost
+}
+
+func (u *usageTracker) report() (string, map[string]KeyUsage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rotate(time.Now())
+	report := make(map[string]KeyUsage, len(u.keys))
+	for key, usage := range u.keys {
+		report[key] = *usage
+	}
+	return u.period, report
+}
+
+// callerKey identifies who a request is accounted to.
+func callerKey(r *http.Request) string {
+	if id := identityFromRequest(r); id != nil && id.Subject != "" {
+		return id.Subject
+	}
+	return "anonymous"
+}
+
+// usagePeriodTTL keeps a month's shared cost counter past its month.
+const usagePeriodTTL = 32 * 24 * time.Hour
+
+func usageCostKey(key string) string {
+	return "usage:" + time.Now().UTC().Format("2006-01") + ":" + key
+}
+
+// recordUsage accounts a request locally for the usage report and adds its
+// cost to the shared counter quotas are checked against.
+func (de *DbExplorer) recordUsage(ctx context.Context, key string, rows int64, duration time.Duration) {
+	cost := de.usage.record(key, rows, duration)
+	if _, err := de.store.IncrBy(ctx, usageCostKey(key), cost, usagePeriodTTL); err != nil {
+		log.Printf("usage: %v", err)
+	}
+}
+
+// sharedCost returns what key spent this month across all replicas.
+func (de *DbExplorer) sharedCost(ctx context.Context, key string) float64 {
+	raw, _, err := de.store.Get(ctx, usageCostKey(key))
+	if err != nil {
+		log.Printf("usage: %v", err)
+	}
+	cost, _ := strconv.ParseFloat(raw, 64)
+	return cost
+}
+
+// quotaExceeded reports whether key has used up its monthly quota; the "*"
+// entry applies to keys without their own.
+func (de *DbExplorer) quotaExceeded(ctx context.Context, key string) bool {
+	quota, ok := de.cfg.MonthlyQuotas[key]
+	if !ok {
+		quota, ok = de.cfg.MonthlyQuotas["*"]
+	}
+	return ok && de.sharedCost(ctx, key) >= quota
+}
+
+// handleUsage reports usage per key: "usage" details what this replica
+// served, "spent" is the cost across all replicas that quotas apply to.
+// Admins see every key; other callers only their own.
+func (de *DbExplorer) handleUsage(w http.ResponseWriter, r *http.Request, key string) {
+	if !de.isAdmin(r) {
+		own := callerKey(r)
+		if key != "" && key != own {
+			writeError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+		key = own
+	}
+	period, report := de.usage.report()
+	keys := make([]string, 0, len(report))
+	for k := range report {
+		if key == "" || k == key {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	usage := make([]map[string]interface{}, 0, len(keys))
+	for _, k := range keys {
+		quota, ok := de.cfg.MonthlyQuotas[k]
+		if !ok {
+			quota = de.cfg.MonthlyQuotas["*"]
+		}
+		usage = append(usage, map[string]interface{}{
+			"key":   k,
+			"usage": report[k],
+			"spent": de.sharedCost(r.Context(), k),
+			"quota": quota,
+		})
+	}
+	writeResponse(w, map[string]interface{}{
+		"response": map[string]interface{}{
+			"period": period,
+			"keys":   usage,
+		},
+	}, false)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsage(t *testing.T) {
+	de := backendExplorer(&fakeStore{})
+	de.cfg.Auth.Roles = map[string][]Permission{"*": {{Table: "*", Actions: []string{actionRead}}}}
+	de.cfg.MonthlyQuotas = map[string]float64{"*": 1000, "bob": 50}
+	ctx := context.Background()
+	de.recordUsage(ctx, "ann", 10, 0)
+	de.recordUsage(ctx, "ann", 5, 0)
+	de.recordUsage(ctx, "bob", 40, 0)
+
+	report := func(path string, roles ...string) (int, map[string]float64) {
+		r := withIdentity(httptest.NewRequest(http.MethodGet, path, nil), &Identity{Subject: "ann", Roles: roles})
+		w := httptest.NewRecorder()
+		de.route(w, r)
+		var body struct {
+			Response struct {
+				Keys []struct {
+					Key   string   `json:"key"`
+					Usage KeyUsage `json:"usage"`
+					Spent float64  `json:"spent"`
+					Quota float64  `json:"quota"`
+				} `json:"keys"`
+			} `json:"response"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		spent := map[string]float64{}
+		for _, key := range body.Response.Keys {
+			spent[key.Key] = key.Spent
+			if key.Key == "ann" && (key.Usage.Requests != 2 || key.Usage.Rows != 15 || key.Quota != 1000) {
+				t.Fatalf("results not match\nGot : %+v\nWant: 2 requests, 15 rows, a quota of 1000", key)
+			}
+		}
+		return w.Code, spent
+	}
+
+	// Callers only see their own usage.
+	if code, spent := report("/_usage"); code != http.StatusOK || len(spent) != 1 || spent["ann"] != 15 {
+		t.Fatalf("results not match\nGot : %d %v\nWant: ann's usage only", code, spent)
+	}
+	if code, spent := report("/_usage/ann"); code != http.StatusOK || len(spent) != 1 {
+		t.Fatalf("results not match\nGot : %d %v\nWant: ann's usage", code, spent)
+	}
+	if code, _ := report("/_usage/bob"); code != http.StatusForbidden {
+		t.Fatalf("results not match\nGot : %d\nWant: %d", code, http.StatusForbidden)
+	}
+	if code, spent := report("/_usage", "admin"); code != http.StatusOK || spent["ann"] != 15 || spent["bob"] != 40 {
+		t.Fatalf("results not match\nGot : %d %v\nWant: every key", code, spent)
+	}
+
+	// A caller at its quota is refused.
+	de.recordUsage(ctx, "bob", 10, time.Millisecond)
+	if !de.quotaExceeded(ctx, "bob") || de.quotaExceeded(ctx, "ann") {
+		t.Fatal("results not match\nGot : quotas not applied\nWant: bob over quota, ann not")
+	}
+}
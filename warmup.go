@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// warmUp prepares a freshly loaded snapshot before it starts serving, so the
+// first requests after a deploy or schema switch don't pay cold-start
+// latency: the pool gets its idle connections, the per-table row estimates
+// are read from the planner statistics and the single record reads are
+// prepared. Statements are skipped in PgBouncer mode.
+func (de *DbExplorer) warmUp(ctx context.Context, schema *Schema) error {
+	conns := make([]*sql.Conn, 0, defaultIdleConns)
+	for i := 0; i < defaultIdleConns; i++ {
+		conn, err := de.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	// Tables never analyzed report -1 and get no estimate.
+	rows, err := de.db.QueryContext(ctx, `SELECT c.relname, c.reltuples::bigint
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p', 'm') AND c.reltuples >= 0`, schema.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	schema.Estimates = make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var estimate int64
+		if err := rows.Scan(&name, &estimate); err != nil {
+			return err
+		}
+		schema.Estimates[name] = estimate
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if de.cfg.PgBouncer {
+		return nil
+	}
+	schema.prepared = make(map[string]*sql.Stmt)
+	for _, table := range schema.Tables {
+		if len(table.PrimaryKey) == 0 {
+			continue
+		}
+		query, _ := buildSQL(selectRecord(table, table.ColumnNames(), nil))
+		stmt, err := de.db.PrepareContext(ctx, query)
+		if err != nil {
+			schema.close()
+			return fmt.Errorf("preparing %s: %v", table.Name, err)
+		}
+		schema.prepared[query] = stmt
+	}
+	return nil
+}
+
+// close releases the statements prepared for s.
+func (s *Schema) close() {
+	for _, stmt := range s.prepared {
+		stmt.Close()
+	}
+}
+
+// retire closes the statements of a snapshot that was swapped out, once the
+// requests still holding it had time to finish.
+func (s *Schema) retire() {
+	if len(s.prepared) > 0 {
+		time.AfterFunc(time.Minute, s.close)
+	}
+}
+
+// preparedStatement returns the statement prepared for query during the
+// warm-up of the schema served.
+func (de *DbExplorer) preparedStatement(query string) (*sql.Stmt, bool) {
+	schema := de.snapshot()
+	if schema == nil {
+		return nil, false
+	}
+	stmt, ok := schema.prepared[query]
+	return stmt, ok
+}
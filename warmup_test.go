@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func warmUpExplorer(t *testing.T) (*DbExplorer, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mock.MatchExpectationsInOrder(false)
+	de := backendExplorer(nil)
+	de.db = db
+	return de, mock
+}
+
+// recordQuery is the single record read warm-up prepares for table.
+func recordQuery(table *Table) string {
+	query, _ := buildSQL(selectRecord(table, table.ColumnNames(), nil))
+	return regexp.QuoteMeta(query)
+}
+
+func TestWarmUp(t *testing.T) {
+	de, mock := warmUpExplorer(t)
+	schema := fuzzSchema()
+	mock.ExpectQuery("SELECT c.relname, c.reltuples").WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "reltuples"}).AddRow("items", 1200))
+	items := mock.ExpectPrepare(recordQuery(schema.Tables["items"]))
+	mock.ExpectPrepare(recordQuery(schema.Tables["order_items"]))
+	mock.ExpectPrepare(recordQuery(schema.Tables[`we"ird`]))
+	if err := de.warmUp(context.Background(), schema); err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.prepared) != 3 || schema.Estimates["items"] != 1200 {
+		t.Fatalf("results not match\nGot : %d statements, estimates %v\nWant: 3, items 1200", len(schema.prepared), schema.Estimates)
+	}
+
+	// Record reads of the snapshot served go through its statements, and
+	// aren't prepared again.
+	de.schema.Store(schema)
+	hits := 0
+	de.backend = newSQLStore(de.db, func(query string) (*sql.Stmt, bool) {
+		stmt, ok := de.preparedStatement(query)
+		if ok {
+			hits++
+		}
+		return stmt, ok
+	})
+	for i := 0; i < 2; i++ {
+		items.ExpectQuery().WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "price", "created", "extra"}).AddRow(7, "memcache", nil, nil, nil))
+		w := httptest.NewRecorder()
+		de.route(w, httptest.NewRequest(http.MethodGet, "/items/7", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("[%d] results not match\nGot : %d %s\nWant: %d", i, w.Code, w.Body, http.StatusOK)
+		}
+	}
+	if hits != 2 {
+		t.Fatalf("results not match\nGot : %d reads through a statement\nWant: 2", hits)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmUpPgBouncer(t *testing.T) {
+	// Behind PgBouncer nothing is prepared; estimates are still read.
+	de, mock := warmUpExplorer(t)
+	de.cfg.PgBouncer = true
+	schema := fuzzSchema()
+	mock.ExpectQuery("SELECT c.relname, c.reltuples").WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "reltuples"}))
+	if err := de.warmUp(context.Background(), schema); err != nil || len(schema.prepared) != 0 {
+		t.Fatalf("results not match\nGot : %d statements %v\nWant: none", len(schema.prepared), err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmUpFailure(t *testing.T) {
+	de, mock := warmUpExplorer(t)
+	schema := &Schema{Name: "public", Tables: map[string]*Table{"items": fuzzSchema().Tables["items"]}}
+	mock.ExpectQuery("SELECT c.relname, c.reltuples").WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "reltuples"}))
+	mock.ExpectPrepare(recordQuery(schema.Tables["items"])).WillReturnError(sql.ErrConnDone)
+	if err := de.warmUp(context.Background(), schema); err == nil || err.Error() != "preparing items: "+sql.ErrConnDone.Error() {
+		t.Fatalf("results not match\nGot : %v\nWant: the table that failed", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const defaultIdleConns = 2
+
+// watchdog pings the database every interval. After failures consecutive
+// errors the explorer is marked not ready and the pools are flushed, so the
+// next dial re-resolves the host (e.g. after a failover) instead of reusing
+// dead connections.
+func (de *DbExplorer) watchdog(interval time.Duration, failures int) {
+	if failures <= 0 {
+		failures = 3
+	}
+	failed := 0
+	for range time.Tick(interval) {
+		failed = de.probe(interval, failed, failures)
+	}
+}
+
+// probe pings the database once, given the failed pings before it, and
+// returns the count of consecutive failures.
+func (de *DbExplorer) probe(timeout time.Duration, failed, failures int) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err := de.db.PingContext(ctx)
+	cancel()
+
+	if err == nil {
+		if !de.ready.Load() {
+			log.Printf("database is reachable again")
+			de.db.SetConnMaxLifetime(0)
+		}
+		de.ready.Store(true)
+		return 0
+	}
+
+	failed++
+	log.Printf("database ping failed (%d/%d): %v", failed, failures, err)
+	if failed >= failures {
+		de.ready.Store(false)
+		de.resetPool(timeout)
+	}
+	return failed
+}
+
+// resetPool flushes the connections of the pools. database/sql closes the
+// idle ones at once and those in use as they are released, older than a
+// ConnMaxLifetime of retire, the ping interval, until the database is back.
+// A store with a pool of its own resets it.
+func (de *DbExplorer) resetPool(retire time.Duration) {
+	de.db.SetMaxIdleConns(0)
+	de.db.SetConnMaxLifetime(retire)
+	de.db.SetMaxIdleConns(defaultIdleConns)
+	if resetter, ok := de.backend.(poolResetter); ok {
+		resetter.ResetPool()
+	}
+}
+
+func (de *DbExplorer) handleReady(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	state := "ready"
+	if !de.ready.Load() {
+		status = http.StatusServiceUnavailable
+		state = "unavailable"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response": map[string]interface{}{"status": state},
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	counter := &countingConnector{}
+	db := sql.OpenDB(counter)
+	defer db.Close()
+	db.SetMaxIdleConns(defaultIdleConns)
+	de := backendExplorer(&fakeStore{})
+	de.db = db
+	ready := func(want int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_ready", nil))
+		if w.Code != want {
+			t.Fatalf("results not match\nGot : %d %s\nWant: %d", w.Code, w.Body, want)
+		}
+	}
+
+	// A failed ping is tolerated until failures of them in a row, and a
+	// success in between starts the count over. Then the pool is flushed
+	// of its idle connection on every failed ping.
+	down := errors.New("connection refused")
+	steps := []struct {
+		ping   error
+		failed int
+		closed int32
+		ready  int
+	}{
+		{down, 1, 0, http.StatusOK},
+		{nil, 0, 0, http.StatusOK},
+		{down, 1, 0, http.StatusOK},
+		{down, 2, 0, http.StatusOK},
+		{down, 3, 1, http.StatusServiceUnavailable},
+		{down, 4, 2, http.StatusServiceUnavailable},
+		{nil, 0, 2, http.StatusOK},
+	}
+	failed := 0
+	for i, step := range steps {
+		counter.ping = step.ping
+		failed = de.probe(time.Second, failed, 3)
+		if closed := atomic.LoadInt32(&counter.closed); failed != step.failed || closed != step.closed {
+			t.Fatalf("[%d] results not match\nGot : %d failures, %d closed\nWant: %d, %d", i, failed, closed, step.failed, step.closed)
+		}
+		ready(step.ready)
+	}
+
+	// A connection in use during the failures is closed once released.
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.ping = down
+	de.probe(time.Millisecond, 0, 1)
+	before := atomic.LoadInt32(&counter.closed)
+	time.Sleep(5 * time.Millisecond)
+	conn.Close()
+	if closed := atomic.LoadInt32(&counter.closed); closed != before+1 {
+		t.Fatalf("results not match\nGot : %d closed\nWant: %d", closed, before+1)
+	}
+}
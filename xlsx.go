@@ -0,0 +1,248 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const xlsxType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Cell styles of xlsxStyles, by index.
+const (
+	xlsxStyleDate     = 1
+	xlsxStyleDateTime = 2
+)
+
+// The parts of a workbook with a single sheet, apart from the sheet itself.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+	// xlsxStyles has the default style, a date and a date and time style,
+	// both built-in number formats.
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="1"><fill><patternFill patternType="none"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`</styleSheet>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxEncoder writes a workbook with one sheet named after the table: a
+// header row with the selected columns, then a row per record. Cells are
+// typed after the column: numbers, booleans and dates are cells of that
+// type, anything else is text. The sheet is the last part of the archive,
+// so it is written as records arrive. Like CSV, a failed stream is aborted.
+type xlsxEncoder struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	table   *Table
+	columns []string
+	rows    int
+}
+
+func (e *xlsxEncoder) start(h http.Header) {
+	h.Set("Content-Type", xlsxType)
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.table.Name + ".xlsx"}))
+}
+
+// open writes the parts before the sheet and the header row.
+func (e *xlsxEncoder) open() error {
+	if e.sheet != nil {
+		return nil
+	}
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlText(xlsxSheetName(e.table.Name)))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := e.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	w, err := e.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	e.sheet = bufio.NewWriter(w)
+	e.sheet.WriteString(xlsxSheetStart)
+
+	header := make([]interface{}, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column
+	}
+	return e.writeRow(header, nil)
+}
+
+func (e *xlsxEncoder) encode(record map[string]interface{}) error {
+	if err := e.open(); err != nil {
+		return err
+	}
+	values := make([]interface{}, len(e.columns))
+	columns := make([]*Column, len(e.columns))
+	for i, name := range e.columns {
+		values[i] = record[name]
+		columns[i], _ = e.table.Column(name)
+	}
+	return e.writeRow(values, columns)
+}
+
+func (e *xlsxEncoder) writeRow(values []interface{}, columns []*Column) error {
+	e.rows++
+	fmt.Fprintf(e.sheet, `<row r="%d">`, e.rows)
+	for i, value := range values {
+		var column *Column
+		if columns != nil {
+			column = columns[i]
+		}
+		e.sheet.WriteString(xlsxCell(xlsxRef(i, e.rows), value, column))
+	}
+	_, err := e.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (e *xlsxEncoder) fail(err error) {
+	panic(http.ErrAbortHandler)
+}
+
+func (e *xlsxEncoder) flush() error {
+	if e.sheet == nil {
+		return nil
+	}
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.archive.Flush()
+}
+
+func (e *xlsxEncoder) close() error {
+	if err := e.open(); err != nil {
+		return err
+	}
+	e.sheet.WriteString(xlsxSheetEnd)
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.archive.Close()
+}
+
+// xlsxCell renders value at ref, typed after column; a nil column is text.
+func xlsxCell(ref string, value interface{}, column *Column) string {
+	if value == nil {
+		return ""
+	}
+	kind := "string"
+	if column != nil {
+		kind = columnKind(column.DataType)
+	}
+	switch v := value.(type) {
+	case bool:
+		b := 0
+		if v {
+			b = 1
+		}
+		return fmt.Sprintf(`<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+	case int64:
+		return fmt.Sprintf(`<c r="%s"><v>%d</v></c>`, ref, v)
+	case float64:
+		if !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case time.Time:
+		style := xlsxStyleDateTime
+		if column != nil && column.DataType == "date" {
+			style = xlsxStyleDate
+		}
+		return fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(excelSerial(v), 'f', -1, 64))
+	case json.Number:
+		return fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, v)
+	case []byte:
+		// lib/pq scans numeric columns as text.
+		if kind == "numeric" {
+			if f, err := strconv.ParseFloat(string(v), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, string(v))
+			}
+		}
+	}
+	text, _ := csvCell(value)
+	return fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlText(text))
+}
+
+// xlsxRef names the cell of a zero based column and a one based row, as A1.
+func xlsxRef(column, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// excelSerial converts the wall clock of t to days since 1899-12-30, the
+// date system of spreadsheets; they have no time zones.
+func excelSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	seconds := wall.Unix() - time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).Unix()
+	return (float64(seconds) + float64(wall.Nanosecond())/1e9) / 86400
+}
+
+// xlsxSheetName drops the characters sheet names can't hold and keeps
+// their maximum of 31 characters.
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	return name
+}
+
+func xmlText(s string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
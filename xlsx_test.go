@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamXLSX(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(1), "title": "a < b", "price": []byte("1.50"), "created": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{"id": int64(2), "title": "redis", "price": nil, "created": nil},
+	}}
+	de := backendExplorer(backend)
+
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?format=xlsx&fields=id,title,price,created", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != xlsxType {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, xlsxType)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var sheet []byte
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			f, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sheet, _ = io.ReadAll(f)
+		}
+	}
+	if len(names) != 6 || names[5] != "xl/worksheets/sheet1.xml" {
+		t.Fatalf("unexpected parts %v", names)
+	}
+	want := xlsxSheetStart +
+		`<row r="1">` +
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>` +
+		`<c r="B1" t="inlineStr"><is><t xml:space="preserve">title</t></is></c>` +
+		`<c r="C1" t="inlineStr"><is><t xml:space="preserve">price</t></is></c>` +
+		`<c r="D1" t="inlineStr"><is><t xml:space="preserve">created</t></is></c></row>` +
+		`<row r="2"><c r="A2"><v>1</v></c>` +
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">a &lt; b</t></is></c>` +
+		`<c r="C2"><v>1.50</v></c>` +
+		`<c r="D2" s="2"><v>45413.5</v></c></row>` +
+		`<row r="3"><c r="A3"><v>2</v></c>` +
+		`<c r="B3" t="inlineStr"><is><t xml:space="preserve">redis</t></is></c></row>` +
+		xlsxSheetEnd
+	if string(sheet) != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", sheet, want)
+	}
+}
+
+func TestXLSXRef(t *testing.T) {
+	cases := []struct {
+		column, row int
+		want        string
+	}{
+		{0, 1, "A1"},
+		{25, 2, "Z2"},
+		{26, 3, "AA3"},
+		{701, 4, "ZZ4"},
+		{702, 5, "AAA5"},
+	}
+	for _, item := range cases {
+		if got := xlsxRef(item.column, item.row); got != item.want {
+			t.Fatalf("[%d %d] results not match\nGot : %s\nWant: %s", item.column, item.row, got, item.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const xmlType = "application/xml"
+
+// acceptsXML reports whether the Accept header of r prefers XML to JSON:
+// the first of them it lists wins.
+func acceptsXML(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case xmlType, "text/xml":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+	return false
+}
+
+// writeResponse writes the envelope of a response as JSON, or as XML for
+// the clients that asked for it.
+func writeResponse(w http.ResponseWriter, envelope map[string]interface{}, asXML bool) {
+	if !asXML {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(envelope)
+		return
+	}
+	w.Header().Set("Content-Type", xmlType+"; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	for _, key := range objectKeys(envelope) {
+		encodeXML(encoder, key, envelope[key])
+	}
+	encoder.Flush()
+}
+
+// encodeXML renders value as the element name: objects are elements per
+// key in key order, arrays an <item> per entry and null an empty element
+// with nil="true", which tells it apart from an empty string. Keys that
+// aren't XML names, such as some column names, become <field name="...">.
+func encodeXML(encoder *xml.Encoder, name string, value interface{}) {
+	if raw, ok := value.(json.RawMessage); ok {
+		value = decodeRaw(raw)
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "field"}, Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}}}
+	}
+	if value == nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "nil"}, Value: "true"})
+	}
+	encoder.EncodeToken(start)
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for _, key := range objectKeys(v) {
+			encodeXML(encoder, key, v[key])
+		}
+	case []map[string]interface{}:
+		for _, item := range v {
+			encodeXML(encoder, "item", item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			encodeXML(encoder, "item", item)
+		}
+	case []string:
+		for _, item := range v {
+			encodeXML(encoder, "item", item)
+		}
+	case []byte:
+		encoder.EncodeToken(xml.CharData(v))
+	case time.Time:
+		encoder.EncodeToken(xml.CharData(v.Format(time.RFC3339Nano)))
+	default:
+		encoder.EncodeToken(xml.CharData(fmt.Sprint(v)))
+	}
+	encoder.EncodeToken(start.End())
+}
+
+// decodeRaw decodes an embedded JSON document, such as the value of a json
+// column, to render it like the rest of the response; a document that
+// doesn't decode stays text.
+func decodeRaw(raw json.RawMessage) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return string(raw)
+	}
+	return value
+}
+
+// isXMLName reports whether name can be used as an element name as is.
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func objectKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestXMLResponse(t *testing.T) {
+	backend := &fakeStore{records: []map[string]interface{}{
+		{"id": int64(7), "title": "a < b", "price": nil},
+	}}
+	de := backendExplorer(backend)
+
+	r := httptest.NewRequest(http.MethodGet, "/items/7?fields=id,title,price", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	de.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if got, want := w.Header().Get("Content-Type"), "application/xml; charset=utf-8"; got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<response><record><id>7</id><price nil="true"></price><title>a &lt; b</title></record></response>`
+	if got := w.Body.String(); got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+
+	// json columns are embedded as elements.
+	backend.records = []map[string]interface{}{{"id": int64(7), "extra": json.RawMessage(`{"tags":["a",1],"n":null}`)}}
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/items/7?fields=id,extra", nil)
+	r.Header.Set("Accept", "application/xml")
+	de.ServeHTTP(w, r)
+	want = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<response><record><extra><n nil="true"></n><tags><item>a</item><item>1</item></tags></extra><id>7</id></record></response>`
+	if got := w.Body.String(); got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+
+	backend.records = []map[string]interface{}{{`i'd`: "x", `sel"ect`: "y"}}
+	w = httptest.NewRecorder()
+	de.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/we%22ird?format=xml", nil))
+	want = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<response><records><item><field name="i&#39;d">x</field><field name="sel&#34;ect">y</field></item></records></response>`
+	if got := w.Body.String(); got != want {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", got, want)
+	}
+}
+
+func TestAcceptsXML(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"text/xml", true},
+		{"application/json, application/xml", false},
+		{"text/html, application/xml;q=0.9", true},
+	}
+	for _, item := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+		r.Header.Set("Accept", item.accept)
+		if got := acceptsXML(r); got != item.want {
+			t.Fatalf("[%s] results not match\nGot : %v\nWant: %v", item.accept, got, item.want)
+		}
+	}
+}